@@ -0,0 +1,295 @@
+package awsfaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+	"github.com/rosenhouse/awsfaker/journal"
+)
+
+// AdminPrefix is the path under which the awsfaker command serves the admin
+// API, alongside the fake services
+const AdminPrefix = "/_awsfaker/"
+
+// An Injection is a canned response or error pushed through the admin API.
+// While it lasts, it answers the calls that match it in place of the backend.
+//
+// Only actions that a backend implements can be injected, since the backend
+// decides which requests are routed and how their inputs are decoded.  To
+// answer other actions, serve them from a FixtureBackend, whose actions are
+// the ones named by its fixtures.
+type Injection struct {
+	Fixture
+
+	// Service names the service of the action, and may be omitted unless
+	// several services have an action of that name
+	Service string `json:"service,omitempty"`
+
+	// Times limits the number of calls that the injection answers.  Zero
+	// means no limit.
+	Times int `json:"times,omitempty"`
+}
+
+// A Resetter is a backend whose state can be reset through the admin API
+type Resetter interface {
+	Reset()
+}
+
+// A StateDumper is a backend that exposes its state through the admin API.
+// The state is encoded as JSON.
+type StateDumper interface {
+	DumpState() interface{}
+}
+
+// DumpState returns the fixtures of the backend
+func (b *FixtureBackend) DumpState() interface{} {
+	return b.Fixtures()
+}
+
+type injections struct {
+	lock sync.Mutex
+	list []*Injection
+}
+
+func (i *injections) add(injection Injection) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.list = append(i.list, &injection)
+}
+
+func (i *injections) all() []Injection {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	all := make([]Injection, len(i.list))
+	for n, injection := range i.list {
+		all[n] = *injection
+	}
+	return all
+}
+
+func (i *injections) clear() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.list = nil
+}
+
+// answer responds to a call with the first injection that matches it, most
+// recent first, and uses up one of the times it may answer
+func (i *injections) answer(method dispatch.Method, input interface{}) (interface{}, bool, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	for n := len(i.list) - 1; n >= 0; n-- {
+		injection := i.list[n]
+		if injection.Action != method.Name || !matches(injection.Match, reflect.ValueOf(input)) {
+			continue
+		}
+		if injection.Times > 0 {
+			injection.Times--
+			if injection.Times == 0 {
+				i.list = append(i.list[:n], i.list[n+1:]...)
+			}
+		}
+		output, err := injection.respond(method.OutputType())
+		return output.Interface(), true, err
+	}
+	return nil, false, nil
+}
+
+// Admin returns an http.Handler for the admin API of the handler.
+// See Mux.Admin.
+func (h *Handler) Admin() http.Handler {
+	return &admin{services: []*fakeService{h.service}, journal: h.service.handler.Journal}
+}
+
+// Admin returns an http.Handler for the admin API, which lets a test that
+// runs outside of the process inspect and reprogram the fakes.  It serves
+//
+//	GET    /calls       the calls received, as JSON, optionally ?action=
+//	DELETE /calls       forgets the calls received
+//	GET    /responses   the injected responses
+//	POST   /responses   injects a response, given an Injection as JSON
+//	DELETE /responses   removes the injected responses
+//	POST   /reset       all of the above, and resets each Resetter backend
+//	GET    /state       the state of each StateDumper backend, by service
+//
+// Paths are relative to wherever the handler is mounted; see AdminPrefix.
+// An injection for an action that no backend implements is refused with 400
+// Bad Request; see Injection.
+func (m *Mux) Admin() http.Handler {
+	return &admin{services: m.services, journal: m.journal}
+}
+
+type admin struct {
+	services []*fakeService
+	journal  *journal.Journal
+}
+
+func (a *admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := r.Method + " " + r.URL.Path
+	switch route {
+	case "GET /calls":
+		a.listCalls(w, r.URL.Query().Get("action"))
+	case "DELETE /calls":
+		a.journal.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	case "GET /responses":
+		a.listInjections(w)
+	case "POST /responses":
+		a.inject(w, r)
+	case "DELETE /responses":
+		a.clearInjections()
+		w.WriteHeader(http.StatusNoContent)
+	case "POST /reset":
+		a.reset()
+		w.WriteHeader(http.StatusNoContent)
+	case "GET /state":
+		a.dumpState(w)
+	default:
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("no admin route for %s", route))
+	}
+}
+
+type adminCall struct {
+	Action    string         `json:"action"`
+	RequestID string         `json:"requestId"`
+	Started   time.Time      `json:"started"`
+	Duration  string         `json:"duration"`
+	Input     interface{}    `json:"input"`
+	Output    interface{}    `json:"output,omitempty"`
+	Error     *ErrorResponse `json:"error,omitempty"`
+}
+
+func (a *admin) listCalls(w http.ResponseWriter, action string) {
+	calls := a.journal.Calls()
+	if action != "" {
+		calls = a.journal.CallsTo(action)
+	}
+	adminCalls := make([]adminCall, len(calls))
+	for i, call := range calls {
+		adminCalls[i] = adminCall{
+			Action:    call.Action,
+			RequestID: call.RequestID,
+			Started:   call.Started,
+			Duration:  call.Duration.String(),
+			Input:     encodable(call.Input),
+		}
+		if call.Err != nil {
+			errorResponse := ErrorResponse(dispatch.ToErrorResponse(call.Err))
+			adminCalls[i].Error = &errorResponse
+		} else {
+			adminCalls[i].Output = encodable(call.Output)
+		}
+	}
+	writeAdminJSON(w, http.StatusOK, adminCalls)
+}
+
+// encodable returns the value if it can be encoded as JSON, or else a
+// description of it
+func encodable(value interface{}) interface{} {
+	if _, err := json.Marshal(value); err != nil {
+		return awsutil.Prettify(value)
+	}
+	return value
+}
+
+func (a *admin) listInjections(w http.ResponseWriter) {
+	all := []Injection{}
+	for _, service := range a.services {
+		all = append(all, service.injections.all()...)
+	}
+	writeAdminJSON(w, http.StatusOK, all)
+}
+
+func (a *admin) inject(w http.ResponseWriter, r *http.Request) {
+	var injection Injection
+	if err := json.NewDecoder(r.Body).Decode(&injection); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("unable to decode injection: %s", err))
+		return
+	}
+
+	service, method, err := a.findAction(injection.Service, injection.Action)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := injection.validate(method.OutputType()); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	injection.Service = service.name
+	service.injections.add(injection)
+	writeAdminJSON(w, http.StatusCreated, injection)
+}
+
+// findAction returns the one service with the named action, restricted to
+// the named service if given
+func (a *admin) findAction(serviceName, action string) (*fakeService, dispatch.Method, error) {
+	var (
+		found  *fakeService
+		method dispatch.Method
+	)
+	for _, service := range a.services {
+		if serviceName != "" && service.name != serviceName {
+			continue
+		}
+		m, ok := service.handler.Backend.Method(action)
+		if !ok {
+			continue
+		}
+		if found != nil {
+			return nil, method, fmt.Errorf("action %s is served by both %s and %s, choose one with \"service\"", action, found.name, service.name)
+		}
+		found, method = service, m
+	}
+	if found == nil {
+		return nil, method, fmt.Errorf("no backend serves action %q, and only the actions of a backend can be injected", action)
+	}
+	return found, method, nil
+}
+
+func (a *admin) clearInjections() {
+	for _, service := range a.services {
+		service.injections.clear()
+	}
+}
+
+func (a *admin) reset() {
+	a.journal.Reset()
+	a.clearInjections()
+	for _, service := range a.services {
+		if resetter, ok := service.backend.(Resetter); ok {
+			resetter.Reset()
+		}
+	}
+}
+
+func (a *admin) dumpState(w http.ResponseWriter) {
+	state := map[string]interface{}{}
+	for _, service := range a.services {
+		if dumper, ok := service.backend.(StateDumper); ok {
+			state[service.name] = encodable(dumper.DumpState())
+		}
+	}
+	writeAdminJSON(w, http.StatusOK, state)
+}
+
+func writeAdminJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	body, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+func writeAdminError(w http.ResponseWriter, statusCode int, err error) {
+	writeAdminJSON(w, statusCode, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,13 @@
+package awsfakermatchers_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAwsfakermatchers(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Awsfakermatchers Suite")
+}
@@ -0,0 +1,218 @@
+// Package awsfakermatchers provides Gomega matchers for asserting on the calls
+// received by awsfaker backends.
+//
+// The matchers accept an *awsfaker.Handler, an *awsfaker.Mux, or anything
+// else with a Journal method, as well as a *journal.Journal itself:
+//
+//	Expect(handler).To(HaveReceivedCall("DescribeStacks"))
+//	Expect(handler).To(HaveReceivedCallWith(&cloudformation.DescribeStacksInput{
+//		StackName: aws.String("some-stack"),
+//	}))
+package awsfakermatchers
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/onsi/gomega/types"
+
+	"github.com/rosenhouse/awsfaker/journal"
+)
+
+type journaler interface {
+	Journal() *journal.Journal
+}
+
+func journalOf(actual interface{}) (*journal.Journal, error) {
+	switch a := actual.(type) {
+	case *journal.Journal:
+		return a, nil
+	case journaler:
+		return a.Journal(), nil
+	}
+	return nil, fmt.Errorf("expected an awsfaker handler or a journal, got %T", actual)
+}
+
+// actionFor returns the name of the action that takes the given input,
+// e.g. DescribeStacks for a *cloudformation.DescribeStacksInput
+func actionFor(input interface{}) string {
+	t := reflect.TypeOf(input)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return strings.TrimSuffix(t.Name(), "Input")
+}
+
+// HaveReceivedCall succeeds if the action was called at least once
+func HaveReceivedCall(action string) types.GomegaMatcher {
+	return &receivedCallMatcher{action: action, times: -1}
+}
+
+// HaveReceivedCallTimes succeeds if the action was called exactly n times
+func HaveReceivedCallTimes(action string, n int) types.GomegaMatcher {
+	return &receivedCallMatcher{action: action, times: n}
+}
+
+type receivedCallMatcher struct {
+	action string
+	times  int
+
+	calls []journal.Call
+}
+
+func (m *receivedCallMatcher) Match(actual interface{}) (bool, error) {
+	j, err := journalOf(actual)
+	if err != nil {
+		return false, err
+	}
+	m.calls = j.CallsTo(m.action)
+	if m.times < 0 {
+		return len(m.calls) > 0, nil
+	}
+	return len(m.calls) == m.times, nil
+}
+
+func (m *receivedCallMatcher) FailureMessage(actual interface{}) string {
+	if m.times < 0 {
+		return fmt.Sprintf("Expected a call to %s, but there were none", m.action)
+	}
+	return fmt.Sprintf("Expected %d call(s) to %s, but there were %d%s",
+		m.times, m.action, len(m.calls), describeInputs(m.calls))
+}
+
+func (m *receivedCallMatcher) NegatedFailureMessage(actual interface{}) string {
+	if m.times < 0 {
+		return fmt.Sprintf("Expected no calls to %s, but there were %d%s",
+			m.action, len(m.calls), describeInputs(m.calls))
+	}
+	return fmt.Sprintf("Expected other than %d call(s) to %s", m.times, m.action)
+}
+
+// HaveReceivedCallWith succeeds if the action that takes the given input was
+// called at least once with an equal input, as compared by awsutil.DeepEqual
+func HaveReceivedCallWith(input interface{}) types.GomegaMatcher {
+	return &receivedCallWithMatcher{input: input}
+}
+
+type receivedCallWithMatcher struct {
+	input interface{}
+
+	calls []journal.Call
+}
+
+func (m *receivedCallWithMatcher) Match(actual interface{}) (bool, error) {
+	j, err := journalOf(actual)
+	if err != nil {
+		return false, err
+	}
+	m.calls = j.CallsTo(actionFor(m.input))
+	for _, call := range m.calls {
+		if awsutil.DeepEqual(call.Input, m.input) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *receivedCallWithMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected a call to %s with input\n%s\nbut received %d call(s)%s",
+		actionFor(m.input), indent(awsutil.Prettify(m.input)), len(m.calls), describeInputs(m.calls))
+}
+
+func (m *receivedCallWithMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected no call to %s with input\n%s",
+		actionFor(m.input), indent(awsutil.Prettify(m.input)))
+}
+
+// HaveReceivedCallsInOrder succeeds if the given calls were received in the
+// given order, though other calls may come before, between or after them.
+// Each expected call is either the name of an action, or an input that must
+// match as for HaveReceivedCallWith.
+func HaveReceivedCallsInOrder(expected ...interface{}) types.GomegaMatcher {
+	return &receivedCallsInOrderMatcher{expected: expected}
+}
+
+type receivedCallsInOrderMatcher struct {
+	expected []interface{}
+
+	calls   []journal.Call
+	matched int
+}
+
+func (m *receivedCallsInOrderMatcher) Match(actual interface{}) (bool, error) {
+	j, err := journalOf(actual)
+	if err != nil {
+		return false, err
+	}
+	m.calls = j.Calls()
+	m.matched = 0
+	for _, call := range m.calls {
+		if m.matched == len(m.expected) {
+			break
+		}
+		if callMatches(call, m.expected[m.matched]) {
+			m.matched++
+		}
+	}
+	return m.matched == len(m.expected), nil
+}
+
+func callMatches(call journal.Call, expected interface{}) bool {
+	if action, ok := expected.(string); ok {
+		return call.Action == action
+	}
+	return call.Action == actionFor(expected) && awsutil.DeepEqual(call.Input, expected)
+}
+
+func (m *receivedCallsInOrderMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected calls in order\n%s\nbut found no match for\n%s\nafter the first %d, among the calls\n%s",
+		describeExpected(m.expected), describeExpected(m.expected[m.matched:m.matched+1]),
+		m.matched, describeCalls(m.calls))
+}
+
+func (m *receivedCallsInOrderMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected not to receive calls in order\n%s", describeExpected(m.expected))
+}
+
+func describeExpected(expected []interface{}) string {
+	descriptions := []string{}
+	for _, e := range expected {
+		if action, ok := e.(string); ok {
+			descriptions = append(descriptions, "    "+action)
+		} else {
+			descriptions = append(descriptions, fmt.Sprintf("    %s with\n%s", actionFor(e), indent(awsutil.Prettify(e))))
+		}
+	}
+	return strings.Join(descriptions, "\n")
+}
+
+func describeInputs(calls []journal.Call) string {
+	if len(calls) == 0 {
+		return ""
+	}
+	inputs := []string{}
+	for i, call := range calls {
+		inputs = append(inputs, fmt.Sprintf("    #%d:\n%s", i, indent(awsutil.Prettify(call.Input))))
+	}
+	return ", with inputs\n" + strings.Join(inputs, "\n")
+}
+
+func describeCalls(calls []journal.Call) string {
+	if len(calls) == 0 {
+		return "    (none)"
+	}
+	descriptions := []string{}
+	for _, call := range calls {
+		descriptions = append(descriptions, "    "+call.Action)
+	}
+	return strings.Join(descriptions, "\n")
+}
+
+func indent(s string) string {
+	return "        " + strings.Replace(s, "\n", "\n        ", -1)
+}
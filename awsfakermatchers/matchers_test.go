@@ -0,0 +1,111 @@
+package awsfakermatchers_test
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rosenhouse/awsfaker/awsfakermatchers"
+	"github.com/rosenhouse/awsfaker/journal"
+)
+
+type someHandler struct {
+	journal *journal.Journal
+}
+
+func (h *someHandler) Journal() *journal.Journal { return h.journal }
+
+var _ = Describe("Matchers", func() {
+	var j *journal.Journal
+
+	BeforeEach(func() {
+		j = &journal.Journal{}
+		j.Record(journal.Call{
+			Action: "CreateStack",
+			Input:  &cloudformation.CreateStackInput{StackName: aws.String("some-stack")},
+		})
+		j.Record(journal.Call{
+			Action: "DescribeStacks",
+			Input:  &cloudformation.DescribeStacksInput{StackName: aws.String("some-stack")},
+		})
+		j.Record(journal.Call{
+			Action: "DescribeStacks",
+			Input:  &cloudformation.DescribeStacksInput{StackName: aws.String("other-stack")},
+		})
+	})
+
+	Describe("HaveReceivedCall", func() {
+		It("should match actions that were called", func() {
+			Expect(j).To(HaveReceivedCall("DescribeStacks"))
+			Expect(j).NotTo(HaveReceivedCall("DeleteStack"))
+		})
+
+		It("should accept anything with a journal", func() {
+			Expect(&someHandler{journal: j}).To(HaveReceivedCall("CreateStack"))
+		})
+
+		It("should error on other values", func() {
+			_, err := HaveReceivedCall("CreateStack").Match("not a handler")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("HaveReceivedCallTimes", func() {
+		It("should match the number of calls", func() {
+			Expect(j).To(HaveReceivedCallTimes("DescribeStacks", 2))
+			Expect(j).To(HaveReceivedCallTimes("DeleteStack", 0))
+			Expect(j).NotTo(HaveReceivedCallTimes("CreateStack", 2))
+		})
+
+		It("should show the inputs on failure", func() {
+			matcher := HaveReceivedCallTimes("DescribeStacks", 1)
+			Expect(matcher.Match(j)).To(BeFalse())
+			Expect(matcher.FailureMessage(j)).To(ContainSubstring("Expected 1 call(s) to DescribeStacks, but there were 2"))
+			Expect(matcher.FailureMessage(j)).To(ContainSubstring(`StackName: "other-stack"`))
+		})
+	})
+
+	Describe("HaveReceivedCallWith", func() {
+		It("should match a call with an equal input", func() {
+			Expect(j).To(HaveReceivedCallWith(&cloudformation.DescribeStacksInput{StackName: aws.String("other-stack")}))
+			Expect(j).NotTo(HaveReceivedCallWith(&cloudformation.DescribeStacksInput{StackName: aws.String("missing-stack")}))
+			Expect(j).NotTo(HaveReceivedCallWith(&cloudformation.DeleteStackInput{StackName: aws.String("some-stack")}))
+		})
+
+		It("should render the expected and received inputs on failure", func() {
+			matcher := HaveReceivedCallWith(&cloudformation.DescribeStacksInput{StackName: aws.String("missing-stack")})
+			Expect(matcher.Match(j)).To(BeFalse())
+
+			message := matcher.FailureMessage(j)
+			Expect(message).To(ContainSubstring("Expected a call to DescribeStacks with input"))
+			Expect(message).To(ContainSubstring(`StackName: "missing-stack"`))
+			Expect(message).To(ContainSubstring(`StackName: "some-stack"`))
+		})
+	})
+
+	Describe("HaveReceivedCallsInOrder", func() {
+		It("should match calls in order, allowing others in between", func() {
+			Expect(j).To(HaveReceivedCallsInOrder("CreateStack", "DescribeStacks"))
+			Expect(j).To(HaveReceivedCallsInOrder(
+				"CreateStack",
+				&cloudformation.DescribeStacksInput{StackName: aws.String("other-stack")},
+			))
+		})
+
+		It("should not match calls out of order", func() {
+			Expect(j).NotTo(HaveReceivedCallsInOrder("DescribeStacks", "CreateStack"))
+			Expect(j).NotTo(HaveReceivedCallsInOrder(
+				&cloudformation.DescribeStacksInput{StackName: aws.String("other-stack")},
+				&cloudformation.DescribeStacksInput{StackName: aws.String("some-stack")},
+			))
+		})
+
+		It("should name the first missing call on failure", func() {
+			matcher := HaveReceivedCallsInOrder("CreateStack", "DeleteStack")
+			Expect(matcher.Match(j)).To(BeFalse())
+			Expect(matcher.FailureMessage(j)).To(ContainSubstring("but found no match for\n    DeleteStack\nafter the first 1"))
+		})
+	})
+})
@@ -0,0 +1,451 @@
+// Package cloudformation is a ready-made backend for a fake AWS
+// CloudFormation, which keeps its stacks in memory.
+//
+// Stacks go through the statuses that the real service reports, such as
+// CREATE_IN_PROGRESS before CREATE_COMPLETE, without creating any resources.
+// Resources are given made-up physical IDs, which is what Ref evaluates to in
+// the outputs of a template.
+package cloudformation
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/rosenhouse/awsfaker"
+	"github.com/rosenhouse/awsfaker/internal/random"
+)
+
+// Backend is a fake CloudFormation.  Use New to create one.
+type Backend struct {
+	// Region and AccountID appear in stack IDs, and as the values of the
+	// AWS::Region and AWS::AccountId pseudo parameters
+	Region    string
+	AccountID string
+
+	// TransitionDelay is the time that a stack spends in each status on the
+	// way to completing an operation.  With no delay, each operation
+	// completes by the next call.
+	TransitionDelay time.Duration
+
+	// HTTPClient fetches templates given by TemplateURL, and defaults to a
+	// client with a 15 second timeout
+	HTTPClient *http.Client
+
+	lock     sync.Mutex
+	stacks   []*stack
+	failures map[string]string
+}
+
+var defaultHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// New returns a Backend with no stacks
+func New() *Backend {
+	return &Backend{
+		Region:    "us-east-1",
+		AccountID: "123456789012",
+		failures:  map[string]string{},
+	}
+}
+
+// Settle completes the operations in progress on all stacks
+func (b *Backend) Settle() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, s := range b.stacks {
+		s.complete()
+	}
+}
+
+// FailNext makes the next creation or update of the named stack fail, as if
+// a resource had failed for the given reason.  The stack then rolls back.
+func (b *Backend) FailNext(stackName, reason string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failures[stackName] = reason
+}
+
+// Reset removes all stacks
+func (b *Backend) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.stacks = nil
+	b.failures = map[string]string{}
+}
+
+// DumpState returns a description of each stack, including deleted ones
+func (b *Backend) DumpState() interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+	descriptions := []*cfn.Stack{}
+	for _, s := range b.stacks {
+		descriptions = append(descriptions, s.describe())
+	}
+	return descriptions
+}
+
+func (b *Backend) settle() {
+	now := time.Now()
+	for _, s := range b.stacks {
+		s.settle(now)
+	}
+}
+
+// consumeFailure returns the reason that the next operation on the stack
+// should fail, if any
+func (b *Backend) consumeFailure(stackName string) string {
+	reason := b.failures[stackName]
+	delete(b.failures, stackName)
+	return reason
+}
+
+func validationError(format string, args ...interface{}) error {
+	return &awsfaker.ErrorResponse{
+		AWSErrorCode:    "ValidationError",
+		AWSErrorMessage: fmt.Sprintf(format, args...),
+		HTTPStatusCode:  http.StatusBadRequest,
+	}
+}
+
+func notFound(nameOrID string) error {
+	return validationError("Stack with id %s does not exist", nameOrID)
+}
+
+var stackNamePattern = regexp.MustCompile(`^[a-zA-Z][-a-zA-Z0-9]{0,127}$`)
+
+// find returns the live stack with the given name, or the stack with the
+// given ID, which may have been deleted
+func (b *Backend) find(nameOrID string) (*stack, bool) {
+	for _, s := range b.stacks {
+		if s.id == nameOrID || (s.name == nameOrID && !s.deleted()) {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+func (b *Backend) httpClient() *http.Client {
+	if b.HTTPClient == nil {
+		return defaultHTTPClient
+	}
+	return b.HTTPClient
+}
+
+// templateBody returns the template of a request, which is given either in
+// the request or by a URL.  Since fetching a URL may be slow, it is called
+// without holding the lock.
+func (b *Backend) templateBody(body, url *string) (string, error) {
+	switch {
+	case body != nil && url != nil:
+		return "", validationError("Specify exactly one of TemplateBody or TemplateUrl.")
+	case body != nil:
+		return *body, nil
+	case url != nil:
+		fetched, err := fetchTemplate(b.httpClient(), *url)
+		if err != nil {
+			return "", validationError("TemplateURL must reference a valid S3 object to which you have access. (%s)", err)
+		}
+		return fetched, nil
+	}
+	return "", validationError("Either Template URL or Template Body must be specified.")
+}
+
+func parseTemplateBody(body string) (*template, error) {
+	t, err := parseTemplate(body)
+	if err != nil {
+		return nil, validationError("%s", err)
+	}
+	return t, nil
+}
+
+// configure resolves the parameters for the template, and checks that the
+// capabilities it needs are acknowledged
+func configure(t *template, parameters []*cfn.Parameter, previous map[string]string, capabilities []*string) (configuration, error) {
+	given := map[string]string{}
+	for _, p := range parameters {
+		key := aws.StringValue(p.ParameterKey)
+		if aws.BoolValue(p.UsePreviousValue) {
+			value, ok := previous[key]
+			if !ok {
+				return configuration{}, validationError("Invalid input for parameter key %s. Cannot specify usePreviousValue as true for a parameter key not in the previous template", key)
+			}
+			given[key] = value
+			continue
+		}
+		given[key] = aws.StringValue(p.ParameterValue)
+	}
+	resolved, err := t.resolveParameters(given)
+	if err != nil {
+		return configuration{}, validationError("%s", err)
+	}
+
+	for _, required := range t.capabilities() {
+		if !acknowledges(capabilities, required) {
+			return configuration{}, &awsfaker.ErrorResponse{
+				AWSErrorCode:    "InsufficientCapabilitiesException",
+				AWSErrorMessage: fmt.Sprintf("Requires capabilities : [%s]", required),
+				HTTPStatusCode:  http.StatusBadRequest,
+			}
+		}
+	}
+	return configuration{template: t, parameters: resolved, capabilities: capabilities}, nil
+}
+
+func acknowledges(capabilities []*string, required string) bool {
+	for _, c := range aws.StringValueSlice(capabilities) {
+		if c == required || (required == cfn.CapabilityCapabilityIam && c == cfn.CapabilityCapabilityNamedIam) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateStack starts the creation of a stack
+func (b *Backend) CreateStack(input *cfn.CreateStackInput) (*cfn.CreateStackOutput, error) {
+	body, bodyErr := b.templateBody(input.TemplateBody, input.TemplateURL)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+
+	name := aws.StringValue(input.StackName)
+	if !stackNamePattern.MatchString(name) {
+		return nil, validationError("1 validation error detected: Value '%s' at 'stackName' failed to satisfy constraint: Member must satisfy regular expression pattern: [a-zA-Z][-a-zA-Z0-9]*", name)
+	}
+	if _, exists := b.find(name); exists {
+		return nil, &awsfaker.ErrorResponse{
+			AWSErrorCode:    "AlreadyExistsException",
+			AWSErrorMessage: fmt.Sprintf("Stack [%s] already exists", name),
+			HTTPStatusCode:  http.StatusBadRequest,
+		}
+	}
+	if input.OnFailure != nil && input.DisableRollback != nil {
+		return nil, validationError("You cannot specify both DisableRollback and OnFailure.")
+	}
+
+	if bodyErr != nil {
+		return nil, bodyErr
+	}
+	t, err := parseTemplateBody(body)
+	if err != nil {
+		return nil, err
+	}
+	config, err := configure(t, input.Parameters, nil, input.Capabilities)
+	if err != nil {
+		return nil, err
+	}
+	config.tags = input.Tags
+	config.notificationARNs = input.NotificationARNs
+	config.timeoutInMinutes = input.TimeoutInMinutes
+
+	onFailure := aws.StringValue(input.OnFailure)
+	if aws.BoolValue(input.DisableRollback) {
+		onFailure = cfn.OnFailureDoNothing
+	}
+	s := &stack{
+		id:              fmt.Sprintf("arn:aws:cloudformation:%s:%s:stack/%s/%s", b.Region, b.AccountID, name, random.UUID()),
+		name:            name,
+		region:          b.Region,
+		accountID:       b.AccountID,
+		configuration:   config,
+		disableRollback: onFailure == cfn.OnFailureDoNothing,
+		physicalIDs:     map[string]string{},
+	}
+	s.create(time.Now(), b.TransitionDelay, b.consumeFailure(name), onFailure)
+	b.stacks = append(b.stacks, s)
+
+	return &cfn.CreateStackOutput{StackId: aws.String(s.id)}, nil
+}
+
+// UpdateStack starts the update of a stack
+func (b *Backend) UpdateStack(input *cfn.UpdateStackInput) (*cfn.UpdateStackOutput, error) {
+	var (
+		body    string
+		bodyErr error
+	)
+	if !aws.BoolValue(input.UsePreviousTemplate) {
+		body, bodyErr = b.templateBody(input.TemplateBody, input.TemplateURL)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+
+	nameOrID := aws.StringValue(input.StackName)
+	s, ok := b.find(nameOrID)
+	if !ok || s.deleted() {
+		return nil, notFound(nameOrID)
+	}
+	if !s.updatable() {
+		return nil, validationError("Stack:%s is in %s state and can not be updated.", s.id, s.status)
+	}
+
+	t := s.template
+	if !aws.BoolValue(input.UsePreviousTemplate) {
+		if bodyErr != nil {
+			return nil, bodyErr
+		}
+		var err error
+		if t, err = parseTemplateBody(body); err != nil {
+			return nil, err
+		}
+	}
+	next, err := configure(t, input.Parameters, s.parameters, input.Capabilities)
+	if err != nil {
+		return nil, err
+	}
+	next.tags = s.tags
+	if input.Tags != nil {
+		next.tags = input.Tags
+	}
+	next.notificationARNs = s.notificationARNs
+	if input.NotificationARNs != nil {
+		next.notificationARNs = input.NotificationARNs
+	}
+	next.timeoutInMinutes = s.timeoutInMinutes
+
+	if next.template.Body == s.template.Body &&
+		reflect.DeepEqual(next.parameters, s.parameters) &&
+		reflect.DeepEqual(next.tags, s.tags) &&
+		reflect.DeepEqual(next.notificationARNs, s.notificationARNs) {
+		return nil, validationError("No updates are to be performed.")
+	}
+
+	s.update(time.Now(), b.TransitionDelay, next, b.consumeFailure(s.name))
+	return &cfn.UpdateStackOutput{StackId: aws.String(s.id)}, nil
+}
+
+// DeleteStack starts the deletion of a stack.  Like the real service, it
+// succeeds when there is no such stack.
+func (b *Backend) DeleteStack(input *cfn.DeleteStackInput) (*cfn.DeleteStackOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+
+	s, ok := b.find(aws.StringValue(input.StackName))
+	if ok && !s.deleted() && s.status != cfn.StackStatusDeleteInProgress {
+		s.delete(time.Now(), b.TransitionDelay)
+	}
+	return &cfn.DeleteStackOutput{}, nil
+}
+
+// DescribeStacks describes the named stack, or all live stacks
+func (b *Backend) DescribeStacks(input *cfn.DescribeStacksInput) (*cfn.DescribeStacksOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+
+	output := &cfn.DescribeStacksOutput{Stacks: []*cfn.Stack{}}
+	if input.StackName != nil {
+		s, ok := b.find(*input.StackName)
+		if !ok {
+			return nil, notFound(*input.StackName)
+		}
+		output.Stacks = append(output.Stacks, s.describe())
+		return output, nil
+	}
+	for _, s := range b.stacks {
+		if !s.deleted() {
+			output.Stacks = append(output.Stacks, s.describe())
+		}
+	}
+	return output, nil
+}
+
+// DescribeStackEvents lists the events of a stack, most recent first
+func (b *Backend) DescribeStackEvents(input *cfn.DescribeStackEventsInput) (*cfn.DescribeStackEventsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+
+	nameOrID := aws.StringValue(input.StackName)
+	s, ok := b.find(nameOrID)
+	if !ok {
+		return nil, notFound(nameOrID)
+	}
+	events := make([]*cfn.StackEvent, len(s.events))
+	for i, event := range s.events {
+		events[len(events)-1-i] = event
+	}
+	return &cfn.DescribeStackEventsOutput{StackEvents: events}, nil
+}
+
+// ListStacks summarizes all stacks, including those deleted, optionally
+// filtered by status
+func (b *Backend) ListStacks(input *cfn.ListStacksInput) (*cfn.ListStacksOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+
+	filter := aws.StringValueSlice(input.StackStatusFilter)
+	sort.Strings(filter)
+	output := &cfn.ListStacksOutput{StackSummaries: []*cfn.StackSummary{}}
+	for i := len(b.stacks) - 1; i >= 0; i-- {
+		s := b.stacks[i]
+		if len(filter) > 0 {
+			if n := sort.SearchStrings(filter, s.status); n == len(filter) || filter[n] != s.status {
+				continue
+			}
+		}
+		output.StackSummaries = append(output.StackSummaries, s.summarize())
+	}
+	return output, nil
+}
+
+// GetTemplate returns the template body of a stack, as it was given
+func (b *Backend) GetTemplate(input *cfn.GetTemplateInput) (*cfn.GetTemplateOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+
+	nameOrID := aws.StringValue(input.StackName)
+	s, ok := b.find(nameOrID)
+	if !ok {
+		return nil, notFound(nameOrID)
+	}
+	return &cfn.GetTemplateOutput{TemplateBody: aws.String(s.template.Body)}, nil
+}
+
+// ValidateTemplate parses a template, and describes its parameters and the
+// capabilities it requires
+func (b *Backend) ValidateTemplate(input *cfn.ValidateTemplateInput) (*cfn.ValidateTemplateOutput, error) {
+	body, err := b.templateBody(input.TemplateBody, input.TemplateURL)
+	if err != nil {
+		return nil, err
+	}
+	t, err := parseTemplateBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &cfn.ValidateTemplateOutput{Parameters: []*cfn.TemplateParameter{}}
+	if t.Description != "" {
+		output.Description = aws.String(t.Description)
+	}
+	for _, name := range t.parameterNames() {
+		p := t.Parameters[name]
+		parameter := &cfn.TemplateParameter{
+			ParameterKey: aws.String(name),
+			NoEcho:       aws.Bool(p.noEcho()),
+		}
+		if p.Default != nil {
+			parameter.DefaultValue = aws.String(fmt.Sprint(p.Default))
+		}
+		if p.Description != "" {
+			parameter.Description = aws.String(p.Description)
+		}
+		output.Parameters = append(output.Parameters, parameter)
+	}
+	if capabilities := t.capabilities(); len(capabilities) > 0 {
+		output.Capabilities = aws.StringSlice(capabilities)
+		output.CapabilitiesReason = aws.String("The following resource(s) require capabilities: [" + t.iamResourceTypes() + "]")
+	}
+	return output, nil
+}
@@ -0,0 +1,13 @@
+package cloudformation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCloudFormation(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CloudFormation Suite")
+}
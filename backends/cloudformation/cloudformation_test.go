@@ -0,0 +1,362 @@
+package cloudformation_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+
+	"github.com/rosenhouse/awsfaker"
+	"github.com/rosenhouse/awsfaker/backends/cloudformation"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const someTemplate = `{
+  "Description": "some description",
+  "Parameters": {
+    "Size": {"Type": "String", "Default": "small", "AllowedValues": ["small", "large"]},
+    "Password": {"Type": "String", "NoEcho": true}
+  },
+  "Resources": {
+    "Bucket": {"Type": "AWS::S3::Bucket"}
+  },
+  "Outputs": {
+    "BucketName": {"Value": {"Ref": "Bucket"}},
+    "Label": {"Value": {"Fn::Join": ["-", [{"Ref": "AWS::StackName"}, {"Ref": "Size"}]]}},
+    "Where": {"Value": {"Fn::Sub": "${AWS::Region}/${AWS::AccountId}"}}
+  }
+}`
+
+const someYAMLTemplate = `
+Resources:
+  Role:
+    Type: AWS::IAM::Role
+Outputs:
+  RoleName:
+    Value:
+      Ref: Role
+`
+
+var _ = Describe("CloudFormation backend", func() {
+	var (
+		backend    *cloudformation.Backend
+		fakeServer *httptest.Server
+		client     *cfn.CloudFormation
+	)
+
+	BeforeEach(func() {
+		backend = cloudformation.New()
+		fakeServer = httptest.NewServer(awsfaker.New(backend))
+		client = cfn.New(session.New(&aws.Config{
+			Credentials: credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""),
+			Region:      aws.String("us-east-1"),
+			Endpoint:    aws.String(fakeServer.URL),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	createStack := func(name string, parameters ...*cfn.Parameter) (string, error) {
+		output, err := client.CreateStack(&cfn.CreateStackInput{
+			StackName:    aws.String(name),
+			TemplateBody: aws.String(someTemplate),
+			Parameters:   append(parameters, &cfn.Parameter{ParameterKey: aws.String("Password"), ParameterValue: aws.String("secret")}),
+		})
+		if err != nil {
+			return "", err
+		}
+		return aws.StringValue(output.StackId), nil
+	}
+
+	describeStack := func(nameOrID string) *cfn.Stack {
+		output, err := client.DescribeStacks(&cfn.DescribeStacksInput{StackName: aws.String(nameOrID)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.Stacks).To(HaveLen(1))
+		return output.Stacks[0]
+	}
+
+	statuses := func(name string) []string {
+		output, err := client.DescribeStackEvents(&cfn.DescribeStackEventsInput{StackName: aws.String(name)})
+		Expect(err).NotTo(HaveOccurred())
+		result := []string{}
+		for _, event := range output.StackEvents {
+			if aws.StringValue(event.ResourceType) == "AWS::CloudFormation::Stack" {
+				result = append([]string{aws.StringValue(event.ResourceStatus)}, result...)
+			}
+		}
+		return result
+	}
+
+	expectError := func(err error, code, message string) {
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal(code))
+		Expect(err.(awserr.RequestFailure).StatusCode()).To(Equal(http.StatusBadRequest))
+		Expect(err.(awserr.RequestFailure).Message()).To(ContainSubstring(message))
+	}
+
+	Describe("creating a stack", func() {
+		It("should report the stack in progress until it completes", func() {
+			backend.TransitionDelay = time.Hour
+
+			id, err := createStack("some-stack")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(MatchRegexp(`^arn:aws:cloudformation:us-east-1:123456789012:stack/some-stack/[-0-9a-f]{36}$`))
+			Expect(describeStack("some-stack").StackStatus).To(Equal(aws.String("CREATE_IN_PROGRESS")))
+
+			backend.Settle()
+			Expect(describeStack(id).StackStatus).To(Equal(aws.String("CREATE_COMPLETE")))
+			Expect(statuses("some-stack")).To(Equal([]string{"CREATE_IN_PROGRESS", "CREATE_COMPLETE"}))
+		})
+
+		It("should describe the parameters and outputs", func() {
+			_, err := createStack("some-stack")
+			Expect(err).NotTo(HaveOccurred())
+
+			stack := describeStack("some-stack")
+			Expect(stack.Description).To(Equal(aws.String("some description")))
+			Expect(stack.Parameters).To(ConsistOf(
+				&cfn.Parameter{ParameterKey: aws.String("Password"), ParameterValue: aws.String("****")},
+				&cfn.Parameter{ParameterKey: aws.String("Size"), ParameterValue: aws.String("small")},
+			))
+
+			outputs := map[string]string{}
+			for _, output := range stack.Outputs {
+				outputs[*output.OutputKey] = *output.OutputValue
+			}
+			Expect(outputs).To(HaveKeyWithValue("BucketName", MatchRegexp(`^some-stack-Bucket-[A-Z0-9]{12}$`)))
+			Expect(outputs).To(HaveKeyWithValue("Label", "some-stack-small"))
+			Expect(outputs).To(HaveKeyWithValue("Where", "us-east-1/123456789012"))
+		})
+
+		It("should refuse a stack with the name of a live stack", func() {
+			_, err := createStack("some-stack")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = createStack("some-stack")
+			expectError(err, "AlreadyExistsException", "Stack [some-stack] already exists")
+		})
+
+		It("should refuse bad names, parameters and templates", func() {
+			_, err := createStack("some_stack")
+			expectError(err, "ValidationError", "failed to satisfy constraint")
+
+			_, err = createStack("some-stack", &cfn.Parameter{ParameterKey: aws.String("Size"), ParameterValue: aws.String("huge")})
+			expectError(err, "ValidationError", "Parameter 'Size' must be one of AllowedValues")
+
+			_, err = createStack("some-stack", &cfn.Parameter{ParameterKey: aws.String("Colour"), ParameterValue: aws.String("red")})
+			expectError(err, "ValidationError", "Parameters: [Colour] do not exist in the template")
+
+			_, err = client.CreateStack(&cfn.CreateStackInput{StackName: aws.String("some-stack"), TemplateBody: aws.String(someTemplate)})
+			expectError(err, "ValidationError", "Parameters: [Password] must have values")
+
+			_, err = client.CreateStack(&cfn.CreateStackInput{StackName: aws.String("some-stack"), TemplateBody: aws.String(`{"Resources": {}}`)})
+			expectError(err, "ValidationError", "At least one Resources member must be defined")
+		})
+
+		It("should require acknowledgement of IAM capabilities", func() {
+			input := &cfn.CreateStackInput{StackName: aws.String("some-stack"), TemplateBody: aws.String(someYAMLTemplate)}
+			_, err := client.CreateStack(input)
+			expectError(err, "InsufficientCapabilitiesException", "Requires capabilities : [CAPABILITY_IAM]")
+
+			input.Capabilities = aws.StringSlice([]string{"CAPABILITY_IAM"})
+			_, err = client.CreateStack(input)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*describeStack("some-stack").Outputs[0].OutputValue).To(HavePrefix("some-stack-Role-"))
+		})
+
+		It("should roll back when a resource fails", func() {
+			backend.FailNext("some-stack", "some failure")
+			_, err := createStack("some-stack")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(describeStack("some-stack").StackStatus).To(Equal(aws.String("ROLLBACK_COMPLETE")))
+			Expect(statuses("some-stack")).To(Equal([]string{"CREATE_IN_PROGRESS", "ROLLBACK_IN_PROGRESS", "ROLLBACK_COMPLETE"}))
+
+			_, err = client.UpdateStack(&cfn.UpdateStackInput{StackName: aws.String("some-stack"), UsePreviousTemplate: aws.Bool(true)})
+			expectError(err, "ValidationError", "is in ROLLBACK_COMPLETE state and can not be updated.")
+		})
+	})
+
+	Describe("updating a stack", func() {
+		var stackID string
+
+		BeforeEach(func() {
+			var err error
+			stackID, err = createStack("some-stack")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		update := func(size string) error {
+			_, err := client.UpdateStack(&cfn.UpdateStackInput{
+				StackName:           aws.String("some-stack"),
+				UsePreviousTemplate: aws.Bool(true),
+				Parameters: []*cfn.Parameter{
+					{ParameterKey: aws.String("Size"), ParameterValue: aws.String(size)},
+					{ParameterKey: aws.String("Password"), UsePreviousValue: aws.Bool(true)},
+				},
+			})
+			return err
+		}
+
+		It("should apply the new parameters", func() {
+			Expect(update("large")).To(Succeed())
+
+			stack := describeStack(stackID)
+			Expect(stack.StackStatus).To(Equal(aws.String("UPDATE_COMPLETE")))
+			Expect(stack.LastUpdatedTime).NotTo(BeNil())
+			Expect(stack.Parameters).To(ContainElement(&cfn.Parameter{ParameterKey: aws.String("Size"), ParameterValue: aws.String("large")}))
+		})
+
+		It("should refuse an update that changes nothing", func() {
+			expectError(update("small"), "ValidationError", "No updates are to be performed.")
+		})
+
+		It("should roll back to the previous parameters when a resource fails", func() {
+			backend.FailNext("some-stack", "some failure")
+			Expect(update("large")).To(Succeed())
+
+			stack := describeStack("some-stack")
+			Expect(stack.StackStatus).To(Equal(aws.String("UPDATE_ROLLBACK_COMPLETE")))
+			Expect(stack.Parameters).To(ContainElement(&cfn.Parameter{ParameterKey: aws.String("Size"), ParameterValue: aws.String("small")}))
+			Expect(statuses("some-stack")).To(Equal([]string{
+				"CREATE_IN_PROGRESS",
+				"CREATE_COMPLETE",
+				"UPDATE_IN_PROGRESS",
+				"UPDATE_ROLLBACK_IN_PROGRESS",
+				"UPDATE_ROLLBACK_COMPLETE_CLEANUP_IN_PROGRESS",
+				"UPDATE_ROLLBACK_COMPLETE",
+			}))
+
+			Expect(update("large")).To(Succeed())
+		})
+	})
+
+	Describe("deleting a stack", func() {
+		It("should keep the deleted stack for listing and lookup by ID", func() {
+			id, err := createStack("some-stack")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.DeleteStack(&cfn.DeleteStackInput{StackName: aws.String("some-stack")})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.DescribeStacks(&cfn.DescribeStacksInput{StackName: aws.String("some-stack")})
+			expectError(err, "ValidationError", "Stack with id some-stack does not exist")
+			Expect(describeStack(id).StackStatus).To(Equal(aws.String("DELETE_COMPLETE")))
+
+			newID, err := createStack("some-stack")
+			Expect(err).NotTo(HaveOccurred())
+
+			listed, err := client.ListStacks(&cfn.ListStacksInput{StackStatusFilter: aws.StringSlice([]string{"DELETE_COMPLETE"})})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(listed.StackSummaries).To(HaveLen(1))
+			Expect(listed.StackSummaries[0].StackId).To(Equal(aws.String(id)))
+			Expect(listed.StackSummaries[0].DeletionTime).NotTo(BeNil())
+
+			all, err := client.DescribeStacks(&cfn.DescribeStacksInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(all.Stacks).To(HaveLen(1))
+			Expect(all.Stacks[0].StackId).To(Equal(aws.String(newID)))
+		})
+
+		It("should succeed for a stack that does not exist", func() {
+			_, err := client.DeleteStack(&cfn.DeleteStackInput{StackName: aws.String("some-stack")})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	It("should return the template as given", func() {
+		_, err := createStack("some-stack")
+		Expect(err).NotTo(HaveOccurred())
+
+		output, err := client.GetTemplate(&cfn.GetTemplateInput{StackName: aws.String("some-stack")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.TemplateBody).To(Equal(aws.String(someTemplate)))
+	})
+
+	It("should validate a template, reporting parameters and capabilities", func() {
+		output, err := client.ValidateTemplate(&cfn.ValidateTemplateInput{TemplateBody: aws.String(someTemplate)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.Description).To(Equal(aws.String("some description")))
+		Expect(output.Parameters).To(HaveLen(2))
+		Expect(output.Parameters[1]).To(Equal(&cfn.TemplateParameter{
+			ParameterKey: aws.String("Size"),
+			DefaultValue: aws.String("small"),
+			NoEcho:       aws.Bool(false),
+		}))
+
+		output, err = client.ValidateTemplate(&cfn.ValidateTemplateInput{TemplateBody: aws.String(someYAMLTemplate)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.Capabilities).To(Equal(aws.StringSlice([]string{"CAPABILITY_IAM"})))
+
+		_, err = client.ValidateTemplate(&cfn.ValidateTemplateInput{TemplateBody: aws.String("{")})
+		expectError(err, "ValidationError", "Template format error")
+	})
+
+	It("should fetch templates by URL", func() {
+		templateServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(someYAMLTemplate))
+		}))
+		defer templateServer.Close()
+
+		output, err := client.ValidateTemplate(&cfn.ValidateTemplateInput{TemplateURL: aws.String(templateServer.URL)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.Capabilities).To(HaveLen(1))
+	})
+
+	It("should serve other calls while a template is being fetched", func() {
+		release := make(chan struct{})
+		templateServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.Write([]byte(someYAMLTemplate))
+		}))
+		defer templateServer.Close()
+
+		created := make(chan error, 1)
+		go func() {
+			_, err := client.CreateStack(&cfn.CreateStackInput{
+				StackName:    aws.String("slow-stack"),
+				TemplateURL:  aws.String(templateServer.URL),
+				Capabilities: aws.StringSlice([]string{"CAPABILITY_IAM"}),
+			})
+			created <- err
+		}()
+
+		_, err := client.DescribeStacks(&cfn.DescribeStacksInput{})
+		Expect(err).NotTo(HaveOccurred())
+		Consistently(created).ShouldNot(Receive())
+
+		close(release)
+		Eventually(created).Should(Receive(BeNil()))
+	})
+
+	It("should give up on templates that take too long to fetch", func() {
+		release := make(chan struct{})
+		templateServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer templateServer.Close()
+		defer close(release)
+
+		backend.HTTPClient = &http.Client{Timeout: 50 * time.Millisecond}
+		_, err := client.ValidateTemplate(&cfn.ValidateTemplateInput{TemplateURL: aws.String(templateServer.URL)})
+		expectError(err, "ValidationError", "TemplateURL must reference a valid S3 object")
+	})
+
+	It("should forget all stacks on reset", func() {
+		_, err := createStack("some-stack")
+		Expect(err).NotTo(HaveOccurred())
+
+		backend.Reset()
+		Expect(backend.DumpState()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,314 @@
+package cloudformation
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/rosenhouse/awsfaker/internal/random"
+)
+
+// A configuration is what a stack is created or updated with
+type configuration struct {
+	template         *template
+	parameters       map[string]string
+	capabilities     []*string
+	tags             []*cfn.Tag
+	notificationARNs []*string
+	timeoutInMinutes *int64
+}
+
+type stack struct {
+	id, name          string
+	region, accountID string
+	configuration
+
+	disableRollback bool
+	status, reason  string
+	creationTime    time.Time
+	lastUpdatedTime *time.Time
+	deletionTime    *time.Time
+	outputs         []*cfn.Output
+	physicalIDs     map[string]string
+	events          []*cfn.StackEvent
+
+	// pending holds the transitions of the current operation that have yet
+	// to happen
+	pending []step
+}
+
+// A step is a transition of the stack status, due at a given time
+type step struct {
+	status, reason string
+	at             time.Time
+	apply          func()
+}
+
+func (s *stack) deleted() bool {
+	return s.status == cfn.StackStatusDeleteComplete
+}
+
+func (s *stack) inProgress() bool {
+	return len(s.pending) > 0
+}
+
+// physicalID returns the physical ID made up for a resource of the stack
+func (s *stack) physicalID(logicalID string) string {
+	id, ok := s.physicalIDs[logicalID]
+	if !ok {
+		id = fmt.Sprintf("%s-%s-%s", s.name, logicalID, random.Upper(12))
+		s.physicalIDs[logicalID] = id
+	}
+	return id
+}
+
+// transition moves the stack to a status, and records the event
+func (s *stack) transition(status, reason string, at time.Time) {
+	s.status = status
+	s.reason = reason
+	s.event(s.name, s.id, "AWS::CloudFormation::Stack", status, reason, at)
+}
+
+func (s *stack) event(logicalID, physicalID, resourceType, status, reason string, at time.Time) {
+	event := &cfn.StackEvent{
+		EventId:            aws.String(random.UUID()),
+		StackId:            aws.String(s.id),
+		StackName:          aws.String(s.name),
+		LogicalResourceId:  aws.String(logicalID),
+		PhysicalResourceId: aws.String(physicalID),
+		ResourceType:       aws.String(resourceType),
+		ResourceStatus:     aws.String(status),
+		Timestamp:          aws.Time(at),
+	}
+	if reason != "" {
+		event.ResourceStatusReason = aws.String(reason)
+	}
+	s.events = append(s.events, event)
+}
+
+// resourceEvents records an event for each resource of the template
+func (s *stack) resourceEvents(status string, at time.Time) {
+	for _, logicalID := range s.resourceNames() {
+		s.event(logicalID, s.physicalID(logicalID), s.template.Resources[logicalID].Type, status, "", at)
+	}
+}
+
+func (s *stack) resourceNames() []string {
+	names := make([]string, 0, len(s.template.Resources))
+	for name := range s.template.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// begin starts an operation: the stack moves to the first status now, and to
+// each of the following statuses after a further delay
+func (s *stack) begin(now time.Time, delay time.Duration, first step, rest ...step) {
+	if first.apply != nil {
+		first.apply()
+	}
+	s.transition(first.status, first.reason, now)
+	s.pending = nil
+	for i, next := range rest {
+		next.at = now.Add(time.Duration(i+1) * delay)
+		s.pending = append(s.pending, next)
+	}
+}
+
+// settle makes the transitions that are due
+func (s *stack) settle(now time.Time) {
+	for len(s.pending) > 0 && !s.pending[0].at.After(now) {
+		next := s.pending[0]
+		s.pending = s.pending[1:]
+		if next.apply != nil {
+			next.apply()
+		}
+		s.transition(next.status, next.reason, next.at)
+	}
+}
+
+// complete makes all of the pending transitions at once
+func (s *stack) complete() {
+	for len(s.pending) > 0 {
+		s.settle(s.pending[len(s.pending)-1].at)
+	}
+}
+
+// computeOutputs evaluates the outputs of the template
+func (s *stack) computeOutputs() {
+	names := make([]string, 0, len(s.template.Outputs))
+	for name := range s.template.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s.outputs = nil
+	for _, name := range names {
+		output := &cfn.Output{
+			OutputKey:   aws.String(name),
+			OutputValue: aws.String(s.evaluate(s.template.Outputs[name].Value)),
+		}
+		if description := s.template.Outputs[name].Description; description != "" {
+			output.Description = aws.String(description)
+		}
+		s.outputs = append(s.outputs, output)
+	}
+}
+
+func (s *stack) describe() *cfn.Stack {
+	description := &cfn.Stack{
+		StackId:          aws.String(s.id),
+		StackName:        aws.String(s.name),
+		StackStatus:      aws.String(s.status),
+		CreationTime:     aws.Time(s.creationTime),
+		LastUpdatedTime:  s.lastUpdatedTime,
+		DisableRollback:  aws.Bool(s.disableRollback),
+		Capabilities:     s.capabilities,
+		Tags:             s.tags,
+		NotificationARNs: s.notificationARNs,
+		TimeoutInMinutes: s.timeoutInMinutes,
+		Outputs:          s.outputs,
+	}
+	if s.reason != "" {
+		description.StackStatusReason = aws.String(s.reason)
+	}
+	if s.template.Description != "" {
+		description.Description = aws.String(s.template.Description)
+	}
+	for _, name := range s.template.parameterNames() {
+		value := s.parameters[name]
+		if s.template.Parameters[name].noEcho() {
+			value = "****"
+		}
+		description.Parameters = append(description.Parameters, &cfn.Parameter{
+			ParameterKey:   aws.String(name),
+			ParameterValue: aws.String(value),
+		})
+	}
+	return description
+}
+
+func (s *stack) summarize() *cfn.StackSummary {
+	summary := &cfn.StackSummary{
+		StackId:         aws.String(s.id),
+		StackName:       aws.String(s.name),
+		StackStatus:     aws.String(s.status),
+		CreationTime:    aws.Time(s.creationTime),
+		LastUpdatedTime: s.lastUpdatedTime,
+		DeletionTime:    s.deletionTime,
+	}
+	if s.reason != "" {
+		summary.StackStatusReason = aws.String(s.reason)
+	}
+	if s.template.Description != "" {
+		summary.TemplateDescription = aws.String(s.template.Description)
+	}
+	return summary
+}
+
+// create starts the creation of the stack.  If failure is not empty, a
+// resource fails to create for that reason, and the stack rolls back as
+// directed by onFailure.
+func (s *stack) create(now time.Time, delay time.Duration, failure, onFailure string) {
+	s.creationTime = now
+	inProgress := step{status: cfn.StackStatusCreateInProgress, reason: "User Initiated"}
+	if failure == "" {
+		s.begin(now, delay, inProgress, step{
+			status: cfn.StackStatusCreateComplete,
+			apply: func() {
+				s.resourceEvents(cfn.ResourceStatusCreateComplete, now.Add(delay))
+				s.computeOutputs()
+			},
+		})
+		return
+	}
+
+	failed := func() { s.failResource(cfn.ResourceStatusCreateFailed, failure, now.Add(delay)) }
+	rollbackReason := fmt.Sprintf("The following resource(s) failed to create: [%s]. ", s.resourceNames()[0])
+	switch onFailure {
+	case cfn.OnFailureDoNothing:
+		s.begin(now, delay, inProgress, step{status: cfn.StackStatusCreateFailed, reason: rollbackReason, apply: failed})
+	case cfn.OnFailureDelete:
+		s.begin(now, delay, inProgress,
+			step{status: cfn.StackStatusDeleteInProgress, reason: rollbackReason, apply: failed},
+			step{status: cfn.StackStatusDeleteComplete, apply: func() { s.deletionTime = aws.Time(now.Add(2 * delay)) }},
+		)
+	default:
+		s.begin(now, delay, inProgress,
+			step{status: cfn.StackStatusRollbackInProgress, reason: rollbackReason, apply: failed},
+			step{status: cfn.StackStatusRollbackComplete},
+		)
+	}
+}
+
+// failResource records the failure of the first resource of the template
+func (s *stack) failResource(status, reason string, at time.Time) {
+	logicalID := s.resourceNames()[0]
+	s.event(logicalID, "", s.template.Resources[logicalID].Type, status, reason, at)
+}
+
+// update starts the update of the stack to the new configuration.  If failure
+// is not empty, a resource fails to update for that reason, and the stack
+// rolls back to its previous configuration.
+func (s *stack) update(now time.Time, delay time.Duration, next configuration, failure string) {
+	previous := s.configuration
+	s.lastUpdatedTime = aws.Time(now)
+	inProgress := step{
+		status: cfn.StackStatusUpdateInProgress,
+		reason: "User Initiated",
+		apply:  func() { s.configuration = next },
+	}
+	if failure == "" {
+		s.begin(now, delay, inProgress,
+			step{
+				status: cfn.StackStatusUpdateCompleteCleanupInProgress,
+				apply: func() {
+					s.resourceEvents(cfn.ResourceStatusUpdateComplete, now.Add(delay))
+					s.computeOutputs()
+				},
+			},
+			step{status: cfn.StackStatusUpdateComplete},
+		)
+		return
+	}
+
+	s.begin(now, delay, inProgress,
+		step{
+			status: cfn.StackStatusUpdateRollbackInProgress,
+			reason: fmt.Sprintf("The following resource(s) failed to update: [%s]. ", s.resourceNames()[0]),
+			apply: func() {
+				s.failResource(cfn.ResourceStatusUpdateFailed, failure, now.Add(delay))
+				s.configuration = previous
+			},
+		},
+		step{status: cfn.StackStatusUpdateRollbackCompleteCleanupInProgress},
+		step{status: cfn.StackStatusUpdateRollbackComplete},
+	)
+}
+
+// delete starts the deletion of the stack
+func (s *stack) delete(now time.Time, delay time.Duration) {
+	s.begin(now, delay,
+		step{status: cfn.StackStatusDeleteInProgress, reason: "User Initiated"},
+		step{
+			status: cfn.StackStatusDeleteComplete,
+			apply: func() {
+				s.resourceEvents(cfn.ResourceStatusDeleteComplete, now.Add(delay))
+				s.deletionTime = aws.Time(now.Add(delay))
+				s.outputs = nil
+			},
+		},
+	)
+}
+
+// updatable reports whether the stack may be updated in its current status
+func (s *stack) updatable() bool {
+	switch s.status {
+	case cfn.StackStatusCreateComplete, cfn.StackStatusUpdateComplete, cfn.StackStatusUpdateRollbackComplete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package cloudformation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/rosenhouse/awsfaker/internal/yamlutil"
+)
+
+// A template is the parsed form of a template body.  Only the sections that
+// the backend reports on are read.
+type template struct {
+	Body        string
+	Description string
+	Parameters  map[string]templateParameter
+	Resources   map[string]templateResource
+	Outputs     map[string]templateOutput
+}
+
+type templateParameter struct {
+	Type          string        `json:"Type"`
+	Default       interface{}   `json:"Default"`
+	NoEcho        interface{}   `json:"NoEcho"`
+	AllowedValues []interface{} `json:"AllowedValues"`
+	Description   string        `json:"Description"`
+}
+
+func (p templateParameter) noEcho() bool {
+	return fmt.Sprint(p.NoEcho) == "true"
+}
+
+type templateResource struct {
+	Type string `json:"Type"`
+}
+
+type templateOutput struct {
+	Value       interface{} `json:"Value"`
+	Description string      `json:"Description"`
+}
+
+// parseTemplate parses a template body in JSON or YAML.  YAML templates must
+// use the long form of intrinsic functions, e.g. "Ref: Foo" rather than
+// "!Ref Foo", since the short form tags are lost when parsing.
+func parseTemplate(body string) (*template, error) {
+	var document interface{}
+	if err := json.Unmarshal([]byte(body), &document); err != nil {
+		if yamlErr := yaml.Unmarshal([]byte(body), &document); yamlErr != nil {
+			return nil, fmt.Errorf("Template format error: JSON not well-formed. (%s)", err)
+		}
+		document = yamlutil.Normalize(document)
+	}
+	if _, ok := document.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("Template format error: unsupported structure.")
+	}
+
+	normalized, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	t := &template{Body: body}
+	if err := json.Unmarshal(normalized, t); err != nil {
+		return nil, fmt.Errorf("Template format error: %s", err)
+	}
+	if len(t.Resources) == 0 {
+		return nil, fmt.Errorf("Template format error: At least one Resources member must be defined.")
+	}
+	for name, resource := range t.Resources {
+		if resource.Type == "" {
+			return nil, fmt.Errorf("Template format error: [/Resources/%s] Every Resources object must contain a Type member.", name)
+		}
+	}
+	return t, nil
+}
+
+// fetchTemplate reads a template from a URL, which may itself be served by
+// a fake S3
+func fetchTemplate(client *http.Client, url string) (string, error) {
+	response, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	return string(body), err
+}
+
+var substitutionPattern = regexp.MustCompile(`\$\{[^}!]+\}`)
+
+func (t *template) parameterNames() []string {
+	names := make([]string, 0, len(t.Parameters))
+	for name := range t.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// capabilities returns the capabilities that a stack must acknowledge to be
+// created from the template
+func (t *template) capabilities() []string {
+	if t.iamResourceTypes() == "" {
+		return nil
+	}
+	return []string{"CAPABILITY_IAM"}
+}
+
+// iamResourceTypes lists the IAM resource types used by the template
+func (t *template) iamResourceTypes() string {
+	seen := map[string]bool{}
+	var types []string
+	for _, resource := range t.Resources {
+		if strings.HasPrefix(resource.Type, "AWS::IAM::") && !seen[resource.Type] {
+			seen[resource.Type] = true
+			types = append(types, resource.Type)
+		}
+	}
+	sort.Strings(types)
+	return strings.Join(types, ", ")
+}
+
+// resolveParameters combines the given parameter values with the defaults of
+// the template, and checks them against the template
+func (t *template) resolveParameters(given map[string]string) (map[string]string, error) {
+	var unknown []string
+	for name := range given {
+		if _, ok := t.Parameters[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("Parameters: [%s] do not exist in the template", strings.Join(unknown, ", "))
+	}
+
+	resolved := map[string]string{}
+	var missing []string
+	for _, name := range t.parameterNames() {
+		parameter := t.Parameters[name]
+		value, ok := given[name]
+		if !ok && parameter.Default != nil {
+			value, ok = fmt.Sprint(parameter.Default), true
+		}
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		if len(parameter.AllowedValues) > 0 && !isAllowed(value, parameter.AllowedValues) {
+			return nil, fmt.Errorf("Parameter '%s' must be one of AllowedValues", name)
+		}
+		resolved[name] = value
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("Parameters: [%s] must have values", strings.Join(missing, ", "))
+	}
+	return resolved, nil
+}
+
+func isAllowed(value string, allowed []interface{}) bool {
+	for _, a := range allowed {
+		if fmt.Sprint(a) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate computes the value of a template expression, supporting Ref,
+// Fn::GetAtt, Fn::Join and Fn::Sub.  Resources are referred to by physical
+// IDs made up by the stack.
+func (s *stack) evaluate(expression interface{}) string {
+	switch e := expression.(type) {
+	case string:
+		return e
+	case []interface{}:
+		values := make([]string, len(e))
+		for i, element := range e {
+			values[i] = s.evaluate(element)
+		}
+		return strings.Join(values, ",")
+	case map[string]interface{}:
+		if len(e) != 1 {
+			break
+		}
+		for function, argument := range e {
+			switch function {
+			case "Ref":
+				return s.ref(fmt.Sprint(argument))
+			case "Fn::GetAtt":
+				if names, ok := argument.([]interface{}); ok && len(names) == 2 {
+					return s.ref(fmt.Sprint(names[0])) + "." + fmt.Sprint(names[1])
+				}
+				if name, ok := argument.(string); ok {
+					parts := strings.SplitN(name, ".", 2)
+					return s.ref(parts[0]) + "." + parts[len(parts)-1]
+				}
+			case "Fn::Join":
+				if arguments, ok := argument.([]interface{}); ok && len(arguments) == 2 {
+					if list, ok := arguments[1].([]interface{}); ok {
+						values := make([]string, len(list))
+						for i, element := range list {
+							values[i] = s.evaluate(element)
+						}
+						return strings.Join(values, fmt.Sprint(arguments[0]))
+					}
+				}
+			case "Fn::Sub":
+				if text, ok := argument.(string); ok {
+					return substitutionPattern.ReplaceAllStringFunc(text, func(match string) string {
+						return s.ref(match[2 : len(match)-1])
+					})
+				}
+			}
+		}
+	}
+	return fmt.Sprint(expression)
+}
+
+// ref returns the value of a parameter, pseudo parameter or resource
+func (s *stack) ref(name string) string {
+	switch name {
+	case "AWS::StackName":
+		return s.name
+	case "AWS::StackId":
+		return s.id
+	case "AWS::Region":
+		return s.region
+	case "AWS::AccountId":
+		return s.accountID
+	}
+	if value, ok := s.parameters[name]; ok {
+		return value
+	}
+	if _, ok := s.template.Resources[name]; ok {
+		return s.physicalID(name)
+	}
+	return name
+}
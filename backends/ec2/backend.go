@@ -0,0 +1,303 @@
+// Package ec2 is a ready-made backend for a fake Amazon EC2, which keeps VPCs,
+// subnets, security groups, key pairs, instances and tags in memory.
+//
+// Describe calls support the Filter semantics of the real service: values
+// may contain the wildcards * and ?, a filter matches if any of its values
+// does, and all filters must match.  Tags are matched with tag:Key, tag-key
+// and tag-value.
+package ec2
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/rosenhouse/awsfaker"
+	"github.com/rosenhouse/awsfaker/internal/random"
+)
+
+// Backend is a fake EC2.  Use New to create one.
+//
+// There is no default VPC, so instances must be launched into a subnet.
+type Backend struct {
+	// Region sets the availability zones, and the AccountID is the owner of
+	// all resources
+	Region    string
+	AccountID string
+
+	// TransitionDelay is the time that an instance spends pending, stopping
+	// or shutting down.  With no delay, each change of state completes by the
+	// next call.
+	TransitionDelay time.Duration
+
+	lock           sync.Mutex
+	vpcs           []*ec2.Vpc
+	subnets        []*subnet
+	securityGroups []*securityGroup
+	keyPairs       []*keyPair
+	instances      []*instance
+	tags           map[string]map[string]string
+}
+
+// New returns a Backend with no resources
+func New() *Backend {
+	return &Backend{
+		Region:    "us-east-1",
+		AccountID: "123456789012",
+		tags:      map[string]map[string]string{},
+	}
+}
+
+// Settle completes the changes of state in progress on all instances
+func (b *Backend) Settle() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, i := range b.instances {
+		i.complete()
+	}
+}
+
+// Reset removes all resources
+func (b *Backend) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.vpcs = nil
+	b.subnets = nil
+	b.securityGroups = nil
+	b.keyPairs = nil
+	b.instances = nil
+	b.tags = map[string]map[string]string{}
+}
+
+// State is the state of a Backend, as reported by DumpState
+type State struct {
+	Vpcs           []*ec2.Vpc
+	Subnets        []*ec2.Subnet
+	SecurityGroups []*ec2.SecurityGroup
+	KeyPairs       []*ec2.KeyPairInfo
+	Reservations   []*ec2.Reservation
+}
+
+// DumpState returns all resources
+func (b *Backend) DumpState() interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+
+	state := State{}
+	for _, v := range b.vpcs {
+		state.Vpcs = append(state.Vpcs, b.describeVpc(v))
+	}
+	for _, s := range b.subnets {
+		state.Subnets = append(state.Subnets, b.describeSubnet(s))
+	}
+	for _, g := range b.securityGroups {
+		state.SecurityGroups = append(state.SecurityGroups, b.describeSecurityGroup(g))
+	}
+	for _, k := range b.keyPairs {
+		state.KeyPairs = append(state.KeyPairs, k.describe())
+	}
+	state.Reservations = b.reservations(b.instances)
+	return state
+}
+
+func (b *Backend) settle() {
+	now := time.Now()
+	for _, i := range b.instances {
+		i.settle(now)
+	}
+}
+
+// newID returns an ID in the long format of EC2, e.g. vpc-0123456789abcdef0
+func newID(prefix string) string {
+	return prefix + "-" + random.Hex(17)
+}
+
+func (b *Backend) availabilityZones() []string {
+	return []string{b.Region + "a", b.Region + "b", b.Region + "c"}
+}
+
+func ec2Error(code, format string, args ...interface{}) error {
+	return &awsfaker.ErrorResponse{
+		AWSErrorCode:    code,
+		AWSErrorMessage: fmt.Sprintf(format, args...),
+		HTTPStatusCode:  http.StatusBadRequest,
+	}
+}
+
+// dryRun refuses requests that are only checking permissions, as the real
+// service does once it has checked them
+func dryRun(flag *bool) error {
+	if !aws.BoolValue(flag) {
+		return nil
+	}
+	return &awsfaker.ErrorResponse{
+		AWSErrorCode:    "DryRunOperation",
+		AWSErrorMessage: "Request would have succeeded, but DryRun flag is set.",
+		HTTPStatusCode:  http.StatusPreconditionFailed,
+	}
+}
+
+// CreateTags adds or overwrites tags on resources
+func (b *Backend) CreateTags(input *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	for _, id := range aws.StringValueSlice(input.Resources) {
+		if err := b.checkResource(id); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range aws.StringValueSlice(input.Resources) {
+		b.tag(id, input.Tags)
+	}
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+// DeleteTags removes tags from resources.  A tag given without a value is
+// removed whatever its value.
+func (b *Backend) DeleteTags(input *ec2.DeleteTagsInput) (*ec2.DeleteTagsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	for _, id := range aws.StringValueSlice(input.Resources) {
+		tags := b.tags[id]
+		if input.Tags == nil {
+			delete(b.tags, id)
+			continue
+		}
+		for _, tag := range input.Tags {
+			key := aws.StringValue(tag.Key)
+			if value, ok := tags[key]; ok && (tag.Value == nil || *tag.Value == value) {
+				delete(tags, key)
+			}
+		}
+	}
+	return &ec2.DeleteTagsOutput{}, nil
+}
+
+// DescribeTags lists the tags of all resources, with the filters key, value,
+// resource-id and resource-type
+func (b *Backend) DescribeTags(input *ec2.DescribeTagsInput) (*ec2.DescribeTagsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+
+	output := &ec2.DescribeTagsOutput{Tags: []*ec2.TagDescription{}}
+	for _, id := range b.resourceIDs() {
+		for _, tag := range b.tagsOf(id) {
+			description := &ec2.TagDescription{
+				ResourceId:   aws.String(id),
+				ResourceType: aws.String(resourceType(id)),
+				Key:          tag.Key,
+				Value:        tag.Value,
+			}
+			ok, err := matchesFilters(input.Filters, nil, func(name string) ([]string, bool) {
+				switch name {
+				case "key":
+					return []string{*description.Key}, true
+				case "value":
+					return []string{*description.Value}, true
+				case "resource-id":
+					return []string{id}, true
+				case "resource-type":
+					return []string{*description.ResourceType}, true
+				}
+				return nil, false
+			})
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				output.Tags = append(output.Tags, description)
+			}
+		}
+	}
+	return output, nil
+}
+
+func (b *Backend) tag(id string, tags []*ec2.Tag) {
+	if len(tags) == 0 {
+		return
+	}
+	if b.tags[id] == nil {
+		b.tags[id] = map[string]string{}
+	}
+	for _, tag := range tags {
+		b.tags[id][aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+}
+
+// tagsOf returns the tags of a resource, sorted by key
+func (b *Backend) tagsOf(id string) []*ec2.Tag {
+	keys := sortedKeys(b.tags[id])
+	if len(keys) == 0 {
+		return nil
+	}
+	tags := make([]*ec2.Tag, len(keys))
+	for i, key := range keys {
+		tags[i] = &ec2.Tag{Key: aws.String(key), Value: aws.String(b.tags[id][key])}
+	}
+	return tags
+}
+
+// resourceIDs lists the IDs of all taggable resources, in order of creation
+// within each type
+func (b *Backend) resourceIDs() []string {
+	var ids []string
+	for _, i := range b.instances {
+		ids = append(ids, *i.InstanceId)
+	}
+	for _, g := range b.securityGroups {
+		ids = append(ids, *g.GroupId)
+	}
+	for _, s := range b.subnets {
+		ids = append(ids, *s.SubnetId)
+	}
+	for _, v := range b.vpcs {
+		ids = append(ids, *v.VpcId)
+	}
+	return ids
+}
+
+func resourceType(id string) string {
+	switch strings.SplitN(id, "-", 2)[0] {
+	case "i":
+		return "instance"
+	case "sg":
+		return "security-group"
+	case "subnet":
+		return "subnet"
+	case "vpc":
+		return "vpc"
+	}
+	return ""
+}
+
+// checkResource returns the error for a resource ID that does not exist
+func (b *Backend) checkResource(id string) error {
+	var err error
+	switch resourceType(id) {
+	case "instance":
+		_, err = b.findInstance(id)
+	case "security-group":
+		_, err = b.findSecurityGroup(id)
+	case "subnet":
+		_, err = b.findSubnet(id)
+	case "vpc":
+		_, err = b.findVpc(id)
+	default:
+		err = ec2Error("InvalidID", "The ID '%s' is not valid", id)
+	}
+	return err
+}
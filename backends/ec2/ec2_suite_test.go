@@ -0,0 +1,13 @@
+package ec2_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestEC2(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "EC2 Suite")
+}
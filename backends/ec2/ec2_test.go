@@ -0,0 +1,414 @@
+package ec2_test
+
+import (
+	"encoding/pem"
+	"net/http/httptest"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/rosenhouse/awsfaker"
+	fakeec2 "github.com/rosenhouse/awsfaker/backends/ec2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EC2 backend", func() {
+	var (
+		backend    *fakeec2.Backend
+		fakeServer *httptest.Server
+		client     *ec2.EC2
+	)
+
+	BeforeEach(func() {
+		backend = fakeec2.New()
+		fakeServer = httptest.NewServer(awsfaker.New(backend))
+		client = ec2.New(session.New(&aws.Config{
+			Credentials: credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""),
+			Region:      aws.String("us-east-1"),
+			Endpoint:    aws.String(fakeServer.URL),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	expectError := func(err error, code, message string) {
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal(code))
+		Expect(err.(awserr.RequestFailure).Message()).To(ContainSubstring(message))
+	}
+
+	createVpc := func(cidr string) string {
+		output, err := client.CreateVpc(&ec2.CreateVpcInput{CidrBlock: aws.String(cidr)})
+		Expect(err).NotTo(HaveOccurred())
+		return *output.Vpc.VpcId
+	}
+
+	createSubnet := func(vpcID, cidr string) string {
+		output, err := client.CreateSubnet(&ec2.CreateSubnetInput{VpcId: aws.String(vpcID), CidrBlock: aws.String(cidr)})
+		Expect(err).NotTo(HaveOccurred())
+		return *output.Subnet.SubnetId
+	}
+
+	tag := func(id, key, value string) {
+		_, err := client.CreateTags(&ec2.CreateTagsInput{
+			Resources: aws.StringSlice([]string{id}),
+			Tags:      []*ec2.Tag{{Key: aws.String(key), Value: aws.String(value)}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	filter := func(name string, values ...string) *ec2.Filter {
+		return &ec2.Filter{Name: aws.String(name), Values: aws.StringSlice(values)}
+	}
+
+	Describe("VPCs and subnets", func() {
+		It("should create them with realistic IDs", func() {
+			vpcID := createVpc("10.0.0.0/16")
+			Expect(vpcID).To(MatchRegexp(`^vpc-[0-9a-f]{17}$`))
+
+			output, err := client.CreateSubnet(&ec2.CreateSubnetInput{VpcId: aws.String(vpcID), CidrBlock: aws.String("10.0.1.0/24")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.Subnet.SubnetId).To(MatchRegexp(`^subnet-[0-9a-f]{17}$`))
+			Expect(output.Subnet.AvailabilityZone).To(Equal(aws.String("us-east-1a")))
+			Expect(output.Subnet.AvailableIpAddressCount).To(Equal(aws.Int64(251)))
+		})
+
+		It("should refuse CIDR blocks that are out of range or that overlap", func() {
+			_, err := client.CreateVpc(&ec2.CreateVpcInput{CidrBlock: aws.String("10.0.0.0/8")})
+			expectError(err, "InvalidVpc.Range", "The CIDR '10.0.0.0/8' is invalid.")
+
+			vpcID := createVpc("10.0.0.0/16")
+			createSubnet(vpcID, "10.0.1.0/24")
+
+			_, err = client.CreateSubnet(&ec2.CreateSubnetInput{VpcId: aws.String(vpcID), CidrBlock: aws.String("10.1.0.0/24")})
+			expectError(err, "InvalidSubnet.Range", "The CIDR '10.1.0.0/24' is invalid.")
+
+			_, err = client.CreateSubnet(&ec2.CreateSubnetInput{VpcId: aws.String(vpcID), CidrBlock: aws.String("10.0.1.128/25")})
+			expectError(err, "InvalidSubnet.Conflict", "conflicts with another subnet")
+		})
+
+		It("should refuse to delete a VPC that still has subnets", func() {
+			vpcID := createVpc("10.0.0.0/16")
+			subnetID := createSubnet(vpcID, "10.0.1.0/24")
+
+			_, err := client.DeleteVpc(&ec2.DeleteVpcInput{VpcId: aws.String(vpcID)})
+			expectError(err, "DependencyViolation", "has dependencies and cannot be deleted")
+
+			_, err = client.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: aws.String(subnetID)})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.DeleteVpc(&ec2.DeleteVpcInput{VpcId: aws.String(vpcID)})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: aws.StringSlice([]string{vpcID})})
+			expectError(err, "InvalidVpcID.NotFound", "The vpc ID '"+vpcID+"' does not exist")
+		})
+	})
+
+	Describe("filters", func() {
+		var productionVpc, stagingVpc string
+
+		BeforeEach(func() {
+			productionVpc = createVpc("10.0.0.0/16")
+			stagingVpc = createVpc("10.1.0.0/16")
+			tag(productionVpc, "Name", "production-vpc")
+			tag(productionVpc, "team", "web")
+			tag(stagingVpc, "Name", "staging-vpc")
+		})
+
+		describeVpcs := func(filters ...*ec2.Filter) []string {
+			output, err := client.DescribeVpcs(&ec2.DescribeVpcsInput{Filters: filters})
+			Expect(err).NotTo(HaveOccurred())
+			ids := []string{}
+			for _, vpc := range output.Vpcs {
+				ids = append(ids, *vpc.VpcId)
+			}
+			return ids
+		}
+
+		It("should match any of the values of a filter, with wildcards", func() {
+			Expect(describeVpcs(filter("tag:Name", "prod*"))).To(Equal([]string{productionVpc}))
+			Expect(describeVpcs(filter("tag:Name", "*-vpc"))).To(Equal([]string{productionVpc, stagingVpc}))
+			Expect(describeVpcs(filter("cidr", "10.?.0.0/16"))).To(HaveLen(2))
+			Expect(describeVpcs(filter("vpc-id", stagingVpc, "vpc-00000000000000000"))).To(Equal([]string{stagingVpc}))
+		})
+
+		It("should match all of the filters", func() {
+			Expect(describeVpcs(filter("tag-key", "team"), filter("cidr", "10.0.0.0/16"))).To(Equal([]string{productionVpc}))
+			Expect(describeVpcs(filter("tag-value", "web"), filter("cidr", "10.1.0.0/16"))).To(BeEmpty())
+		})
+
+		It("should refuse filters that it does not know", func() {
+			_, err := client.DescribeVpcs(&ec2.DescribeVpcsInput{Filters: []*ec2.Filter{filter("colour", "red")}})
+			expectError(err, "InvalidParameterValue", "The filter 'colour' is invalid")
+		})
+
+		It("should describe tags", func() {
+			output, err := client.DescribeTags(&ec2.DescribeTagsInput{Filters: []*ec2.Filter{filter("key", "Name")}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.Tags).To(HaveLen(2))
+			Expect(output.Tags[0]).To(Equal(&ec2.TagDescription{
+				ResourceId:   aws.String(productionVpc),
+				ResourceType: aws.String("vpc"),
+				Key:          aws.String("Name"),
+				Value:        aws.String("production-vpc"),
+			}))
+
+			_, err = client.DeleteTags(&ec2.DeleteTagsInput{
+				Resources: aws.StringSlice([]string{productionVpc}),
+				Tags:      []*ec2.Tag{{Key: aws.String("Name")}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(describeVpcs(filter("tag:Name", "*"))).To(Equal([]string{stagingVpc}))
+		})
+	})
+
+	Describe("security groups", func() {
+		var vpcID, groupID string
+
+		BeforeEach(func() {
+			vpcID = createVpc("10.0.0.0/16")
+			output, err := client.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
+				VpcId:       aws.String(vpcID),
+				GroupName:   aws.String("web"),
+				Description: aws.String("web servers"),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			groupID = *output.GroupId
+		})
+
+		ssh := &ec2.IpPermission{
+			IpProtocol: aws.String("tcp"),
+			FromPort:   aws.Int64(22),
+			ToPort:     aws.Int64(22),
+			IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("10.0.0.0/8")}},
+		}
+
+		describeGroup := func() *ec2.SecurityGroup {
+			output, err := client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{GroupIds: aws.StringSlice([]string{groupID})})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.SecurityGroups).To(HaveLen(1))
+			return output.SecurityGroups[0]
+		}
+
+		It("should create a default group with each VPC, and allow all outbound traffic", func() {
+			output, err := client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+				Filters: []*ec2.Filter{filter("vpc-id", vpcID), filter("group-name", "default")},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.SecurityGroups).To(HaveLen(1))
+
+			Expect(describeGroup().IpPermissionsEgress).To(Equal([]*ec2.IpPermission{{
+				IpProtocol: aws.String("-1"),
+				IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+			}}))
+		})
+
+		It("should add and remove rules", func() {
+			_, err := client.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+				GroupId:       aws.String(groupID),
+				IpPermissions: []*ec2.IpPermission{ssh},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(describeGroup().IpPermissions).To(Equal([]*ec2.IpPermission{ssh}))
+
+			_, err = client.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+				GroupId:       aws.String(groupID),
+				IpPermissions: []*ec2.IpPermission{ssh},
+			})
+			expectError(err, "InvalidPermission.Duplicate", `"peer: 10.0.0.0/8, TCP, from port: 22, to port: 22, ALLOW" already exists`)
+
+			output, err := client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+				Filters: []*ec2.Filter{filter("ip-permission.from-port", "22")},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.SecurityGroups).To(HaveLen(1))
+
+			_, err = client.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       aws.String(groupID),
+				IpPermissions: []*ec2.IpPermission{ssh},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(describeGroup().IpPermissions).To(BeEmpty())
+
+			_, err = client.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       aws.String(groupID),
+				IpPermissions: []*ec2.IpPermission{ssh},
+			})
+			expectError(err, "InvalidPermission.NotFound", "The specified rule does not exist")
+		})
+
+		It("should refuse duplicate names and deletion of the default group", func() {
+			_, err := client.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
+				VpcId:       aws.String(vpcID),
+				GroupName:   aws.String("web"),
+				Description: aws.String("web servers"),
+			})
+			expectError(err, "InvalidGroup.Duplicate", "The security group 'web' already exists for VPC '"+vpcID+"'")
+
+			_, err = client.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupName: aws.String("default")})
+			expectError(err, "CannotDelete", `name: "default" cannot be deleted by a user`)
+		})
+	})
+
+	Describe("key pairs", func() {
+		It("should generate a private key", func() {
+			output, err := client.CreateKeyPair(&ec2.CreateKeyPairInput{KeyName: aws.String("some-key")})
+			Expect(err).NotTo(HaveOccurred())
+			block, _ := pem.Decode([]byte(*output.KeyMaterial))
+			Expect(block).NotTo(BeNil())
+			Expect(block.Type).To(Equal("RSA PRIVATE KEY"))
+			Expect(*output.KeyFingerprint).To(MatchRegexp(`^([0-9a-f]{2}:){19}[0-9a-f]{2}$`))
+
+			_, err = client.CreateKeyPair(&ec2.CreateKeyPairInput{KeyName: aws.String("some-key")})
+			expectError(err, "InvalidKeyPair.Duplicate", "The keypair 'some-key' already exists.")
+
+			described, err := client.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{Filters: []*ec2.Filter{filter("key-name", "some-*")}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(described.KeyPairs).To(Equal([]*ec2.KeyPairInfo{{KeyName: aws.String("some-key"), KeyFingerprint: output.KeyFingerprint}}))
+
+			_, err = client.DeleteKeyPair(&ec2.DeleteKeyPairInput{KeyName: aws.String("some-key")})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{KeyNames: aws.StringSlice([]string{"some-key"})})
+			expectError(err, "InvalidKeyPair.NotFound", "The key pair 'some-key' does not exist")
+		})
+
+		It("should import a public key", func() {
+			output, err := client.ImportKeyPair(&ec2.ImportKeyPairInput{
+				KeyName:           aws.String("imported-key"),
+				PublicKeyMaterial: []byte("ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQ some-comment"),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.KeyFingerprint).To(MatchRegexp(`^([0-9a-f]{2}:){15}[0-9a-f]{2}$`))
+		})
+	})
+
+	Describe("instances", func() {
+		var subnetID string
+
+		BeforeEach(func() {
+			subnetID = createSubnet(createVpc("10.0.0.0/16"), "10.0.1.0/24")
+		})
+
+		runInstances := func(count int64) *ec2.Reservation {
+			reservation, err := client.RunInstances(&ec2.RunInstancesInput{
+				ImageId:      aws.String("ami-12345678"),
+				InstanceType: aws.String("t2.micro"),
+				MinCount:     aws.Int64(1),
+				MaxCount:     aws.Int64(count),
+				SubnetId:     aws.String(subnetID),
+				TagSpecifications: []*ec2.TagSpecification{{
+					ResourceType: aws.String("instance"),
+					Tags:         []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("web")}},
+				}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return reservation
+		}
+
+		describeStates := func(filters ...*ec2.Filter) []string {
+			output, err := client.DescribeInstances(&ec2.DescribeInstancesInput{Filters: filters})
+			Expect(err).NotTo(HaveOccurred())
+			states := []string{}
+			for _, reservation := range output.Reservations {
+				for _, instance := range reservation.Instances {
+					states = append(states, *instance.State.Name)
+				}
+			}
+			return states
+		}
+
+		It("should launch instances into the subnet", func() {
+			reservation := runInstances(2)
+			Expect(*reservation.ReservationId).To(MatchRegexp(`^r-[0-9a-f]{17}$`))
+			Expect(reservation.Instances).To(HaveLen(2))
+
+			instance := reservation.Instances[0]
+			Expect(*instance.InstanceId).To(MatchRegexp(`^i-[0-9a-f]{17}$`))
+			Expect(instance.State.Name).To(Equal(aws.String("pending")))
+			Expect(instance.PrivateIpAddress).To(Equal(aws.String("10.0.1.4")))
+			Expect(reservation.Instances[1].PrivateIpAddress).To(Equal(aws.String("10.0.1.5")))
+			Expect(instance.SecurityGroups).To(HaveLen(1))
+			Expect(instance.SecurityGroups[0].GroupName).To(Equal(aws.String("default")))
+			Expect(instance.Tags).To(Equal([]*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("web")}}))
+
+			Expect(describeStates(filter("tag:Name", "web"), filter("subnet-id", subnetID))).To(Equal([]string{"running", "running"}))
+		})
+
+		It("should move instances through the states of their lifecycle", func() {
+			backend.TransitionDelay = time.Hour
+			instanceID := runInstances(1).Instances[0].InstanceId
+			Expect(describeStates()).To(Equal([]string{"pending"}))
+			backend.Settle()
+			Expect(describeStates(filter("instance-state-name", "running"))).To(HaveLen(1))
+
+			stopped, err := client.StopInstances(&ec2.StopInstancesInput{InstanceIds: []*string{instanceID}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stopped.StoppingInstances[0].CurrentState.Name).To(Equal(aws.String("stopping")))
+			backend.Settle()
+
+			_, err = client.TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: []*string{instanceID}})
+			Expect(err).NotTo(HaveOccurred())
+			backend.Settle()
+			Expect(describeStates(filter("instance-state-code", "48"))).To(Equal([]string{"terminated"}))
+
+			_, err = client.StartInstances(&ec2.StartInstancesInput{InstanceIds: []*string{instanceID}})
+			expectError(err, "IncorrectInstanceState", "is not in a state from which it can be started")
+		})
+
+		It("should refuse to delete a subnet with instances", func() {
+			instanceID := runInstances(1).Instances[0].InstanceId
+
+			_, err := client.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: aws.String(subnetID)})
+			expectError(err, "DependencyViolation", "has dependencies and cannot be deleted")
+
+			_, err = client.TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: []*string{instanceID}})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: aws.String(subnetID)})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should refuse unknown key pairs, groups and instances", func() {
+			_, err := client.RunInstances(&ec2.RunInstancesInput{
+				ImageId:  aws.String("ami-12345678"),
+				MinCount: aws.Int64(1),
+				MaxCount: aws.Int64(1),
+				SubnetId: aws.String(subnetID),
+				KeyName:  aws.String("missing-key"),
+			})
+			expectError(err, "InvalidKeyPair.NotFound", "The key pair 'missing-key' does not exist")
+
+			_, err = client.RunInstances(&ec2.RunInstancesInput{
+				ImageId:          aws.String("ami-12345678"),
+				MinCount:         aws.Int64(1),
+				MaxCount:         aws.Int64(1),
+				SubnetId:         aws.String(subnetID),
+				SecurityGroupIds: aws.StringSlice([]string{"sg-00000000000000000"}),
+			})
+			expectError(err, "InvalidGroup.NotFound", "The security group 'sg-00000000000000000' does not exist")
+
+			_, err = client.DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: aws.StringSlice([]string{"i-00000000000000000"})})
+			expectError(err, "InvalidInstanceID.NotFound", "The instance ID 'i-00000000000000000' does not exist")
+		})
+
+		It("should refuse requests with the DryRun flag", func() {
+			_, err := client.RunInstances(&ec2.RunInstancesInput{
+				DryRun:   aws.Bool(true),
+				ImageId:  aws.String("ami-12345678"),
+				MinCount: aws.Int64(1),
+				MaxCount: aws.Int64(1),
+				SubnetId: aws.String(subnetID),
+			})
+			expectError(err, "DryRunOperation", "Request would have succeeded")
+			Expect(describeStates()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,105 @@
+package ec2
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// A filterValues function returns the values of a resource for a filter
+// name, or false if the resource type has no filter of that name
+type filterValues func(name string) ([]string, bool)
+
+// matchesFilters reports whether a resource, with the given tags, matches
+// all of the filters
+func matchesFilters(filters []*ec2.Filter, tags map[string]string, values filterValues) (bool, error) {
+	for _, filter := range filters {
+		name := aws.StringValue(filter.Name)
+		actual, err := valuesFor(name, tags, values)
+		if err != nil {
+			return false, err
+		}
+		if !anyMatches(aws.StringValueSlice(filter.Values), actual) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func valuesFor(name string, tags map[string]string, values filterValues) ([]string, error) {
+	switch {
+	case strings.HasPrefix(name, "tag:"):
+		if value, ok := tags[strings.TrimPrefix(name, "tag:")]; ok {
+			return []string{value}, nil
+		}
+		return nil, nil
+	case name == "tag-key":
+		return sortedKeys(tags), nil
+	case name == "tag-value":
+		var all []string
+		for _, key := range sortedKeys(tags) {
+			all = append(all, tags[key])
+		}
+		return all, nil
+	}
+	actual, ok := values(name)
+	if !ok {
+		return nil, ec2Error("InvalidParameterValue", "The filter '%s' is invalid", name)
+	}
+	return actual, nil
+}
+
+func anyMatches(patterns, actual []string) bool {
+	for _, pattern := range patterns {
+		wildcard := wildcardPattern(pattern)
+		for _, value := range actual {
+			if wildcard.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wildcardPattern compiles a filter value, where * matches any characters,
+// ? matches a single character, and a backslash escapes the next character
+func wildcardPattern(value string) *regexp.Regexp {
+	var pattern []string
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			pattern = append(pattern, regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			pattern = append(pattern, ".*")
+		case r == '?':
+			pattern = append(pattern, ".")
+		default:
+			pattern = append(pattern, regexp.QuoteMeta(string(r)))
+		}
+	}
+	return regexp.MustCompile("(?s)^" + strings.Join(pattern, "") + "$")
+}
+
+// boolValue formats a boolean as filter values do
+func boolValue(b *bool) []string {
+	if aws.BoolValue(b) {
+		return []string{"true"}
+	}
+	return []string{"false"}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,470 @@
+package ec2
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+var stateCodes = map[string]int64{
+	ec2.InstanceStateNamePending:      0,
+	ec2.InstanceStateNameRunning:      16,
+	ec2.InstanceStateNameShuttingDown: 32,
+	ec2.InstanceStateNameTerminated:   48,
+	ec2.InstanceStateNameStopping:     64,
+	ec2.InstanceStateNameStopped:      80,
+}
+
+func instanceState(name string) *ec2.InstanceState {
+	return &ec2.InstanceState{Name: aws.String(name), Code: aws.Int64(stateCodes[name])}
+}
+
+type instance struct {
+	*ec2.Instance
+	reservationID string
+	clientToken   string
+
+	// next is the state that the instance is on its way to, if any
+	next *transition
+}
+
+type transition struct {
+	state string
+	at    time.Time
+}
+
+func (i *instance) settle(now time.Time) {
+	if i.next != nil && !i.next.at.After(now) {
+		i.State = instanceState(i.next.state)
+		i.next = nil
+	}
+}
+
+func (i *instance) complete() {
+	if i.next != nil {
+		i.settle(i.next.at)
+	}
+}
+
+// change moves the instance to an intermediate state now, and on to the
+// final state after the delay
+func (i *instance) change(intermediate, final string, now time.Time, delay time.Duration) *ec2.InstanceStateChange {
+	change := &ec2.InstanceStateChange{
+		InstanceId:    i.InstanceId,
+		PreviousState: i.State,
+		CurrentState:  instanceState(intermediate),
+	}
+	i.State = change.CurrentState
+	i.next = &transition{state: final, at: now.Add(delay)}
+	return change
+}
+
+func (i *instance) unchanged() *ec2.InstanceStateChange {
+	return &ec2.InstanceStateChange{InstanceId: i.InstanceId, PreviousState: i.State, CurrentState: i.State}
+}
+
+func (i *instance) inGroup(groupID string) bool {
+	for _, g := range i.SecurityGroups {
+		if *g.GroupId == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *instance) terminated() bool {
+	return *i.State.Name == ec2.InstanceStateNameTerminated
+}
+
+func (b *Backend) findInstance(id string) (*instance, error) {
+	for _, i := range b.instances {
+		if *i.InstanceId == id {
+			return i, nil
+		}
+	}
+	return nil, ec2Error("InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", id)
+}
+
+// instancesIn returns the instances in a subnet that are not terminated
+func (b *Backend) instancesIn(subnetID string) []*instance {
+	var result []*instance
+	for _, i := range b.instances {
+		if *i.SubnetId == subnetID && !i.terminated() {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+func (b *Backend) describeInstance(i *instance) *ec2.Instance {
+	description := *i.Instance
+	description.Tags = b.tagsOf(*i.InstanceId)
+	return &description
+}
+
+// reservations groups instances by the RunInstances call that launched them
+func (b *Backend) reservations(instances []*instance) []*ec2.Reservation {
+	result := []*ec2.Reservation{}
+	byID := map[string]*ec2.Reservation{}
+	for _, i := range instances {
+		reservation, ok := byID[i.reservationID]
+		if !ok {
+			reservation = &ec2.Reservation{
+				ReservationId: aws.String(i.reservationID),
+				OwnerId:       aws.String(b.AccountID),
+			}
+			byID[i.reservationID] = reservation
+			result = append(result, reservation)
+		}
+		reservation.Instances = append(reservation.Instances, b.describeInstance(i))
+	}
+	return result
+}
+
+func (b *Backend) privateDNSName(ip string) string {
+	host := "ip-" + strings.Replace(ip, ".", "-", -1)
+	if b.Region == "us-east-1" {
+		return host + ".ec2.internal"
+	}
+	return host + "." + b.Region + ".compute.internal"
+}
+
+// launchGroups returns the security groups for instances in a subnet, by ID
+// or by name, defaulting to the default group of the VPC
+func (b *Backend) launchGroups(s *subnet, ids, names []*string) ([]*ec2.GroupIdentifier, error) {
+	var groups []*securityGroup
+	for _, id := range aws.StringValueSlice(ids) {
+		g, err := b.findSecurityGroup(id)
+		if err != nil {
+			return nil, err
+		}
+		if *g.VpcId != *s.VpcId {
+			return nil, ec2Error("InvalidParameter", "Security group %s and subnet %s belong to different networks.", id, *s.SubnetId)
+		}
+		groups = append(groups, g)
+	}
+	for _, name := range aws.StringValueSlice(names) {
+		found := false
+		for _, g := range b.securityGroups {
+			if *g.VpcId == *s.VpcId && *g.GroupName == name {
+				groups = append(groups, g)
+				found = true
+			}
+		}
+		if !found {
+			return nil, ec2Error("InvalidGroup.NotFound", "The security group '%s' does not exist in VPC '%s'", name, *s.VpcId)
+		}
+	}
+	if len(groups) == 0 {
+		for _, g := range b.securityGroups {
+			if *g.VpcId == *s.VpcId && *g.GroupName == "default" {
+				groups = append(groups, g)
+			}
+		}
+	}
+
+	identifiers := make([]*ec2.GroupIdentifier, len(groups))
+	for n, g := range groups {
+		identifiers[n] = &ec2.GroupIdentifier{GroupId: g.GroupId, GroupName: g.GroupName}
+	}
+	return identifiers, nil
+}
+
+// RunInstances launches instances into a subnet.  They are pending until
+// the TransitionDelay has passed, and then running.
+func (b *Backend) RunInstances(input *ec2.RunInstancesInput) (*ec2.Reservation, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	if token := aws.StringValue(input.ClientToken); token != "" {
+		var launched []*instance
+		for _, i := range b.instances {
+			if i.clientToken == token {
+				launched = append(launched, i)
+			}
+		}
+		if len(launched) > 0 {
+			return b.reservations(launched)[0], nil
+		}
+	}
+
+	imageID := aws.StringValue(input.ImageId)
+	if imageID == "" {
+		return nil, ec2Error("MissingParameter", "The request must contain the parameter ImageId")
+	}
+	if !strings.HasPrefix(imageID, "ami-") {
+		return nil, ec2Error("InvalidAMIID.Malformed", "Invalid id: \"%s\" (expecting \"ami-...\")", imageID)
+	}
+	minCount, maxCount := aws.Int64Value(input.MinCount), aws.Int64Value(input.MaxCount)
+	if minCount < 1 {
+		return nil, ec2Error("InvalidParameterValue", "Invalid value '%d' for minCount. Must be greater than 0.", minCount)
+	}
+	if minCount > maxCount {
+		return nil, ec2Error("InvalidParameterValue", "Invalid value '%d' for minCount. Must be less than or equal to maxCount.", minCount)
+	}
+	if input.SubnetId == nil {
+		return nil, ec2Error("VPCIdNotSpecified", "No default VPC for this user")
+	}
+	s, err := b.findSubnet(*input.SubnetId)
+	if err != nil {
+		return nil, err
+	}
+	if input.KeyName != nil {
+		if _, err := b.findKeyPair(*input.KeyName); err != nil {
+			return nil, err
+		}
+	}
+	groups, err := b.launchGroups(s, input.SecurityGroupIds, input.SecurityGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	count := maxCount
+	if free := s.size() - int64(len(b.instancesIn(*s.SubnetId))); free < count {
+		if free < minCount {
+			return nil, ec2Error("InsufficientFreeAddressesInSubnet", "There are not enough free addresses in subnet '%s' to satisfy the requested number of instances.", *s.SubnetId)
+		}
+		count = free
+	}
+	if input.PrivateIpAddress != nil {
+		if err := b.checkPrivateAddress(s, *input.PrivateIpAddress, count); err != nil {
+			return nil, err
+		}
+	}
+	instanceType := aws.StringValue(input.InstanceType)
+	if instanceType == "" {
+		instanceType = ec2.InstanceTypeM1Small
+	}
+
+	reservationID := newID("r")
+	now := time.Now()
+	var launched []*instance
+	for n := int64(0); n < count; n++ {
+		address := aws.StringValue(input.PrivateIpAddress)
+		if address == "" {
+			address = s.assignAddress()
+		}
+		i := &instance{
+			Instance: &ec2.Instance{
+				InstanceId:         aws.String(newID("i")),
+				ImageId:            aws.String(imageID),
+				InstanceType:       aws.String(instanceType),
+				KeyName:            input.KeyName,
+				LaunchTime:         aws.Time(now),
+				AmiLaunchIndex:     aws.Int64(n),
+				Placement:          &ec2.Placement{AvailabilityZone: s.AvailabilityZone, Tenancy: aws.String(ec2.TenancyDefault)},
+				SubnetId:           s.SubnetId,
+				VpcId:              s.VpcId,
+				PrivateIpAddress:   aws.String(address),
+				PrivateDnsName:     aws.String(b.privateDNSName(address)),
+				SecurityGroups:     groups,
+				Architecture:       aws.String(ec2.ArchitectureValuesX8664),
+				Hypervisor:         aws.String(ec2.HypervisorTypeXen),
+				RootDeviceType:     aws.String(ec2.DeviceTypeEbs),
+				VirtualizationType: aws.String(ec2.VirtualizationTypeHvm),
+				Monitoring:         &ec2.Monitoring{State: aws.String(ec2.MonitoringStateDisabled)},
+				State:              instanceState(ec2.InstanceStateNamePending),
+			},
+			reservationID: reservationID,
+			clientToken:   aws.StringValue(input.ClientToken),
+			next:          &transition{state: ec2.InstanceStateNameRunning, at: now.Add(b.TransitionDelay)},
+		}
+		for _, specification := range input.TagSpecifications {
+			if aws.StringValue(specification.ResourceType) == ec2.ResourceTypeInstance {
+				b.tag(*i.InstanceId, specification.Tags)
+			}
+		}
+		b.instances = append(b.instances, i)
+		launched = append(launched, i)
+	}
+	return b.reservations(launched)[0], nil
+}
+
+// checkPrivateAddress checks an address requested for a single instance
+func (b *Backend) checkPrivateAddress(s *subnet, address string, count int64) error {
+	ip := net.ParseIP(address)
+	if ip == nil || !s.network.Contains(ip) {
+		return ec2Error("InvalidParameterValue", "Address %s does not fall within the subnet's address range", address)
+	}
+	if count > 1 {
+		return ec2Error("InvalidParameterCombination", "Network interfaces and an instance-level private IP address should not be specified on the same request")
+	}
+	for _, i := range b.instancesIn(*s.SubnetId) {
+		if *i.PrivateIpAddress == address {
+			return ec2Error("InvalidIPAddress.InUse", "Address %s is in use.", address)
+		}
+	}
+	return nil
+}
+
+func (b *Backend) changeInstances(ids []*string, change func(*instance, time.Time) (*ec2.InstanceStateChange, error)) ([]*ec2.InstanceStateChange, error) {
+	b.settle()
+	var instances []*instance
+	for _, id := range aws.StringValueSlice(ids) {
+		i, err := b.findInstance(id)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, i)
+	}
+
+	now := time.Now()
+	changes := []*ec2.InstanceStateChange{}
+	for _, i := range instances {
+		stateChange, err := change(i, now)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, stateChange)
+	}
+	return changes, nil
+}
+
+// StopInstances stops running instances
+func (b *Backend) StopInstances(input *ec2.StopInstancesInput) (*ec2.StopInstancesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	changes, err := b.changeInstances(input.InstanceIds, func(i *instance, now time.Time) (*ec2.InstanceStateChange, error) {
+		switch *i.State.Name {
+		case ec2.InstanceStateNameRunning:
+			return i.change(ec2.InstanceStateNameStopping, ec2.InstanceStateNameStopped, now, b.TransitionDelay), nil
+		case ec2.InstanceStateNameStopping, ec2.InstanceStateNameStopped:
+			return i.unchanged(), nil
+		}
+		return nil, ec2Error("IncorrectInstanceState", "This instance '%s' is not in a state from which it can be stopped.", *i.InstanceId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ec2.StopInstancesOutput{StoppingInstances: changes}, nil
+}
+
+// StartInstances starts stopped instances
+func (b *Backend) StartInstances(input *ec2.StartInstancesInput) (*ec2.StartInstancesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	changes, err := b.changeInstances(input.InstanceIds, func(i *instance, now time.Time) (*ec2.InstanceStateChange, error) {
+		switch *i.State.Name {
+		case ec2.InstanceStateNameStopped:
+			return i.change(ec2.InstanceStateNamePending, ec2.InstanceStateNameRunning, now, b.TransitionDelay), nil
+		case ec2.InstanceStateNamePending, ec2.InstanceStateNameRunning:
+			return i.unchanged(), nil
+		}
+		return nil, ec2Error("IncorrectInstanceState", "The instance '%s' is not in a state from which it can be started.", *i.InstanceId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ec2.StartInstancesOutput{StartingInstances: changes}, nil
+}
+
+// TerminateInstances terminates instances.  Terminated instances are still
+// described, as by the real service for a while.
+func (b *Backend) TerminateInstances(input *ec2.TerminateInstancesInput) (*ec2.TerminateInstancesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	changes, err := b.changeInstances(input.InstanceIds, func(i *instance, now time.Time) (*ec2.InstanceStateChange, error) {
+		switch *i.State.Name {
+		case ec2.InstanceStateNameShuttingDown, ec2.InstanceStateNameTerminated:
+			return i.unchanged(), nil
+		}
+		return i.change(ec2.InstanceStateNameShuttingDown, ec2.InstanceStateNameTerminated, now, b.TransitionDelay), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ec2.TerminateInstancesOutput{TerminatingInstances: changes}, nil
+}
+
+// DescribeInstances describes instances, by ID or by the filters
+// availability-zone, image-id, instance-id, instance-state-code,
+// instance-state-name, instance-type, instance.group-id,
+// instance.group-name, key-name, owner-id, private-dns-name,
+// private-ip-address, reservation-id, subnet-id and vpc-id
+func (b *Backend) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+
+	for _, id := range aws.StringValueSlice(input.InstanceIds) {
+		if _, err := b.findInstance(id); err != nil {
+			return nil, err
+		}
+	}
+	var matching []*instance
+	for _, i := range b.instances {
+		if input.InstanceIds != nil && !contains(aws.StringValueSlice(input.InstanceIds), *i.InstanceId) {
+			continue
+		}
+		ok, err := matchesFilters(input.Filters, b.tags[*i.InstanceId], func(name string) ([]string, bool) {
+			switch name {
+			case "availability-zone":
+				return []string{*i.Placement.AvailabilityZone}, true
+			case "image-id":
+				return []string{*i.ImageId}, true
+			case "instance-id":
+				return []string{*i.InstanceId}, true
+			case "instance-state-code":
+				return []string{fmt.Sprint(*i.State.Code)}, true
+			case "instance-state-name":
+				return []string{*i.State.Name}, true
+			case "instance-type":
+				return []string{*i.InstanceType}, true
+			case "instance.group-id", "group-id":
+				var ids []string
+				for _, g := range i.SecurityGroups {
+					ids = append(ids, *g.GroupId)
+				}
+				return ids, true
+			case "instance.group-name", "group-name":
+				var names []string
+				for _, g := range i.SecurityGroups {
+					names = append(names, *g.GroupName)
+				}
+				return names, true
+			case "key-name":
+				return aws.StringValueSlice([]*string{i.KeyName}), true
+			case "owner-id":
+				return []string{b.AccountID}, true
+			case "private-dns-name":
+				return []string{*i.PrivateDnsName}, true
+			case "private-ip-address":
+				return []string{*i.PrivateIpAddress}, true
+			case "reservation-id":
+				return []string{i.reservationID}, true
+			case "subnet-id":
+				return []string{*i.SubnetId}, true
+			case "vpc-id":
+				return []string{*i.VpcId}, true
+			}
+			return nil, false
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matching = append(matching, i)
+		}
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: b.reservations(matching)}, nil
+}
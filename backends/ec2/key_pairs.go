@@ -0,0 +1,181 @@
+package ec2
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+type keyPair struct {
+	name, fingerprint string
+}
+
+func (k *keyPair) describe() *ec2.KeyPairInfo {
+	return &ec2.KeyPairInfo{
+		KeyName:        aws.String(k.name),
+		KeyFingerprint: aws.String(k.fingerprint),
+	}
+}
+
+// pkcs8Key is the PKCS #8 encoding of a private key, whose digest is the
+// fingerprint of a generated key pair
+type pkcs8Key struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+var oidRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+
+// fingerprint formats a digest as colon-separated hex, like the real service
+func fingerprint(digest []byte) string {
+	parts := make([]string, len(digest))
+	for i, b := range digest {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func (b *Backend) findKeyPair(name string) (*keyPair, error) {
+	for _, k := range b.keyPairs {
+		if k.name == name {
+			return k, nil
+		}
+	}
+	return nil, ec2Error("InvalidKeyPair.NotFound", "The key pair '%s' does not exist", name)
+}
+
+func (b *Backend) addKeyPair(name, fingerprint string) (*keyPair, error) {
+	if _, err := b.findKeyPair(name); err == nil {
+		return nil, ec2Error("InvalidKeyPair.Duplicate", "The keypair '%s' already exists.", name)
+	}
+	k := &keyPair{name: name, fingerprint: fingerprint}
+	b.keyPairs = append(b.keyPairs, k)
+	return k, nil
+}
+
+// CreateKeyPair generates an RSA key pair, and returns the private key in
+// PEM format.  The fingerprint is the SHA-1 digest of the private key, as
+// for key pairs created by the real service.
+func (b *Backend) CreateKeyPair(input *ec2.CreateKeyPairInput) (*ec2.CreateKeyPairOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(input.KeyName)
+	if _, err := b.findKeyPair(name); err == nil {
+		return nil, ec2Error("InvalidKeyPair.Duplicate", "The keypair '%s' already exists.", name)
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	pkcs1 := x509.MarshalPKCS1PrivateKey(privateKey)
+	pkcs8, err := asn1.Marshal(pkcs8Key{
+		Algorithm:  pkix.AlgorithmIdentifier{Algorithm: oidRSA, Parameters: asn1.RawValue{Tag: 5}}, // NULL
+		PrivateKey: pkcs1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	digest := sha1.Sum(pkcs8)
+
+	k, err := b.addKeyPair(name, fingerprint(digest[:]))
+	if err != nil {
+		return nil, err
+	}
+	material := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: pkcs1})
+	return &ec2.CreateKeyPairOutput{
+		KeyName:        aws.String(k.name),
+		KeyFingerprint: aws.String(k.fingerprint),
+		KeyMaterial:    aws.String(string(material)),
+	}, nil
+}
+
+// ImportKeyPair registers an OpenSSH public key
+func (b *Backend) ImportKeyPair(input *ec2.ImportKeyPairInput) (*ec2.ImportKeyPairOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(string(input.PublicKeyMaterial), "ssh-") {
+		return nil, ec2Error("InvalidKey.Format", "Key is not in valid OpenSSH public key format")
+	}
+	digest := md5.Sum(input.PublicKeyMaterial)
+	k, err := b.addKeyPair(aws.StringValue(input.KeyName), fingerprint(digest[:]))
+	if err != nil {
+		return nil, err
+	}
+	return &ec2.ImportKeyPairOutput{
+		KeyName:        aws.String(k.name),
+		KeyFingerprint: aws.String(k.fingerprint),
+	}, nil
+}
+
+// DeleteKeyPair deletes a key pair.  Like the real service, it succeeds when
+// there is no such key pair.
+func (b *Backend) DeleteKeyPair(input *ec2.DeleteKeyPairInput) (*ec2.DeleteKeyPairOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	var keyPairs []*keyPair
+	for _, k := range b.keyPairs {
+		if k.name != aws.StringValue(input.KeyName) {
+			keyPairs = append(keyPairs, k)
+		}
+	}
+	b.keyPairs = keyPairs
+	return &ec2.DeleteKeyPairOutput{}, nil
+}
+
+// DescribeKeyPairs describes key pairs, by name or by the filters
+// fingerprint and key-name
+func (b *Backend) DescribeKeyPairs(input *ec2.DescribeKeyPairsInput) (*ec2.DescribeKeyPairsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, name := range aws.StringValueSlice(input.KeyNames) {
+		if _, err := b.findKeyPair(name); err != nil {
+			return nil, err
+		}
+	}
+	output := &ec2.DescribeKeyPairsOutput{KeyPairs: []*ec2.KeyPairInfo{}}
+	for _, k := range b.keyPairs {
+		if input.KeyNames != nil && !contains(aws.StringValueSlice(input.KeyNames), k.name) {
+			continue
+		}
+		ok, err := matchesFilters(input.Filters, nil, func(name string) ([]string, bool) {
+			switch name {
+			case "fingerprint":
+				return []string{k.fingerprint}, true
+			case "key-name":
+				return []string{k.name}, true
+			}
+			return nil, false
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			output.KeyPairs = append(output.KeyPairs, k.describe())
+		}
+	}
+	return output, nil
+}
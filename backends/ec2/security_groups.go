@@ -0,0 +1,446 @@
+package ec2
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+type securityGroup struct {
+	*ec2.SecurityGroup
+	ingress, egress []rule
+}
+
+// A rule allows traffic of a protocol and port range from or to a single
+// CIDR block or security group
+type rule struct {
+	protocol         string
+	fromPort, toPort int64
+	cidr, groupID    string
+}
+
+func (r rule) peer() string {
+	if r.cidr != "" {
+		return r.cidr
+	}
+	return r.groupID
+}
+
+func (r rule) String() string {
+	if r.protocol == "-1" {
+		return fmt.Sprintf("peer: %s, ALL, ALLOW", r.peer())
+	}
+	return fmt.Sprintf("peer: %s, %s, from port: %d, to port: %d, ALLOW", r.peer(), strings.ToUpper(r.protocol), r.fromPort, r.toPort)
+}
+
+var allTraffic = rule{protocol: "-1", cidr: "0.0.0.0/0"}
+
+func (b *Backend) newSecurityGroup(vpcID, name, description string) *securityGroup {
+	return &securityGroup{
+		SecurityGroup: &ec2.SecurityGroup{
+			GroupId:     aws.String(newID("sg")),
+			GroupName:   aws.String(name),
+			Description: aws.String(description),
+			VpcId:       aws.String(vpcID),
+			OwnerId:     aws.String(b.AccountID),
+		},
+		egress: []rule{allTraffic},
+	}
+}
+
+func (b *Backend) findSecurityGroup(id string) (*securityGroup, error) {
+	for _, g := range b.securityGroups {
+		if *g.GroupId == id {
+			return g, nil
+		}
+	}
+	return nil, ec2Error("InvalidGroup.NotFound", "The security group '%s' does not exist", id)
+}
+
+// findSecurityGroupByIDOrName looks up a group by ID if one is given, and
+// otherwise by name
+func (b *Backend) findSecurityGroupByIDOrName(id, name *string) (*securityGroup, error) {
+	if id != nil {
+		return b.findSecurityGroup(*id)
+	}
+	for _, g := range b.securityGroups {
+		if *g.GroupName == aws.StringValue(name) {
+			return g, nil
+		}
+	}
+	return nil, ec2Error("InvalidGroup.NotFound", "The security group '%s' does not exist", aws.StringValue(name))
+}
+
+func (b *Backend) describeSecurityGroup(g *securityGroup) *ec2.SecurityGroup {
+	description := *g.SecurityGroup
+	description.IpPermissions = permissions(g.ingress, b.AccountID)
+	description.IpPermissionsEgress = permissions(g.egress, b.AccountID)
+	description.Tags = b.tagsOf(*g.GroupId)
+	return &description
+}
+
+// permissions combines the rules with the same protocol and ports, in the
+// order they were added
+func permissions(rules []rule, accountID string) []*ec2.IpPermission {
+	var result []*ec2.IpPermission
+	byPorts := map[rule]*ec2.IpPermission{}
+	for _, r := range rules {
+		key := rule{protocol: r.protocol, fromPort: r.fromPort, toPort: r.toPort}
+		permission, ok := byPorts[key]
+		if !ok {
+			permission = &ec2.IpPermission{IpProtocol: aws.String(r.protocol)}
+			if r.protocol != "-1" {
+				permission.FromPort = aws.Int64(r.fromPort)
+				permission.ToPort = aws.Int64(r.toPort)
+			}
+			byPorts[key] = permission
+			result = append(result, permission)
+		}
+		if r.cidr != "" {
+			permission.IpRanges = append(permission.IpRanges, &ec2.IpRange{CidrIp: aws.String(r.cidr)})
+		} else {
+			permission.UserIdGroupPairs = append(permission.UserIdGroupPairs, &ec2.UserIdGroupPair{
+				GroupId: aws.String(r.groupID),
+				UserId:  aws.String(accountID),
+			})
+		}
+	}
+	return result
+}
+
+var protocolNames = map[string]string{"6": "tcp", "17": "udp", "1": "icmp", "all": "-1"}
+
+// rules splits permissions into a rule for each peer
+func (b *Backend) rules(permissions []*ec2.IpPermission) ([]rule, error) {
+	var result []rule
+	for _, p := range permissions {
+		protocol := strings.ToLower(aws.StringValue(p.IpProtocol))
+		if name, ok := protocolNames[protocol]; ok {
+			protocol = name
+		}
+		r := rule{protocol: protocol}
+		switch protocol {
+		case "-1":
+		case "tcp", "udp", "icmp":
+			if p.FromPort == nil || p.ToPort == nil {
+				return nil, ec2Error("InvalidParameterValue", "Invalid value 'Must specify both from and to ports with TCP/UDP/ICMP.' for portRange")
+			}
+			r.fromPort, r.toPort = *p.FromPort, *p.ToPort
+		default:
+			return nil, ec2Error("InvalidParameterValue", "Invalid value '%s' for IP protocol. Unknown protocol.", protocol)
+		}
+
+		for _, ipRange := range p.IpRanges {
+			cidr := aws.StringValue(ipRange.CidrIp)
+			if _, _, err := parseCIDR(cidr, "cidrIp"); err != nil {
+				return nil, err
+			}
+			peer := r
+			peer.cidr = cidr
+			result = append(result, peer)
+		}
+		for _, pair := range p.UserIdGroupPairs {
+			source, err := b.findSecurityGroupByIDOrName(pair.GroupId, pair.GroupName)
+			if err != nil {
+				return nil, err
+			}
+			peer := r
+			peer.groupID = *source.GroupId
+			result = append(result, peer)
+		}
+	}
+	return result, nil
+}
+
+// legacyPermissions returns the permission given by the fields that
+// predate IpPermissions, if any
+func legacyPermissions(protocol *string, fromPort, toPort *int64, cidr *string) []*ec2.IpPermission {
+	if protocol == nil && cidr == nil {
+		return nil
+	}
+	permission := &ec2.IpPermission{IpProtocol: protocol, FromPort: fromPort, ToPort: toPort}
+	if protocol == nil {
+		permission.IpProtocol = aws.String("-1")
+	}
+	if cidr != nil {
+		permission.IpRanges = []*ec2.IpRange{{CidrIp: cidr}}
+	}
+	return []*ec2.IpPermission{permission}
+}
+
+func authorize(existing []rule, added []rule) ([]rule, error) {
+	existing = existing[:len(existing):len(existing)]
+	for _, r := range added {
+		for _, e := range existing {
+			if r == e {
+				return nil, ec2Error("InvalidPermission.Duplicate", "the specified rule \"%s\" already exists", r)
+			}
+		}
+		existing = append(existing, r)
+	}
+	return existing, nil
+}
+
+func revoke(existing []rule, removed []rule) ([]rule, error) {
+	for _, r := range removed {
+		found := false
+		for i, e := range existing {
+			if r == e {
+				existing = append(existing[:i:i], existing[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ec2Error("InvalidPermission.NotFound", "The specified rule does not exist in this security group.")
+		}
+	}
+	return existing, nil
+}
+
+// CreateSecurityGroup creates a security group in a VPC, which allows all
+// outbound traffic
+func (b *Backend) CreateSecurityGroup(input *ec2.CreateSecurityGroupInput) (*ec2.CreateSecurityGroupOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(input.GroupName)
+	if input.VpcId == nil {
+		return nil, ec2Error("VPCIdNotSpecified", "No default VPC for this user")
+	}
+	if _, err := b.findVpc(*input.VpcId); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(name, "sg-") {
+		return nil, ec2Error("InvalidParameterValue", "Group names may not be in the format sg-*.")
+	}
+	if name == "default" {
+		return nil, ec2Error("InvalidGroup.Reserved", "The security group 'default' is reserved")
+	}
+	for _, g := range b.securityGroups {
+		if *g.VpcId == *input.VpcId && *g.GroupName == name {
+			return nil, ec2Error("InvalidGroup.Duplicate", "The security group '%s' already exists for VPC '%s'", name, *input.VpcId)
+		}
+	}
+
+	g := b.newSecurityGroup(*input.VpcId, name, aws.StringValue(input.Description))
+	b.securityGroups = append(b.securityGroups, g)
+	return &ec2.CreateSecurityGroupOutput{GroupId: g.GroupId}, nil
+}
+
+// DeleteSecurityGroup deletes a security group that is not the default of
+// its VPC, and that no instance or other group refers to
+func (b *Backend) DeleteSecurityGroup(input *ec2.DeleteSecurityGroupInput) (*ec2.DeleteSecurityGroupOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	g, err := b.findSecurityGroupByIDOrName(input.GroupId, input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	id := *g.GroupId
+	if *g.GroupName == "default" {
+		return nil, ec2Error("CannotDelete", "the specified group: \"%s\" name: \"default\" cannot be deleted by a user", id)
+	}
+	for _, i := range b.instances {
+		if *i.State.Name != ec2.InstanceStateNameTerminated && i.inGroup(id) {
+			return nil, ec2Error("DependencyViolation", "resource %s has a dependent object", id)
+		}
+	}
+	for _, other := range b.securityGroups {
+		if other != g && (refersTo(other.ingress, id) || refersTo(other.egress, id)) {
+			return nil, ec2Error("DependencyViolation", "resource %s has a dependent object", id)
+		}
+	}
+
+	var groups []*securityGroup
+	for _, other := range b.securityGroups {
+		if other != g {
+			groups = append(groups, other)
+		}
+	}
+	b.securityGroups = groups
+	delete(b.tags, id)
+	return &ec2.DeleteSecurityGroupOutput{}, nil
+}
+
+// DescribeSecurityGroups describes security groups, by ID, by name, or by
+// the filters description, group-id, group-name, owner-id and vpc-id.  The
+// rules are matched with ip-permission.cidr, ip-permission.from-port,
+// ip-permission.group-id, ip-permission.protocol and ip-permission.to-port,
+// and the same filters prefixed with egress.
+func (b *Backend) DescribeSecurityGroups(input *ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, id := range aws.StringValueSlice(input.GroupIds) {
+		if _, err := b.findSecurityGroup(id); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range input.GroupNames {
+		if _, err := b.findSecurityGroupByIDOrName(nil, name); err != nil {
+			return nil, err
+		}
+	}
+
+	output := &ec2.DescribeSecurityGroupsOutput{SecurityGroups: []*ec2.SecurityGroup{}}
+	for _, g := range b.securityGroups {
+		if input.GroupIds != nil && !contains(aws.StringValueSlice(input.GroupIds), *g.GroupId) {
+			continue
+		}
+		if input.GroupNames != nil && !contains(aws.StringValueSlice(input.GroupNames), *g.GroupName) {
+			continue
+		}
+		ok, err := matchesFilters(input.Filters, b.tags[*g.GroupId], func(name string) ([]string, bool) {
+			switch name {
+			case "description":
+				return []string{*g.Description}, true
+			case "group-id":
+				return []string{*g.GroupId}, true
+			case "group-name":
+				return []string{*g.GroupName}, true
+			case "owner-id":
+				return []string{*g.OwnerId}, true
+			case "vpc-id":
+				return []string{*g.VpcId}, true
+			}
+			if strings.HasPrefix(name, "egress.ip-permission.") {
+				return ruleValues(g.egress, strings.TrimPrefix(name, "egress.ip-permission."))
+			}
+			if strings.HasPrefix(name, "ip-permission.") {
+				return ruleValues(g.ingress, strings.TrimPrefix(name, "ip-permission."))
+			}
+			return nil, false
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			output.SecurityGroups = append(output.SecurityGroups, b.describeSecurityGroup(g))
+		}
+	}
+	return output, nil
+}
+
+func refersTo(rules []rule, groupID string) bool {
+	for _, r := range rules {
+		if r.groupID == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleValues returns the values of the rules for a filter on the fields of
+// IP permissions
+func ruleValues(rules []rule, field string) ([]string, bool) {
+	var values []string
+	for _, r := range rules {
+		switch field {
+		case "cidr":
+			values = append(values, r.cidr)
+		case "from-port":
+			values = append(values, fmt.Sprint(r.fromPort))
+		case "group-id":
+			values = append(values, r.groupID)
+		case "protocol":
+			values = append(values, r.protocol)
+		case "to-port":
+			values = append(values, fmt.Sprint(r.toPort))
+		default:
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+func (b *Backend) changeRules(groupID, groupName *string, permissions []*ec2.IpPermission, egress bool, change func([]rule, []rule) ([]rule, error)) error {
+	g, err := b.findSecurityGroupByIDOrName(groupID, groupName)
+	if err != nil {
+		return err
+	}
+	rules, err := b.rules(permissions)
+	if err != nil {
+		return err
+	}
+	existing := &g.ingress
+	if egress {
+		existing = &g.egress
+	}
+	changed, err := change(*existing, rules)
+	if err != nil {
+		return err
+	}
+	*existing = changed
+	return nil
+}
+
+// AuthorizeSecurityGroupIngress adds inbound rules to a security group
+func (b *Backend) AuthorizeSecurityGroupIngress(input *ec2.AuthorizeSecurityGroupIngressInput) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	permissions := append(input.IpPermissions, legacyPermissions(input.IpProtocol, input.FromPort, input.ToPort, input.CidrIp)...)
+	if err := b.changeRules(input.GroupId, input.GroupName, permissions, false, authorize); err != nil {
+		return nil, err
+	}
+	return &ec2.AuthorizeSecurityGroupIngressOutput{}, nil
+}
+
+// AuthorizeSecurityGroupEgress adds outbound rules to a security group
+func (b *Backend) AuthorizeSecurityGroupEgress(input *ec2.AuthorizeSecurityGroupEgressInput) (*ec2.AuthorizeSecurityGroupEgressOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	permissions := append(input.IpPermissions, legacyPermissions(input.IpProtocol, input.FromPort, input.ToPort, input.CidrIp)...)
+	if err := b.changeRules(input.GroupId, nil, permissions, true, authorize); err != nil {
+		return nil, err
+	}
+	return &ec2.AuthorizeSecurityGroupEgressOutput{}, nil
+}
+
+// RevokeSecurityGroupIngress removes inbound rules from a security group
+func (b *Backend) RevokeSecurityGroupIngress(input *ec2.RevokeSecurityGroupIngressInput) (*ec2.RevokeSecurityGroupIngressOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	permissions := append(input.IpPermissions, legacyPermissions(input.IpProtocol, input.FromPort, input.ToPort, input.CidrIp)...)
+	if err := b.changeRules(input.GroupId, input.GroupName, permissions, false, revoke); err != nil {
+		return nil, err
+	}
+	return &ec2.RevokeSecurityGroupIngressOutput{}, nil
+}
+
+// RevokeSecurityGroupEgress removes outbound rules from a security group
+func (b *Backend) RevokeSecurityGroupEgress(input *ec2.RevokeSecurityGroupEgressInput) (*ec2.RevokeSecurityGroupEgressOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	permissions := append(input.IpPermissions, legacyPermissions(input.IpProtocol, input.FromPort, input.ToPort, input.CidrIp)...)
+	if err := b.changeRules(input.GroupId, nil, permissions, true, revoke); err != nil {
+		return nil, err
+	}
+	return &ec2.RevokeSecurityGroupEgressOutput{}, nil
+}
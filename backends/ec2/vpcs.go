@@ -0,0 +1,349 @@
+package ec2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+type subnet struct {
+	*ec2.Subnet
+	network *net.IPNet
+
+	// nextHost is the offset in the subnet of the next private IP address
+	// to assign.  The first four addresses are reserved.
+	nextHost uint32
+}
+
+// size returns the number of addresses in the subnet that instances may use
+func (s *subnet) size() int64 {
+	ones, bits := s.network.Mask.Size()
+	return int64(1)<<uint(bits-ones) - 5
+}
+
+func (s *subnet) assignAddress() string {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(s.network.IP.To4())+s.nextHost)
+	s.nextHost++
+	return ip.String()
+}
+
+// parseCIDR parses an IPv4 CIDR block with a prefix between /16 and /28, as
+// allowed for VPCs and subnets
+func parseCIDR(cidr, parameter string) (*net.IPNet, bool, error) {
+	ip, network, err := net.ParseCIDR(cidr)
+	if err != nil || ip.To4() == nil || !ip.Equal(network.IP) {
+		return nil, false, ec2Error("InvalidParameterValue", "Value (%s) for parameter %s is invalid. This is not a valid CIDR block.", cidr, parameter)
+	}
+	ones, _ := network.Mask.Size()
+	return network, ones >= 16 && ones <= 28, nil
+}
+
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+func (b *Backend) findVpc(id string) (*ec2.Vpc, error) {
+	for _, v := range b.vpcs {
+		if *v.VpcId == id {
+			return v, nil
+		}
+	}
+	return nil, ec2Error("InvalidVpcID.NotFound", "The vpc ID '%s' does not exist", id)
+}
+
+func (b *Backend) findSubnet(id string) (*subnet, error) {
+	for _, s := range b.subnets {
+		if *s.SubnetId == id {
+			return s, nil
+		}
+	}
+	return nil, ec2Error("InvalidSubnetID.NotFound", "The subnet ID '%s' does not exist", id)
+}
+
+func (b *Backend) describeVpc(v *ec2.Vpc) *ec2.Vpc {
+	description := *v
+	description.Tags = b.tagsOf(*v.VpcId)
+	return &description
+}
+
+func (b *Backend) describeSubnet(s *subnet) *ec2.Subnet {
+	description := *s.Subnet
+	description.Tags = b.tagsOf(*s.SubnetId)
+	description.AvailableIpAddressCount = aws.Int64(s.size() - int64(len(b.instancesIn(*s.SubnetId))))
+	return &description
+}
+
+// CreateVpc creates a VPC, along with its default security group
+func (b *Backend) CreateVpc(input *ec2.CreateVpcInput) (*ec2.CreateVpcOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	cidr := aws.StringValue(input.CidrBlock)
+	if _, ok, err := parseCIDR(cidr, "cidrBlock"); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ec2Error("InvalidVpc.Range", "The CIDR '%s' is invalid.", cidr)
+	}
+	tenancy := aws.StringValue(input.InstanceTenancy)
+	if tenancy == "" {
+		tenancy = ec2.TenancyDefault
+	}
+
+	id := newID("vpc")
+	v := &ec2.Vpc{
+		VpcId:           aws.String(id),
+		CidrBlock:       aws.String(cidr),
+		State:           aws.String(ec2.VpcStateAvailable),
+		IsDefault:       aws.Bool(false),
+		InstanceTenancy: aws.String(tenancy),
+		DhcpOptionsId:   aws.String("default"),
+		OwnerId:         aws.String(b.AccountID),
+		CidrBlockAssociationSet: []*ec2.VpcCidrBlockAssociation{{
+			AssociationId:  aws.String(newID("vpc-cidr-assoc")),
+			CidrBlock:      aws.String(cidr),
+			CidrBlockState: &ec2.VpcCidrBlockState{State: aws.String(ec2.VpcCidrBlockStateCodeAssociated)},
+		}},
+	}
+	b.vpcs = append(b.vpcs, v)
+	b.securityGroups = append(b.securityGroups, b.newSecurityGroup(id, "default", "default VPC security group"))
+
+	return &ec2.CreateVpcOutput{Vpc: b.describeVpc(v)}, nil
+}
+
+// DeleteVpc deletes a VPC that has no subnets or security groups left, other
+// than its default security group
+func (b *Backend) DeleteVpc(input *ec2.DeleteVpcInput) (*ec2.DeleteVpcOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	id := aws.StringValue(input.VpcId)
+	if _, err := b.findVpc(id); err != nil {
+		return nil, err
+	}
+	for _, s := range b.subnets {
+		if *s.VpcId == id {
+			return nil, ec2Error("DependencyViolation", "The vpc '%s' has dependencies and cannot be deleted.", id)
+		}
+	}
+	for _, g := range b.securityGroups {
+		if *g.VpcId == id && *g.GroupName != "default" {
+			return nil, ec2Error("DependencyViolation", "The vpc '%s' has dependencies and cannot be deleted.", id)
+		}
+	}
+
+	var vpcs []*ec2.Vpc
+	for _, v := range b.vpcs {
+		if *v.VpcId != id {
+			vpcs = append(vpcs, v)
+		}
+	}
+	b.vpcs = vpcs
+	var groups []*securityGroup
+	for _, g := range b.securityGroups {
+		if *g.VpcId == id {
+			delete(b.tags, *g.GroupId)
+		} else {
+			groups = append(groups, g)
+		}
+	}
+	b.securityGroups = groups
+	delete(b.tags, id)
+	return &ec2.DeleteVpcOutput{}, nil
+}
+
+// DescribeVpcs describes VPCs, by ID or by the filters cidr,
+// cidr-block-association.cidr-block, dhcp-options-id, is-default, owner-id,
+// state and vpc-id
+func (b *Backend) DescribeVpcs(input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, id := range aws.StringValueSlice(input.VpcIds) {
+		if _, err := b.findVpc(id); err != nil {
+			return nil, err
+		}
+	}
+	output := &ec2.DescribeVpcsOutput{Vpcs: []*ec2.Vpc{}}
+	for _, v := range b.vpcs {
+		if input.VpcIds != nil && !contains(aws.StringValueSlice(input.VpcIds), *v.VpcId) {
+			continue
+		}
+		ok, err := matchesFilters(input.Filters, b.tags[*v.VpcId], func(name string) ([]string, bool) {
+			switch name {
+			case "cidr", "cidr-block-association.cidr-block":
+				return []string{*v.CidrBlock}, true
+			case "dhcp-options-id":
+				return []string{*v.DhcpOptionsId}, true
+			case "is-default":
+				return boolValue(v.IsDefault), true
+			case "owner-id":
+				return []string{*v.OwnerId}, true
+			case "state":
+				return []string{*v.State}, true
+			case "vpc-id":
+				return []string{*v.VpcId}, true
+			}
+			return nil, false
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			output.Vpcs = append(output.Vpcs, b.describeVpc(v))
+		}
+	}
+	return output, nil
+}
+
+// CreateSubnet creates a subnet in a VPC, with a CIDR block that is within
+// that of the VPC and that does not overlap other subnets
+func (b *Backend) CreateSubnet(input *ec2.CreateSubnetInput) (*ec2.CreateSubnetOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	v, err := b.findVpc(aws.StringValue(input.VpcId))
+	if err != nil {
+		return nil, err
+	}
+	cidr := aws.StringValue(input.CidrBlock)
+	network, ok, err := parseCIDR(cidr, "cidrBlock")
+	if err != nil {
+		return nil, err
+	}
+	_, vpcNetwork, _ := net.ParseCIDR(*v.CidrBlock)
+	vpcOnes, _ := vpcNetwork.Mask.Size()
+	ones, _ := network.Mask.Size()
+	if !ok || !vpcNetwork.Contains(network.IP) || ones < vpcOnes {
+		return nil, ec2Error("InvalidSubnet.Range", "The CIDR '%s' is invalid.", cidr)
+	}
+	for _, s := range b.subnets {
+		if *s.VpcId == *v.VpcId && overlaps(s.network, network) {
+			return nil, ec2Error("InvalidSubnet.Conflict", "The CIDR '%s' conflicts with another subnet", cidr)
+		}
+	}
+
+	zones := b.availabilityZones()
+	zone := aws.StringValue(input.AvailabilityZone)
+	if zone == "" {
+		zone = zones[0]
+	} else if !contains(zones, zone) {
+		return nil, ec2Error("InvalidParameterValue",
+			"Value (%s) for parameter availabilityZone is invalid. Subnets can currently only be created in the following availability zones: %s.",
+			zone, strings.Join(zones, ", "))
+	}
+
+	s := &subnet{
+		Subnet: &ec2.Subnet{
+			SubnetId:            aws.String(newID("subnet")),
+			VpcId:               v.VpcId,
+			CidrBlock:           aws.String(cidr),
+			AvailabilityZone:    aws.String(zone),
+			State:               aws.String(ec2.SubnetStateAvailable),
+			DefaultForAz:        aws.Bool(false),
+			MapPublicIpOnLaunch: aws.Bool(false),
+		},
+		network:  network,
+		nextHost: 4,
+	}
+	b.subnets = append(b.subnets, s)
+	return &ec2.CreateSubnetOutput{Subnet: b.describeSubnet(s)}, nil
+}
+
+// DeleteSubnet deletes a subnet that has no instances left in it
+func (b *Backend) DeleteSubnet(input *ec2.DeleteSubnetInput) (*ec2.DeleteSubnetOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+	if err := dryRun(input.DryRun); err != nil {
+		return nil, err
+	}
+
+	id := aws.StringValue(input.SubnetId)
+	if _, err := b.findSubnet(id); err != nil {
+		return nil, err
+	}
+	if len(b.instancesIn(id)) > 0 {
+		return nil, ec2Error("DependencyViolation", "The subnet '%s' has dependencies and cannot be deleted.", id)
+	}
+
+	var subnets []*subnet
+	for _, s := range b.subnets {
+		if *s.SubnetId != id {
+			subnets = append(subnets, s)
+		}
+	}
+	b.subnets = subnets
+	delete(b.tags, id)
+	return &ec2.DeleteSubnetOutput{}, nil
+}
+
+// DescribeSubnets describes subnets, by ID or by the filters
+// availability-zone, available-ip-address-count, cidr-block,
+// default-for-az, state, subnet-id and vpc-id
+func (b *Backend) DescribeSubnets(input *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.settle()
+
+	for _, id := range aws.StringValueSlice(input.SubnetIds) {
+		if _, err := b.findSubnet(id); err != nil {
+			return nil, err
+		}
+	}
+	output := &ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{}}
+	for _, s := range b.subnets {
+		if input.SubnetIds != nil && !contains(aws.StringValueSlice(input.SubnetIds), *s.SubnetId) {
+			continue
+		}
+		description := b.describeSubnet(s)
+		ok, err := matchesFilters(input.Filters, b.tags[*s.SubnetId], func(name string) ([]string, bool) {
+			switch name {
+			case "availability-zone", "availabilityZone":
+				return []string{*s.AvailabilityZone}, true
+			case "available-ip-address-count":
+				return []string{fmt.Sprint(*description.AvailableIpAddressCount)}, true
+			case "cidr-block", "cidr", "cidrBlock":
+				return []string{*s.CidrBlock}, true
+			case "default-for-az", "defaultForAz":
+				return boolValue(s.DefaultForAz), true
+			case "state":
+				return []string{*s.State}, true
+			case "subnet-id":
+				return []string{*s.SubnetId}, true
+			case "vpc-id":
+				return []string{*s.VpcId}, true
+			}
+			return nil, false
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			output.Subnets = append(output.Subnets, description)
+		}
+	}
+	return output, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, element := range list {
+		if element == s {
+			return true
+		}
+	}
+	return false
+}
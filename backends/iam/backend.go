@@ -0,0 +1,236 @@
+// Package iam is a ready-made backend for a fake AWS Identity and Access
+// Management, which keeps users, groups, roles, policies, access keys and
+// instance profiles in memory.
+//
+// As in the real service, names are unique regardless of case, policy
+// documents are returned URL-encoded, and the List calls are paginated with
+// Marker and MaxItems.
+package iam
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/rosenhouse/awsfaker"
+	"github.com/rosenhouse/awsfaker/internal/random"
+)
+
+// Backend is a fake IAM.  Use New to create one.
+//
+// Managed policies with ARNs under arn:aws:iam::aws:policy/ stand for the
+// policies that AWS provides, and are created with an empty document when
+// first referred to.
+//
+// Backend is also an awsfaker.CredentialStore, which knows the secrets of the
+// active access keys that it has created.
+type Backend struct {
+	// AccountID appears in the ARNs of all entities
+	AccountID string
+
+	lock             sync.Mutex
+	users            map[string]*user
+	groups           map[string]*group
+	roles            map[string]*role
+	policies         map[string]*policy
+	instanceProfiles map[string]*instanceProfile
+}
+
+// New returns a Backend with no entities
+func New() *Backend {
+	b := &Backend{AccountID: "123456789012"}
+	b.clear()
+	return b
+}
+
+func (b *Backend) clear() {
+	b.users = map[string]*user{}
+	b.groups = map[string]*group{}
+	b.roles = map[string]*role{}
+	b.policies = map[string]*policy{}
+	b.instanceProfiles = map[string]*instanceProfile{}
+}
+
+// Reset removes all entities
+func (b *Backend) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.clear()
+}
+
+// State is the state of a Backend, as reported by DumpState
+type State struct {
+	Users            []string
+	Groups           []string
+	Roles            []string
+	Policies         []string
+	InstanceProfiles []string
+}
+
+// DumpState returns the ARNs of all entities
+func (b *Backend) DumpState() interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	state := State{Users: []string{}, Groups: []string{}, Roles: []string{}, Policies: []string{}, InstanceProfiles: []string{}}
+	for _, u := range b.users {
+		state.Users = append(state.Users, *u.Arn)
+	}
+	for _, g := range b.groups {
+		state.Groups = append(state.Groups, *g.Arn)
+	}
+	for _, r := range b.roles {
+		state.Roles = append(state.Roles, *r.Arn)
+	}
+	for arn := range b.policies {
+		state.Policies = append(state.Policies, arn)
+	}
+	for _, p := range b.instanceProfiles {
+		state.InstanceProfiles = append(state.InstanceProfiles, *p.Arn)
+	}
+	for _, arns := range [][]string{state.Users, state.Groups, state.Roles, state.Policies, state.InstanceProfiles} {
+		sort.Strings(arns)
+	}
+	return state
+}
+
+// Credential returns the secret of an active access key
+func (b *Backend) Credential(accessKeyID string) (awsfaker.Credential, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	_, key := b.findAccessKey(accessKeyID)
+	if key == nil || *key.Status != "Active" {
+		return awsfaker.Credential{}, false
+	}
+	return awsfaker.Credential{SecretAccessKey: key.secret}, true
+}
+
+func iamError(code string, status int, format string, args ...interface{}) error {
+	return &awsfaker.ErrorResponse{
+		AWSErrorCode:    code,
+		AWSErrorMessage: fmt.Sprintf(format, args...),
+		HTTPStatusCode:  status,
+	}
+}
+
+func noSuchEntity(format string, args ...interface{}) error {
+	return iamError("NoSuchEntity", http.StatusNotFound, format, args...)
+}
+
+func entityAlreadyExists(format string, args ...interface{}) error {
+	return iamError("EntityAlreadyExists", http.StatusConflict, format, args...)
+}
+
+func deleteConflict(format string, args ...interface{}) error {
+	return iamError("DeleteConflict", http.StatusConflict, format, args...)
+}
+
+func limitExceeded(format string, args ...interface{}) error {
+	return iamError("LimitExceeded", http.StatusConflict, format, args...)
+}
+
+func validationError(format string, args ...interface{}) error {
+	return iamError("ValidationError", http.StatusBadRequest, format, args...)
+}
+
+// key returns the key under which an entity is stored, since names differ
+// by more than case
+func key(name *string) string {
+	return strings.ToLower(aws.StringValue(name))
+}
+
+var namePattern = regexp.MustCompile(`^[\w+=,.@-]+$`)
+
+func checkName(name *string, parameter string, maxLength int) error {
+	value := aws.StringValue(name)
+	if !namePattern.MatchString(value) {
+		return validationError("1 validation error detected: Value '%s' at '%s' failed to satisfy constraint: Member must satisfy regular expression pattern: [\\w+=,.@-]+", value, parameter)
+	}
+	if len(value) > maxLength {
+		return validationError("1 validation error detected: Value '%s' at '%s' failed to satisfy constraint: Member must have length less than or equal to %d", value, parameter, maxLength)
+	}
+	return nil
+}
+
+var pathPattern = regexp.MustCompile(`^/([\x21-\x7e]*/)?$`)
+
+// checkPath returns the path of a new entity, which defaults to /
+func checkPath(path *string) (string, error) {
+	if path == nil {
+		return "/", nil
+	}
+	if !pathPattern.MatchString(*path) {
+		return "", validationError("The specified value for path is invalid. It must begin and end with / and contain only alphanumeric characters and/or / characters.")
+	}
+	return *path, nil
+}
+
+func hasPathPrefix(path, prefix *string) bool {
+	return strings.HasPrefix(aws.StringValue(path), aws.StringValue(prefix))
+}
+
+func (b *Backend) arn(resource, path, name string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:%s%s%s", b.AccountID, resource, path, name)
+}
+
+// newID returns a unique ID with the prefix that IAM uses for the type of
+// entity, e.g. AIDA for users
+func newID(prefix string) string {
+	return prefix + random.Upper(17)
+}
+
+// checkDocument checks that a policy document is JSON
+func checkDocument(document *string) error {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(aws.StringValue(document)), &parsed); err != nil {
+		return iamError("MalformedPolicyDocument", http.StatusBadRequest, "Syntax errors in policy.")
+	}
+	return nil
+}
+
+// encodeDocument URL-encodes a policy document the way IAM returns it,
+// escaping all but the unreserved characters of RFC 3986
+func encodeDocument(document string) *string {
+	var encoded []byte
+	for i := 0; i < len(document); i++ {
+		c := document[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			encoded = append(encoded, c)
+		default:
+			encoded = append(encoded, fmt.Sprintf("%%%02X", c)...)
+		}
+	}
+	return aws.String(string(encoded))
+}
+
+// page returns the range of a sorted list of keys to return for a Marker
+// and MaxItems, and the Marker for the next page, if any
+func page(keys []string, marker *string, maxItems *int64) (int, int, *string, error) {
+	from := 0
+	if marker != nil {
+		decoded, err := base64.StdEncoding.DecodeString(*marker)
+		if err != nil {
+			return 0, 0, nil, validationError("Invalid Marker.")
+		}
+		from = sort.SearchStrings(keys, string(decoded))
+	}
+	limit := 100
+	if maxItems != nil {
+		if *maxItems < 1 || *maxItems > 1000 {
+			return 0, 0, nil, validationError("1 validation error detected: Value '%d' at 'maxItems' failed to satisfy constraint: Member must have value between 1 and 1000", *maxItems)
+		}
+		limit = int(*maxItems)
+	}
+	to := from + limit
+	if to >= len(keys) {
+		return from, len(keys), nil, nil
+	}
+	return from, to, aws.String(base64.StdEncoding.EncodeToString([]byte(keys[to]))), nil
+}
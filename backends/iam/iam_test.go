@@ -0,0 +1,392 @@
+package iam_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+
+	"github.com/rosenhouse/awsfaker"
+	fakeiam "github.com/rosenhouse/awsfaker/backends/iam"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const document = `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": "s3:*", "Resource": "*"}]}`
+
+const trustPolicy = `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": {"Service": "ec2.amazonaws.com"}, "Action": "sts:AssumeRole"}]}`
+
+var _ = Describe("IAM backend", func() {
+	var (
+		backend    *fakeiam.Backend
+		fakeServer *httptest.Server
+		client     *iam.IAM
+	)
+
+	newClient := func(accessKeyID, secretAccessKey string) *iam.IAM {
+		return iam.New(session.New(&aws.Config{
+			Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
+			Region:      aws.String("us-east-1"),
+			Endpoint:    aws.String(fakeServer.URL),
+			MaxRetries:  aws.Int(0),
+		}))
+	}
+
+	BeforeEach(func() {
+		backend = fakeiam.New()
+		fakeServer = httptest.NewServer(awsfaker.New(backend))
+		client = newClient("some-access-key", "some-secret-key")
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	expectError := func(err error, code, message string) {
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal(code))
+		Expect(err.(awserr.RequestFailure).Message()).To(ContainSubstring(message))
+	}
+
+	decode := func(encoded *string) string {
+		decoded, err := url.QueryUnescape(*encoded)
+		Expect(err).NotTo(HaveOccurred())
+		return decoded
+	}
+
+	createUser := func(name, path string) {
+		_, err := client.CreateUser(&iam.CreateUserInput{UserName: aws.String(name), Path: aws.String(path)})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	createRole := func(name string) {
+		_, err := client.CreateRole(&iam.CreateRoleInput{RoleName: aws.String(name), AssumeRolePolicyDocument: aws.String(trustPolicy)})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	createPolicy := func(name string) string {
+		output, err := client.CreatePolicy(&iam.CreatePolicyInput{PolicyName: aws.String(name), PolicyDocument: aws.String(document)})
+		Expect(err).NotTo(HaveOccurred())
+		return *output.Policy.Arn
+	}
+
+	Describe("users", func() {
+		It("creates a user with an ARN and ID", func() {
+			output, err := client.CreateUser(&iam.CreateUserInput{UserName: aws.String("alice"), Path: aws.String("/team/")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.User.Arn).To(Equal("arn:aws:iam::123456789012:user/team/alice"))
+			Expect(*output.User.UserId).To(HavePrefix("AIDA"))
+
+			got, err := client.GetUser(&iam.GetUserInput{UserName: aws.String("alice")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*got.User.UserId).To(Equal(*output.User.UserId))
+		})
+
+		It("requires names to be unique regardless of case", func() {
+			createUser("alice", "/")
+			_, err := client.CreateUser(&iam.CreateUserInput{UserName: aws.String("Alice")})
+			expectError(err, "EntityAlreadyExists", "User with name Alice already exists.")
+		})
+
+		It("rejects invalid names and paths", func() {
+			_, err := client.CreateUser(&iam.CreateUserInput{UserName: aws.String("not a name")})
+			expectError(err, "ValidationError", "regular expression pattern")
+
+			_, err = client.CreateUser(&iam.CreateUserInput{UserName: aws.String("alice"), Path: aws.String("team")})
+			expectError(err, "ValidationError", "path is invalid")
+		})
+
+		It("reports users that do not exist", func() {
+			_, err := client.GetUser(&iam.GetUserInput{UserName: aws.String("nobody")})
+			expectError(err, "NoSuchEntity", "The user with name nobody cannot be found.")
+			Expect(err.(awserr.RequestFailure).StatusCode()).To(Equal(404))
+		})
+
+		It("lists users by path prefix, a page at a time", func() {
+			createUser("carol", "/ops/")
+			createUser("alice", "/dev/")
+			createUser("bob", "/dev/")
+			createUser("dave", "/dev/")
+
+			first, err := client.ListUsers(&iam.ListUsersInput{PathPrefix: aws.String("/dev/"), MaxItems: aws.Int64(2)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*first.IsTruncated).To(BeTrue())
+			Expect(first.Users).To(HaveLen(2))
+			Expect(*first.Users[0].UserName).To(Equal("alice"))
+			Expect(*first.Users[1].UserName).To(Equal("bob"))
+
+			second, err := client.ListUsers(&iam.ListUsersInput{PathPrefix: aws.String("/dev/"), MaxItems: aws.Int64(2), Marker: first.Marker})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*second.IsTruncated).To(BeFalse())
+			Expect(second.Marker).To(BeNil())
+			Expect(second.Users).To(HaveLen(1))
+			Expect(*second.Users[0].UserName).To(Equal("dave"))
+		})
+
+		It("refuses to delete a user until its dependents are gone", func() {
+			createUser("alice", "/")
+			arn := createPolicy("some-policy")
+			_, err := client.CreateGroup(&iam.CreateGroupInput{GroupName: aws.String("admins")})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.AddUserToGroup(&iam.AddUserToGroupInput{GroupName: aws.String("admins"), UserName: aws.String("alice")})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.AttachUserPolicy(&iam.AttachUserPolicyInput{UserName: aws.String("alice"), PolicyArn: aws.String(arn)})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.PutUserPolicy(&iam.PutUserPolicyInput{UserName: aws.String("alice"), PolicyName: aws.String("inline"), PolicyDocument: aws.String(document)})
+			Expect(err).NotTo(HaveOccurred())
+			key, err := client.CreateAccessKey(&iam.CreateAccessKeyInput{UserName: aws.String("alice")})
+			Expect(err).NotTo(HaveOccurred())
+
+			deleteUser := func() error {
+				_, err := client.DeleteUser(&iam.DeleteUserInput{UserName: aws.String("alice")})
+				return err
+			}
+
+			expectError(deleteUser(), "DeleteConflict", "must delete access keys first")
+			_, err = client.DeleteAccessKey(&iam.DeleteAccessKeyInput{UserName: aws.String("alice"), AccessKeyId: key.AccessKey.AccessKeyId})
+			Expect(err).NotTo(HaveOccurred())
+
+			expectError(deleteUser(), "DeleteConflict", "must delete policies first")
+			_, err = client.DeleteUserPolicy(&iam.DeleteUserPolicyInput{UserName: aws.String("alice"), PolicyName: aws.String("inline")})
+			Expect(err).NotTo(HaveOccurred())
+
+			expectError(deleteUser(), "DeleteConflict", "must detach all policies first")
+			_, err = client.DetachUserPolicy(&iam.DetachUserPolicyInput{UserName: aws.String("alice"), PolicyArn: aws.String(arn)})
+			Expect(err).NotTo(HaveOccurred())
+
+			expectError(deleteUser(), "DeleteConflict", "must remove users from group first")
+			_, err = client.RemoveUserFromGroup(&iam.RemoveUserFromGroupInput{GroupName: aws.String("admins"), UserName: aws.String("alice")})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(deleteUser()).To(Succeed())
+			_, err = client.GetUser(&iam.GetUserInput{UserName: aws.String("alice")})
+			expectError(err, "NoSuchEntity", "cannot be found")
+		})
+	})
+
+	Describe("groups", func() {
+		It("lists the members of a group and the groups of a user", func() {
+			createUser("alice", "/")
+			_, err := client.CreateGroup(&iam.CreateGroupInput{GroupName: aws.String("admins")})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.AddUserToGroup(&iam.AddUserToGroupInput{GroupName: aws.String("admins"), UserName: aws.String("alice")})
+			Expect(err).NotTo(HaveOccurred())
+
+			group, err := client.GetGroup(&iam.GetGroupInput{GroupName: aws.String("admins")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(group.Users).To(HaveLen(1))
+			Expect(*group.Users[0].UserName).To(Equal("alice"))
+
+			groups, err := client.ListGroupsForUser(&iam.ListGroupsForUserInput{UserName: aws.String("alice")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(groups.Groups).To(HaveLen(1))
+			Expect(*groups.Groups[0].Arn).To(Equal("arn:aws:iam::123456789012:group/admins"))
+
+			_, err = client.DeleteGroup(&iam.DeleteGroupInput{GroupName: aws.String("admins")})
+			expectError(err, "DeleteConflict", "")
+		})
+	})
+
+	Describe("access keys", func() {
+		BeforeEach(func() {
+			createUser("alice", "/")
+		})
+
+		It("allows two access keys per user", func() {
+			for i := 0; i < 2; i++ {
+				output, err := client.CreateAccessKey(&iam.CreateAccessKeyInput{UserName: aws.String("alice")})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*output.AccessKey.AccessKeyId).To(HavePrefix("AKIA"))
+				Expect(*output.AccessKey.SecretAccessKey).To(HaveLen(40))
+				Expect(*output.AccessKey.Status).To(Equal("Active"))
+			}
+			_, err := client.CreateAccessKey(&iam.CreateAccessKeyInput{UserName: aws.String("alice")})
+			expectError(err, "LimitExceeded", "")
+
+			keys, err := client.ListAccessKeys(&iam.ListAccessKeysInput{UserName: aws.String("alice")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys.AccessKeyMetadata).To(HaveLen(2))
+		})
+
+		It("serves as a credential store for signature verification", func() {
+			output, err := client.CreateAccessKey(&iam.CreateAccessKeyInput{UserName: aws.String("alice")})
+			Expect(err).NotTo(HaveOccurred())
+			key := output.AccessKey
+
+			handler := awsfaker.New(backend)
+			handler.Signatures = &awsfaker.SignatureVerifier{Credentials: backend}
+			fakeServer.Close()
+			fakeServer = httptest.NewServer(handler)
+
+			_, err = newClient("some-access-key", "some-secret-key").GetUser(&iam.GetUserInput{})
+			expectError(err, "InvalidClientTokenId", "")
+
+			alice := newClient(*key.AccessKeyId, *key.SecretAccessKey)
+			user, err := alice.GetUser(&iam.GetUserInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*user.User.UserName).To(Equal("alice"))
+
+			_, err = alice.UpdateAccessKey(&iam.UpdateAccessKeyInput{AccessKeyId: key.AccessKeyId, Status: aws.String("Inactive")})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = alice.GetUser(&iam.GetUserInput{})
+			expectError(err, "InvalidClientTokenId", "")
+		})
+	})
+
+	Describe("roles and instance profiles", func() {
+		It("returns the trust policy URL-encoded", func() {
+			createRole("web")
+			output, err := client.GetRole(&iam.GetRoleInput{RoleName: aws.String("web")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.Role.AssumeRolePolicyDocument).To(HavePrefix("%7B%22Version%22%3A%20%222012-10-17%22"))
+			Expect(decode(output.Role.AssumeRolePolicyDocument)).To(Equal(trustPolicy))
+			Expect(*output.Role.RoleId).To(HavePrefix("AROA"))
+		})
+
+		It("rejects malformed documents", func() {
+			_, err := client.CreateRole(&iam.CreateRoleInput{RoleName: aws.String("web"), AssumeRolePolicyDocument: aws.String("{")})
+			expectError(err, "MalformedPolicyDocument", "Syntax errors in policy.")
+		})
+
+		It("holds one role per instance profile", func() {
+			createRole("web")
+			createRole("worker")
+			_, err := client.CreateInstanceProfile(&iam.CreateInstanceProfileInput{InstanceProfileName: aws.String("web")})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.CreateInstanceProfile(&iam.CreateInstanceProfileInput{InstanceProfileName: aws.String("WEB")})
+			expectError(err, "EntityAlreadyExists", "Instance Profile WEB already exists.")
+
+			_, err = client.AddRoleToInstanceProfile(&iam.AddRoleToInstanceProfileInput{InstanceProfileName: aws.String("web"), RoleName: aws.String("web")})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.AddRoleToInstanceProfile(&iam.AddRoleToInstanceProfileInput{InstanceProfileName: aws.String("web"), RoleName: aws.String("worker")})
+			expectError(err, "LimitExceeded", "InstanceSessionsPerInstanceProfile")
+
+			profile, err := client.GetInstanceProfile(&iam.GetInstanceProfileInput{InstanceProfileName: aws.String("web")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*profile.InstanceProfile.Arn).To(Equal("arn:aws:iam::123456789012:instance-profile/web"))
+			Expect(profile.InstanceProfile.Roles).To(HaveLen(1))
+			Expect(*profile.InstanceProfile.Roles[0].RoleName).To(Equal("web"))
+
+			profiles, err := client.ListInstanceProfilesForRole(&iam.ListInstanceProfilesForRoleInput{RoleName: aws.String("web")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(profiles.InstanceProfiles).To(HaveLen(1))
+
+			_, err = client.DeleteRole(&iam.DeleteRoleInput{RoleName: aws.String("web")})
+			expectError(err, "DeleteConflict", "must remove roles from instance profile first")
+			_, err = client.DeleteInstanceProfile(&iam.DeleteInstanceProfileInput{InstanceProfileName: aws.String("web")})
+			expectError(err, "DeleteConflict", "must remove roles from instance profile first")
+
+			_, err = client.RemoveRoleFromInstanceProfile(&iam.RemoveRoleFromInstanceProfileInput{InstanceProfileName: aws.String("web"), RoleName: aws.String("web")})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.DeleteRole(&iam.DeleteRoleInput{RoleName: aws.String("web")})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("policies", func() {
+		It("returns inline policies URL-encoded", func() {
+			createRole("web")
+			_, err := client.PutRolePolicy(&iam.PutRolePolicyInput{RoleName: aws.String("web"), PolicyName: aws.String("s3"), PolicyDocument: aws.String(document)})
+			Expect(err).NotTo(HaveOccurred())
+
+			output, err := client.GetRolePolicy(&iam.GetRolePolicyInput{RoleName: aws.String("web"), PolicyName: aws.String("s3")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decode(output.PolicyDocument)).To(Equal(document))
+
+			names, err := client.ListRolePolicies(&iam.ListRolePoliciesInput{RoleName: aws.String("web")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(aws.StringValueSlice(names.PolicyNames)).To(Equal([]string{"s3"}))
+
+			_, err = client.GetRolePolicy(&iam.GetRolePolicyInput{RoleName: aws.String("web"), PolicyName: aws.String("ec2")})
+			expectError(err, "NoSuchEntity", "The role policy with name ec2 cannot be found.")
+		})
+
+		It("counts the attachments of a managed policy", func() {
+			arn := createPolicy("some-policy")
+			Expect(arn).To(Equal("arn:aws:iam::123456789012:policy/some-policy"))
+			createRole("web")
+			_, err := client.AttachRolePolicy(&iam.AttachRolePolicyInput{RoleName: aws.String("web"), PolicyArn: aws.String(arn)})
+			Expect(err).NotTo(HaveOccurred())
+
+			output, err := client.GetPolicy(&iam.GetPolicyInput{PolicyArn: aws.String(arn)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.Policy.AttachmentCount).To(Equal(int64(1)))
+
+			attached, err := client.ListAttachedRolePolicies(&iam.ListAttachedRolePoliciesInput{RoleName: aws.String("web")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attached.AttachedPolicies).To(HaveLen(1))
+			Expect(*attached.AttachedPolicies[0].PolicyArn).To(Equal(arn))
+
+			_, err = client.DeletePolicy(&iam.DeletePolicyInput{PolicyArn: aws.String(arn)})
+			expectError(err, "DeleteConflict", "Cannot delete a policy attached to entities.")
+
+			_, err = client.DeleteRole(&iam.DeleteRoleInput{RoleName: aws.String("web")})
+			expectError(err, "DeleteConflict", "must detach all policies first")
+		})
+
+		It("attaches policies provided by AWS", func() {
+			createRole("web")
+			arn := "arn:aws:iam::aws:policy/service-role/AmazonEC2RoleforSSM"
+			_, err := client.AttachRolePolicy(&iam.AttachRolePolicyInput{RoleName: aws.String("web"), PolicyArn: aws.String(arn)})
+			Expect(err).NotTo(HaveOccurred())
+
+			output, err := client.ListPolicies(&iam.ListPoliciesInput{Scope: aws.String("AWS"), PathPrefix: aws.String("/service-role/")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.Policies).To(HaveLen(1))
+			Expect(*output.Policies[0].PolicyName).To(Equal("AmazonEC2RoleforSSM"))
+
+			_, err = client.AttachRolePolicy(&iam.AttachRolePolicyInput{RoleName: aws.String("web"), PolicyArn: aws.String("arn:aws:iam::123456789012:policy/missing")})
+			expectError(err, "NoSuchEntity", "does not exist or is not attachable")
+		})
+
+		It("keeps up to five versions of a managed policy", func() {
+			arn := createPolicy("some-policy")
+			for i := 0; i < 4; i++ {
+				_, err := client.CreatePolicyVersion(&iam.CreatePolicyVersionInput{PolicyArn: aws.String(arn), PolicyDocument: aws.String(document)})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			_, err := client.CreatePolicyVersion(&iam.CreatePolicyVersionInput{PolicyArn: aws.String(arn), PolicyDocument: aws.String(document)})
+			expectError(err, "LimitExceeded", "up to 5 versions")
+
+			_, err = client.SetDefaultPolicyVersion(&iam.SetDefaultPolicyVersionInput{PolicyArn: aws.String(arn), VersionId: aws.String("v3")})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.DeletePolicyVersion(&iam.DeletePolicyVersionInput{PolicyArn: aws.String(arn), VersionId: aws.String("v3")})
+			expectError(err, "DeleteConflict", "Cannot delete the default version of a policy.")
+
+			versions, err := client.ListPolicyVersions(&iam.ListPolicyVersionsInput{PolicyArn: aws.String(arn)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions.Versions).To(HaveLen(5))
+			Expect(*versions.Versions[0].VersionId).To(Equal("v5"))
+
+			version, err := client.GetPolicyVersion(&iam.GetPolicyVersionInput{PolicyArn: aws.String(arn), VersionId: aws.String("v3")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*version.PolicyVersion.IsDefaultVersion).To(BeTrue())
+			Expect(decode(version.PolicyVersion.Document)).To(Equal(document))
+
+			_, err = client.DeletePolicy(&iam.DeletePolicyInput{PolicyArn: aws.String(arn)})
+			expectError(err, "DeleteConflict", "more than one version")
+		})
+
+		It("requires managed policy names to be unique", func() {
+			createPolicy("some-policy")
+			_, err := client.CreatePolicy(&iam.CreatePolicyInput{PolicyName: aws.String("Some-Policy"), PolicyDocument: aws.String(document), Path: aws.String("/other/")})
+			expectError(err, "EntityAlreadyExists", "A policy called Some-Policy already exists.")
+		})
+	})
+
+	It("resets and dumps its state", func() {
+		createUser("alice", "/")
+		createRole("web")
+		state := backend.DumpState().(fakeiam.State)
+		Expect(state.Users).To(Equal([]string{"arn:aws:iam::123456789012:user/alice"}))
+		Expect(state.Roles).To(Equal([]string{"arn:aws:iam::123456789012:role/web"}))
+
+		backend.Reset()
+		Expect(backend.DumpState().(fakeiam.State).Users).To(BeEmpty())
+	})
+})
@@ -0,0 +1,826 @@
+package iam
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+const awsPolicyPrefix = "arn:aws:iam::aws:policy/"
+
+// maxAttachedPolicies is the number of managed policies that may be attached
+// to a user, group or role
+const maxAttachedPolicies = 10
+
+type policy struct {
+	*iam.Policy
+	versions    []*iam.PolicyVersion
+	nextVersion int
+}
+
+// policies holds the inline policies of a user, group or role, by key, and
+// the managed policies attached to it
+type policies struct {
+	inline   map[string]inlinePolicy
+	attached []*policy
+}
+
+type inlinePolicy struct {
+	name, document string
+}
+
+func newPolicies() policies {
+	return policies{inline: map[string]inlinePolicy{}}
+}
+
+func (p *policies) inlineKeys() []string {
+	keys := make([]string, 0, len(p.inline))
+	for k := range p.inline {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (p *policies) isAttached(managed *policy) bool {
+	for _, a := range p.attached {
+		if a == managed {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *policies) attach(managed *policy, kind string) error {
+	if p.isAttached(managed) {
+		return nil
+	}
+	if len(p.attached) >= maxAttachedPolicies {
+		return limitExceeded("Cannot exceed quota for PoliciesPer%s: %d", kind, maxAttachedPolicies)
+	}
+	p.attached = append(p.attached, managed)
+	return nil
+}
+
+func (p *policies) detach(managed *policy) error {
+	if !p.isAttached(managed) {
+		return noSuchEntity("Policy %s was not found.", *managed.Arn)
+	}
+	var attached []*policy
+	for _, a := range p.attached {
+		if a != managed {
+			attached = append(attached, a)
+		}
+	}
+	p.attached = attached
+	return nil
+}
+
+// listAttached pages through the attached policies with the path prefix
+func (p *policies) listAttached(pathPrefix, marker *string, maxItems *int64) ([]*iam.AttachedPolicy, *string, error) {
+	byKey := map[string]*policy{}
+	var keys []string
+	for _, a := range p.attached {
+		if hasPathPrefix(a.Path, pathPrefix) {
+			k := policyKey(a)
+			byKey[k] = a
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	from, to, next, err := page(keys, marker, maxItems)
+	if err != nil {
+		return nil, nil, err
+	}
+	attached := []*iam.AttachedPolicy{}
+	for _, k := range keys[from:to] {
+		attached = append(attached, &iam.AttachedPolicy{PolicyName: byKey[k].PolicyName, PolicyArn: byKey[k].Arn})
+	}
+	return attached, next, nil
+}
+
+// policyKey orders managed policies by name, and by ARN where AWS and the
+// account have policies of the same name
+func policyKey(p *policy) string {
+	return key(p.PolicyName) + " " + *p.Arn
+}
+
+func (p *policies) putInline(name, document *string) error {
+	if err := checkName(name, "policyName", 128); err != nil {
+		return err
+	}
+	if err := checkDocument(document); err != nil {
+		return err
+	}
+	p.inline[key(name)] = inlinePolicy{name: *name, document: *document}
+	return nil
+}
+
+func (p *policies) getInline(name *string, kind string) (inlinePolicy, error) {
+	inline, ok := p.inline[key(name)]
+	if !ok {
+		return inlinePolicy{}, noSuchEntity("The %s policy with name %s cannot be found.", kind, aws.StringValue(name))
+	}
+	return inline, nil
+}
+
+func (p *policies) deleteInline(name *string, kind string) error {
+	if _, err := p.getInline(name, kind); err != nil {
+		return err
+	}
+	delete(p.inline, key(name))
+	return nil
+}
+
+func (p *policies) listInline(marker *string, maxItems *int64) ([]*string, *string, error) {
+	keys := p.inlineKeys()
+	from, to, next, err := page(keys, marker, maxItems)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := []*string{}
+	for _, k := range keys[from:to] {
+		names = append(names, aws.String(p.inline[k].name))
+	}
+	return names, next, nil
+}
+
+// findPolicy returns the managed policy with the ARN.  Policies provided by
+// AWS are created when first referred to.
+func (b *Backend) findPolicy(arn *string) (*policy, error) {
+	if p, ok := b.policies[aws.StringValue(arn)]; ok {
+		return p, nil
+	}
+	if !strings.HasPrefix(aws.StringValue(arn), awsPolicyPrefix) {
+		return nil, noSuchEntity("Policy %s does not exist or is not attachable.", aws.StringValue(arn))
+	}
+
+	resource := strings.TrimPrefix(*arn, awsPolicyPrefix)
+	name := resource[strings.LastIndex(resource, "/")+1:]
+	now := aws.Time(time.Now())
+	p := &policy{
+		Policy: &iam.Policy{
+			PolicyName:       aws.String(name),
+			PolicyId:         aws.String(newID("ANPA")),
+			Arn:              arn,
+			Path:             aws.String("/" + strings.TrimSuffix(resource, name)),
+			DefaultVersionId: aws.String("v1"),
+			IsAttachable:     aws.Bool(true),
+			CreateDate:       now,
+			UpdateDate:       now,
+		},
+		versions: []*iam.PolicyVersion{{
+			VersionId:        aws.String("v1"),
+			Document:         aws.String(`{"Version":"2012-10-17","Statement":[]}`),
+			IsDefaultVersion: aws.Bool(true),
+			CreateDate:       now,
+		}},
+		nextVersion: 2,
+	}
+	b.policies[*arn] = p
+	return p, nil
+}
+
+func (b *Backend) attachmentCount(p *policy) int64 {
+	var count int64
+	for _, u := range b.users {
+		if u.isAttached(p) {
+			count++
+		}
+	}
+	for _, g := range b.groups {
+		if g.isAttached(p) {
+			count++
+		}
+	}
+	for _, r := range b.roles {
+		if r.isAttached(p) {
+			count++
+		}
+	}
+	return count
+}
+
+func (b *Backend) describePolicy(p *policy) *iam.Policy {
+	description := *p.Policy
+	description.AttachmentCount = aws.Int64(b.attachmentCount(p))
+	return &description
+}
+
+func describeVersion(v *iam.PolicyVersion) *iam.PolicyVersion {
+	description := *v
+	description.Document = encodeDocument(*v.Document)
+	return &description
+}
+
+func (p *policy) findVersion(id *string) (*iam.PolicyVersion, error) {
+	for _, v := range p.versions {
+		if *v.VersionId == aws.StringValue(id) {
+			return v, nil
+		}
+	}
+	return nil, noSuchEntity("Policy %s version %s does not exist or is not attachable.", *p.Arn, aws.StringValue(id))
+}
+
+func (p *policy) setDefault(version *iam.PolicyVersion) {
+	for _, v := range p.versions {
+		v.IsDefaultVersion = aws.Bool(v == version)
+	}
+	p.DefaultVersionId = version.VersionId
+	p.UpdateDate = aws.Time(time.Now())
+}
+
+// CreatePolicy creates a managed policy, with the document as its first
+// version
+func (b *Backend) CreatePolicy(input *iam.CreatePolicyInput) (*iam.CreatePolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := checkName(input.PolicyName, "policyName", 128); err != nil {
+		return nil, err
+	}
+	path, err := checkPath(input.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDocument(input.PolicyDocument); err != nil {
+		return nil, err
+	}
+	for _, p := range b.policies {
+		if !strings.HasPrefix(*p.Arn, awsPolicyPrefix) && key(p.PolicyName) == key(input.PolicyName) {
+			return nil, entityAlreadyExists("A policy called %s already exists. Duplicate names are not allowed.", *input.PolicyName)
+		}
+	}
+
+	now := aws.Time(time.Now())
+	p := &policy{
+		Policy: &iam.Policy{
+			PolicyName:       input.PolicyName,
+			PolicyId:         aws.String(newID("ANPA")),
+			Arn:              aws.String(b.arn("policy", path, *input.PolicyName)),
+			Path:             aws.String(path),
+			Description:      input.Description,
+			DefaultVersionId: aws.String("v1"),
+			IsAttachable:     aws.Bool(true),
+			CreateDate:       now,
+			UpdateDate:       now,
+		},
+		versions: []*iam.PolicyVersion{{
+			VersionId:        aws.String("v1"),
+			Document:         input.PolicyDocument,
+			IsDefaultVersion: aws.Bool(true),
+			CreateDate:       now,
+		}},
+		nextVersion: 2,
+	}
+	b.policies[*p.Arn] = p
+	return &iam.CreatePolicyOutput{Policy: b.describePolicy(p)}, nil
+}
+
+// GetPolicy describes a managed policy
+func (b *Backend) GetPolicy(input *iam.GetPolicyInput) (*iam.GetPolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetPolicyOutput{Policy: b.describePolicy(p)}, nil
+}
+
+// DeletePolicy deletes a managed policy that is attached to nothing, and
+// that has no versions other than the default
+func (b *Backend) DeletePolicy(input *iam.DeletePolicyInput) (*iam.DeletePolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	if b.attachmentCount(p) > 0 {
+		return nil, deleteConflict("Cannot delete a policy attached to entities.")
+	}
+	if len(p.versions) > 1 {
+		return nil, deleteConflict("This policy has more than one version. Before you delete a policy, you must delete the policy's versions. The default version is deleted with the policy.")
+	}
+	delete(b.policies, *p.Arn)
+	return &iam.DeletePolicyOutput{}, nil
+}
+
+// ListPolicies lists managed policies, by scope, path prefix, and whether
+// they are attached
+func (b *Backend) ListPolicies(input *iam.ListPoliciesInput) (*iam.ListPoliciesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	byKey := map[string]*policy{}
+	var keys []string
+	for arn, p := range b.policies {
+		isAWS := strings.HasPrefix(arn, awsPolicyPrefix)
+		switch {
+		case aws.StringValue(input.Scope) == iam.PolicyScopeTypeAws && !isAWS,
+			aws.StringValue(input.Scope) == iam.PolicyScopeTypeLocal && isAWS,
+			aws.BoolValue(input.OnlyAttached) && b.attachmentCount(p) == 0,
+			!hasPathPrefix(p.Path, input.PathPrefix):
+			continue
+		}
+		byKey[policyKey(p)] = p
+		keys = append(keys, policyKey(p))
+	}
+	sort.Strings(keys)
+	from, to, marker, err := page(keys, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &iam.ListPoliciesOutput{Policies: []*iam.Policy{}, IsTruncated: aws.Bool(marker != nil), Marker: marker}
+	for _, k := range keys[from:to] {
+		output.Policies = append(output.Policies, b.describePolicy(byKey[k]))
+	}
+	return output, nil
+}
+
+// CreatePolicyVersion adds a version to a managed policy, which may have up
+// to five versions
+func (b *Backend) CreatePolicyVersion(input *iam.CreatePolicyVersionInput) (*iam.CreatePolicyVersionOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDocument(input.PolicyDocument); err != nil {
+		return nil, err
+	}
+	if len(p.versions) >= 5 {
+		return nil, limitExceeded("A managed policy can have up to 5 versions. Before you create a new version, you must delete an existing version.")
+	}
+
+	version := &iam.PolicyVersion{
+		VersionId:        aws.String(fmt.Sprintf("v%d", p.nextVersion)),
+		Document:         input.PolicyDocument,
+		IsDefaultVersion: aws.Bool(false),
+		CreateDate:       aws.Time(time.Now()),
+	}
+	p.nextVersion++
+	p.versions = append(p.versions, version)
+	if aws.BoolValue(input.SetAsDefault) {
+		p.setDefault(version)
+	}
+	return &iam.CreatePolicyVersionOutput{PolicyVersion: describeVersion(version)}, nil
+}
+
+// GetPolicyVersion returns a version of a managed policy
+func (b *Backend) GetPolicyVersion(input *iam.GetPolicyVersionInput) (*iam.GetPolicyVersionOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	version, err := p.findVersion(input.VersionId)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetPolicyVersionOutput{PolicyVersion: describeVersion(version)}, nil
+}
+
+// ListPolicyVersions lists the versions of a managed policy, most recent
+// first
+func (b *Backend) ListPolicyVersions(input *iam.ListPolicyVersionsInput) (*iam.ListPolicyVersionsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(p.versions))
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%05d", i)
+	}
+	from, to, marker, err := page(keys, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &iam.ListPolicyVersionsOutput{Versions: []*iam.PolicyVersion{}, IsTruncated: aws.Bool(marker != nil), Marker: marker}
+	for i := from; i < to; i++ {
+		version := describeVersion(p.versions[len(p.versions)-1-i])
+		version.Document = nil
+		output.Versions = append(output.Versions, version)
+	}
+	return output, nil
+}
+
+// SetDefaultPolicyVersion makes a version the one that is in effect
+func (b *Backend) SetDefaultPolicyVersion(input *iam.SetDefaultPolicyVersionInput) (*iam.SetDefaultPolicyVersionOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	version, err := p.findVersion(input.VersionId)
+	if err != nil {
+		return nil, err
+	}
+	p.setDefault(version)
+	return &iam.SetDefaultPolicyVersionOutput{}, nil
+}
+
+// DeletePolicyVersion deletes a version of a managed policy, other than the
+// default version
+func (b *Backend) DeletePolicyVersion(input *iam.DeletePolicyVersionInput) (*iam.DeletePolicyVersionOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	version, err := p.findVersion(input.VersionId)
+	if err != nil {
+		return nil, err
+	}
+	if aws.BoolValue(version.IsDefaultVersion) {
+		return nil, deleteConflict("Cannot delete the default version of a policy.")
+	}
+	var versions []*iam.PolicyVersion
+	for _, v := range p.versions {
+		if v != version {
+			versions = append(versions, v)
+		}
+	}
+	p.versions = versions
+	return &iam.DeletePolicyVersionOutput{}, nil
+}
+
+// AttachUserPolicy attaches a managed policy to a user
+func (b *Backend) AttachUserPolicy(input *iam.AttachUserPolicyInput) (*iam.AttachUserPolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, err := b.findUser(input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.attach(p, "User"); err != nil {
+		return nil, err
+	}
+	return &iam.AttachUserPolicyOutput{}, nil
+}
+
+// DetachUserPolicy detaches a managed policy from a user
+func (b *Backend) DetachUserPolicy(input *iam.DetachUserPolicyInput) (*iam.DetachUserPolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, err := b.findUser(input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.detach(p); err != nil {
+		return nil, err
+	}
+	return &iam.DetachUserPolicyOutput{}, nil
+}
+
+// ListAttachedUserPolicies lists the managed policies attached to a user
+func (b *Backend) ListAttachedUserPolicies(input *iam.ListAttachedUserPoliciesInput) (*iam.ListAttachedUserPoliciesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, err := b.findUser(input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	attached, marker, err := u.listAttached(input.PathPrefix, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListAttachedUserPoliciesOutput{AttachedPolicies: attached, IsTruncated: aws.Bool(marker != nil), Marker: marker}, nil
+}
+
+// AttachGroupPolicy attaches a managed policy to a group
+func (b *Backend) AttachGroupPolicy(input *iam.AttachGroupPolicyInput) (*iam.AttachGroupPolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, err := b.findGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.attach(p, "Group"); err != nil {
+		return nil, err
+	}
+	return &iam.AttachGroupPolicyOutput{}, nil
+}
+
+// DetachGroupPolicy detaches a managed policy from a group
+func (b *Backend) DetachGroupPolicy(input *iam.DetachGroupPolicyInput) (*iam.DetachGroupPolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, err := b.findGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.detach(p); err != nil {
+		return nil, err
+	}
+	return &iam.DetachGroupPolicyOutput{}, nil
+}
+
+// ListAttachedGroupPolicies lists the managed policies attached to a group
+func (b *Backend) ListAttachedGroupPolicies(input *iam.ListAttachedGroupPoliciesInput) (*iam.ListAttachedGroupPoliciesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, err := b.findGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	attached, marker, err := g.listAttached(input.PathPrefix, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListAttachedGroupPoliciesOutput{AttachedPolicies: attached, IsTruncated: aws.Bool(marker != nil), Marker: marker}, nil
+}
+
+// AttachRolePolicy attaches a managed policy to a role
+func (b *Backend) AttachRolePolicy(input *iam.AttachRolePolicyInput) (*iam.AttachRolePolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.attach(p, "Role"); err != nil {
+		return nil, err
+	}
+	return &iam.AttachRolePolicyOutput{}, nil
+}
+
+// DetachRolePolicy detaches a managed policy from a role
+func (b *Backend) DetachRolePolicy(input *iam.DetachRolePolicyInput) (*iam.DetachRolePolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	p, err := b.findPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.detach(p); err != nil {
+		return nil, err
+	}
+	return &iam.DetachRolePolicyOutput{}, nil
+}
+
+// ListAttachedRolePolicies lists the managed policies attached to a role
+func (b *Backend) ListAttachedRolePolicies(input *iam.ListAttachedRolePoliciesInput) (*iam.ListAttachedRolePoliciesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	attached, marker, err := r.listAttached(input.PathPrefix, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListAttachedRolePoliciesOutput{AttachedPolicies: attached, IsTruncated: aws.Bool(marker != nil), Marker: marker}, nil
+}
+
+// PutUserPolicy adds or replaces an inline policy of a user
+func (b *Backend) PutUserPolicy(input *iam.PutUserPolicyInput) (*iam.PutUserPolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, err := b.findUser(input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.putInline(input.PolicyName, input.PolicyDocument); err != nil {
+		return nil, err
+	}
+	return &iam.PutUserPolicyOutput{}, nil
+}
+
+// GetUserPolicy returns an inline policy of a user
+func (b *Backend) GetUserPolicy(input *iam.GetUserPolicyInput) (*iam.GetUserPolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, err := b.findUser(input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	inline, err := u.getInline(input.PolicyName, "user")
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetUserPolicyOutput{
+		UserName:       u.UserName,
+		PolicyName:     aws.String(inline.name),
+		PolicyDocument: encodeDocument(inline.document),
+	}, nil
+}
+
+// DeleteUserPolicy deletes an inline policy of a user
+func (b *Backend) DeleteUserPolicy(input *iam.DeleteUserPolicyInput) (*iam.DeleteUserPolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, err := b.findUser(input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.deleteInline(input.PolicyName, "user"); err != nil {
+		return nil, err
+	}
+	return &iam.DeleteUserPolicyOutput{}, nil
+}
+
+// ListUserPolicies lists the names of the inline policies of a user
+func (b *Backend) ListUserPolicies(input *iam.ListUserPoliciesInput) (*iam.ListUserPoliciesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, err := b.findUser(input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	names, marker, err := u.listInline(input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListUserPoliciesOutput{PolicyNames: names, IsTruncated: aws.Bool(marker != nil), Marker: marker}, nil
+}
+
+// PutGroupPolicy adds or replaces an inline policy of a group
+func (b *Backend) PutGroupPolicy(input *iam.PutGroupPolicyInput) (*iam.PutGroupPolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, err := b.findGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.putInline(input.PolicyName, input.PolicyDocument); err != nil {
+		return nil, err
+	}
+	return &iam.PutGroupPolicyOutput{}, nil
+}
+
+// GetGroupPolicy returns an inline policy of a group
+func (b *Backend) GetGroupPolicy(input *iam.GetGroupPolicyInput) (*iam.GetGroupPolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, err := b.findGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	inline, err := g.getInline(input.PolicyName, "group")
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetGroupPolicyOutput{
+		GroupName:      g.GroupName,
+		PolicyName:     aws.String(inline.name),
+		PolicyDocument: encodeDocument(inline.document),
+	}, nil
+}
+
+// DeleteGroupPolicy deletes an inline policy of a group
+func (b *Backend) DeleteGroupPolicy(input *iam.DeleteGroupPolicyInput) (*iam.DeleteGroupPolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, err := b.findGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.deleteInline(input.PolicyName, "group"); err != nil {
+		return nil, err
+	}
+	return &iam.DeleteGroupPolicyOutput{}, nil
+}
+
+// ListGroupPolicies lists the names of the inline policies of a group
+func (b *Backend) ListGroupPolicies(input *iam.ListGroupPoliciesInput) (*iam.ListGroupPoliciesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, err := b.findGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	names, marker, err := g.listInline(input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListGroupPoliciesOutput{PolicyNames: names, IsTruncated: aws.Bool(marker != nil), Marker: marker}, nil
+}
+
+// PutRolePolicy adds or replaces an inline policy of a role
+func (b *Backend) PutRolePolicy(input *iam.PutRolePolicyInput) (*iam.PutRolePolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.putInline(input.PolicyName, input.PolicyDocument); err != nil {
+		return nil, err
+	}
+	return &iam.PutRolePolicyOutput{}, nil
+}
+
+// GetRolePolicy returns an inline policy of a role
+func (b *Backend) GetRolePolicy(input *iam.GetRolePolicyInput) (*iam.GetRolePolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	inline, err := r.getInline(input.PolicyName, "role")
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetRolePolicyOutput{
+		RoleName:       r.RoleName,
+		PolicyName:     aws.String(inline.name),
+		PolicyDocument: encodeDocument(inline.document),
+	}, nil
+}
+
+// DeleteRolePolicy deletes an inline policy of a role
+func (b *Backend) DeleteRolePolicy(input *iam.DeleteRolePolicyInput) (*iam.DeleteRolePolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.deleteInline(input.PolicyName, "role"); err != nil {
+		return nil, err
+	}
+	return &iam.DeleteRolePolicyOutput{}, nil
+}
+
+// ListRolePolicies lists the names of the inline policies of a role
+func (b *Backend) ListRolePolicies(input *iam.ListRolePoliciesInput) (*iam.ListRolePoliciesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	names, marker, err := r.listInline(input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListRolePoliciesOutput{PolicyNames: names, IsTruncated: aws.Bool(marker != nil), Marker: marker}, nil
+}
@@ -0,0 +1,334 @@
+package iam
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+type role struct {
+	*iam.Role
+	policies
+	assumeRolePolicy string
+}
+
+type instanceProfile struct {
+	*iam.InstanceProfile
+	roles []*role
+}
+
+func (b *Backend) findRole(name *string) (*role, error) {
+	r, ok := b.roles[key(name)]
+	if !ok {
+		return nil, noSuchEntity("The role with name %s cannot be found.", aws.StringValue(name))
+	}
+	return r, nil
+}
+
+func (b *Backend) findInstanceProfile(name *string) (*instanceProfile, error) {
+	p, ok := b.instanceProfiles[key(name)]
+	if !ok {
+		return nil, noSuchEntity("Instance Profile %s cannot be found.", aws.StringValue(name))
+	}
+	return p, nil
+}
+
+func (b *Backend) instanceProfilesOf(r *role) []*instanceProfile {
+	var profiles []*instanceProfile
+	for _, p := range b.instanceProfiles {
+		if p.hasRole(r) {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles
+}
+
+func (p *instanceProfile) hasRole(r *role) bool {
+	for _, member := range p.roles {
+		if member == r {
+			return true
+		}
+	}
+	return false
+}
+
+func describeRole(r *role) *iam.Role {
+	description := *r.Role
+	description.AssumeRolePolicyDocument = encodeDocument(r.assumeRolePolicy)
+	return &description
+}
+
+func describeInstanceProfile(p *instanceProfile) *iam.InstanceProfile {
+	description := *p.InstanceProfile
+	description.Roles = []*iam.Role{}
+	for _, r := range p.roles {
+		description.Roles = append(description.Roles, describeRole(r))
+	}
+	return &description
+}
+
+// CreateRole creates a role that may be assumed by the principals that its
+// trust policy allows
+func (b *Backend) CreateRole(input *iam.CreateRoleInput) (*iam.CreateRoleOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := checkName(input.RoleName, "roleName", 64); err != nil {
+		return nil, err
+	}
+	path, err := checkPath(input.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDocument(input.AssumeRolePolicyDocument); err != nil {
+		return nil, err
+	}
+	if _, exists := b.roles[key(input.RoleName)]; exists {
+		return nil, entityAlreadyExists("Role with name %s already exists.", *input.RoleName)
+	}
+
+	r := &role{
+		Role: &iam.Role{
+			RoleName:    input.RoleName,
+			Path:        aws.String(path),
+			RoleId:      aws.String(newID("AROA")),
+			Arn:         aws.String(b.arn("role", path, *input.RoleName)),
+			Description: input.Description,
+			CreateDate:  aws.Time(time.Now()),
+		},
+		policies:         newPolicies(),
+		assumeRolePolicy: *input.AssumeRolePolicyDocument,
+	}
+	b.roles[key(input.RoleName)] = r
+	return &iam.CreateRoleOutput{Role: describeRole(r)}, nil
+}
+
+// GetRole describes a role
+func (b *Backend) GetRole(input *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetRoleOutput{Role: describeRole(r)}, nil
+}
+
+// DeleteRole deletes a role that has no policies and is in no instance
+// profile
+func (b *Backend) DeleteRole(input *iam.DeleteRoleInput) (*iam.DeleteRoleOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(b.instanceProfilesOf(r)) > 0:
+		return nil, deleteConflict("Cannot delete entity, must remove roles from instance profile first.")
+	case len(r.inline) > 0:
+		return nil, deleteConflict("Cannot delete entity, must delete policies first.")
+	case len(r.attached) > 0:
+		return nil, deleteConflict("Cannot delete entity, must detach all policies first.")
+	}
+	delete(b.roles, key(input.RoleName))
+	return &iam.DeleteRoleOutput{}, nil
+}
+
+// ListRoles lists the roles with the path prefix
+func (b *Backend) ListRoles(input *iam.ListRolesInput) (*iam.ListRolesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var keys []string
+	for k, r := range b.roles {
+		if hasPathPrefix(r.Path, input.PathPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	from, to, marker, err := page(keys, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &iam.ListRolesOutput{Roles: []*iam.Role{}, IsTruncated: aws.Bool(marker != nil), Marker: marker}
+	for _, k := range keys[from:to] {
+		output.Roles = append(output.Roles, describeRole(b.roles[k]))
+	}
+	return output, nil
+}
+
+// UpdateAssumeRolePolicy replaces the trust policy of a role
+func (b *Backend) UpdateAssumeRolePolicy(input *iam.UpdateAssumeRolePolicyInput) (*iam.UpdateAssumeRolePolicyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDocument(input.PolicyDocument); err != nil {
+		return nil, err
+	}
+	r.assumeRolePolicy = *input.PolicyDocument
+	return &iam.UpdateAssumeRolePolicyOutput{}, nil
+}
+
+// CreateInstanceProfile creates an instance profile with no role
+func (b *Backend) CreateInstanceProfile(input *iam.CreateInstanceProfileInput) (*iam.CreateInstanceProfileOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := checkName(input.InstanceProfileName, "instanceProfileName", 128); err != nil {
+		return nil, err
+	}
+	path, err := checkPath(input.Path)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := b.instanceProfiles[key(input.InstanceProfileName)]; exists {
+		return nil, entityAlreadyExists("Instance Profile %s already exists.", *input.InstanceProfileName)
+	}
+
+	p := &instanceProfile{
+		InstanceProfile: &iam.InstanceProfile{
+			InstanceProfileName: input.InstanceProfileName,
+			Path:                aws.String(path),
+			InstanceProfileId:   aws.String(newID("AIPA")),
+			Arn:                 aws.String(b.arn("instance-profile", path, *input.InstanceProfileName)),
+			CreateDate:          aws.Time(time.Now()),
+		},
+	}
+	b.instanceProfiles[key(input.InstanceProfileName)] = p
+	return &iam.CreateInstanceProfileOutput{InstanceProfile: describeInstanceProfile(p)}, nil
+}
+
+// GetInstanceProfile describes an instance profile and its role
+func (b *Backend) GetInstanceProfile(input *iam.GetInstanceProfileInput) (*iam.GetInstanceProfileOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	p, err := b.findInstanceProfile(input.InstanceProfileName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetInstanceProfileOutput{InstanceProfile: describeInstanceProfile(p)}, nil
+}
+
+// DeleteInstanceProfile deletes an instance profile that has no role
+func (b *Backend) DeleteInstanceProfile(input *iam.DeleteInstanceProfileInput) (*iam.DeleteInstanceProfileOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	p, err := b.findInstanceProfile(input.InstanceProfileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.roles) > 0 {
+		return nil, deleteConflict("Cannot delete entity, must remove roles from instance profile first.")
+	}
+	delete(b.instanceProfiles, key(input.InstanceProfileName))
+	return &iam.DeleteInstanceProfileOutput{}, nil
+}
+
+// ListInstanceProfiles lists the instance profiles with the path prefix
+func (b *Backend) ListInstanceProfiles(input *iam.ListInstanceProfilesInput) (*iam.ListInstanceProfilesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var keys []string
+	for k, p := range b.instanceProfiles {
+		if hasPathPrefix(p.Path, input.PathPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	from, to, marker, err := page(keys, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &iam.ListInstanceProfilesOutput{InstanceProfiles: []*iam.InstanceProfile{}, IsTruncated: aws.Bool(marker != nil), Marker: marker}
+	for _, k := range keys[from:to] {
+		output.InstanceProfiles = append(output.InstanceProfiles, describeInstanceProfile(b.instanceProfiles[k]))
+	}
+	return output, nil
+}
+
+// ListInstanceProfilesForRole lists the instance profiles that hold a role
+func (b *Backend) ListInstanceProfilesForRole(input *iam.ListInstanceProfilesForRoleInput) (*iam.ListInstanceProfilesForRoleOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, p := range b.instanceProfilesOf(r) {
+		keys = append(keys, key(p.InstanceProfileName))
+	}
+	sort.Strings(keys)
+	from, to, marker, err := page(keys, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &iam.ListInstanceProfilesForRoleOutput{InstanceProfiles: []*iam.InstanceProfile{}, IsTruncated: aws.Bool(marker != nil), Marker: marker}
+	for _, k := range keys[from:to] {
+		output.InstanceProfiles = append(output.InstanceProfiles, describeInstanceProfile(b.instanceProfiles[k]))
+	}
+	return output, nil
+}
+
+// AddRoleToInstanceProfile puts a role in an instance profile, which may
+// hold only one
+func (b *Backend) AddRoleToInstanceProfile(input *iam.AddRoleToInstanceProfileInput) (*iam.AddRoleToInstanceProfileOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	p, err := b.findInstanceProfile(input.InstanceProfileName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.roles) > 0 {
+		return nil, limitExceeded("Cannot exceed quota for InstanceSessionsPerInstanceProfile: 1")
+	}
+	p.roles = append(p.roles, r)
+	return &iam.AddRoleToInstanceProfileOutput{}, nil
+}
+
+// RemoveRoleFromInstanceProfile takes a role out of an instance profile
+func (b *Backend) RemoveRoleFromInstanceProfile(input *iam.RemoveRoleFromInstanceProfileInput) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	p, err := b.findInstanceProfile(input.InstanceProfileName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := b.findRole(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	if !p.hasRole(r) {
+		return nil, noSuchEntity("The role with name %s cannot be found in instance profile %s.", *input.RoleName, *input.InstanceProfileName)
+	}
+	var roles []*role
+	for _, member := range p.roles {
+		if member != r {
+			roles = append(roles, member)
+		}
+	}
+	p.roles = roles
+	return &iam.RemoveRoleFromInstanceProfileOutput{}, nil
+}
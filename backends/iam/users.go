@@ -0,0 +1,457 @@
+package iam
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/rosenhouse/awsfaker"
+	"github.com/rosenhouse/awsfaker/internal/random"
+)
+
+type user struct {
+	*iam.User
+	policies
+	accessKeys []*accessKey
+}
+
+type accessKey struct {
+	*iam.AccessKeyMetadata
+	secret string
+}
+
+type group struct {
+	*iam.Group
+	policies
+	users []*user
+}
+
+func (g *group) hasUser(u *user) bool {
+	for _, member := range g.users {
+		if member == u {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Backend) findUser(name *string) (*user, error) {
+	u, ok := b.users[key(name)]
+	if !ok {
+		return nil, noSuchEntity("The user with name %s cannot be found.", aws.StringValue(name))
+	}
+	return u, nil
+}
+
+func (b *Backend) findGroup(name *string) (*group, error) {
+	g, ok := b.groups[key(name)]
+	if !ok {
+		return nil, noSuchEntity("The group with name %s cannot be found.", aws.StringValue(name))
+	}
+	return g, nil
+}
+
+func (b *Backend) findAccessKey(id string) (*user, *accessKey) {
+	for _, u := range b.users {
+		for _, k := range u.accessKeys {
+			if *k.AccessKeyId == id {
+				return u, k
+			}
+		}
+	}
+	return nil, nil
+}
+
+// caller returns the named user, or else the user whose access key signed
+// the request, as IAM does for calls that act on the caller by default
+func (b *Backend) caller(ctx context.Context, name *string) (*user, error) {
+	if name != nil {
+		return b.findUser(name)
+	}
+	info, _ := awsfaker.RequestInfoFromContext(ctx)
+	if u, _ := b.findAccessKey(info.AccessKeyID); u != nil {
+		return u, nil
+	}
+	return nil, validationError("Must specify userName when calling with non-User credentials")
+}
+
+func (b *Backend) groupsOf(u *user) []*group {
+	var groups []*group
+	for _, g := range b.groups {
+		if g.hasUser(u) {
+			groups = append(groups, g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return key(groups[i].GroupName) < key(groups[j].GroupName) })
+	return groups
+}
+
+// CreateUser creates a user
+func (b *Backend) CreateUser(input *iam.CreateUserInput) (*iam.CreateUserOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := checkName(input.UserName, "userName", 64); err != nil {
+		return nil, err
+	}
+	path, err := checkPath(input.Path)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := b.users[key(input.UserName)]; exists {
+		return nil, entityAlreadyExists("User with name %s already exists.", *input.UserName)
+	}
+
+	u := &user{
+		User: &iam.User{
+			UserName:   input.UserName,
+			Path:       aws.String(path),
+			UserId:     aws.String(newID("AIDA")),
+			Arn:        aws.String(b.arn("user", path, *input.UserName)),
+			CreateDate: aws.Time(time.Now()),
+		},
+		policies: newPolicies(),
+	}
+	b.users[key(input.UserName)] = u
+	return &iam.CreateUserOutput{User: u.User}, nil
+}
+
+// GetUser describes the named user, or the user making the request
+func (b *Backend) GetUser(ctx context.Context, input *iam.GetUserInput) (*iam.GetUserOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, err := b.caller(ctx, input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetUserOutput{User: u.User}, nil
+}
+
+// DeleteUser deletes a user that has no access keys or policies, and that
+// is in no groups
+func (b *Backend) DeleteUser(input *iam.DeleteUserInput) (*iam.DeleteUserOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, err := b.findUser(input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(u.accessKeys) > 0:
+		return nil, deleteConflict("Cannot delete entity, must delete access keys first.")
+	case len(u.inline) > 0:
+		return nil, deleteConflict("Cannot delete entity, must delete policies first.")
+	case len(u.attached) > 0:
+		return nil, deleteConflict("Cannot delete entity, must detach all policies first.")
+	case len(b.groupsOf(u)) > 0:
+		return nil, deleteConflict("Cannot delete entity, must remove users from group first.")
+	}
+	delete(b.users, key(input.UserName))
+	return &iam.DeleteUserOutput{}, nil
+}
+
+// ListUsers lists users, by path prefix
+func (b *Backend) ListUsers(input *iam.ListUsersInput) (*iam.ListUsersOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var keys []string
+	for k, u := range b.users {
+		if hasPathPrefix(u.Path, input.PathPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	from, to, marker, err := page(keys, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &iam.ListUsersOutput{Users: []*iam.User{}, IsTruncated: aws.Bool(marker != nil), Marker: marker}
+	for _, k := range keys[from:to] {
+		output.Users = append(output.Users, b.users[k].User)
+	}
+	return output, nil
+}
+
+// CreateGroup creates a group
+func (b *Backend) CreateGroup(input *iam.CreateGroupInput) (*iam.CreateGroupOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := checkName(input.GroupName, "groupName", 128); err != nil {
+		return nil, err
+	}
+	path, err := checkPath(input.Path)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := b.groups[key(input.GroupName)]; exists {
+		return nil, entityAlreadyExists("Group with name %s already exists.", *input.GroupName)
+	}
+
+	g := &group{
+		Group: &iam.Group{
+			GroupName:  input.GroupName,
+			Path:       aws.String(path),
+			GroupId:    aws.String(newID("AGPA")),
+			Arn:        aws.String(b.arn("group", path, *input.GroupName)),
+			CreateDate: aws.Time(time.Now()),
+		},
+		policies: newPolicies(),
+	}
+	b.groups[key(input.GroupName)] = g
+	return &iam.CreateGroupOutput{Group: g.Group}, nil
+}
+
+// GetGroup describes a group, and lists its users
+func (b *Backend) GetGroup(input *iam.GetGroupInput) (*iam.GetGroupOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, err := b.findGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, u := range g.users {
+		keys = append(keys, key(u.UserName))
+	}
+	sort.Strings(keys)
+	from, to, marker, err := page(keys, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &iam.GetGroupOutput{Group: g.Group, Users: []*iam.User{}, IsTruncated: aws.Bool(marker != nil), Marker: marker}
+	for _, k := range keys[from:to] {
+		output.Users = append(output.Users, b.users[k].User)
+	}
+	return output, nil
+}
+
+// DeleteGroup deletes a group that has no users or policies
+func (b *Backend) DeleteGroup(input *iam.DeleteGroupInput) (*iam.DeleteGroupOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, err := b.findGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(g.users) > 0:
+		return nil, deleteConflict("Cannot delete entity, must remove users from group first.")
+	case len(g.inline) > 0:
+		return nil, deleteConflict("Cannot delete entity, must delete policies first.")
+	case len(g.attached) > 0:
+		return nil, deleteConflict("Cannot delete entity, must detach all policies first.")
+	}
+	delete(b.groups, key(input.GroupName))
+	return &iam.DeleteGroupOutput{}, nil
+}
+
+// ListGroups lists groups, by path prefix
+func (b *Backend) ListGroups(input *iam.ListGroupsInput) (*iam.ListGroupsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var keys []string
+	for k, g := range b.groups {
+		if hasPathPrefix(g.Path, input.PathPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	from, to, marker, err := page(keys, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &iam.ListGroupsOutput{Groups: []*iam.Group{}, IsTruncated: aws.Bool(marker != nil), Marker: marker}
+	for _, k := range keys[from:to] {
+		output.Groups = append(output.Groups, b.groups[k].Group)
+	}
+	return output, nil
+}
+
+// ListGroupsForUser lists the groups that a user is in
+func (b *Backend) ListGroupsForUser(input *iam.ListGroupsForUserInput) (*iam.ListGroupsForUserOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, err := b.findUser(input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	groups := b.groupsOf(u)
+	keys := make([]string, len(groups))
+	for i, g := range groups {
+		keys[i] = key(g.GroupName)
+	}
+	from, to, marker, err := page(keys, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &iam.ListGroupsForUserOutput{Groups: []*iam.Group{}, IsTruncated: aws.Bool(marker != nil), Marker: marker}
+	for _, g := range groups[from:to] {
+		output.Groups = append(output.Groups, g.Group)
+	}
+	return output, nil
+}
+
+// AddUserToGroup adds a user to a group, if the user is not already in it
+func (b *Backend) AddUserToGroup(input *iam.AddUserToGroupInput) (*iam.AddUserToGroupOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, err := b.findGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	u, err := b.findUser(input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if !g.hasUser(u) {
+		g.users = append(g.users, u)
+	}
+	return &iam.AddUserToGroupOutput{}, nil
+}
+
+// RemoveUserFromGroup removes a user from a group
+func (b *Backend) RemoveUserFromGroup(input *iam.RemoveUserFromGroupInput) (*iam.RemoveUserFromGroupOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, err := b.findGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	u, err := b.findUser(input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if !g.hasUser(u) {
+		return nil, noSuchEntity("User %s is not in group %s.", *u.UserName, *g.GroupName)
+	}
+	var users []*user
+	for _, member := range g.users {
+		if member != u {
+			users = append(users, member)
+		}
+	}
+	g.users = users
+	return &iam.RemoveUserFromGroupOutput{}, nil
+}
+
+// CreateAccessKey creates an access key for the named user, or for the user
+// making the request.  A user may have two access keys.
+func (b *Backend) CreateAccessKey(ctx context.Context, input *iam.CreateAccessKeyInput) (*iam.CreateAccessKeyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, err := b.caller(ctx, input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.accessKeys) >= 2 {
+		return nil, limitExceeded("Cannot exceed quota for AccessKeysPerUser: 2")
+	}
+
+	k := &accessKey{
+		AccessKeyMetadata: &iam.AccessKeyMetadata{
+			UserName:    u.UserName,
+			AccessKeyId: aws.String("AKIA" + random.Upper(16)),
+			Status:      aws.String(iam.StatusTypeActive),
+			CreateDate:  aws.Time(time.Now()),
+		},
+		secret: random.Alphanumeric(40),
+	}
+	u.accessKeys = append(u.accessKeys, k)
+	return &iam.CreateAccessKeyOutput{AccessKey: &iam.AccessKey{
+		UserName:        k.UserName,
+		AccessKeyId:     k.AccessKeyId,
+		Status:          k.Status,
+		CreateDate:      k.CreateDate,
+		SecretAccessKey: aws.String(k.secret),
+	}}, nil
+}
+
+// ListAccessKeys lists the access keys of the named user, or of the user
+// making the request
+func (b *Backend) ListAccessKeys(ctx context.Context, input *iam.ListAccessKeysInput) (*iam.ListAccessKeysOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, err := b.caller(ctx, input.UserName)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(u.accessKeys))
+	for i, k := range u.accessKeys {
+		keys[i] = *k.AccessKeyId
+	}
+	sort.Strings(keys)
+	from, to, marker, err := page(keys, input.Marker, input.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &iam.ListAccessKeysOutput{AccessKeyMetadata: []*iam.AccessKeyMetadata{}, IsTruncated: aws.Bool(marker != nil), Marker: marker}
+	for _, id := range keys[from:to] {
+		_, k := b.findAccessKey(id)
+		output.AccessKeyMetadata = append(output.AccessKeyMetadata, k.AccessKeyMetadata)
+	}
+	return output, nil
+}
+
+func (b *Backend) findUserAccessKey(ctx context.Context, userName *string, id string) (*user, *accessKey, error) {
+	u, err := b.caller(ctx, userName)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, k := range u.accessKeys {
+		if *k.AccessKeyId == id {
+			return u, k, nil
+		}
+	}
+	return nil, nil, noSuchEntity("The Access Key with id %s cannot be found.", id)
+}
+
+// UpdateAccessKey activates or deactivates an access key
+func (b *Backend) UpdateAccessKey(ctx context.Context, input *iam.UpdateAccessKeyInput) (*iam.UpdateAccessKeyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	_, k, err := b.findUserAccessKey(ctx, input.UserName, aws.StringValue(input.AccessKeyId))
+	if err != nil {
+		return nil, err
+	}
+	k.Status = input.Status
+	return &iam.UpdateAccessKeyOutput{}, nil
+}
+
+// DeleteAccessKey deletes an access key
+func (b *Backend) DeleteAccessKey(ctx context.Context, input *iam.DeleteAccessKeyInput) (*iam.DeleteAccessKeyOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	u, k, err := b.findUserAccessKey(ctx, input.UserName, aws.StringValue(input.AccessKeyId))
+	if err != nil {
+		return nil, err
+	}
+	var keys []*accessKey
+	for _, other := range u.accessKeys {
+		if other != k {
+			keys = append(keys, other)
+		}
+	}
+	u.accessKeys = keys
+	return &iam.DeleteAccessKeyOutput{}, nil
+}
@@ -0,0 +1,230 @@
+// Package s3 is a ready-made backend for a fake Amazon Simple Storage
+// Service, which keeps its buckets and objects in memory, or their contents
+// in a directory.
+//
+// Objects have the ETags of the real service: the MD5 of the content, or for
+// multipart uploads the MD5 of the part digests followed by the number of
+// parts.  Versioned buckets keep every version and add delete markers, GETs
+// honour Range and the If-Match family of headers, and a Content-MD5 that
+// does not match the content is refused with BadDigest.
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/rosenhouse/awsfaker"
+)
+
+// DefaultMinPartSize is the smallest size that S3 allows for the parts of a
+// multipart upload, other than the last
+const DefaultMinPartSize = 5 * 1024 * 1024
+
+// Backend is a fake S3.  Use New to create one.
+type Backend struct {
+	// Region is where buckets are created when no LocationConstraint is
+	// given, and the only LocationConstraint accepted
+	Region string
+
+	// Dir, if set, is the directory in which the contents of objects and
+	// parts are kept, rather than in memory.  Use a temporary directory,
+	// such as one made by ioutil.TempDir.
+	Dir string
+
+	// MinPartSize is the smallest size allowed for the parts of a multipart
+	// upload, other than the last, and defaults to DefaultMinPartSize
+	MinPartSize int64
+
+	// Now returns the current time, and defaults to time.Now.  It sets the
+	// LastModified times that conditional requests compare against.
+	Now func() time.Time
+
+	lock    sync.Mutex
+	buckets map[string]*bucket
+}
+
+// the owner of all buckets and objects
+var owner = &s3.Owner{
+	ID:          aws.String("75aa57f09aa0c8caeab4f8c24e99d10f8e7faeebf76c078efc7c6caea54ba06a"),
+	DisplayName: aws.String("awsfaker"),
+}
+
+// New returns a Backend with no buckets, which keeps objects in memory
+func New() *Backend {
+	return &Backend{
+		Region:  "us-east-1",
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Reset removes all buckets, along with the contents of their objects
+func (b *Backend) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, bk := range b.buckets {
+		bk.discardAll()
+	}
+	b.buckets = map[string]*bucket{}
+}
+
+// State is the state of a Backend, as reported by DumpState
+type State struct {
+	Buckets []BucketState
+}
+
+// BucketState counts the objects in a bucket
+type BucketState struct {
+	Name       string
+	Versioning string
+
+	// Objects counts the keys whose latest version is not a delete marker,
+	// and Versions counts all versions, including delete markers
+	Objects  int
+	Versions int
+	Uploads  int
+}
+
+// DumpState returns the buckets and the number of objects in each
+func (b *Backend) DumpState() interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	state := State{Buckets: []BucketState{}}
+	for _, name := range b.bucketNames() {
+		bk := b.buckets[name]
+		bucketState := BucketState{Name: name, Versioning: bk.versioning, Uploads: len(bk.uploads)}
+		for _, versions := range bk.objects {
+			bucketState.Versions += len(versions)
+			if !versions[len(versions)-1].deleteMarker {
+				bucketState.Objects++
+			}
+		}
+		state.Buckets = append(state.Buckets, bucketState)
+	}
+	return state
+}
+
+func (b *Backend) now() time.Time {
+	now := time.Now()
+	if b.Now != nil {
+		now = b.Now()
+	}
+	// S3 keeps times to the second, as they appear in Last-Modified headers
+	return now.UTC().Truncate(time.Second)
+}
+
+func (b *Backend) minPartSize() int64 {
+	if b.MinPartSize == 0 {
+		return DefaultMinPartSize
+	}
+	return b.MinPartSize
+}
+
+func (b *Backend) bucketNames() []string {
+	names := make([]string, 0, len(b.buckets))
+	for name := range b.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// blob is the content of an object or part, held in memory or in a file
+type blob struct {
+	data []byte
+	path string
+}
+
+// store keeps content in memory, or in a new file in Dir
+func (b *Backend) store(data []byte) (blob, error) {
+	if b.Dir == "" {
+		return blob{data: data}, nil
+	}
+	f, err := ioutil.TempFile(b.Dir, "object-")
+	if err != nil {
+		return blob{}, err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return blob{}, err
+	}
+	return blob{path: f.Name()}, nil
+}
+
+func (bl blob) read() ([]byte, error) {
+	if bl.path == "" {
+		return bl.data, nil
+	}
+	return ioutil.ReadFile(bl.path)
+}
+
+// discard removes the file holding the content, if there is one
+func (bl blob) discard() {
+	if bl.path != "" {
+		os.Remove(bl.path)
+	}
+}
+
+func md5Sum(data []byte) []byte {
+	sum := md5.Sum(data)
+	return sum[:]
+}
+
+// checkContentMD5 checks content against the base64 MD5 digest sent in a
+// Content-MD5 header, if any
+func checkContentMD5(contentMD5 *string, data []byte) error {
+	if contentMD5 == nil {
+		return nil
+	}
+	expected, err := base64.StdEncoding.DecodeString(*contentMD5)
+	if err != nil || len(expected) != md5.Size {
+		return s3Error("InvalidDigest", http.StatusBadRequest, "The Content-MD5 you specified was invalid.")
+	}
+	if hex.EncodeToString(expected) != hex.EncodeToString(md5Sum(data)) {
+		return s3Error("BadDigest", http.StatusBadRequest, "The Content-MD5 you specified did not match what we received.")
+	}
+	return nil
+}
+
+func s3Error(code string, status int, format string, args ...interface{}) error {
+	return &awsfaker.ErrorResponse{
+		AWSErrorCode:    code,
+		AWSErrorMessage: fmt.Sprintf(format, args...),
+		HTTPStatusCode:  status,
+	}
+}
+
+func noSuchBucket() error {
+	return s3Error("NoSuchBucket", http.StatusNotFound, "The specified bucket does not exist")
+}
+
+func noSuchKey() error {
+	return s3Error("NoSuchKey", http.StatusNotFound, "The specified key does not exist.")
+}
+
+func noSuchUpload() error {
+	return s3Error("NoSuchUpload", http.StatusNotFound, "The specified upload does not exist. The upload ID may be invalid, or the upload may have been aborted or completed.")
+}
+
+func invalidArgument(format string, args ...interface{}) error {
+	return s3Error("InvalidArgument", http.StatusBadRequest, format, args...)
+}
+
+func malformedXML() error {
+	return s3Error("MalformedXML", http.StatusBadRequest, "The XML you provided was not well-formed or did not validate against our published schema")
+}
+
+func internalError(err error) error {
+	return s3Error("InternalError", http.StatusInternalServerError, "We encountered an internal error. Please try again. (%s)", err)
+}
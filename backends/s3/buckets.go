@@ -0,0 +1,288 @@
+package s3
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/rosenhouse/awsfaker/internal/random"
+)
+
+type bucket struct {
+	name    string
+	region  string
+	created time.Time
+
+	// versioning is empty until versioning is first configured, and then
+	// Enabled or Suspended
+	versioning string
+
+	// objects holds the versions of each key, oldest first
+	objects map[string][]*version
+	uploads map[string]*upload
+}
+
+// version is a version of an object, or a delete marker
+type version struct {
+	key          string
+	id           string
+	deleteMarker bool
+	lastModified time.Time
+
+	content blob
+	size    int64
+	etag    string
+
+	contentType        string
+	contentEncoding    string
+	contentDisposition string
+	contentLanguage    string
+	cacheControl       string
+	storageClass       string
+	metadata           map[string]string
+	tags               map[string]string
+}
+
+// nullVersionID is the ID of versions written while versioning is not
+// enabled
+const nullVersionID = "null"
+
+var (
+	bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	ipAddressPattern  = regexp.MustCompile(`^\d+\.\d+\.\d+\.\d+$`)
+)
+
+func checkBucketName(name string) error {
+	if !bucketNamePattern.MatchString(name) || strings.Contains(name, "..") || ipAddressPattern.MatchString(name) {
+		return s3Error("InvalidBucketName", http.StatusBadRequest, "The specified bucket is not valid.")
+	}
+	return nil
+}
+
+func (b *Backend) findBucket(name *string) (*bucket, error) {
+	bk, ok := b.buckets[aws.StringValue(name)]
+	if !ok {
+		return nil, noSuchBucket()
+	}
+	return bk, nil
+}
+
+// latest returns the current version of a key, which may be a delete
+// marker, or nil if the key has no versions
+func (bk *bucket) latest(key string) *version {
+	versions := bk.objects[key]
+	if len(versions) == 0 {
+		return nil
+	}
+	return versions[len(versions)-1]
+}
+
+// find returns the version of a key with the ID, or the current version if
+// the ID is nil.  Like S3, it reports a missing current version as
+// NoSuchKey, and a missing version with an ID as NoSuchVersion.
+func (bk *bucket) find(key string, versionID *string) (*version, error) {
+	if versionID == nil {
+		v := bk.latest(key)
+		if v == nil || v.deleteMarker {
+			return nil, noSuchKey()
+		}
+		return v, nil
+	}
+	for _, v := range bk.objects[key] {
+		if v.id == *versionID {
+			return v, nil
+		}
+	}
+	if *versionID != nullVersionID && len(*versionID) != 32 {
+		return nil, invalidArgument("Invalid version id specified")
+	}
+	return nil, s3Error("NoSuchVersion", http.StatusNotFound, "The specified version does not exist.")
+}
+
+// add makes a version the current version of its key.  Unless versioning is
+// enabled, it replaces the null version.
+func (bk *bucket) add(v *version) {
+	if bk.versioning == "Enabled" {
+		v.id = random.Alphanumeric(32)
+	} else {
+		v.id = nullVersionID
+		bk.remove(v.key, nullVersionID)
+	}
+	bk.objects[v.key] = append(bk.objects[v.key], v)
+}
+
+// remove permanently deletes a version of a key, and reports whether there
+// was one
+func (bk *bucket) remove(key, versionID string) (*version, bool) {
+	versions := bk.objects[key]
+	for i, v := range versions {
+		if v.id == versionID {
+			v.content.discard()
+			versions = append(versions[:i:i], versions[i+1:]...)
+			if len(versions) == 0 {
+				delete(bk.objects, key)
+			} else {
+				bk.objects[key] = versions
+			}
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// outputVersionID returns the version ID to report for a version, which is
+// omitted for buckets that have never been versioned
+func (bk *bucket) outputVersionID(v *version) *string {
+	if bk.versioning == "" {
+		return nil
+	}
+	return aws.String(v.id)
+}
+
+func (bk *bucket) discardAll() {
+	for _, versions := range bk.objects {
+		for _, v := range versions {
+			v.content.discard()
+		}
+	}
+	for _, u := range bk.uploads {
+		u.discard()
+	}
+}
+
+// CreateBucket creates a bucket in the Region, which is the only
+// LocationConstraint accepted
+func (b *Backend) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	name := aws.StringValue(input.Bucket)
+	if err := checkBucketName(name); err != nil {
+		return nil, err
+	}
+	if _, ok := b.buckets[name]; ok {
+		return nil, s3Error("BucketAlreadyOwnedByYou", http.StatusConflict, "Your previous request to create the named bucket succeeded and you already own it.")
+	}
+
+	region := "us-east-1"
+	if input.CreateBucketConfiguration != nil && aws.StringValue(input.CreateBucketConfiguration.LocationConstraint) != "" {
+		region = *input.CreateBucketConfiguration.LocationConstraint
+	}
+	if region != b.Region {
+		if region == "us-east-1" {
+			return nil, s3Error("IllegalLocationConstraintException", http.StatusBadRequest, "The unspecified location constraint is incompatible for the region specific endpoint this request was sent to.")
+		}
+		return nil, s3Error("IllegalLocationConstraintException", http.StatusBadRequest, "The %s location constraint is incompatible for the region specific endpoint this request was sent to.", region)
+	}
+
+	b.buckets[name] = &bucket{
+		name:    name,
+		region:  region,
+		created: b.now(),
+		objects: map[string][]*version{},
+		uploads: map[string]*upload{},
+	}
+	return &s3.CreateBucketOutput{Location: aws.String("/" + name)}, nil
+}
+
+// DeleteBucket deletes a bucket, which must not hold any object versions
+func (b *Backend) DeleteBucket(input *s3.DeleteBucketInput) (*s3.DeleteBucketOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if len(bk.objects) > 0 {
+		return nil, s3Error("BucketNotEmpty", http.StatusConflict, "The bucket you tried to delete is not empty")
+	}
+	bk.discardAll()
+	delete(b.buckets, bk.name)
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+// HeadBucket succeeds if the bucket exists
+func (b *Backend) HeadBucket(input *s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, err := b.findBucket(input.Bucket); err != nil {
+		return nil, err
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+// ListBuckets lists all buckets by name
+func (b *Backend) ListBuckets(input *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	output := &s3.ListBucketsOutput{Buckets: []*s3.Bucket{}, Owner: owner}
+	for _, name := range b.bucketNames() {
+		output.Buckets = append(output.Buckets, &s3.Bucket{
+			Name:         aws.String(name),
+			CreationDate: aws.Time(b.buckets[name].created),
+		})
+	}
+	return output, nil
+}
+
+// GetBucketLocation returns the region of a bucket, which is empty for
+// us-east-1
+func (b *Backend) GetBucketLocation(input *s3.GetBucketLocationInput) (*s3.GetBucketLocationOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	output := &s3.GetBucketLocationOutput{}
+	if bk.region != "us-east-1" {
+		output.LocationConstraint = aws.String(bk.region)
+	}
+	return output, nil
+}
+
+// PutBucketVersioning enables or suspends versioning.  Once enabled,
+// versioning can be suspended but not turned off.
+func (b *Backend) PutBucketVersioning(input *s3.PutBucketVersioningInput) (*s3.PutBucketVersioningOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if input.VersioningConfiguration == nil {
+		return nil, malformedXML()
+	}
+	switch status := aws.StringValue(input.VersioningConfiguration.Status); status {
+	case "Enabled", "Suspended":
+		bk.versioning = status
+	default:
+		return nil, malformedXML()
+	}
+	return &s3.PutBucketVersioningOutput{}, nil
+}
+
+// GetBucketVersioning returns the versioning status of a bucket, which is
+// absent if versioning has never been configured
+func (b *Backend) GetBucketVersioning(input *s3.GetBucketVersioningInput) (*s3.GetBucketVersioningOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	output := &s3.GetBucketVersioningOutput{}
+	if bk.versioning != "" {
+		output.Status = aws.String(bk.versioning)
+	}
+	return output, nil
+}
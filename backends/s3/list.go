@@ -0,0 +1,283 @@
+package s3
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxKeys returns a page size, which defaults to and is capped at 1000
+func maxKeys(value *int64, name string) (int64, error) {
+	if value == nil {
+		return 1000, nil
+	}
+	if *value < 0 {
+		return 0, invalidArgument("Argument %s must be an integer between 0 and 2147483647", name)
+	}
+	if *value > 1000 {
+		return 1000, nil
+	}
+	return *value, nil
+}
+
+// sortedKeys returns the keys with the prefix, in order
+func (bk *bucket) sortedKeys(prefix string) []string {
+	var keys []string
+	for key := range bk.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// rollUp returns the common prefix under which a key is listed, if the
+// delimiter appears in the key after the prefix
+func rollUp(key, prefix, delimiter string) (string, bool) {
+	if delimiter == "" {
+		return "", false
+	}
+	i := strings.Index(key[len(prefix):], delimiter)
+	if i < 0 {
+		return "", false
+	}
+	return key[:len(prefix)+i+len(delimiter)], true
+}
+
+// listing is a page of current objects and common prefixes
+type listing struct {
+	objects   []*version
+	prefixes  []string
+	truncated bool
+
+	// next is the last key or common prefix in the page
+	next string
+}
+
+// list returns the current objects with the prefix that come after the
+// marker, rolling up keys that contain the delimiter after the prefix into
+// common prefixes.  Each common prefix counts once towards max.
+func (bk *bucket) list(prefix, delimiter, marker string, max int64) listing {
+	var page listing
+	for _, key := range bk.sortedKeys(prefix) {
+		v := bk.latest(key)
+		if v.deleteMarker {
+			continue
+		}
+		entry := key
+		commonPrefix, rolled := rollUp(key, prefix, delimiter)
+		if rolled {
+			entry = commonPrefix
+		}
+		if entry <= marker || rolled && len(page.prefixes) > 0 && page.prefixes[len(page.prefixes)-1] == entry {
+			continue
+		}
+		if int64(len(page.objects)+len(page.prefixes)) == max {
+			page.truncated = true
+			break
+		}
+		if rolled {
+			page.prefixes = append(page.prefixes, entry)
+		} else {
+			page.objects = append(page.objects, v)
+		}
+		page.next = entry
+	}
+	return page
+}
+
+func describeObject(v *version, withOwner bool) *s3.Object {
+	object := &s3.Object{
+		Key:          aws.String(v.key),
+		ETag:         aws.String(v.etag),
+		Size:         aws.Int64(v.size),
+		LastModified: aws.Time(v.lastModified),
+		StorageClass: aws.String(v.storageClass),
+	}
+	if withOwner {
+		object.Owner = owner
+	}
+	return object
+}
+
+func commonPrefixes(prefixes []string) []*s3.CommonPrefix {
+	var listed []*s3.CommonPrefix
+	for _, prefix := range prefixes {
+		listed = append(listed, &s3.CommonPrefix{Prefix: aws.String(prefix)})
+	}
+	return listed
+}
+
+// ListObjects lists the current objects in a bucket by key, up to MaxKeys
+// after the Marker.  As in S3, NextMarker is only given when there is a
+// Delimiter; otherwise the next page starts after the last key.
+func (b *Backend) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	max, err := maxKeys(input.MaxKeys, "max-keys")
+	if err != nil {
+		return nil, err
+	}
+
+	page := bk.list(aws.StringValue(input.Prefix), aws.StringValue(input.Delimiter), aws.StringValue(input.Marker), max)
+	output := &s3.ListObjectsOutput{
+		Name:           input.Bucket,
+		Prefix:         aws.String(aws.StringValue(input.Prefix)),
+		Delimiter:      input.Delimiter,
+		Marker:         aws.String(aws.StringValue(input.Marker)),
+		MaxKeys:        aws.Int64(max),
+		IsTruncated:    aws.Bool(page.truncated),
+		CommonPrefixes: commonPrefixes(page.prefixes),
+	}
+	for _, v := range page.objects {
+		output.Contents = append(output.Contents, describeObject(v, true))
+	}
+	if page.truncated && input.Delimiter != nil {
+		output.NextMarker = aws.String(page.next)
+	}
+	return output, nil
+}
+
+// ListObjectsV2 lists the current objects in a bucket by key, up to MaxKeys
+// after the StartAfter key, or where the ContinuationToken left off
+func (b *Backend) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	max, err := maxKeys(input.MaxKeys, "max-keys")
+	if err != nil {
+		return nil, err
+	}
+	marker := aws.StringValue(input.StartAfter)
+	if input.ContinuationToken != nil {
+		decoded, err := base64.StdEncoding.DecodeString(*input.ContinuationToken)
+		if err != nil || len(decoded) == 0 {
+			return nil, invalidArgument("The continuation token provided is incorrect")
+		}
+		marker = string(decoded)
+	}
+
+	page := bk.list(aws.StringValue(input.Prefix), aws.StringValue(input.Delimiter), marker, max)
+	output := &s3.ListObjectsV2Output{
+		Name:              input.Bucket,
+		Prefix:            aws.String(aws.StringValue(input.Prefix)),
+		Delimiter:         input.Delimiter,
+		StartAfter:        input.StartAfter,
+		ContinuationToken: input.ContinuationToken,
+		MaxKeys:           aws.Int64(max),
+		KeyCount:          aws.Int64(int64(len(page.objects) + len(page.prefixes))),
+		IsTruncated:       aws.Bool(page.truncated),
+		CommonPrefixes:    commonPrefixes(page.prefixes),
+	}
+	for _, v := range page.objects {
+		output.Contents = append(output.Contents, describeObject(v, aws.BoolValue(input.FetchOwner)))
+	}
+	if page.truncated {
+		output.NextContinuationToken = aws.String(base64.StdEncoding.EncodeToString([]byte(page.next)))
+	}
+	return output, nil
+}
+
+// ListObjectVersions lists the versions and delete markers in a bucket by
+// key, newest first for each key, up to MaxKeys after the KeyMarker and
+// VersionIdMarker
+func (b *Backend) ListObjectVersions(input *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	max, err := maxKeys(input.MaxKeys, "max-keys")
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, delimiter := aws.StringValue(input.Prefix), aws.StringValue(input.Delimiter)
+	keyMarker, versionIDMarker := aws.StringValue(input.KeyMarker), aws.StringValue(input.VersionIdMarker)
+	output := &s3.ListObjectVersionsOutput{
+		Name:            input.Bucket,
+		Prefix:          aws.String(prefix),
+		Delimiter:       input.Delimiter,
+		KeyMarker:       aws.String(keyMarker),
+		VersionIdMarker: aws.String(versionIDMarker),
+		MaxKeys:         aws.Int64(max),
+		IsTruncated:     aws.Bool(false),
+	}
+
+	var prefixes []string
+	count := int64(0)
+	full := func() bool {
+		if count < max {
+			return false
+		}
+		output.IsTruncated = aws.Bool(true)
+		return true
+	}
+
+keys:
+	for _, key := range bk.sortedKeys(prefix) {
+		if commonPrefix, rolled := rollUp(key, prefix, delimiter); rolled {
+			if commonPrefix <= keyMarker || len(prefixes) > 0 && prefixes[len(prefixes)-1] == commonPrefix {
+				continue
+			}
+			if full() {
+				break
+			}
+			prefixes = append(prefixes, commonPrefix)
+			output.NextKeyMarker, output.NextVersionIdMarker = aws.String(commonPrefix), nil
+			count++
+			continue
+		}
+		if key < keyMarker || key == keyMarker && versionIDMarker == "" {
+			continue
+		}
+
+		versions := bk.objects[key]
+		skipping := key == keyMarker
+		for i := len(versions) - 1; i >= 0; i-- {
+			v := versions[i]
+			if skipping {
+				skipping = v.id != versionIDMarker
+				continue
+			}
+			if full() {
+				break keys
+			}
+			isLatest := aws.Bool(i == len(versions)-1)
+			if v.deleteMarker {
+				output.DeleteMarkers = append(output.DeleteMarkers, &s3.DeleteMarkerEntry{
+					Key: aws.String(key), VersionId: aws.String(v.id), IsLatest: isLatest,
+					LastModified: aws.Time(v.lastModified), Owner: owner,
+				})
+			} else {
+				output.Versions = append(output.Versions, &s3.ObjectVersion{
+					Key: aws.String(key), VersionId: aws.String(v.id), IsLatest: isLatest,
+					LastModified: aws.Time(v.lastModified), ETag: aws.String(v.etag), Size: aws.Int64(v.size),
+					StorageClass: aws.String(v.storageClass), Owner: owner,
+				})
+			}
+			output.NextKeyMarker, output.NextVersionIdMarker = aws.String(key), aws.String(v.id)
+			count++
+		}
+	}
+	output.CommonPrefixes = commonPrefixes(prefixes)
+	if !aws.BoolValue(output.IsTruncated) {
+		output.NextKeyMarker, output.NextVersionIdMarker = nil, nil
+	}
+	return output, nil
+}
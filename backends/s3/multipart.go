@@ -0,0 +1,332 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/rosenhouse/awsfaker/internal/random"
+)
+
+type upload struct {
+	id        string
+	key       string
+	initiated time.Time
+
+	// object holds the fields of the object to be created
+	object *version
+	parts  map[int64]*part
+}
+
+type part struct {
+	number       int64
+	content      blob
+	size         int64
+	md5          []byte
+	lastModified time.Time
+}
+
+func (p *part) etag() string {
+	return `"` + hex.EncodeToString(p.md5) + `"`
+}
+
+func (u *upload) discard() {
+	for _, p := range u.parts {
+		p.content.discard()
+	}
+}
+
+func (u *upload) partNumbers() []int64 {
+	numbers := make([]int64, 0, len(u.parts))
+	for number := range u.parts {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers
+}
+
+func (b *Backend) findUpload(bucketName, key, uploadID *string) (*bucket, *upload, error) {
+	bk, err := b.findBucket(bucketName)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, ok := bk.uploads[aws.StringValue(uploadID)]
+	if !ok || u.key != aws.StringValue(key) {
+		return nil, nil, noSuchUpload()
+	}
+	return bk, u, nil
+}
+
+// CreateMultipartUpload starts an upload, whose object gets the content
+// type, metadata and tags given here
+func (b *Backend) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	key := aws.StringValue(input.Key)
+	object, err := newVersion(key, objectFields{
+		contentType:        input.ContentType,
+		contentEncoding:    input.ContentEncoding,
+		contentDisposition: input.ContentDisposition,
+		contentLanguage:    input.ContentLanguage,
+		cacheControl:       input.CacheControl,
+		storageClass:       input.StorageClass,
+		metadata:           input.Metadata,
+		tagging:            input.Tagging,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	u := &upload{
+		id:        random.Alphanumeric(64),
+		key:       key,
+		initiated: b.now(),
+		object:    object,
+		parts:     map[int64]*part{},
+	}
+	bk.uploads[u.id] = u
+	return &s3.CreateMultipartUploadOutput{Bucket: input.Bucket, Key: input.Key, UploadId: aws.String(u.id)}, nil
+}
+
+// UploadPart stores a part of an upload, replacing any earlier part with the
+// same number
+func (b *Backend) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	data := []byte{}
+	if input.Body != nil {
+		var err error
+		if data, err = ioutil.ReadAll(input.Body); err != nil {
+			return nil, internalError(err)
+		}
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	_, u, err := b.findUpload(input.Bucket, input.Key, input.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	number := aws.Int64Value(input.PartNumber)
+	if number < 1 || number > 10000 {
+		return nil, invalidArgument("Part number must be an integer between 1 and 10000, inclusive")
+	}
+	if err := checkContentMD5(input.ContentMD5, data); err != nil {
+		return nil, err
+	}
+
+	content, err := b.store(data)
+	if err != nil {
+		return nil, internalError(err)
+	}
+	if earlier, ok := u.parts[number]; ok {
+		earlier.content.discard()
+	}
+	p := &part{number: number, content: content, size: int64(len(data)), md5: md5Sum(data), lastModified: b.now()}
+	u.parts[number] = p
+	return &s3.UploadPartOutput{ETag: aws.String(p.etag())}, nil
+}
+
+func invalidPart() error {
+	return s3Error("InvalidPart", http.StatusBadRequest, "One or more of the specified parts could not be found.  The part may not have been uploaded, or the specified entity tag may not match the part's entity tag.")
+}
+
+// CompleteMultipartUpload joins the listed parts into an object, whose ETag
+// is the MD5 of the part digests followed by the number of parts.  The parts
+// must be listed in order, and all but the last must be at least
+// MinPartSize.
+func (b *Backend) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, u, err := b.findUpload(input.Bucket, input.Key, input.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	if input.MultipartUpload == nil || len(input.MultipartUpload.Parts) == 0 {
+		return nil, malformedXML()
+	}
+
+	var parts []*part
+	for i, completed := range input.MultipartUpload.Parts {
+		number := aws.Int64Value(completed.PartNumber)
+		if i > 0 && number <= aws.Int64Value(input.MultipartUpload.Parts[i-1].PartNumber) {
+			return nil, s3Error("InvalidPartOrder", http.StatusBadRequest, "The list of parts was not in ascending order. Parts must be ordered by part number.")
+		}
+		p, ok := u.parts[number]
+		if !ok || !etagMatches(aws.StringValue(completed.ETag), p.etag()) {
+			return nil, invalidPart()
+		}
+		parts = append(parts, p)
+	}
+
+	var data bytes.Buffer
+	digests := md5.New()
+	for i, p := range parts {
+		if i < len(parts)-1 && p.size < b.minPartSize() {
+			return nil, s3Error("EntityTooSmall", http.StatusBadRequest, "Your proposed upload is smaller than the minimum allowed size")
+		}
+		content, err := p.content.read()
+		if err != nil {
+			return nil, internalError(err)
+		}
+		data.Write(content)
+		digests.Write(p.md5)
+	}
+
+	v := u.object
+	if err := b.setContent(v, data.Bytes()); err != nil {
+		return nil, err
+	}
+	v.etag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(digests.Sum(nil)), len(parts))
+	u.discard()
+	delete(bk.uploads, u.id)
+	bk.add(v)
+
+	return &s3.CompleteMultipartUploadOutput{
+		Bucket:    input.Bucket,
+		Key:       input.Key,
+		Location:  aws.String(fmt.Sprintf("/%s/%s", bk.name, v.key)),
+		ETag:      aws.String(v.etag),
+		VersionId: bk.outputVersionID(v),
+	}, nil
+}
+
+// AbortMultipartUpload discards an upload and its parts
+func (b *Backend) AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, u, err := b.findUpload(input.Bucket, input.Key, input.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	u.discard()
+	delete(bk.uploads, u.id)
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// ListParts lists the parts of an upload in order, up to MaxParts, which
+// defaults to 1000, after the PartNumberMarker
+func (b *Backend) ListParts(input *s3.ListPartsInput) (*s3.ListPartsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	_, u, err := b.findUpload(input.Bucket, input.Key, input.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	maxParts, err := maxKeys(input.MaxParts, "max-parts")
+	if err != nil {
+		return nil, err
+	}
+
+	output := &s3.ListPartsOutput{
+		Bucket:           input.Bucket,
+		Key:              input.Key,
+		UploadId:         input.UploadId,
+		MaxParts:         aws.Int64(maxParts),
+		PartNumberMarker: input.PartNumberMarker,
+		StorageClass:     aws.String(u.object.storageClass),
+		Initiator:        &s3.Initiator{ID: owner.ID, DisplayName: owner.DisplayName},
+		Owner:            owner,
+		IsTruncated:      aws.Bool(false),
+	}
+	for _, number := range u.partNumbers() {
+		if number <= aws.Int64Value(input.PartNumberMarker) {
+			continue
+		}
+		if int64(len(output.Parts)) == maxParts {
+			output.IsTruncated = aws.Bool(true)
+			break
+		}
+		p := u.parts[number]
+		output.Parts = append(output.Parts, &s3.Part{
+			PartNumber:   aws.Int64(number),
+			ETag:         aws.String(p.etag()),
+			Size:         aws.Int64(p.size),
+			LastModified: aws.Time(p.lastModified),
+		})
+		output.NextPartNumberMarker = aws.Int64(number)
+	}
+	return output, nil
+}
+
+// ListMultipartUploads lists the uploads in progress, ordered by key and
+// then by the time they were started
+func (b *Backend) ListMultipartUploads(input *s3.ListMultipartUploadsInput) (*s3.ListMultipartUploadsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	maxUploads, err := maxKeys(input.MaxUploads, "max-uploads")
+	if err != nil {
+		return nil, err
+	}
+
+	var uploads []*upload
+	for _, u := range bk.uploads {
+		if strings.HasPrefix(u.key, aws.StringValue(input.Prefix)) {
+			uploads = append(uploads, u)
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].key != uploads[j].key {
+			return uploads[i].key < uploads[j].key
+		}
+		if !uploads[i].initiated.Equal(uploads[j].initiated) {
+			return uploads[i].initiated.Before(uploads[j].initiated)
+		}
+		return uploads[i].id < uploads[j].id
+	})
+
+	output := &s3.ListMultipartUploadsOutput{
+		Bucket:         input.Bucket,
+		Prefix:         input.Prefix,
+		KeyMarker:      input.KeyMarker,
+		UploadIdMarker: input.UploadIdMarker,
+		MaxUploads:     aws.Int64(maxUploads),
+		IsTruncated:    aws.Bool(false),
+	}
+	keyMarker, uploadIDMarker := aws.StringValue(input.KeyMarker), aws.StringValue(input.UploadIdMarker)
+	skipping := uploadIDMarker != ""
+	for _, u := range uploads {
+		switch {
+		case u.key < keyMarker, u.key == keyMarker && uploadIDMarker == "":
+			continue
+		case skipping && u.key == keyMarker:
+			skipping = u.id != uploadIDMarker
+			continue
+		}
+		if int64(len(output.Uploads)) == maxUploads {
+			output.IsTruncated = aws.Bool(true)
+			break
+		}
+		output.Uploads = append(output.Uploads, &s3.MultipartUpload{
+			Key:          aws.String(u.key),
+			UploadId:     aws.String(u.id),
+			Initiated:    aws.Time(u.initiated),
+			StorageClass: aws.String(u.object.storageClass),
+			Initiator:    &s3.Initiator{ID: owner.ID, DisplayName: owner.DisplayName},
+			Owner:        owner,
+		})
+		output.NextKeyMarker = aws.String(u.key)
+		output.NextUploadIdMarker = aws.String(u.id)
+	}
+	return output, nil
+}
@@ -0,0 +1,600 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var storageClasses = map[string]bool{
+	"STANDARD":            true,
+	"REDUCED_REDUNDANCY":  true,
+	"STANDARD_IA":         true,
+	"ONEZONE_IA":          true,
+	"INTELLIGENT_TIERING": true,
+	"GLACIER":             true,
+	"DEEP_ARCHIVE":        true,
+}
+
+// objectFields holds the fields shared by PutObjectInput, CopyObjectInput
+// and CreateMultipartUploadInput that describe a new object
+type objectFields struct {
+	contentType, contentEncoding, contentDisposition, contentLanguage, cacheControl *string
+	storageClass                                                                    *string
+	metadata                                                                        map[string]*string
+	tagging                                                                         *string
+}
+
+// newVersion returns a version of a key with the fields, which are checked
+func newVersion(key string, fields objectFields) (*version, error) {
+	storageClass := aws.StringValue(fields.storageClass)
+	if storageClass == "" {
+		storageClass = "STANDARD"
+	}
+	if !storageClasses[storageClass] {
+		return nil, s3Error("InvalidStorageClass", http.StatusBadRequest, "The storage class you specified is not valid")
+	}
+	tags, err := parseTagging(fields.tagging)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]string{}
+	for name, value := range fields.metadata {
+		metadata[strings.ToLower(name)] = aws.StringValue(value)
+	}
+	contentType := aws.StringValue(fields.contentType)
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	return &version{
+		key:                key,
+		contentType:        contentType,
+		contentEncoding:    aws.StringValue(fields.contentEncoding),
+		contentDisposition: aws.StringValue(fields.contentDisposition),
+		contentLanguage:    aws.StringValue(fields.contentLanguage),
+		cacheControl:       aws.StringValue(fields.cacheControl),
+		storageClass:       storageClass,
+		metadata:           metadata,
+		tags:               tags,
+	}, nil
+}
+
+// setContent stores the content of a version, with the ETag of a single
+// part upload
+func (b *Backend) setContent(v *version, data []byte) error {
+	content, err := b.store(data)
+	if err != nil {
+		return internalError(err)
+	}
+	v.content = content
+	v.size = int64(len(data))
+	v.etag = `"` + hex.EncodeToString(md5Sum(data)) + `"`
+	v.lastModified = b.now()
+	return nil
+}
+
+// parseTagging parses tags in the query string format of the x-amz-tagging
+// header
+func parseTagging(tagging *string) (map[string]string, error) {
+	tags := map[string]string{}
+	if aws.StringValue(tagging) == "" {
+		return tags, nil
+	}
+	values, err := url.ParseQuery(*tagging)
+	if err != nil {
+		return nil, invalidArgument("The header 'x-amz-tagging' shall be encoded as UTF-8 then URLEncoded URL query parameters without tag name duplicates.")
+	}
+	for key, value := range values {
+		tags[key] = value[0]
+	}
+	return tags, checkTags(tags)
+}
+
+func checkTags(tags map[string]string) error {
+	if len(tags) > 10 {
+		return s3Error("BadRequest", http.StatusBadRequest, "Object tags cannot be greater than 10")
+	}
+	for key, value := range tags {
+		if key == "" || len(key) > 128 {
+			return s3Error("InvalidTag", http.StatusBadRequest, "The TagKey you have provided is invalid")
+		}
+		if len(value) > 256 {
+			return s3Error("InvalidTag", http.StatusBadRequest, "The TagValue you have provided is too long")
+		}
+	}
+	return nil
+}
+
+// PutObject stores an object, checking its Content-MD5 if one is given
+func (b *Backend) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	data := []byte{}
+	if input.Body != nil {
+		var err error
+		if data, err = ioutil.ReadAll(input.Body); err != nil {
+			return nil, internalError(err)
+		}
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContentMD5(input.ContentMD5, data); err != nil {
+		return nil, err
+	}
+	v, err := newVersion(aws.StringValue(input.Key), objectFields{
+		contentType:        input.ContentType,
+		contentEncoding:    input.ContentEncoding,
+		contentDisposition: input.ContentDisposition,
+		contentLanguage:    input.ContentLanguage,
+		cacheControl:       input.CacheControl,
+		storageClass:       input.StorageClass,
+		metadata:           input.Metadata,
+		tagging:            input.Tagging,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := b.setContent(v, data); err != nil {
+		return nil, err
+	}
+	bk.add(v)
+	return &s3.PutObjectOutput{ETag: aws.String(v.etag), VersionId: bk.outputVersionID(v)}, nil
+}
+
+// etagMatches reports whether an ETag is in the list of an If-Match or
+// If-None-Match header, in which * matches any ETag
+func etagMatches(list, etag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || strings.Trim(candidate, `"`) == strings.Trim(etag, `"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// conditions holds the conditional headers of a GET, HEAD or copy
+type conditions struct {
+	ifMatch, ifNoneMatch               *string
+	ifModifiedSince, ifUnmodifiedSince *time.Time
+}
+
+// check returns the error for a version that does not meet the conditions.
+// If-Match takes precedence over If-Unmodified-Since, and If-None-Match over
+// If-Modified-Since.  Failures of If-None-Match and If-Modified-Since are
+// reported with notModified.
+func (c conditions) check(v *version, notModified error) error {
+	preconditionFailed := s3Error("PreconditionFailed", http.StatusPreconditionFailed, "At least one of the pre-conditions you specified did not hold")
+	switch {
+	case c.ifMatch != nil:
+		if !etagMatches(*c.ifMatch, v.etag) {
+			return preconditionFailed
+		}
+	case c.ifUnmodifiedSince != nil:
+		if v.lastModified.After(*c.ifUnmodifiedSince) {
+			return preconditionFailed
+		}
+	}
+	switch {
+	case c.ifNoneMatch != nil:
+		if etagMatches(*c.ifNoneMatch, v.etag) {
+			return notModified
+		}
+	case c.ifModifiedSince != nil:
+		if !v.lastModified.After(*c.ifModifiedSince) {
+			return notModified
+		}
+	}
+	return nil
+}
+
+func notModified() error {
+	return s3Error("NotModified", http.StatusNotModified, "Not Modified")
+}
+
+// parseRange returns the first and last byte selected by a Range header.  As
+// in S3, a header that cannot be parsed or that has several ranges selects
+// the whole object, reported as ok false.
+func parseRange(header string, size int64) (int64, int64, bool, error) {
+	unsatisfiable := s3Error("InvalidRange", http.StatusRequestedRangeNotSatisfiable, "The requested range is not satisfiable")
+	spec := strings.TrimPrefix(header, "bytes=")
+	dash := strings.Index(spec, "-")
+	if spec == header || strings.Contains(spec, ",") || dash < 0 {
+		return 0, 0, false, nil
+	}
+
+	if dash == 0 {
+		suffix, err := strconv.ParseInt(spec[1:], 10, 64)
+		if err != nil {
+			return 0, 0, false, nil
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, false, unsatisfiable
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, size - 1, true, nil
+	}
+
+	first, err := strconv.ParseInt(spec[:dash], 10, 64)
+	if err != nil {
+		return 0, 0, false, nil
+	}
+	last := size - 1
+	if spec[dash+1:] != "" {
+		if last, err = strconv.ParseInt(spec[dash+1:], 10, 64); err != nil || last < first {
+			return 0, 0, false, nil
+		}
+	}
+	if first >= size {
+		return 0, 0, false, unsatisfiable
+	}
+	if last > size-1 {
+		last = size - 1
+	}
+	return first, last, true, nil
+}
+
+// findForRead returns the version to read or tag, which may not be a delete
+// marker
+func (b *Backend) findForRead(bucketName, key, versionID *string) (*bucket, *version, error) {
+	bk, err := b.findBucket(bucketName)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := bk.find(aws.StringValue(key), versionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v.deleteMarker {
+		return nil, nil, s3Error("MethodNotAllowed", http.StatusMethodNotAllowed, "The specified method is not allowed against this resource.")
+	}
+	return bk, v, nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+func metadataOutput(metadata map[string]string) map[string]*string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	return aws.StringMap(metadata)
+}
+
+func storageClassOutput(storageClass string) *string {
+	if storageClass == "STANDARD" {
+		return nil
+	}
+	return aws.String(storageClass)
+}
+
+// GetObject returns the content of an object, or of the bytes selected by
+// the Range, if it meets the conditions of the If-Match family of headers
+func (b *Backend) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, v, err := b.findForRead(input.Bucket, input.Key, input.VersionId)
+	if err != nil {
+		return nil, err
+	}
+	c := conditions{input.IfMatch, input.IfNoneMatch, input.IfModifiedSince, input.IfUnmodifiedSince}
+	if err := c.check(v, notModified()); err != nil {
+		return nil, err
+	}
+	data, err := v.content.read()
+	if err != nil {
+		return nil, internalError(err)
+	}
+
+	output := &s3.GetObjectOutput{
+		AcceptRanges:       aws.String("bytes"),
+		ContentLength:      aws.Int64(v.size),
+		ContentType:        aws.String(v.contentType),
+		ContentEncoding:    optionalString(v.contentEncoding),
+		ContentDisposition: optionalString(v.contentDisposition),
+		ContentLanguage:    optionalString(v.contentLanguage),
+		CacheControl:       optionalString(v.cacheControl),
+		ETag:               aws.String(v.etag),
+		LastModified:       aws.Time(v.lastModified),
+		Metadata:           metadataOutput(v.metadata),
+		StorageClass:       storageClassOutput(v.storageClass),
+		VersionId:          bk.outputVersionID(v),
+	}
+	if len(v.tags) > 0 {
+		output.TagCount = aws.Int64(int64(len(v.tags)))
+	}
+
+	first, last, ok, err := parseRange(aws.StringValue(input.Range), v.size)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		data = data[first : last+1]
+		output.ContentLength = aws.Int64(last - first + 1)
+		output.ContentRange = aws.String("bytes " + strconv.FormatInt(first, 10) + "-" + strconv.FormatInt(last, 10) + "/" + strconv.FormatInt(v.size, 10))
+	}
+	output.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return output, nil
+}
+
+// HeadObject describes an object, if it meets the conditions of the
+// If-Match family of headers
+func (b *Backend) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, v, err := b.findForRead(input.Bucket, input.Key, input.VersionId)
+	if err != nil {
+		return nil, err
+	}
+	c := conditions{input.IfMatch, input.IfNoneMatch, input.IfModifiedSince, input.IfUnmodifiedSince}
+	if err := c.check(v, notModified()); err != nil {
+		return nil, err
+	}
+	return &s3.HeadObjectOutput{
+		AcceptRanges:       aws.String("bytes"),
+		ContentLength:      aws.Int64(v.size),
+		ContentType:        aws.String(v.contentType),
+		ContentEncoding:    optionalString(v.contentEncoding),
+		ContentDisposition: optionalString(v.contentDisposition),
+		ContentLanguage:    optionalString(v.contentLanguage),
+		CacheControl:       optionalString(v.cacheControl),
+		ETag:               aws.String(v.etag),
+		LastModified:       aws.Time(v.lastModified),
+		Metadata:           metadataOutput(v.metadata),
+		StorageClass:       storageClassOutput(v.storageClass),
+		VersionId:          bk.outputVersionID(v),
+	}, nil
+}
+
+// deleteObject deletes a version of a key, or if no version is given, hides
+// the key behind a delete marker in a versioned bucket.  It returns the
+// version that was deleted or added.
+func (b *Backend) deleteObject(bk *bucket, key string, versionID *string) *version {
+	if versionID != nil {
+		v, _ := bk.remove(key, *versionID)
+		return v
+	}
+	if bk.versioning == "" {
+		v, _ := bk.remove(key, nullVersionID)
+		return v
+	}
+	marker := &version{key: key, deleteMarker: true, lastModified: b.now()}
+	bk.add(marker)
+	return marker
+}
+
+// DeleteObject deletes an object.  Like S3, it succeeds whether or not the
+// object exists.
+func (b *Backend) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	output := &s3.DeleteObjectOutput{}
+	if v := b.deleteObject(bk, aws.StringValue(input.Key), input.VersionId); v != nil && bk.versioning != "" {
+		output.VersionId = aws.String(v.id)
+		if v.deleteMarker {
+			output.DeleteMarker = aws.Bool(true)
+		}
+	}
+	return output, nil
+}
+
+// DeleteObjects deletes up to 1000 objects, reporting each unless Quiet is
+// set
+func (b *Backend) DeleteObjects(input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if input.Delete == nil || len(input.Delete.Objects) == 0 || len(input.Delete.Objects) > 1000 {
+		return nil, malformedXML()
+	}
+
+	output := &s3.DeleteObjectsOutput{}
+	for _, object := range input.Delete.Objects {
+		v := b.deleteObject(bk, aws.StringValue(object.Key), object.VersionId)
+		if aws.BoolValue(input.Delete.Quiet) {
+			continue
+		}
+		deleted := &s3.DeletedObject{Key: object.Key, VersionId: object.VersionId}
+		if v != nil && v.deleteMarker && bk.versioning != "" {
+			deleted.DeleteMarker = aws.Bool(true)
+			deleted.DeleteMarkerVersionId = aws.String(v.id)
+		}
+		output.Deleted = append(output.Deleted, deleted)
+	}
+	return output, nil
+}
+
+// parseCopySource returns the bucket, key and version ID of an
+// x-amz-copy-source header, like some-bucket/some/key?versionId=abc
+func parseCopySource(copySource string) (string, string, *string, error) {
+	var versionID *string
+	if i := strings.Index(copySource, "?versionId="); i >= 0 {
+		versionID = aws.String(copySource[i+len("?versionId="):])
+		copySource = copySource[:i]
+	}
+	unescaped, err := url.PathUnescape(strings.TrimPrefix(copySource, "/"))
+	if err != nil {
+		return "", "", nil, invalidArgument("Invalid copy source encoding")
+	}
+	parts := strings.SplitN(unescaped, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", nil, invalidArgument("Invalid copy source object key")
+	}
+	return parts[0], parts[1], versionID, nil
+}
+
+// CopyObject copies an object, along with its metadata and tags unless the
+// MetadataDirective or TaggingDirective is REPLACE
+func (b *Backend) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, err := b.findBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	sourceBucketName, sourceKey, sourceVersionID, err := parseCopySource(aws.StringValue(input.CopySource))
+	if err != nil {
+		return nil, err
+	}
+	sourceBucket, source, err := b.findForRead(&sourceBucketName, &sourceKey, sourceVersionID)
+	if err != nil {
+		return nil, err
+	}
+	c := conditions{input.CopySourceIfMatch, input.CopySourceIfNoneMatch, input.CopySourceIfModifiedSince, input.CopySourceIfUnmodifiedSince}
+	if err := c.check(source, s3Error("PreconditionFailed", http.StatusPreconditionFailed, "At least one of the pre-conditions you specified did not hold")); err != nil {
+		return nil, err
+	}
+
+	metadataDirective := aws.StringValue(input.MetadataDirective)
+	taggingDirective := aws.StringValue(input.TaggingDirective)
+	if metadataDirective != "" && metadataDirective != "COPY" && metadataDirective != "REPLACE" {
+		return nil, invalidArgument("Unknown metadata directive.")
+	}
+	if taggingDirective != "" && taggingDirective != "COPY" && taggingDirective != "REPLACE" {
+		return nil, invalidArgument("Unknown tagging directive.")
+	}
+	key := aws.StringValue(input.Key)
+	if sourceBucket == bk && sourceKey == key && metadataDirective != "REPLACE" && input.StorageClass == nil {
+		return nil, s3Error("InvalidRequest", http.StatusBadRequest, "This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata, storage class, website redirect location or encryption attributes.")
+	}
+
+	fields := objectFields{storageClass: input.StorageClass, tagging: input.Tagging}
+	if metadataDirective == "REPLACE" {
+		fields.contentType = input.ContentType
+		fields.contentEncoding = input.ContentEncoding
+		fields.contentDisposition = input.ContentDisposition
+		fields.contentLanguage = input.ContentLanguage
+		fields.cacheControl = input.CacheControl
+		fields.metadata = input.Metadata
+	} else {
+		fields.contentType = aws.String(source.contentType)
+		fields.contentEncoding = aws.String(source.contentEncoding)
+		fields.contentDisposition = aws.String(source.contentDisposition)
+		fields.contentLanguage = aws.String(source.contentLanguage)
+		fields.cacheControl = aws.String(source.cacheControl)
+		fields.metadata = aws.StringMap(source.metadata)
+	}
+	v, err := newVersion(key, fields)
+	if err != nil {
+		return nil, err
+	}
+	if taggingDirective != "REPLACE" {
+		v.tags = copyTags(source.tags)
+	}
+
+	data, err := source.content.read()
+	if err != nil {
+		return nil, internalError(err)
+	}
+	if err := b.setContent(v, data); err != nil {
+		return nil, err
+	}
+	output := &s3.CopyObjectOutput{
+		CopyObjectResult:    &s3.CopyObjectResult{ETag: aws.String(v.etag), LastModified: aws.Time(v.lastModified)},
+		CopySourceVersionId: sourceBucket.outputVersionID(source),
+	}
+	bk.add(v)
+	output.VersionId = bk.outputVersionID(v)
+	return output, nil
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	copied := map[string]string{}
+	for key, value := range tags {
+		copied[key] = value
+	}
+	return copied
+}
+
+// PutObjectTagging replaces the tags of an object
+func (b *Backend) PutObjectTagging(input *s3.PutObjectTaggingInput) (*s3.PutObjectTaggingOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, v, err := b.findForRead(input.Bucket, input.Key, input.VersionId)
+	if err != nil {
+		return nil, err
+	}
+	if input.Tagging == nil {
+		return nil, malformedXML()
+	}
+	tags := map[string]string{}
+	for _, tag := range input.Tagging.TagSet {
+		key := aws.StringValue(tag.Key)
+		if _, ok := tags[key]; ok {
+			return nil, s3Error("InvalidTag", http.StatusBadRequest, "Cannot provide multiple Tags with the same key")
+		}
+		tags[key] = aws.StringValue(tag.Value)
+	}
+	if err := checkTags(tags); err != nil {
+		return nil, err
+	}
+	v.tags = tags
+	return &s3.PutObjectTaggingOutput{VersionId: bk.outputVersionID(v)}, nil
+}
+
+// GetObjectTagging returns the tags of an object, ordered by key
+func (b *Backend) GetObjectTagging(input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, v, err := b.findForRead(input.Bucket, input.Key, input.VersionId)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(v.tags))
+	for key := range v.tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	output := &s3.GetObjectTaggingOutput{TagSet: []*s3.Tag{}, VersionId: bk.outputVersionID(v)}
+	for _, key := range keys {
+		output.TagSet = append(output.TagSet, &s3.Tag{Key: aws.String(key), Value: aws.String(v.tags[key])})
+	}
+	return output, nil
+}
+
+// DeleteObjectTagging removes the tags of an object
+func (b *Backend) DeleteObjectTagging(input *s3.DeleteObjectTaggingInput) (*s3.DeleteObjectTaggingOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bk, v, err := b.findForRead(input.Bucket, input.Key, input.VersionId)
+	if err != nil {
+		return nil, err
+	}
+	v.tags = map[string]string{}
+	return &s3.DeleteObjectTaggingOutput{VersionId: bk.outputVersionID(v)}, nil
+}
@@ -0,0 +1,582 @@
+package s3_test
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/rosenhouse/awsfaker"
+	fakes3 "github.com/rosenhouse/awsfaker/backends/s3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("S3 backend", func() {
+	var (
+		backend    *fakes3.Backend
+		fakeServer *httptest.Server
+		client     *s3.S3
+	)
+
+	BeforeEach(func() {
+		backend = fakes3.New()
+		fakeServer = httptest.NewServer(awsfaker.New(backend))
+		client = s3.New(session.New(&aws.Config{
+			Credentials:      credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""),
+			Region:           aws.String("us-east-1"),
+			Endpoint:         aws.String(fakeServer.URL),
+			S3ForcePathStyle: aws.Bool(true),
+			MaxRetries:       aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	expectError := func(err error, status int, code string) {
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).StatusCode()).To(Equal(status))
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal(code))
+	}
+
+	createBucket := func(name string) {
+		_, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(name)})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	put := func(key, body string) *s3.PutObjectOutput {
+		output, err := client.PutObject(&s3.PutObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String(key), Body: strings.NewReader(body)})
+		Expect(err).NotTo(HaveOccurred())
+		return output
+	}
+
+	get := func(input *s3.GetObjectInput) (*s3.GetObjectOutput, string) {
+		input.Bucket = aws.String("some-bucket")
+		output, err := client.GetObject(input)
+		Expect(err).NotTo(HaveOccurred())
+		body, err := ioutil.ReadAll(output.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return output, string(body)
+	}
+
+	etag := func(body string) string {
+		return fmt.Sprintf(`"%x"`, md5.Sum([]byte(body)))
+	}
+
+	keys := func(objects []*s3.Object) []string {
+		var keys []string
+		for _, o := range objects {
+			keys = append(keys, *o.Key)
+		}
+		return keys
+	}
+
+	prefixes := func(commonPrefixes []*s3.CommonPrefix) []string {
+		var prefixes []string
+		for _, p := range commonPrefixes {
+			prefixes = append(prefixes, *p.Prefix)
+		}
+		return prefixes
+	}
+
+	Describe("buckets", func() {
+		It("creates, lists and deletes buckets", func() {
+			createBucket("bucket-two")
+			createBucket("bucket-one")
+
+			_, err := client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String("bucket-one")})
+			Expect(err).NotTo(HaveOccurred())
+
+			output, err := client.ListBuckets(&s3.ListBucketsInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.Buckets).To(HaveLen(2))
+			Expect(*output.Buckets[0].Name).To(Equal("bucket-one"))
+
+			_, err = client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("bucket-one")})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String("bucket-one")})
+			expectError(err, 404, "NotFound")
+		})
+
+		It("rejects invalid names, existing buckets and other regions", func() {
+			_, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("Some_Bucket")})
+			expectError(err, 400, "InvalidBucketName")
+
+			createBucket("some-bucket")
+			_, err = client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("some-bucket")})
+			expectError(err, 409, "BucketAlreadyOwnedByYou")
+
+			_, err = client.CreateBucket(&s3.CreateBucketInput{
+				Bucket:                    aws.String("other-bucket"),
+				CreateBucketConfiguration: &s3.CreateBucketConfiguration{LocationConstraint: aws.String("eu-west-1")},
+			})
+			expectError(err, 400, "IllegalLocationConstraintException")
+		})
+
+		It("refuses to delete a bucket that is not empty", func() {
+			createBucket("some-bucket")
+			put("some-key", "hello")
+
+			_, err := client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("some-bucket")})
+			expectError(err, 409, "BucketNotEmpty")
+		})
+	})
+
+	Describe("objects", func() {
+		BeforeEach(func() {
+			createBucket("some-bucket")
+		})
+
+		It("stores objects with their metadata, and returns the MD5 as the ETag", func() {
+			_, err := client.PutObject(&s3.PutObjectInput{
+				Bucket:      aws.String("some-bucket"),
+				Key:         aws.String("some/key"),
+				Body:        strings.NewReader("hello world"),
+				ContentType: aws.String("text/plain"),
+				Metadata:    map[string]*string{"Color": aws.String("blue")},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			output, body := get(&s3.GetObjectInput{Key: aws.String("some/key")})
+			Expect(body).To(Equal("hello world"))
+			Expect(*output.ETag).To(Equal(etag("hello world")))
+			Expect(*output.ContentType).To(Equal("text/plain"))
+			Expect(*output.ContentLength).To(Equal(int64(11)))
+			Expect(aws.StringValueMap(output.Metadata)).To(Equal(map[string]string{"Color": "blue"}))
+			Expect(output.VersionId).To(BeNil())
+
+			head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("some/key")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*head.ETag).To(Equal(etag("hello world")))
+			Expect(*head.ContentLength).To(Equal(int64(11)))
+			Expect(*head.LastModified).To(BeTemporally("~", time.Now(), 2*time.Second))
+		})
+
+		It("checks the Content-MD5", func() {
+			sum := md5.Sum([]byte("hello"))
+			_, err := client.PutObject(&s3.PutObjectInput{
+				Bucket:     aws.String("some-bucket"),
+				Key:        aws.String("some-key"),
+				Body:       strings.NewReader("hello"),
+				ContentMD5: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.PutObject(&s3.PutObjectInput{
+				Bucket:     aws.String("some-bucket"),
+				Key:        aws.String("some-key"),
+				Body:       strings.NewReader("goodbye"),
+				ContentMD5: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+			})
+			expectError(err, 400, "BadDigest")
+
+			_, err = client.PutObject(&s3.PutObjectInput{
+				Bucket:     aws.String("some-bucket"),
+				Key:        aws.String("some-key"),
+				Body:       strings.NewReader("hello"),
+				ContentMD5: aws.String("not-a-digest"),
+			})
+			expectError(err, 400, "InvalidDigest")
+		})
+
+		It("reports missing buckets and keys", func() {
+			_, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("missing")})
+			expectError(err, 404, "NoSuchKey")
+
+			_, err = client.GetObject(&s3.GetObjectInput{Bucket: aws.String("missing-bucket"), Key: aws.String("some-key")})
+			expectError(err, 404, "NoSuchBucket")
+		})
+
+		It("deletes objects, whether or not they exist", func() {
+			put("some-key", "hello")
+			_, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key")})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key")})
+			Expect(err).NotTo(HaveOccurred())
+
+			put("one", "1")
+			put("two", "2")
+			output, err := client.DeleteObjects(&s3.DeleteObjectsInput{
+				Bucket: aws.String("some-bucket"),
+				Delete: &s3.Delete{Objects: []*s3.ObjectIdentifier{{Key: aws.String("one")}, {Key: aws.String("two")}}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.Deleted).To(HaveLen(2))
+			Expect(backend.DumpState()).To(Equal(fakes3.State{Buckets: []fakes3.BucketState{{Name: "some-bucket"}}}))
+		})
+
+		Describe("ranges and conditions", func() {
+			var tag string
+
+			BeforeEach(func() {
+				tag = *put("some-key", "0123456789").ETag
+			})
+
+			It("returns the bytes in the Range", func() {
+				output, body := get(&s3.GetObjectInput{Key: aws.String("some-key"), Range: aws.String("bytes=2-5")})
+				Expect(body).To(Equal("2345"))
+				Expect(*output.ContentRange).To(Equal("bytes 2-5/10"))
+				Expect(*output.ContentLength).To(Equal(int64(4)))
+
+				_, body = get(&s3.GetObjectInput{Key: aws.String("some-key"), Range: aws.String("bytes=-3")})
+				Expect(body).To(Equal("789"))
+
+				_, body = get(&s3.GetObjectInput{Key: aws.String("some-key"), Range: aws.String("bytes=8-")})
+				Expect(body).To(Equal("89"))
+
+				_, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key"), Range: aws.String("bytes=20-30")})
+				expectError(err, 416, "InvalidRange")
+			})
+
+			It("honours If-Match and If-None-Match", func() {
+				_, body := get(&s3.GetObjectInput{Key: aws.String("some-key"), IfMatch: aws.String(tag)})
+				Expect(body).To(Equal("0123456789"))
+
+				_, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key"), IfMatch: aws.String(`"other"`)})
+				expectError(err, 412, "PreconditionFailed")
+
+				_, err = client.GetObject(&s3.GetObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key"), IfNoneMatch: aws.String(tag)})
+				expectError(err, 304, "NotModified")
+
+				_, body = get(&s3.GetObjectInput{Key: aws.String("some-key"), IfNoneMatch: aws.String(`"other"`)})
+				Expect(body).To(Equal("0123456789"))
+			})
+
+			It("honours If-Modified-Since and If-Unmodified-Since", func() {
+				later := time.Now().Add(time.Hour)
+				_, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key"), IfModifiedSince: aws.Time(later)})
+				expectError(err, 304, "NotModified")
+
+				earlier := time.Now().Add(-time.Hour)
+				_, err = client.GetObject(&s3.GetObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key"), IfUnmodifiedSince: aws.Time(earlier)})
+				expectError(err, 412, "PreconditionFailed")
+			})
+		})
+
+		It("copies objects with their metadata and tags, unless told to replace them", func() {
+			_, err := client.PutObject(&s3.PutObjectInput{
+				Bucket:   aws.String("some-bucket"),
+				Key:      aws.String("source"),
+				Body:     strings.NewReader("hello"),
+				Metadata: map[string]*string{"Color": aws.String("blue")},
+				Tagging:  aws.String("team=core"),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			output, err := client.CopyObject(&s3.CopyObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("copy"), CopySource: aws.String("some-bucket/source")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.CopyObjectResult.ETag).To(Equal(etag("hello")))
+
+			copied, body := get(&s3.GetObjectInput{Key: aws.String("copy")})
+			Expect(body).To(Equal("hello"))
+			Expect(aws.StringValueMap(copied.Metadata)).To(Equal(map[string]string{"Color": "blue"}))
+			Expect(*copied.TagCount).To(Equal(int64(1)))
+
+			_, err = client.CopyObject(&s3.CopyObjectInput{
+				Bucket:            aws.String("some-bucket"),
+				Key:               aws.String("copy"),
+				CopySource:        aws.String("some-bucket/source"),
+				MetadataDirective: aws.String("REPLACE"),
+				Metadata:          map[string]*string{"Color": aws.String("red")},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			replaced, _ := get(&s3.GetObjectInput{Key: aws.String("copy")})
+			Expect(aws.StringValueMap(replaced.Metadata)).To(Equal(map[string]string{"Color": "red"}))
+
+			_, err = client.CopyObject(&s3.CopyObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("source"), CopySource: aws.String("some-bucket/source")})
+			expectError(err, 400, "InvalidRequest")
+
+			_, err = client.CopyObject(&s3.CopyObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("copy"), CopySource: aws.String("some-bucket/source"), CopySourceIfMatch: aws.String(`"other"`)})
+			expectError(err, 412, "PreconditionFailed")
+		})
+
+		It("sets, gets and deletes tags", func() {
+			put("some-key", "hello")
+			_, err := client.PutObjectTagging(&s3.PutObjectTaggingInput{
+				Bucket:  aws.String("some-bucket"),
+				Key:     aws.String("some-key"),
+				Tagging: &s3.Tagging{TagSet: []*s3.Tag{{Key: aws.String("b"), Value: aws.String("2")}, {Key: aws.String("a"), Value: aws.String("1")}}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			output, err := client.GetObjectTagging(&s3.GetObjectTaggingInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.TagSet).To(Equal([]*s3.Tag{{Key: aws.String("a"), Value: aws.String("1")}, {Key: aws.String("b"), Value: aws.String("2")}}))
+
+			_, err = client.DeleteObjectTagging(&s3.DeleteObjectTaggingInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key")})
+			Expect(err).NotTo(HaveOccurred())
+			output, err = client.GetObjectTagging(&s3.GetObjectTaggingInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.TagSet).To(BeEmpty())
+		})
+	})
+
+	Describe("listing", func() {
+		BeforeEach(func() {
+			createBucket("some-bucket")
+			for _, key := range []string{"a/1", "a/2", "b/1", "c", "d", "e"} {
+				put(key, key)
+			}
+		})
+
+		It("lists by prefix and rolls keys up to the delimiter", func() {
+			output, err := client.ListObjects(&s3.ListObjectsInput{Bucket: aws.String("some-bucket"), Delimiter: aws.String("/")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys(output.Contents)).To(Equal([]string{"c", "d", "e"}))
+			Expect(prefixes(output.CommonPrefixes)).To(Equal([]string{"a/", "b/"}))
+
+			output, err = client.ListObjects(&s3.ListObjectsInput{Bucket: aws.String("some-bucket"), Prefix: aws.String("a/")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys(output.Contents)).To(Equal([]string{"a/1", "a/2"}))
+			Expect(*output.Contents[0].ETag).To(Equal(etag("a/1")))
+		})
+
+		It("pages through ListObjects with markers", func() {
+			var pages [][]string
+			err := client.ListObjectsPages(&s3.ListObjectsInput{Bucket: aws.String("some-bucket"), MaxKeys: aws.Int64(2)}, func(page *s3.ListObjectsOutput, last bool) bool {
+				pages = append(pages, keys(page.Contents))
+				return true
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pages).To(Equal([][]string{{"a/1", "a/2"}, {"b/1", "c"}, {"d", "e"}}))
+		})
+
+		It("pages through ListObjectsV2 with continuation tokens, counting common prefixes once", func() {
+			var contents, commonPrefixes []string
+			pages := 0
+			err := client.ListObjectsV2Pages(&s3.ListObjectsV2Input{Bucket: aws.String("some-bucket"), Delimiter: aws.String("/"), MaxKeys: aws.Int64(2)}, func(page *s3.ListObjectsV2Output, last bool) bool {
+				pages++
+				Expect(*page.KeyCount).To(BeNumerically("<=", 2))
+				contents = append(contents, keys(page.Contents)...)
+				commonPrefixes = append(commonPrefixes, prefixes(page.CommonPrefixes)...)
+				return true
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pages).To(Equal(3))
+			Expect(contents).To(Equal([]string{"c", "d", "e"}))
+			Expect(commonPrefixes).To(Equal([]string{"a/", "b/"}))
+
+			_, err = client.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String("some-bucket"), ContinuationToken: aws.String("!")})
+			expectError(err, 400, "InvalidArgument")
+		})
+
+		It("starts after the StartAfter key", func() {
+			output, err := client.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String("some-bucket"), StartAfter: aws.String("c")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys(output.Contents)).To(Equal([]string{"d", "e"}))
+			Expect(*output.IsTruncated).To(BeFalse())
+		})
+	})
+
+	Describe("versioning", func() {
+		BeforeEach(func() {
+			createBucket("some-bucket")
+			_, err := client.PutBucketVersioning(&s3.PutBucketVersioningInput{
+				Bucket:                  aws.String("some-bucket"),
+				VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String("Enabled")},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("keeps every version, and hides deleted objects behind delete markers", func() {
+			first := *put("some-key", "one").VersionId
+			second := *put("some-key", "two").VersionId
+			Expect(first).NotTo(Equal(second))
+
+			_, body := get(&s3.GetObjectInput{Key: aws.String("some-key")})
+			Expect(body).To(Equal("two"))
+			_, body = get(&s3.GetObjectInput{Key: aws.String("some-key"), VersionId: aws.String(first)})
+			Expect(body).To(Equal("one"))
+
+			deleted, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*deleted.DeleteMarker).To(BeTrue())
+
+			_, err = client.GetObject(&s3.GetObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key")})
+			expectError(err, 404, "NoSuchKey")
+
+			versions, err := client.ListObjectVersions(&s3.ListObjectVersionsInput{Bucket: aws.String("some-bucket")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions.DeleteMarkers).To(HaveLen(1))
+			Expect(*versions.DeleteMarkers[0].IsLatest).To(BeTrue())
+			Expect(versions.Versions).To(HaveLen(2))
+			Expect(*versions.Versions[0].VersionId).To(Equal(second))
+			Expect(*versions.Versions[1].VersionId).To(Equal(first))
+
+			_, err = client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key"), VersionId: deleted.VersionId})
+			Expect(err).NotTo(HaveOccurred())
+			_, body = get(&s3.GetObjectInput{Key: aws.String("some-key")})
+			Expect(body).To(Equal("two"))
+		})
+
+		It("pages through versions", func() {
+			put("a", "1")
+			put("a", "2")
+			put("b", "3")
+
+			var seen []string
+			err := client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{Bucket: aws.String("some-bucket"), MaxKeys: aws.Int64(1)}, func(page *s3.ListObjectVersionsOutput, last bool) bool {
+				for _, v := range page.Versions {
+					seen = append(seen, *v.Key)
+				}
+				return true
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(seen).To(Equal([]string{"a", "a", "b"}))
+		})
+
+		It("reports the versioning status", func() {
+			output, err := client.GetBucketVersioning(&s3.GetBucketVersioningInput{Bucket: aws.String("some-bucket")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.Status).To(Equal("Enabled"))
+		})
+	})
+
+	Describe("multipart uploads", func() {
+		var uploadID string
+
+		BeforeEach(func() {
+			backend.MinPartSize = 5
+			createBucket("some-bucket")
+			output, err := client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+				Bucket:      aws.String("some-bucket"),
+				Key:         aws.String("some-key"),
+				ContentType: aws.String("text/plain"),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			uploadID = *output.UploadId
+		})
+
+		uploadPart := func(number int64, body string) *s3.CompletedPart {
+			output, err := client.UploadPart(&s3.UploadPartInput{
+				Bucket:     aws.String("some-bucket"),
+				Key:        aws.String("some-key"),
+				UploadId:   aws.String(uploadID),
+				PartNumber: aws.Int64(number),
+				Body:       strings.NewReader(body),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.ETag).To(Equal(etag(body)))
+			return &s3.CompletedPart{PartNumber: aws.Int64(number), ETag: output.ETag}
+		}
+
+		complete := func(parts ...*s3.CompletedPart) (*s3.CompleteMultipartUploadOutput, error) {
+			return client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+				Bucket:          aws.String("some-bucket"),
+				Key:             aws.String("some-key"),
+				UploadId:        aws.String(uploadID),
+				MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+			})
+		}
+
+		It("joins the parts, with an ETag made from the part digests", func() {
+			one := uploadPart(1, "hello ")
+			two := uploadPart(2, "world")
+
+			parts, err := client.ListParts(&s3.ListPartsInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key"), UploadId: aws.String(uploadID)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parts.Parts).To(HaveLen(2))
+
+			output, err := complete(one, two)
+			Expect(err).NotTo(HaveOccurred())
+			sumOne, sumTwo := md5.Sum([]byte("hello ")), md5.Sum([]byte("world"))
+			Expect(*output.ETag).To(Equal(fmt.Sprintf(`"%x-2"`, md5.Sum(append(sumOne[:], sumTwo[:]...)))))
+
+			object, body := get(&s3.GetObjectInput{Key: aws.String("some-key")})
+			Expect(body).To(Equal("hello world"))
+			Expect(*object.ContentType).To(Equal("text/plain"))
+
+			_, err = client.ListParts(&s3.ListPartsInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key"), UploadId: aws.String(uploadID)})
+			expectError(err, 404, "NoSuchUpload")
+		})
+
+		It("refuses parts that are missing, out of order or too small", func() {
+			one := uploadPart(1, "hi")
+			two := uploadPart(2, "there")
+
+			_, err := complete(two, one)
+			expectError(err, 400, "InvalidPartOrder")
+
+			_, err = complete(one, &s3.CompletedPart{PartNumber: aws.Int64(3), ETag: two.ETag})
+			expectError(err, 400, "InvalidPart")
+
+			_, err = complete(one, two)
+			expectError(err, 400, "EntityTooSmall")
+		})
+
+		It("lists and aborts uploads", func() {
+			uploads, err := client.ListMultipartUploads(&s3.ListMultipartUploadsInput{Bucket: aws.String("some-bucket")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uploads.Uploads).To(HaveLen(1))
+			Expect(*uploads.Uploads[0].UploadId).To(Equal(uploadID))
+
+			_, err = client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key"), UploadId: aws.String(uploadID)})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.UploadPart(&s3.UploadPartInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key"), UploadId: aws.String(uploadID), PartNumber: aws.Int64(1), Body: strings.NewReader("hi")})
+			expectError(err, 404, "NoSuchUpload")
+		})
+	})
+
+	Describe("DumpState and Reset", func() {
+		It("summarizes each bucket, and forgets everything on Reset", func() {
+			createBucket("some-bucket")
+			put("one", "1")
+			put("two", "2")
+			_, err := client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{Bucket: aws.String("some-bucket"), Key: aws.String("three")})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(backend.DumpState()).To(Equal(fakes3.State{Buckets: []fakes3.BucketState{
+				{Name: "some-bucket", Objects: 2, Versions: 2, Uploads: 1},
+			}}))
+
+			backend.Reset()
+			Expect(backend.DumpState()).To(Equal(fakes3.State{Buckets: []fakes3.BucketState{}}))
+		})
+	})
+
+	Context("when objects are kept in a directory", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "awsfaker-s3")
+			Expect(err).NotTo(HaveOccurred())
+			backend.Dir = dir
+			createBucket("some-bucket")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("writes contents to files, and removes them on delete", func() {
+			put("some-key", "hello")
+			files, err := ioutil.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(1))
+
+			_, body := get(&s3.GetObjectInput{Key: aws.String("some-key")})
+			Expect(body).To(Equal("hello"))
+
+			_, err = client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("some-bucket"), Key: aws.String("some-key")})
+			Expect(err).NotTo(HaveOccurred())
+			files, err = ioutil.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,219 @@
+// Package sns is a ready-made backend for a fake Amazon Simple Notification
+// Service, which keeps its topics and subscriptions in memory.
+//
+// Published messages are delivered as they would be by the real service:
+// wrapped in the SNS JSON envelope, or raw when the subscription has
+// RawMessageDelivery, and only when they pass the subscription's
+// FilterPolicy.  Messages for sqs subscriptions go into the queues of an SQS
+// backend in the same process, and messages for http and https
+// subscriptions are POSTed to the endpoint, which must first confirm the
+// subscription by fetching the SubscribeURL from a SubscriptionConfirmation.
+// Every delivery is recorded, whatever the protocol.
+package sns
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/rosenhouse/awsfaker"
+	"github.com/rosenhouse/awsfaker/backends/sqs"
+)
+
+// Backend is a fake SNS.  Use New to create one.
+type Backend struct {
+	// Region and AccountID appear in topic and subscription ARNs
+	Region    string
+	AccountID string
+
+	// Queues receives the messages for sqs subscriptions.  If it is nil,
+	// those messages are only recorded.
+	Queues *sqs.Backend
+
+	// HTTPClient sends the messages for http and https subscriptions, and
+	// defaults to a client with a 15 second timeout
+	HTTPClient *http.Client
+
+	lock          sync.Mutex
+	topics        map[string]*topic
+	subscriptions map[string]*subscription
+	deliveries    map[string][]Delivery
+}
+
+// Delivery is a message sent to a subscriber
+type Delivery struct {
+	// Type is Notification, or SubscriptionConfirmation
+	Type      string
+	MessageID string
+	Body      string
+
+	// Error describes why the delivery failed, and is empty if it did not
+	Error string
+}
+
+var defaultHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// New returns a Backend with no topics
+func New() *Backend {
+	b := &Backend{
+		Region:    "us-east-1",
+		AccountID: "123456789012",
+	}
+	b.clear()
+	return b
+}
+
+func (b *Backend) clear() {
+	b.topics = map[string]*topic{}
+	b.subscriptions = map[string]*subscription{}
+	b.deliveries = map[string][]Delivery{}
+}
+
+// Reset removes all topics, subscriptions and recorded deliveries
+func (b *Backend) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.clear()
+}
+
+// Deliveries returns the messages sent for a subscription, oldest first,
+// including those sent before it was deleted
+func (b *Backend) Deliveries(subscriptionArn string) []Delivery {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]Delivery{}, b.deliveries[subscriptionArn]...)
+}
+
+// State is the state of a Backend, as reported by DumpState
+type State struct {
+	Topics []TopicState
+}
+
+// TopicState describes a topic and its subscriptions
+type TopicState struct {
+	Arn           string
+	Subscriptions []SubscriptionState
+}
+
+// SubscriptionState describes a subscription
+type SubscriptionState struct {
+	Arn        string
+	Protocol   string
+	Endpoint   string
+	Confirmed  bool
+	Deliveries int
+}
+
+// DumpState returns the topics, their subscriptions, and the number of
+// messages sent for each subscription
+func (b *Backend) DumpState() interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	state := State{Topics: []TopicState{}}
+	for _, topicArn := range b.topicArns() {
+		topicState := TopicState{Arn: topicArn, Subscriptions: []SubscriptionState{}}
+		for _, s := range b.topicSubscriptions(topicArn) {
+			topicState.Subscriptions = append(topicState.Subscriptions, SubscriptionState{
+				Arn:        s.arn,
+				Protocol:   s.protocol,
+				Endpoint:   s.endpoint,
+				Confirmed:  s.confirmed,
+				Deliveries: len(b.deliveries[s.arn]),
+			})
+		}
+		state.Topics = append(state.Topics, topicState)
+	}
+	return state
+}
+
+func (b *Backend) httpClient() *http.Client {
+	if b.HTTPClient == nil {
+		return defaultHTTPClient
+	}
+	return b.HTTPClient
+}
+
+// endpoint returns the URL of the endpoint that the request was sent to, so
+// that the links in messages reach the fake
+func (b *Backend) endpoint(ctx context.Context) string {
+	if info, ok := awsfaker.RequestInfoFromContext(ctx); ok && info.Request != nil {
+		scheme := "http"
+		if info.Request.TLS != nil {
+			scheme = "https"
+		}
+		return scheme + "://" + info.Request.Host
+	}
+	return fmt.Sprintf("https://sns.%s.amazonaws.com", b.Region)
+}
+
+func (b *Backend) record(subscriptionArn string, delivery Delivery) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.deliveries[subscriptionArn] = append(b.deliveries[subscriptionArn], delivery)
+}
+
+func (b *Backend) topicArns() []string {
+	arns := make([]string, 0, len(b.topics))
+	for arn := range b.topics {
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+	return arns
+}
+
+func (b *Backend) subscriptionArns() []string {
+	arns := make([]string, 0, len(b.subscriptions))
+	for arn := range b.subscriptions {
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+	return arns
+}
+
+// page returns the bounds of the page of keys that starts after the token,
+// and the token for the next page, if there is one
+func page(keys []string, token *string, limit int) (int, int, *string, error) {
+	from := 0
+	if token != nil {
+		decoded, err := base64.StdEncoding.DecodeString(*token)
+		if err != nil {
+			return 0, 0, nil, invalidParameter("NextToken")
+		}
+		from = sort.SearchStrings(keys, string(decoded))
+	}
+	to := from + limit
+	if to >= len(keys) {
+		return from, len(keys), nil, nil
+	}
+	return from, to, aws.String(base64.StdEncoding.EncodeToString([]byte(keys[to]))), nil
+}
+
+func snsError(code string, status int, format string, args ...interface{}) error {
+	return &awsfaker.ErrorResponse{
+		AWSErrorCode:    code,
+		AWSErrorMessage: fmt.Sprintf(format, args...),
+		HTTPStatusCode:  status,
+	}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return snsError("NotFound", http.StatusNotFound, format, args...)
+}
+
+func invalidParameter(name string) error {
+	return snsError("InvalidParameter", http.StatusBadRequest, "Invalid parameter: %s", name)
+}
+
+func invalidParameterReason(name, format string, args ...interface{}) error {
+	return snsError("InvalidParameter", http.StatusBadRequest, "Invalid parameter: %s Reason: %s", name, fmt.Sprintf(format, args...))
+}
+
+func invalidParameterValue(format string, args ...interface{}) error {
+	return snsError("InvalidParameterValue", http.StatusBadRequest, format, args...)
+}
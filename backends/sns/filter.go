@@ -0,0 +1,205 @@
+package sns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// filterPolicy maps the name of a message attribute to the conditions on its
+// value, any of which may be met
+type filterPolicy map[string][]interface{}
+
+var numericOperators = map[string]func(a, b float64) bool{
+	"=":  func(a, b float64) bool { return a == b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+}
+
+// parseFilterPolicy parses a policy, whose conditions may be strings and
+// numbers to match exactly, or objects with one of the operators prefix,
+// anything-but, numeric or exists
+func parseFilterPolicy(document string) (filterPolicy, error) {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(document), &decoded); err != nil {
+		return nil, err
+	}
+	policy := filterPolicy{}
+	for name, value := range decoded {
+		conditions, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Filter policy attribute %s must be an array", name)
+		}
+		for _, condition := range conditions {
+			if err := checkCondition(condition); err != nil {
+				return nil, err
+			}
+		}
+		policy[name] = conditions
+	}
+	return policy, nil
+}
+
+func checkCondition(condition interface{}) error {
+	switch condition := condition.(type) {
+	case string, float64:
+		return nil
+	case map[string]interface{}:
+		if len(condition) != 1 {
+			return errors.New("Filter policy operators must be objects with one key")
+		}
+		for operator, operand := range condition {
+			switch operator {
+			case "prefix":
+				if _, ok := operand.(string); ok {
+					return nil
+				}
+			case "exists":
+				if _, ok := operand.(bool); ok {
+					return nil
+				}
+			case "anything-but":
+				switch operand := operand.(type) {
+				case string, float64:
+					return nil
+				case []interface{}:
+					for _, excluded := range operand {
+						if err := checkCondition(excluded); err != nil {
+							return err
+						}
+					}
+					return nil
+				}
+			case "numeric":
+				if _, err := numericComparisons(operand); err == nil {
+					return nil
+				}
+			default:
+				return fmt.Errorf("Unrecognized match type %s", operator)
+			}
+			return fmt.Errorf("Value of %s is not valid", operator)
+		}
+	}
+	return errors.New("Match value must be String, number, true, false, or null")
+}
+
+type numericComparison struct {
+	operator string
+	value    float64
+}
+
+func numericComparisons(operand interface{}) ([]numericComparison, error) {
+	terms, ok := operand.([]interface{})
+	if !ok || len(terms) == 0 || len(terms)%2 != 0 {
+		return nil, errors.New("Value of numeric must be an array of operators and numbers")
+	}
+	comparisons := []numericComparison{}
+	for i := 0; i < len(terms); i += 2 {
+		operator, ok := terms[i].(string)
+		value, isNumber := terms[i+1].(float64)
+		if _, known := numericOperators[operator]; !ok || !known || !isNumber {
+			return nil, errors.New("Value of numeric must be an array of operators and numbers")
+		}
+		comparisons = append(comparisons, numericComparison{operator, value})
+	}
+	return comparisons, nil
+}
+
+// matches reports whether message attributes pass the policy: each
+// attribute named in the policy must meet one of its conditions
+func (p filterPolicy) matches(attributes map[string]*sns.MessageAttributeValue) bool {
+	for name, conditions := range p {
+		attribute, present := attributes[name]
+		if !matchesAny(conditions, attribute, present) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAny(conditions []interface{}, attribute *sns.MessageAttributeValue, present bool) bool {
+	values := attributeValues(attribute)
+	for _, condition := range conditions {
+		if operator, ok := condition.(map[string]interface{}); ok {
+			if exists, ok := operator["exists"].(bool); ok {
+				if exists == present {
+					return true
+				}
+				continue
+			}
+		}
+		for _, value := range values {
+			if matchesCondition(condition, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// attributeValues returns the values of an attribute to match against:
+// strings, and numbers as float64.  A String.Array has a value for each
+// element.
+func attributeValues(attribute *sns.MessageAttributeValue) []interface{} {
+	if attribute == nil || attribute.StringValue == nil {
+		return nil
+	}
+	dataType, value := aws.StringValue(attribute.DataType), *attribute.StringValue
+	switch {
+	case strings.HasPrefix(dataType, "Number"):
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			return []interface{}{number}
+		}
+	case dataType == "String.Array":
+		var elements []interface{}
+		if err := json.Unmarshal([]byte(value), &elements); err == nil {
+			return elements
+		}
+	case strings.HasPrefix(dataType, "String"):
+		return []interface{}{value}
+	}
+	return nil
+}
+
+func matchesCondition(condition, value interface{}) bool {
+	operator, ok := condition.(map[string]interface{})
+	if !ok {
+		return condition == value
+	}
+	if prefix, ok := operator["prefix"].(string); ok {
+		s, ok := value.(string)
+		return ok && strings.HasPrefix(s, prefix)
+	}
+	if excluded, ok := operator["anything-but"]; ok {
+		if list, ok := excluded.([]interface{}); ok {
+			for _, e := range list {
+				if e == value {
+					return false
+				}
+			}
+			return true
+		}
+		return excluded != value
+	}
+	if operand, ok := operator["numeric"]; ok {
+		number, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		comparisons, _ := numericComparisons(operand)
+		for _, c := range comparisons {
+			if !numericOperators[c.operator](number, c.value) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,317 @@
+package sns
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	awssqs "github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/rosenhouse/awsfaker"
+	"github.com/rosenhouse/awsfaker/internal/random"
+)
+
+const maxMessageSize = 256 * 1024
+
+// envelope is the JSON document that wraps messages sent to subscribers.
+// Signature is random, since the fake has no certificate to sign with.
+type envelope struct {
+	Type              string
+	MessageID         string `json:"MessageId"`
+	Token             string `json:",omitempty"`
+	TopicArn          string
+	Subject           string `json:",omitempty"`
+	Message           string
+	SubscribeURL      string `json:",omitempty"`
+	Timestamp         string
+	SignatureVersion  string
+	Signature         string
+	SigningCertURL    string
+	UnsubscribeURL    string                       `json:",omitempty"`
+	MessageAttributes map[string]envelopeAttribute `json:",omitempty"`
+}
+
+type envelopeAttribute struct {
+	Type  string
+	Value string
+}
+
+// outgoing is a message on its way to a subscriber.  It holds what it needs
+// of the subscription, so that it can be sent without holding the lock.
+type outgoing struct {
+	subscriptionArn string
+	topicArn        string
+	protocol        string
+	endpoint        string
+	raw             bool
+	attributes      map[string]*sns.MessageAttributeValue
+	delivery        Delivery
+}
+
+func (b *Backend) newEnvelope(messageType, topicArn string) envelope {
+	return envelope{
+		Type:             messageType,
+		MessageID:        random.UUID(),
+		TopicArn:         topicArn,
+		Timestamp:        time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		SignatureVersion: "1",
+		Signature:        base64.StdEncoding.EncodeToString([]byte(random.Hex(256))),
+		SigningCertURL:   fmt.Sprintf("https://sns.%s.amazonaws.com/SimpleNotificationService-%s.pem", b.Region, random.Hex(32)),
+	}
+}
+
+func encodeEnvelope(e envelope) string {
+	encoded, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	return string(encoded)
+}
+
+// confirmation returns the SubscriptionConfirmation for a subscription
+func (b *Backend) confirmation(ctx context.Context, s *subscription) outgoing {
+	e := b.newEnvelope("SubscriptionConfirmation", s.topicArn)
+	e.Token = s.token
+	e.Message = fmt.Sprintf("You have chosen to subscribe to the topic %s.\nTo confirm the subscription, visit the SubscribeURL included in this message.", s.topicArn)
+	e.SubscribeURL = b.endpoint(ctx) + "/?" + url.Values{
+		"Action":   {"ConfirmSubscription"},
+		"TopicArn": {s.topicArn},
+		"Token":    {s.token},
+	}.Encode()
+
+	return outgoing{
+		topicArn:        s.topicArn,
+		subscriptionArn: s.arn,
+		protocol:        s.protocol,
+		endpoint:        s.endpoint,
+		delivery:        Delivery{Type: e.Type, MessageID: e.MessageID, Body: encodeEnvelope(e)},
+	}
+}
+
+// notification returns the Notification of a message to a subscription
+func (b *Backend) notification(ctx context.Context, s *subscription, e envelope, attributes map[string]*sns.MessageAttributeValue) outgoing {
+	e.UnsubscribeURL = b.endpoint(ctx) + "/?" + url.Values{
+		"Action":          {"Unsubscribe"},
+		"SubscriptionArn": {s.arn},
+	}.Encode()
+
+	o := outgoing{
+		topicArn:        s.topicArn,
+		subscriptionArn: s.arn,
+		protocol:        s.protocol,
+		endpoint:        s.endpoint,
+		raw:             s.attributes["RawMessageDelivery"] == "true",
+		attributes:      attributes,
+		delivery:        Delivery{Type: e.Type, MessageID: e.MessageID, Body: encodeEnvelope(e)},
+	}
+	if o.raw {
+		o.delivery.Body = e.Message
+	}
+	return o
+}
+
+// send delivers a message to its subscriber, and records the delivery
+func (b *Backend) send(o outgoing) {
+	var err error
+	switch o.protocol {
+	case "sqs":
+		err = b.sendToQueue(o)
+	case "http", "https":
+		err = b.post(o)
+	}
+	if err != nil {
+		if response, ok := err.(*awsfaker.ErrorResponse); ok {
+			o.delivery.Error = response.AWSErrorMessage
+		} else {
+			o.delivery.Error = err.Error()
+		}
+	}
+	b.record(o.subscriptionArn, o.delivery)
+}
+
+func (b *Backend) sendToQueue(o outgoing) error {
+	if b.Queues == nil {
+		return nil
+	}
+	var attributes map[string]*awssqs.MessageAttributeValue
+	if o.raw && len(o.attributes) > 0 {
+		attributes = map[string]*awssqs.MessageAttributeValue{}
+		for name, value := range o.attributes {
+			attributes[name] = &awssqs.MessageAttributeValue{
+				DataType:    value.DataType,
+				StringValue: value.StringValue,
+				BinaryValue: value.BinaryValue,
+			}
+		}
+	}
+	return b.Queues.Deliver(o.endpoint, o.delivery.Body, attributes)
+}
+
+func (b *Backend) post(o outgoing) error {
+	request, err := http.NewRequest("POST", o.endpoint, strings.NewReader(o.delivery.Body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+	request.Header.Set("User-Agent", "Amazon Simple Notification Service Agent")
+	request.Header.Set("x-amz-sns-message-type", o.delivery.Type)
+	request.Header.Set("x-amz-sns-message-id", o.delivery.MessageID)
+	request.Header.Set("x-amz-sns-topic-arn", o.topicArn)
+	if o.delivery.Type == "Notification" {
+		request.Header.Set("x-amz-sns-subscription-arn", o.subscriptionArn)
+	}
+	if o.raw {
+		request.Header.Set("x-amz-sns-rawdelivery", "true")
+	}
+
+	response, err := b.httpClient().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("endpoint responded with status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// Publish sends a message to the confirmed subscribers of a topic whose
+// FilterPolicy it passes.  With a MessageStructure of json, the message is a
+// JSON object of the messages for each protocol, which must include a
+// default.  Publish returns once the message has been delivered to every
+// subscriber.
+func (b *Backend) Publish(ctx context.Context, input *sns.PublishInput) (*sns.PublishOutput, error) {
+	messageID, messages, err := b.publish(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range messages {
+		b.send(o)
+	}
+	return &sns.PublishOutput{MessageId: aws.String(messageID)}, nil
+}
+
+func (b *Backend) publish(ctx context.Context, input *sns.PublishInput) (string, []outgoing, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	topicArn := input.TopicArn
+	if topicArn == nil {
+		topicArn = input.TargetArn
+	}
+	if topicArn == nil && input.PhoneNumber != nil {
+		return random.UUID(), nil, nil
+	}
+	t, err := b.findTopic(topicArn)
+	if err != nil {
+		return "", nil, err
+	}
+
+	message := aws.StringValue(input.Message)
+	if message == "" {
+		return "", nil, invalidParameter("Empty message")
+	}
+	size := len(message)
+	for name, value := range input.MessageAttributes {
+		size += len(name) + len(aws.StringValue(value.DataType)) + len(aws.StringValue(value.StringValue)) + len(value.BinaryValue)
+	}
+	if size > maxMessageSize {
+		return "", nil, invalidParameterReason("Message", "Message too long")
+	}
+	subject := aws.StringValue(input.Subject)
+	if err := checkSubject(subject); err != nil {
+		return "", nil, err
+	}
+	attributes, err := checkMessageAttributes(input.MessageAttributes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	messages := map[string]string{"default": message}
+	switch aws.StringValue(input.MessageStructure) {
+	case "":
+	case "json":
+		messages = map[string]string{}
+		if err := json.Unmarshal([]byte(message), &messages); err != nil {
+			return "", nil, invalidParameterReason("Message", "Message Structure - JSON message body failed to parse")
+		}
+		if _, ok := messages["default"]; !ok {
+			return "", nil, invalidParameterReason("Message", "Message Structure - No default entry in JSON message body")
+		}
+	default:
+		return "", nil, invalidParameter("MessageStructure")
+	}
+
+	e := b.newEnvelope("Notification", t.arn)
+	e.Subject = subject
+	e.MessageAttributes = attributes
+
+	var outgoings []outgoing
+	for _, s := range b.topicSubscriptions(t.arn) {
+		if !s.confirmed || (s.filter != nil && !s.filter.matches(input.MessageAttributes)) {
+			continue
+		}
+		e.Message = messages["default"]
+		if m, ok := messages[s.protocol]; ok {
+			e.Message = m
+		}
+		outgoings = append(outgoings, b.notification(ctx, s, e, input.MessageAttributes))
+	}
+	return e.MessageID, outgoings, nil
+}
+
+func checkSubject(subject string) error {
+	if len(subject) > 100 {
+		return invalidParameter("Subject")
+	}
+	for _, r := range subject {
+		if r < ' ' || r > '~' {
+			return invalidParameter("Subject")
+		}
+	}
+	return nil
+}
+
+// checkMessageAttributes checks the attributes of a published message, and
+// returns them as they appear in the envelope
+func checkMessageAttributes(attributes map[string]*sns.MessageAttributeValue) (map[string]envelopeAttribute, error) {
+	if len(attributes) == 0 {
+		return nil, nil
+	}
+	encoded := map[string]envelopeAttribute{}
+	for name, value := range attributes {
+		dataType := aws.StringValue(value.DataType)
+		switch {
+		case dataType == "":
+			return nil, invalidParameterValue("The message attribute '%s' must contain non-empty message attribute type.", name)
+		case strings.HasPrefix(dataType, "Binary"):
+			if len(value.BinaryValue) == 0 {
+				return nil, invalidParameterValue("The message attribute '%s' must contain non-empty message attribute value for message attribute type '%s'.", name, dataType)
+			}
+			encoded[name] = envelopeAttribute{Type: dataType, Value: base64.StdEncoding.EncodeToString(value.BinaryValue)}
+		case strings.HasPrefix(dataType, "String"), strings.HasPrefix(dataType, "Number"):
+			if aws.StringValue(value.StringValue) == "" {
+				return nil, invalidParameterValue("The message attribute '%s' must contain non-empty message attribute value for message attribute type '%s'.", name, dataType)
+			}
+			if strings.HasPrefix(dataType, "Number") {
+				if _, err := strconv.ParseFloat(*value.StringValue, 64); err != nil {
+					return nil, invalidParameterValue("Could not cast message attribute '%s' value to number.", name)
+				}
+			}
+			encoded[name] = envelopeAttribute{Type: dataType, Value: *value.StringValue}
+		default:
+			return nil, invalidParameterValue("The message attribute '%s' has an invalid message attribute type, the set of supported type prefixes is Binary, Number, and String.", name)
+		}
+	}
+	return encoded, nil
+}
@@ -0,0 +1,13 @@
+package sns_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSNS(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SNS Suite")
+}
@@ -0,0 +1,421 @@
+package sns_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/rosenhouse/awsfaker"
+	fakesns "github.com/rosenhouse/awsfaker/backends/sns"
+	fakesqs "github.com/rosenhouse/awsfaker/backends/sqs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SNS backend", func() {
+	var (
+		backend    *fakesns.Backend
+		queues     *fakesqs.Backend
+		fakeServer *httptest.Server
+		client     *sns.SNS
+		sqsClient  *sqs.SQS
+	)
+
+	BeforeEach(func() {
+		backend = fakesns.New()
+		queues = fakesqs.New()
+		backend.Queues = queues
+		fakeServer = httptest.NewServer(awsfaker.NewMux(backend, queues))
+		sess := session.New(&aws.Config{
+			Credentials: credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""),
+			Region:      aws.String("us-east-1"),
+			Endpoint:    aws.String(fakeServer.URL),
+			MaxRetries:  aws.Int(0),
+		})
+		client = sns.New(sess)
+		sqsClient = sqs.New(sess)
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	expectError := func(err error, code, message string) {
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal(code))
+		Expect(err.(awserr.RequestFailure).Message()).To(ContainSubstring(message))
+	}
+
+	createTopic := func(name string) string {
+		output, err := client.CreateTopic(&sns.CreateTopicInput{Name: aws.String(name)})
+		Expect(err).NotTo(HaveOccurred())
+		return *output.TopicArn
+	}
+
+	subscribe := func(topicArn, protocol, endpoint string) string {
+		output, err := client.Subscribe(&sns.SubscribeInput{TopicArn: aws.String(topicArn), Protocol: aws.String(protocol), Endpoint: aws.String(endpoint)})
+		Expect(err).NotTo(HaveOccurred())
+		return *output.SubscriptionArn
+	}
+
+	publish := func(input *sns.PublishInput) string {
+		output, err := client.Publish(input)
+		Expect(err).NotTo(HaveOccurred())
+		return *output.MessageId
+	}
+
+	createQueue := func(name string) (string, string) {
+		output, err := sqsClient.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String(name)})
+		Expect(err).NotTo(HaveOccurred())
+		attributes, err := sqsClient.GetQueueAttributes(&sqs.GetQueueAttributesInput{QueueUrl: output.QueueUrl, AttributeNames: aws.StringSlice([]string{"QueueArn"})})
+		Expect(err).NotTo(HaveOccurred())
+		return *output.QueueUrl, *attributes.Attributes["QueueArn"]
+	}
+
+	receive := func(queueURL string) []*sqs.Message {
+		output, err := sqsClient.ReceiveMessage(&sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(queueURL),
+			MaxNumberOfMessages:   aws.Int64(10),
+			MessageAttributeNames: aws.StringSlice([]string{"All"}),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return output.Messages
+	}
+
+	decode := func(body string) map[string]interface{} {
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal([]byte(body), &decoded)).To(Succeed())
+		return decoded
+	}
+
+	Describe("topics", func() {
+		It("creates a topic once per name, with default attributes", func() {
+			topicArn := createTopic("some-topic")
+			Expect(topicArn).To(Equal("arn:aws:sns:us-east-1:123456789012:some-topic"))
+			Expect(createTopic("some-topic")).To(Equal(topicArn))
+
+			output, err := client.GetTopicAttributes(&sns.GetTopicAttributesInput{TopicArn: aws.String(topicArn)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(aws.StringValueMap(output.Attributes)).To(HaveKeyWithValue("TopicArn", topicArn))
+			Expect(aws.StringValueMap(output.Attributes)).To(HaveKeyWithValue("Owner", "123456789012"))
+			Expect(aws.StringValueMap(output.Attributes)).To(HaveKeyWithValue("SubscriptionsConfirmed", "0"))
+			Expect(aws.StringValueMap(output.Attributes)).To(HaveKey("Policy"))
+		})
+
+		It("sets attributes, checking that JSON attributes are JSON", func() {
+			topicArn := createTopic("some-topic")
+			_, err := client.SetTopicAttributes(&sns.SetTopicAttributesInput{TopicArn: aws.String(topicArn), AttributeName: aws.String("DisplayName"), AttributeValue: aws.String("Some Topic")})
+			Expect(err).NotTo(HaveOccurred())
+
+			output, err := client.GetTopicAttributes(&sns.GetTopicAttributesInput{TopicArn: aws.String(topicArn)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(aws.StringValueMap(output.Attributes)).To(HaveKeyWithValue("DisplayName", "Some Topic"))
+
+			_, err = client.SetTopicAttributes(&sns.SetTopicAttributesInput{TopicArn: aws.String(topicArn), AttributeName: aws.String("Policy"), AttributeValue: aws.String("{")})
+			expectError(err, "InvalidParameter", "Invalid parameter: Policy")
+
+			_, err = client.SetTopicAttributes(&sns.SetTopicAttributesInput{TopicArn: aws.String(topicArn), AttributeName: aws.String("Color"), AttributeValue: aws.String("blue")})
+			expectError(err, "InvalidParameter", "Invalid parameter: AttributeName")
+		})
+
+		It("rejects invalid names and reports topics that do not exist", func() {
+			_, err := client.CreateTopic(&sns.CreateTopicInput{Name: aws.String("some topic")})
+			expectError(err, "InvalidParameter", "Topic names must be made up of")
+
+			_, err = client.GetTopicAttributes(&sns.GetTopicAttributesInput{TopicArn: aws.String("arn:aws:sns:us-east-1:123456789012:missing")})
+			expectError(err, "NotFound", "Topic does not exist")
+		})
+
+		It("lists topics and deletes them with their subscriptions", func() {
+			topicArn := createTopic("one")
+			createTopic("two")
+			_, queueArn := createQueue("some-queue")
+			subscribe(topicArn, "sqs", queueArn)
+
+			_, err := client.DeleteTopic(&sns.DeleteTopicInput{TopicArn: aws.String(topicArn)})
+			Expect(err).NotTo(HaveOccurred())
+
+			topics, err := client.ListTopics(&sns.ListTopicsInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(topics.Topics).To(HaveLen(1))
+			Expect(*topics.Topics[0].TopicArn).To(HaveSuffix(":two"))
+
+			subscriptions, err := client.ListSubscriptions(&sns.ListSubscriptionsInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(subscriptions.Subscriptions).To(BeEmpty())
+		})
+	})
+
+	Describe("delivery to SQS", func() {
+		var topicArn, queueURL, queueArn, subscriptionArn string
+
+		BeforeEach(func() {
+			topicArn = createTopic("some-topic")
+			queueURL, queueArn = createQueue("some-queue")
+			subscriptionArn = subscribe(topicArn, "sqs", queueArn)
+		})
+
+		It("confirms the subscription at once", func() {
+			Expect(subscriptionArn).To(HavePrefix(topicArn + ":"))
+
+			output, err := client.ListSubscriptionsByTopic(&sns.ListSubscriptionsByTopicInput{TopicArn: aws.String(topicArn)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.Subscriptions).To(HaveLen(1))
+			Expect(*output.Subscriptions[0].SubscriptionArn).To(Equal(subscriptionArn))
+			Expect(*output.Subscriptions[0].Endpoint).To(Equal(queueArn))
+		})
+
+		It("sends published messages to the queue in the SNS envelope", func() {
+			messageID := publish(&sns.PublishInput{
+				TopicArn: aws.String(topicArn),
+				Subject:  aws.String("greeting"),
+				Message:  aws.String("hello"),
+				MessageAttributes: map[string]*sns.MessageAttributeValue{
+					"color": {DataType: aws.String("String"), StringValue: aws.String("blue")},
+				},
+			})
+
+			messages := receive(queueURL)
+			Expect(messages).To(HaveLen(1))
+			envelope := decode(*messages[0].Body)
+			Expect(envelope).To(HaveKeyWithValue("Type", "Notification"))
+			Expect(envelope).To(HaveKeyWithValue("MessageId", messageID))
+			Expect(envelope).To(HaveKeyWithValue("TopicArn", topicArn))
+			Expect(envelope).To(HaveKeyWithValue("Subject", "greeting"))
+			Expect(envelope).To(HaveKeyWithValue("Message", "hello"))
+			Expect(envelope).To(HaveKeyWithValue("SignatureVersion", "1"))
+			Expect(envelope["UnsubscribeURL"]).To(ContainSubstring("Action=Unsubscribe"))
+			Expect(envelope["MessageAttributes"]).To(Equal(map[string]interface{}{
+				"color": map[string]interface{}{"Type": "String", "Value": "blue"},
+			}))
+
+			deliveries := backend.Deliveries(subscriptionArn)
+			Expect(deliveries).To(HaveLen(1))
+			Expect(deliveries[0].MessageID).To(Equal(messageID))
+			Expect(deliveries[0].Body).To(Equal(*messages[0].Body))
+			Expect(deliveries[0].Error).To(BeEmpty())
+		})
+
+		It("sends the message alone with RawMessageDelivery", func() {
+			_, err := client.SetSubscriptionAttributes(&sns.SetSubscriptionAttributesInput{
+				SubscriptionArn: aws.String(subscriptionArn),
+				AttributeName:   aws.String("RawMessageDelivery"),
+				AttributeValue:  aws.String("true"),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			publish(&sns.PublishInput{
+				TopicArn: aws.String(topicArn),
+				Message:  aws.String("hello"),
+				MessageAttributes: map[string]*sns.MessageAttributeValue{
+					"color": {DataType: aws.String("String"), StringValue: aws.String("blue")},
+				},
+			})
+
+			messages := receive(queueURL)
+			Expect(messages).To(HaveLen(1))
+			Expect(*messages[0].Body).To(Equal("hello"))
+			Expect(*messages[0].MessageAttributes["color"].StringValue).To(Equal("blue"))
+		})
+
+		It("sends the message for the protocol when the structure is json", func() {
+			publish(&sns.PublishInput{
+				TopicArn:         aws.String(topicArn),
+				MessageStructure: aws.String("json"),
+				Message:          aws.String(`{"default":"hello","sqs":"hello queue"}`),
+			})
+			Expect(decode(*receive(queueURL)[0].Body)).To(HaveKeyWithValue("Message", "hello queue"))
+
+			_, err := client.Publish(&sns.PublishInput{
+				TopicArn:         aws.String(topicArn),
+				MessageStructure: aws.String("json"),
+				Message:          aws.String(`{"sqs":"hello queue"}`),
+			})
+			expectError(err, "InvalidParameter", "No default entry in JSON message body")
+		})
+
+		It("sends only the messages that pass the filter policy", func() {
+			_, err := client.SetSubscriptionAttributes(&sns.SetSubscriptionAttributesInput{
+				SubscriptionArn: aws.String(subscriptionArn),
+				AttributeName:   aws.String("FilterPolicy"),
+				AttributeValue:  aws.String(`{"color":["blue",{"prefix":"gr"}],"size":[{"numeric":[">",10]}]}`),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			send := func(color, size string) {
+				publish(&sns.PublishInput{
+					TopicArn: aws.String(topicArn),
+					Message:  aws.String(color + " " + size),
+					MessageAttributes: map[string]*sns.MessageAttributeValue{
+						"color": {DataType: aws.String("String"), StringValue: aws.String(color)},
+						"size":  {DataType: aws.String("Number"), StringValue: aws.String(size)},
+					},
+				})
+			}
+			send("blue", "20")
+			send("green", "11")
+			send("red", "20")
+			send("blue", "5")
+
+			var published []string
+			for _, m := range receive(queueURL) {
+				published = append(published, decode(*m.Body)["Message"].(string))
+			}
+			Expect(published).To(ConsistOf("blue 20", "green 11"))
+			Expect(backend.Deliveries(subscriptionArn)).To(HaveLen(2))
+		})
+
+		It("rejects filter policies it cannot parse", func() {
+			_, err := client.SetSubscriptionAttributes(&sns.SetSubscriptionAttributesInput{
+				SubscriptionArn: aws.String(subscriptionArn),
+				AttributeName:   aws.String("FilterPolicy"),
+				AttributeValue:  aws.String(`{"color":[{"suffix":"ue"}]}`),
+			})
+			expectError(err, "InvalidParameter", "Unrecognized match type suffix")
+		})
+
+		It("records the delivery failure when the queue does not exist", func() {
+			_, err := sqsClient.DeleteQueue(&sqs.DeleteQueueInput{QueueUrl: aws.String(queueURL)})
+			Expect(err).NotTo(HaveOccurred())
+
+			publish(&sns.PublishInput{TopicArn: aws.String(topicArn), Message: aws.String("hello")})
+
+			deliveries := backend.Deliveries(subscriptionArn)
+			Expect(deliveries).To(HaveLen(1))
+			Expect(deliveries[0].Error).To(ContainSubstring("does not exist"))
+		})
+
+		It("stops delivering after Unsubscribe", func() {
+			_, err := client.Unsubscribe(&sns.UnsubscribeInput{SubscriptionArn: aws.String(subscriptionArn)})
+			Expect(err).NotTo(HaveOccurred())
+
+			publish(&sns.PublishInput{TopicArn: aws.String(topicArn), Message: aws.String("hello")})
+			Expect(receive(queueURL)).To(BeEmpty())
+
+			_, err = client.GetSubscriptionAttributes(&sns.GetSubscriptionAttributesInput{SubscriptionArn: aws.String(subscriptionArn)})
+			expectError(err, "NotFound", "Subscription does not exist")
+		})
+	})
+
+	Describe("delivery to HTTP endpoints", func() {
+		var (
+			topicArn string
+			endpoint *httptest.Server
+
+			lock     sync.Mutex
+			received []map[string]interface{}
+			headers  []http.Header
+			confirm  bool
+		)
+
+		BeforeEach(func() {
+			topicArn = createTopic("some-topic")
+			received, headers, confirm = nil, nil, true
+			endpoint = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				message := decode(string(body))
+
+				lock.Lock()
+				received = append(received, message)
+				headers = append(headers, r.Header)
+				shouldConfirm := confirm
+				lock.Unlock()
+
+				if message["Type"] == "SubscriptionConfirmation" && shouldConfirm {
+					response, err := http.Get(message["SubscribeURL"].(string))
+					Expect(err).NotTo(HaveOccurred())
+					response.Body.Close()
+					Expect(response.StatusCode).To(Equal(http.StatusOK))
+				}
+			}))
+		})
+
+		AfterEach(func() {
+			endpoint.Close()
+		})
+
+		subscriptionArn := func() string {
+			output, err := client.ListSubscriptionsByTopic(&sns.ListSubscriptionsByTopicInput{TopicArn: aws.String(topicArn)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.Subscriptions).To(HaveLen(1))
+			return *output.Subscriptions[0].SubscriptionArn
+		}
+
+		It("sends a SubscriptionConfirmation, then notifications once it is confirmed", func() {
+			Expect(subscribe(topicArn, "http", endpoint.URL)).To(Equal("pending confirmation"))
+			Expect(subscriptionArn()).To(HavePrefix(topicArn + ":"))
+
+			messageID := publish(&sns.PublishInput{TopicArn: aws.String(topicArn), Message: aws.String("hello")})
+
+			lock.Lock()
+			defer lock.Unlock()
+			Expect(received).To(HaveLen(2))
+			Expect(received[0]).To(HaveKeyWithValue("Type", "SubscriptionConfirmation"))
+			Expect(received[0]).To(HaveKey("Token"))
+			Expect(headers[0].Get("x-amz-sns-message-type")).To(Equal("SubscriptionConfirmation"))
+
+			Expect(received[1]).To(HaveKeyWithValue("Type", "Notification"))
+			Expect(received[1]).To(HaveKeyWithValue("MessageId", messageID))
+			Expect(received[1]).To(HaveKeyWithValue("Message", "hello"))
+			Expect(headers[1].Get("x-amz-sns-topic-arn")).To(Equal(topicArn))
+			Expect(headers[1].Get("x-amz-sns-subscription-arn")).To(Equal(subscriptionArn()))
+
+			Expect(backend.Deliveries(subscriptionArn())).To(HaveLen(2))
+		})
+
+		It("sends nothing more until the subscription is confirmed", func() {
+			lock.Lock()
+			confirm = false
+			lock.Unlock()
+
+			subscribe(topicArn, "http", endpoint.URL)
+			Expect(subscriptionArn()).To(Equal("PendingConfirmation"))
+
+			publish(&sns.PublishInput{TopicArn: aws.String(topicArn), Message: aws.String("hello")})
+
+			lock.Lock()
+			token := received[0]["Token"].(string)
+			Expect(received).To(HaveLen(1))
+			lock.Unlock()
+
+			_, err := client.ConfirmSubscription(&sns.ConfirmSubscriptionInput{TopicArn: aws.String(topicArn), Token: aws.String("wrong")})
+			expectError(err, "InvalidParameter", "Invalid token")
+
+			output, err := client.ConfirmSubscription(&sns.ConfirmSubscriptionInput{TopicArn: aws.String(topicArn), Token: aws.String(token)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.SubscriptionArn).To(Equal(subscriptionArn()))
+		})
+	})
+
+	It("reports its topics and subscriptions, and forgets them on Reset", func() {
+		topicArn := createTopic("some-topic")
+		_, queueArn := createQueue("some-queue")
+		subscriptionArn := subscribe(topicArn, "sqs", queueArn)
+		publish(&sns.PublishInput{TopicArn: aws.String(topicArn), Message: aws.String("hello")})
+
+		Expect(backend.DumpState()).To(Equal(fakesns.State{Topics: []fakesns.TopicState{{
+			Arn: topicArn,
+			Subscriptions: []fakesns.SubscriptionState{{
+				Arn:        subscriptionArn,
+				Protocol:   "sqs",
+				Endpoint:   queueArn,
+				Confirmed:  true,
+				Deliveries: 1,
+			}},
+		}}}))
+
+		backend.Reset()
+		Expect(backend.DumpState()).To(Equal(fakesns.State{Topics: []fakesns.TopicState{}}))
+		Expect(backend.Deliveries(subscriptionArn)).To(BeEmpty())
+	})
+})
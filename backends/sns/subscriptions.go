@@ -0,0 +1,305 @@
+package sns
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/rosenhouse/awsfaker/internal/random"
+)
+
+type subscription struct {
+	arn       string
+	topicArn  string
+	protocol  string
+	endpoint  string
+	token     string
+	confirmed bool
+
+	attributes map[string]string
+	filter     filterPolicy
+}
+
+// settableSubscriptionAttributes are the subscription attributes that
+// SetSubscriptionAttributes may change, and whether their values are JSON
+var settableSubscriptionAttributes = map[string]bool{
+	"RawMessageDelivery": false,
+	"FilterPolicy":       true,
+	"DeliveryPolicy":     true,
+}
+
+// checkEndpoint checks that an endpoint suits the protocol, and reports
+// whether subscriptions with the protocol must be confirmed
+func checkEndpoint(protocol, endpoint string) (bool, error) {
+	var valid, mustConfirm bool
+	switch protocol {
+	case "http", "https":
+		parsed, err := url.Parse(endpoint)
+		valid, mustConfirm = err == nil && parsed.Scheme == protocol && parsed.Host != "", true
+	case "email", "email-json":
+		valid, mustConfirm = strings.Contains(endpoint, "@"), true
+	case "sqs":
+		valid = strings.HasPrefix(endpoint, "arn:aws:sqs:")
+	case "lambda":
+		valid = strings.HasPrefix(endpoint, "arn:aws:lambda:")
+	case "sms", "application":
+		valid = endpoint != ""
+	default:
+		return false, invalidParameterReason("Protocol", "Invalid protocol type: %s", protocol)
+	}
+	if !valid {
+		return false, invalidParameterReason("Endpoint", "Endpoint is not valid for protocol %s: %s", protocol, endpoint)
+	}
+	return mustConfirm, nil
+}
+
+// topicSubscriptions returns the subscriptions to a topic, ordered by ARN
+func (b *Backend) topicSubscriptions(topicArn string) []*subscription {
+	subscriptions := []*subscription{}
+	for _, arn := range b.subscriptionArns() {
+		if s := b.subscriptions[arn]; s.topicArn == topicArn {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	return subscriptions
+}
+
+func (b *Backend) findSubscription(subscriptionArn *string) (*subscription, error) {
+	if subscriptionArn == nil {
+		return nil, invalidParameter("SubscriptionArn")
+	}
+	s, ok := b.subscriptions[*subscriptionArn]
+	if !ok {
+		return nil, notFound("Subscription does not exist")
+	}
+	return s, nil
+}
+
+// listedArn is the ARN that the API reports for a subscription, which is
+// withheld until the subscription is confirmed
+func (s *subscription) listedArn() *string {
+	if !s.confirmed {
+		return aws.String("PendingConfirmation")
+	}
+	return aws.String(s.arn)
+}
+
+// Subscribe subscribes an endpoint to a topic.  Subscriptions with the sqs,
+// lambda, sms and application protocols are confirmed at once.  Others are
+// sent a SubscriptionConfirmation, which for http and https is POSTed to the
+// endpoint, and must be confirmed with ConfirmSubscription.
+func (b *Backend) Subscribe(ctx context.Context, input *sns.SubscribeInput) (*sns.SubscribeOutput, error) {
+	s, confirmation, err := b.subscribe(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if confirmation != nil {
+		b.send(*confirmation)
+	}
+	if !s.confirmed {
+		return &sns.SubscribeOutput{SubscriptionArn: aws.String("pending confirmation")}, nil
+	}
+	return &sns.SubscribeOutput{SubscriptionArn: aws.String(s.arn)}, nil
+}
+
+func (b *Backend) subscribe(ctx context.Context, input *sns.SubscribeInput) (subscription, *outgoing, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	t, err := b.findTopic(input.TopicArn)
+	if err != nil {
+		return subscription{}, nil, err
+	}
+	protocol, endpoint := aws.StringValue(input.Protocol), aws.StringValue(input.Endpoint)
+	mustConfirm, err := checkEndpoint(protocol, endpoint)
+	if err != nil {
+		return subscription{}, nil, err
+	}
+
+	for _, s := range b.topicSubscriptions(t.arn) {
+		if s.protocol == protocol && s.endpoint == endpoint {
+			return *s, nil, nil
+		}
+	}
+
+	s := &subscription{
+		arn:        t.arn + ":" + random.UUID(),
+		topicArn:   t.arn,
+		protocol:   protocol,
+		endpoint:   endpoint,
+		token:      random.Hex(256),
+		confirmed:  !mustConfirm,
+		attributes: map[string]string{"RawMessageDelivery": "false"},
+	}
+	b.subscriptions[s.arn] = s
+	if s.confirmed {
+		return *s, nil, nil
+	}
+	confirmation := b.confirmation(ctx, s)
+	return *s, &confirmation, nil
+}
+
+// ConfirmSubscription confirms a subscription with the token sent in its
+// SubscriptionConfirmation, which may also be done by fetching the
+// SubscribeURL
+func (b *Backend) ConfirmSubscription(input *sns.ConfirmSubscriptionInput) (*sns.ConfirmSubscriptionOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	t, err := b.findTopic(input.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range b.topicSubscriptions(t.arn) {
+		if s.token != "" && s.token == aws.StringValue(input.Token) {
+			s.confirmed = true
+			return &sns.ConfirmSubscriptionOutput{SubscriptionArn: aws.String(s.arn)}, nil
+		}
+	}
+	return nil, invalidParameter("Invalid token")
+}
+
+// Unsubscribe deletes a subscription, which may also be done by fetching the
+// UnsubscribeURL of a message
+func (b *Backend) Unsubscribe(input *sns.UnsubscribeInput) (*sns.UnsubscribeOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	s, err := b.findSubscription(input.SubscriptionArn)
+	if err != nil {
+		return nil, err
+	}
+	delete(b.subscriptions, s.arn)
+	return &sns.UnsubscribeOutput{}, nil
+}
+
+func (b *Backend) listSubscriptions(subscriptions []*subscription, token *string) ([]*sns.Subscription, *string, error) {
+	arns := make([]string, len(subscriptions))
+	for i, s := range subscriptions {
+		arns[i] = s.arn
+	}
+	from, to, next, err := page(arns, token, 100)
+	if err != nil {
+		return nil, nil, err
+	}
+	listed := []*sns.Subscription{}
+	for _, s := range subscriptions[from:to] {
+		listed = append(listed, &sns.Subscription{
+			SubscriptionArn: s.listedArn(),
+			TopicArn:        aws.String(s.topicArn),
+			Owner:           aws.String(b.AccountID),
+			Protocol:        aws.String(s.protocol),
+			Endpoint:        aws.String(s.endpoint),
+		})
+	}
+	return listed, next, nil
+}
+
+// ListSubscriptions lists the subscriptions to all topics, 100 at a time
+func (b *Backend) ListSubscriptions(input *sns.ListSubscriptionsInput) (*sns.ListSubscriptionsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	subscriptions := []*subscription{}
+	for _, arn := range b.subscriptionArns() {
+		subscriptions = append(subscriptions, b.subscriptions[arn])
+	}
+	listed, next, err := b.listSubscriptions(subscriptions, input.NextToken)
+	if err != nil {
+		return nil, err
+	}
+	return &sns.ListSubscriptionsOutput{Subscriptions: listed, NextToken: next}, nil
+}
+
+// ListSubscriptionsByTopic lists the subscriptions to a topic, 100 at a time
+func (b *Backend) ListSubscriptionsByTopic(input *sns.ListSubscriptionsByTopicInput) (*sns.ListSubscriptionsByTopicOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	t, err := b.findTopic(input.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+	listed, next, err := b.listSubscriptions(b.topicSubscriptions(t.arn), input.NextToken)
+	if err != nil {
+		return nil, err
+	}
+	return &sns.ListSubscriptionsByTopicOutput{Subscriptions: listed, NextToken: next}, nil
+}
+
+// GetSubscriptionAttributes returns the attributes of a subscription
+func (b *Backend) GetSubscriptionAttributes(input *sns.GetSubscriptionAttributesInput) (*sns.GetSubscriptionAttributesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	s, err := b.findSubscription(input.SubscriptionArn)
+	if err != nil {
+		return nil, err
+	}
+	attributes := map[string]string{
+		"SubscriptionArn":              s.arn,
+		"TopicArn":                     s.topicArn,
+		"Owner":                        b.AccountID,
+		"Protocol":                     s.protocol,
+		"Endpoint":                     s.endpoint,
+		"PendingConfirmation":          boolString(!s.confirmed),
+		"ConfirmationWasAuthenticated": boolString(s.confirmed),
+		"EffectiveDeliveryPolicy":      defaultDeliveryPolicy,
+	}
+	for name, value := range s.attributes {
+		attributes[name] = value
+	}
+	if deliveryPolicy, ok := s.attributes["DeliveryPolicy"]; ok {
+		attributes["EffectiveDeliveryPolicy"] = deliveryPolicy
+	} else if deliveryPolicy, ok := b.topics[s.topicArn].attributes["DeliveryPolicy"]; ok {
+		attributes["EffectiveDeliveryPolicy"] = deliveryPolicy
+	}
+	return &sns.GetSubscriptionAttributesOutput{Attributes: aws.StringMap(attributes)}, nil
+}
+
+// SetSubscriptionAttributes sets the RawMessageDelivery, FilterPolicy or
+// DeliveryPolicy of a subscription.  Setting an empty FilterPolicy removes
+// it.
+func (b *Backend) SetSubscriptionAttributes(input *sns.SetSubscriptionAttributesInput) (*sns.SetSubscriptionAttributesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	s, err := b.findSubscription(input.SubscriptionArn)
+	if err != nil {
+		return nil, err
+	}
+	name, value := aws.StringValue(input.AttributeName), aws.StringValue(input.AttributeValue)
+	if err := checkAttribute(settableSubscriptionAttributes, name, value); err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "RawMessageDelivery":
+		value = strings.ToLower(value)
+		if value != "true" && value != "false" {
+			return nil, invalidParameterReason("Attributes", "RawMessageDelivery: Invalid value [%s]. Must be true or false.", value)
+		}
+	case "FilterPolicy":
+		if value == "" {
+			delete(s.attributes, name)
+			s.filter = nil
+			return &sns.SetSubscriptionAttributesOutput{}, nil
+		}
+		filter, err := parseFilterPolicy(value)
+		if err != nil {
+			return nil, invalidParameterReason("FilterPolicy", "%s", err)
+		}
+		s.filter = filter
+	}
+	s.attributes[name] = value
+	return &sns.SetSubscriptionAttributesOutput{}, nil
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
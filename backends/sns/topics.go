@@ -0,0 +1,174 @@
+package sns
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+type topic struct {
+	arn        string
+	attributes map[string]string
+}
+
+var topicNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// settableTopicAttributes are the topic attributes that SetTopicAttributes
+// may change, and whether their values are JSON
+var settableTopicAttributes = map[string]bool{
+	"DisplayName":    false,
+	"Policy":         true,
+	"DeliveryPolicy": true,
+}
+
+const defaultDeliveryPolicy = `{"http":{"defaultHealthyRetryPolicy":{"minDelayTarget":20,"maxDelayTarget":20,"numRetries":3,"numMaxDelayRetries":0,"numNoDelayRetries":0,"numMinDelayRetries":0,"backoffFunction":"linear"},"disableSubscriptionOverrides":false}}`
+
+func (b *Backend) topicArn(name string) string {
+	return fmt.Sprintf("arn:aws:sns:%s:%s:%s", b.Region, b.AccountID, name)
+}
+
+func (b *Backend) defaultPolicy(topicArn string) string {
+	return fmt.Sprintf(`{"Version":"2008-10-17","Id":"__default_policy_ID","Statement":[{"Sid":"__default_statement_ID","Effect":"Allow","Principal":{"AWS":"*"},"Action":["SNS:GetTopicAttributes","SNS:SetTopicAttributes","SNS:AddPermission","SNS:RemovePermission","SNS:DeleteTopic","SNS:Subscribe","SNS:ListSubscriptionsByTopic","SNS:Publish"],"Resource":"%s","Condition":{"StringEquals":{"AWS:SourceOwner":"%s"}}}]}`, topicArn, b.AccountID)
+}
+
+func (b *Backend) findTopic(topicArn *string) (*topic, error) {
+	if topicArn == nil {
+		return nil, invalidParameter("TopicArn")
+	}
+	t, ok := b.topics[*topicArn]
+	if !ok {
+		return nil, notFound("Topic does not exist")
+	}
+	return t, nil
+}
+
+// CreateTopic creates a topic, or returns the ARN of the topic that already
+// has the name
+func (b *Backend) CreateTopic(input *sns.CreateTopicInput) (*sns.CreateTopicOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	name := aws.StringValue(input.Name)
+	if !topicNamePattern.MatchString(name) {
+		return nil, invalidParameterReason("Topic Name", "Topic names must be made up of only uppercase and lowercase ASCII letters, numbers, underscores, and hyphens, and must be between 1 and 256 characters long.")
+	}
+
+	arn := b.topicArn(name)
+	if _, ok := b.topics[arn]; !ok {
+		b.topics[arn] = &topic{
+			arn: arn,
+			attributes: map[string]string{
+				"DisplayName": "",
+				"Policy":      b.defaultPolicy(arn),
+			},
+		}
+	}
+	return &sns.CreateTopicOutput{TopicArn: aws.String(arn)}, nil
+}
+
+// DeleteTopic deletes a topic and its subscriptions.  Like the real service,
+// it succeeds if the topic does not exist.
+func (b *Backend) DeleteTopic(input *sns.DeleteTopicInput) (*sns.DeleteTopicOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if input.TopicArn == nil {
+		return nil, invalidParameter("TopicArn")
+	}
+	for _, s := range b.topicSubscriptions(*input.TopicArn) {
+		delete(b.subscriptions, s.arn)
+	}
+	delete(b.topics, *input.TopicArn)
+	return &sns.DeleteTopicOutput{}, nil
+}
+
+// ListTopics lists topics, 100 at a time
+func (b *Backend) ListTopics(input *sns.ListTopicsInput) (*sns.ListTopicsOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	arns := b.topicArns()
+	from, to, next, err := page(arns, input.NextToken, 100)
+	if err != nil {
+		return nil, err
+	}
+	output := &sns.ListTopicsOutput{Topics: []*sns.Topic{}, NextToken: next}
+	for _, arn := range arns[from:to] {
+		output.Topics = append(output.Topics, &sns.Topic{TopicArn: aws.String(arn)})
+	}
+	return output, nil
+}
+
+// GetTopicAttributes returns the attributes of a topic, including the
+// number of its subscriptions
+func (b *Backend) GetTopicAttributes(input *sns.GetTopicAttributesInput) (*sns.GetTopicAttributesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	t, err := b.findTopic(input.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmed, pending := 0, 0
+	for _, s := range b.topicSubscriptions(t.arn) {
+		if s.confirmed {
+			confirmed++
+		} else {
+			pending++
+		}
+	}
+
+	attributes := map[string]string{
+		"TopicArn":                t.arn,
+		"Owner":                   b.AccountID,
+		"SubscriptionsConfirmed":  strconv.Itoa(confirmed),
+		"SubscriptionsPending":    strconv.Itoa(pending),
+		"SubscriptionsDeleted":    "0",
+		"EffectiveDeliveryPolicy": defaultDeliveryPolicy,
+	}
+	for name, value := range t.attributes {
+		attributes[name] = value
+	}
+	if deliveryPolicy, ok := t.attributes["DeliveryPolicy"]; ok {
+		attributes["EffectiveDeliveryPolicy"] = deliveryPolicy
+	}
+	return &sns.GetTopicAttributesOutput{Attributes: aws.StringMap(attributes)}, nil
+}
+
+// SetTopicAttributes sets the DisplayName, Policy or DeliveryPolicy of a
+// topic
+func (b *Backend) SetTopicAttributes(input *sns.SetTopicAttributesInput) (*sns.SetTopicAttributesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	t, err := b.findTopic(input.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+	name, value := aws.StringValue(input.AttributeName), aws.StringValue(input.AttributeValue)
+	if err := checkAttribute(settableTopicAttributes, name, value); err != nil {
+		return nil, err
+	}
+	t.attributes[name] = value
+	return &sns.SetTopicAttributesOutput{}, nil
+}
+
+// checkAttribute checks that an attribute may be set to the value
+func checkAttribute(settable map[string]bool, name, value string) error {
+	isJSON, ok := settable[name]
+	if !ok {
+		return invalidParameter("AttributeName")
+	}
+	if isJSON && value != "" {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+			return invalidParameterReason(name, "%s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Package sqs is a ready-made backend for a fake Amazon Simple Queue
+// Service, which keeps its queues and messages in memory.
+//
+// Received messages stay invisible for the visibility timeout, and a
+// ReceiveMessage with WaitTimeSeconds holds the HTTP request open until a
+// message arrives.  FIFO queues deduplicate messages and deliver each message
+// group in order, and messages received too often move to the dead-letter
+// queue named by the RedrivePolicy.
+package sqs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rosenhouse/awsfaker"
+)
+
+// Backend is a fake SQS.  Use New to create one.
+type Backend struct {
+	// Region and AccountID appear in queue URLs and ARNs
+	Region    string
+	AccountID string
+
+	// Now returns the current time, and defaults to time.Now.  It decides
+	// when messages become visible, expire, or stop being duplicates.
+	Now func() time.Time
+
+	lock    sync.Mutex
+	queues  map[string]*queue
+	changed chan struct{}
+}
+
+// New returns a Backend with no queues
+func New() *Backend {
+	return &Backend{
+		Region:    "us-east-1",
+		AccountID: "123456789012",
+		queues:    map[string]*queue{},
+		changed:   make(chan struct{}),
+	}
+}
+
+// Reset removes all queues
+func (b *Backend) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.queues = map[string]*queue{}
+	b.notify()
+}
+
+// State is the state of a Backend, as reported by DumpState
+type State struct {
+	Queues []QueueState
+}
+
+// QueueState counts the messages in a queue
+type QueueState struct {
+	Name     string
+	Visible  int
+	InFlight int
+	Delayed  int
+}
+
+// DumpState returns the number of messages in each queue
+func (b *Backend) DumpState() interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	state := State{Queues: []QueueState{}}
+	for _, name := range b.queueNames() {
+		visible, inFlight, delayed := b.queues[name].count(b.now())
+		state.Queues = append(state.Queues, QueueState{Name: name, Visible: visible, InFlight: inFlight, Delayed: delayed})
+	}
+	return state
+}
+
+func (b *Backend) now() time.Time {
+	if b.Now == nil {
+		return time.Now()
+	}
+	return b.Now()
+}
+
+// notify wakes the receivers that are waiting for messages
+func (b *Backend) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *Backend) queueNames() []string {
+	names := make([]string, 0, len(b.queues))
+	for name := range b.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// queueURL returns the URL of a queue on the endpoint that the request was
+// sent to, so that clients which send requests to the queue URL reach the
+// fake
+func (b *Backend) queueURL(ctx context.Context, name string) string {
+	endpoint := fmt.Sprintf("https://sqs.%s.amazonaws.com", b.Region)
+	if info, ok := awsfaker.RequestInfoFromContext(ctx); ok && info.Request != nil {
+		scheme := "http"
+		if info.Request.TLS != nil {
+			scheme = "https"
+		}
+		endpoint = scheme + "://" + info.Request.Host
+	}
+	return fmt.Sprintf("%s/%s/%s", endpoint, b.AccountID, name)
+}
+
+func (b *Backend) queueArn(name string) string {
+	return fmt.Sprintf("arn:aws:sqs:%s:%s:%s", b.Region, b.AccountID, name)
+}
+
+// findQueue returns the queue with the URL, whatever its host
+func (b *Backend) findQueue(queueURL *string) (*queue, error) {
+	if queueURL == nil {
+		return nil, missingParameter("QueueUrl")
+	}
+	parsed, err := url.Parse(*queueURL)
+	if err != nil {
+		return nil, sqsError("InvalidAddress", "The address %s is not valid for this endpoint.", *queueURL)
+	}
+	q, ok := b.queues[parsed.Path[strings.LastIndex(parsed.Path, "/")+1:]]
+	if !ok {
+		return nil, nonExistentQueue()
+	}
+	return q, nil
+}
+
+// findQueueByArn returns the queue with the ARN, or nil
+func (b *Backend) findQueueByArn(arn string) *queue {
+	q, ok := b.queues[arn[strings.LastIndex(arn, ":")+1:]]
+	if !ok || q.arn != arn {
+		return nil
+	}
+	return q
+}
+
+func sqsError(code, format string, args ...interface{}) error {
+	return &awsfaker.ErrorResponse{
+		AWSErrorCode:    code,
+		AWSErrorMessage: fmt.Sprintf(format, args...),
+		HTTPStatusCode:  http.StatusBadRequest,
+	}
+}
+
+func nonExistentQueue() error {
+	return sqsError("AWS.SimpleQueueService.NonExistentQueue", "The specified queue does not exist for this wsdl version.")
+}
+
+func missingParameter(name string) error {
+	return sqsError("MissingParameter", "The request must contain the parameter %s.", name)
+}
+
+func invalidParameterValue(format string, args ...interface{}) error {
+	return sqsError("InvalidParameterValue", format, args...)
+}
@@ -0,0 +1,626 @@
+package sqs
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/rosenhouse/awsfaker"
+	"github.com/rosenhouse/awsfaker/internal/random"
+)
+
+// deduplicationInterval is how long a FIFO queue remembers the deduplication
+// ID of a message
+const deduplicationInterval = 5 * time.Minute
+
+type message struct {
+	id, body        string
+	md5OfBody       string
+	attributes      map[string]*sqs.MessageAttributeValue
+	sent, visibleAt time.Time
+	firstReceived   time.Time
+	receiveCount    int
+
+	groupID, deduplicationID, sequenceNumber string
+}
+
+// sendRequest holds the fields shared by SendMessageInput and
+// SendMessageBatchRequestEntry
+type sendRequest struct {
+	body            *string
+	delaySeconds    *int64
+	attributes      map[string]*sqs.MessageAttributeValue
+	groupID         *string
+	deduplicationID *string
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// md5OfAttributes returns the digest of message attributes that SQS returns
+// as MD5OfMessageAttributes, or nil if there are none
+func md5OfAttributes(attributes map[string]*sqs.MessageAttributeValue) *string {
+	if len(attributes) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := md5.New()
+	for _, name := range names {
+		value := attributes[name]
+		writeField(h, []byte(name))
+		writeField(h, []byte(aws.StringValue(value.DataType)))
+		if value.BinaryValue != nil {
+			h.Write([]byte{2})
+			writeField(h, value.BinaryValue)
+		} else {
+			h.Write([]byte{1})
+			writeField(h, []byte(aws.StringValue(value.StringValue)))
+		}
+	}
+	return aws.String(hex.EncodeToString(h.Sum(nil)))
+}
+
+func writeField(h hash.Hash, field []byte) {
+	binary.Write(h, binary.BigEndian, uint32(len(field)))
+	h.Write(field)
+}
+
+// allowed reports whether SQS accepts the character in a message body
+func allowed(r rune) bool {
+	return r == 0x9 || r == 0xA || r == 0xD || r >= 0x20 && r <= 0xD7FF || r >= 0xE000 && r <= 0xFFFD || r >= 0x10000 && r <= 0x10FFFF
+}
+
+func checkBody(body string, maxSize int) error {
+	if body == "" {
+		return missingParameter("MessageBody")
+	}
+	if len(body) > maxSize {
+		return invalidParameterValue("One or more parameters are invalid. Reason: Message must be shorter than %d bytes.", maxSize)
+	}
+	for i, r := range body {
+		if _, size := utf8.DecodeRuneInString(body[i:]); !allowed(r) || size == 1 && r == utf8.RuneError {
+			return sqsError("InvalidMessageContents", "Invalid binary character '#x%X' was found in the message body, the set of allowed characters is #x9 | #xA | #xD | #x20 to #xD7FF | #xE000 to #xFFFD | #x10000 to #x10FFFF", body[i])
+		}
+	}
+	return nil
+}
+
+func checkMessageAttributes(attributes map[string]*sqs.MessageAttributeValue) error {
+	if len(attributes) > 10 {
+		return invalidParameterValue("Number of message attributes [%d] exceeds the allowed maximum [10].", len(attributes))
+	}
+	for name, value := range attributes {
+		dataType := aws.StringValue(value.DataType)
+		switch {
+		case !strings.HasPrefix(dataType, "String") && !strings.HasPrefix(dataType, "Number") && !strings.HasPrefix(dataType, "Binary"):
+			return invalidParameterValue("The message attribute '%s' has an invalid message attribute type, the set of supported type prefixes is Binary, Number, and String.", name)
+		case strings.HasPrefix(dataType, "Binary") && len(value.BinaryValue) == 0,
+			!strings.HasPrefix(dataType, "Binary") && aws.StringValue(value.StringValue) == "":
+			return invalidParameterValue("The message attribute '%s' must contain non-empty message attribute value for message attribute type '%s'.", name, dataType)
+		}
+	}
+	return nil
+}
+
+// send adds a message to a queue, or returns the earlier message with the
+// same deduplication ID on a FIFO queue
+func (b *Backend) send(q *queue, request sendRequest) (*message, error) {
+	body := aws.StringValue(request.body)
+	if err := checkBody(body, q.intAttribute("MaximumMessageSize")); err != nil {
+		return nil, err
+	}
+	if err := checkMessageAttributes(request.attributes); err != nil {
+		return nil, err
+	}
+
+	delay := int64(q.intAttribute("DelaySeconds"))
+	if request.delaySeconds != nil {
+		if q.fifo() {
+			return nil, invalidParameterValue("Value %d for parameter DelaySeconds is invalid. Reason: The request include parameter that is not valid for this queue type.", *request.delaySeconds)
+		}
+		if *request.delaySeconds < 0 || *request.delaySeconds > 900 {
+			return nil, invalidParameterValue("Value %d for parameter DelaySeconds is invalid. Reason: DelaySeconds must be >= 0 and <= 900.", *request.delaySeconds)
+		}
+		delay = *request.delaySeconds
+	}
+
+	now := b.now()
+	m := &message{
+		id:         random.UUID(),
+		body:       body,
+		md5OfBody:  md5Hex([]byte(body)),
+		attributes: request.attributes,
+		sent:       now,
+		visibleAt:  now.Add(time.Duration(delay) * time.Second),
+	}
+
+	if q.fifo() {
+		if request.groupID == nil {
+			return nil, missingParameter("MessageGroupId")
+		}
+		m.groupID = *request.groupID
+		switch {
+		case request.deduplicationID != nil:
+			m.deduplicationID = *request.deduplicationID
+		case q.attributes["ContentBasedDeduplication"] == "true":
+			sum := sha256.Sum256([]byte(body))
+			m.deduplicationID = hex.EncodeToString(sum[:])
+		default:
+			return nil, invalidParameterValue("The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+		}
+		if earlier, ok := q.deduplication[m.deduplicationID]; ok && now.Sub(earlier.sent) < deduplicationInterval {
+			return earlier, nil
+		}
+		q.sequence++
+		m.sequenceNumber = fmt.Sprintf("%020d", 18000000000000000000+uint64(q.sequence))
+		q.deduplication[m.deduplicationID] = m
+	}
+
+	q.messages = append(q.messages, m)
+	b.notify()
+	return m, nil
+}
+
+// Deliver adds a message to the queue with the ARN, as Amazon SNS does for
+// the queues subscribed to a topic.  It is not an SQS action.
+func (b *Backend) Deliver(queueArn, body string, attributes map[string]*sqs.MessageAttributeValue) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q := b.findQueueByArn(queueArn)
+	if q == nil {
+		return nonExistentQueue()
+	}
+	_, err := b.send(q, sendRequest{body: aws.String(body), attributes: attributes})
+	return err
+}
+
+// SendMessage adds a message to a queue
+func (b *Backend) SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q, err := b.findQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	m, err := b.send(q, sendRequest{
+		body:            input.MessageBody,
+		delaySeconds:    input.DelaySeconds,
+		attributes:      input.MessageAttributes,
+		groupID:         input.MessageGroupId,
+		deduplicationID: input.MessageDeduplicationId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	output := &sqs.SendMessageOutput{
+		MessageId:              aws.String(m.id),
+		MD5OfMessageBody:       aws.String(m.md5OfBody),
+		MD5OfMessageAttributes: md5OfAttributes(m.attributes),
+	}
+	if m.sequenceNumber != "" {
+		output.SequenceNumber = aws.String(m.sequenceNumber)
+	}
+	return output, nil
+}
+
+var batchEntryIDPattern = regexp.MustCompile(`^[\w-]{1,80}$`)
+
+// checkBatch checks the number and IDs of the entries in a batch request
+func checkBatch(entryType string, ids []*string) error {
+	switch {
+	case len(ids) == 0:
+		return sqsError("AWS.SimpleQueueService.EmptyBatchRequest", "There should be at least one %s in the request.", entryType)
+	case len(ids) > 10:
+		return sqsError("AWS.SimpleQueueService.TooManyEntriesInBatchRequest", "Maximum number of entries per request are 10. You have sent %d.", len(ids))
+	}
+	seen := map[string]bool{}
+	for _, id := range aws.StringValueSlice(ids) {
+		if !batchEntryIDPattern.MatchString(id) {
+			return sqsError("AWS.SimpleQueueService.InvalidBatchEntryId", "A batch entry id can only contain alphanumeric characters, hyphens and underscores. It can be at most 80 letters long.")
+		}
+		if seen[id] {
+			return sqsError("AWS.SimpleQueueService.BatchEntryIdsNotDistinct", "Id %s repeated.", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// failedEntry reports an error with one entry of a batch request
+func failedEntry(id *string, err error) *sqs.BatchResultErrorEntry {
+	response := err.(*awsfaker.ErrorResponse)
+	return &sqs.BatchResultErrorEntry{
+		Id:          id,
+		Code:        aws.String(response.AWSErrorCode),
+		Message:     aws.String(response.AWSErrorMessage),
+		SenderFault: aws.Bool(true),
+	}
+}
+
+// SendMessageBatch adds up to ten messages to a queue, reporting the entries
+// that fail
+func (b *Backend) SendMessageBatch(input *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q, err := b.findQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	var ids []*string
+	size := 0
+	for _, entry := range input.Entries {
+		ids = append(ids, entry.Id)
+		size += len(aws.StringValue(entry.MessageBody))
+	}
+	if err := checkBatch("SendMessageBatchRequestEntry", ids); err != nil {
+		return nil, err
+	}
+	if size > numericAttributes["MaximumMessageSize"].max {
+		return nil, sqsError("AWS.SimpleQueueService.BatchRequestTooLong", "Batch requests cannot be longer than %d bytes. You have sent %d bytes.", numericAttributes["MaximumMessageSize"].max, size)
+	}
+
+	output := &sqs.SendMessageBatchOutput{Successful: []*sqs.SendMessageBatchResultEntry{}, Failed: []*sqs.BatchResultErrorEntry{}}
+	for _, entry := range input.Entries {
+		m, err := b.send(q, sendRequest{
+			body:            entry.MessageBody,
+			delaySeconds:    entry.DelaySeconds,
+			attributes:      entry.MessageAttributes,
+			groupID:         entry.MessageGroupId,
+			deduplicationID: entry.MessageDeduplicationId,
+		})
+		if err != nil {
+			output.Failed = append(output.Failed, failedEntry(entry.Id, err))
+			continue
+		}
+		result := &sqs.SendMessageBatchResultEntry{
+			Id:                     entry.Id,
+			MessageId:              aws.String(m.id),
+			MD5OfMessageBody:       aws.String(m.md5OfBody),
+			MD5OfMessageAttributes: md5OfAttributes(m.attributes),
+		}
+		if m.sequenceNumber != "" {
+			result.SequenceNumber = aws.String(m.sequenceNumber)
+		}
+		output.Successful = append(output.Successful, result)
+	}
+	return output, nil
+}
+
+// receive takes up to max visible messages from a queue and makes them
+// invisible for the visibility timeout.  On a FIFO queue, a message group is
+// skipped while an earlier message of the group is invisible.  Messages that
+// have been received as often as the redrive policy allows move to the
+// dead-letter queue instead.
+func (b *Backend) receive(q *queue, max int, visibility time.Duration) []*message {
+	now := b.now()
+	q.expire(now)
+	deadLetterQueue, maxReceiveCount := b.redrivePolicy(q)
+
+	var received, kept, moved []*message
+	locked := map[string]bool{}
+	for _, m := range q.messages {
+		switch {
+		case len(received) == max:
+		case m.visibleAt.After(now):
+			locked[m.groupID] = true
+		case q.fifo() && locked[m.groupID]:
+		case deadLetterQueue != nil && m.receiveCount >= maxReceiveCount:
+			moved = append(moved, m)
+			continue
+		default:
+			if m.receiveCount == 0 {
+				m.firstReceived = now
+			}
+			m.receiveCount++
+			m.visibleAt = now.Add(visibility)
+			received = append(received, m)
+		}
+		kept = append(kept, m)
+	}
+	q.messages = kept
+
+	for _, m := range moved {
+		m.receiveCount = 0
+		deadLetterQueue.messages = append(deadLetterQueue.messages, m)
+	}
+	return received
+}
+
+// wanted reports whether the name is selected by a list of names, in which
+// All and .* select everything and a name ending in .* selects a prefix
+func wanted(names []*string, name string) bool {
+	for _, n := range aws.StringValueSlice(names) {
+		switch {
+		case n == "All", n == ".*", n == name:
+			return true
+		case strings.HasSuffix(n, ".*") && strings.HasPrefix(name, strings.TrimSuffix(n, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+func milliseconds(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// describe returns a received message with the requested attributes, and a
+// new receipt handle
+func (b *Backend) describe(q *queue, m *message, attributeNames, messageAttributeNames []*string) *sqs.Message {
+	receipt := random.Alphanumeric(128)
+	q.receipts[receipt] = m
+
+	system := map[string]string{
+		"SenderId":                         b.AccountID,
+		"SentTimestamp":                    milliseconds(m.sent),
+		"ApproximateReceiveCount":          strconv.Itoa(m.receiveCount),
+		"ApproximateFirstReceiveTimestamp": milliseconds(m.firstReceived),
+	}
+	if q.fifo() {
+		system["MessageGroupId"] = m.groupID
+		system["MessageDeduplicationId"] = m.deduplicationID
+		system["SequenceNumber"] = m.sequenceNumber
+	}
+	attributes := map[string]*string{}
+	for name, value := range system {
+		if wanted(attributeNames, name) {
+			attributes[name] = aws.String(value)
+		}
+	}
+	messageAttributes := map[string]*sqs.MessageAttributeValue{}
+	for name, value := range m.attributes {
+		if wanted(messageAttributeNames, name) {
+			messageAttributes[name] = value
+		}
+	}
+
+	described := &sqs.Message{
+		MessageId:              aws.String(m.id),
+		ReceiptHandle:          aws.String(receipt),
+		Body:                   aws.String(m.body),
+		MD5OfBody:              aws.String(m.md5OfBody),
+		MD5OfMessageAttributes: md5OfAttributes(messageAttributes),
+	}
+	if len(attributes) > 0 {
+		described.Attributes = attributes
+	}
+	if len(messageAttributes) > 0 {
+		described.MessageAttributes = messageAttributes
+	}
+	return described
+}
+
+// intParameter returns the value of an optional parameter, checked to be in
+// range, or the default
+func intParameter(name string, value *int64, defaultValue, min, max int) (int, error) {
+	if value == nil {
+		return defaultValue, nil
+	}
+	if *value < int64(min) || *value > int64(max) {
+		return 0, invalidParameterValue("Value %d for parameter %s is invalid. Reason: Must be between %d and %d, if provided.", *value, name, min, max)
+	}
+	return int(*value), nil
+}
+
+// ReceiveMessage returns up to MaxNumberOfMessages visible messages.  If
+// there are none, it waits up to WaitTimeSeconds for one to become visible
+// before responding.
+func (b *Backend) ReceiveMessage(ctx context.Context, input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q, err := b.findQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	max, err := intParameter("MaxNumberOfMessages", input.MaxNumberOfMessages, 1, 1, 10)
+	if err != nil {
+		return nil, err
+	}
+	visibility, err := intParameter("VisibilityTimeout", input.VisibilityTimeout, q.intAttribute("VisibilityTimeout"), 0, 43200)
+	if err != nil {
+		return nil, err
+	}
+	wait, err := intParameter("WaitTimeSeconds", input.WaitTimeSeconds, q.intAttribute("ReceiveMessageWaitTimeSeconds"), 0, 20)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	for {
+		received := b.receive(q, max, time.Duration(visibility)*time.Second)
+		remaining := deadline.Sub(time.Now())
+		if len(received) > 0 || remaining <= 0 {
+			output := &sqs.ReceiveMessageOutput{Messages: []*sqs.Message{}}
+			for _, m := range received {
+				output.Messages = append(output.Messages, b.describe(q, m, input.AttributeNames, input.MessageAttributeNames))
+			}
+			return output, nil
+		}
+
+		if next, ok := q.nextVisible(b.now()); ok && next < remaining {
+			remaining = next
+		}
+		changed := b.changed
+		b.lock.Unlock()
+		timer := time.NewTimer(remaining)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+		b.lock.Lock()
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if q, err = b.findQueue(input.QueueUrl); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// findReceipt returns the message that was received with the handle, or nil
+// if it has since been deleted
+func (q *queue) findReceipt(handle *string) (*message, error) {
+	m, ok := q.receipts[aws.StringValue(handle)]
+	if !ok {
+		return nil, sqsError("ReceiptHandleIsInvalid", "The input receipt handle \"%s\" is not a valid receipt handle.", aws.StringValue(handle))
+	}
+	for _, queued := range q.messages {
+		if queued == m {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+func (q *queue) delete(handle *string) error {
+	m, err := q.findReceipt(handle)
+	if err != nil || m == nil {
+		return err
+	}
+	var kept []*message
+	for _, queued := range q.messages {
+		if queued != m {
+			kept = append(kept, queued)
+		}
+	}
+	q.messages = kept
+	return nil
+}
+
+// DeleteMessage deletes the message that was received with the handle
+func (b *Backend) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q, err := b.findQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.delete(input.ReceiptHandle); err != nil {
+		return nil, err
+	}
+	b.notify()
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+// DeleteMessageBatch deletes up to ten messages, reporting the entries that
+// fail
+func (b *Backend) DeleteMessageBatch(input *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q, err := b.findQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	var ids []*string
+	for _, entry := range input.Entries {
+		ids = append(ids, entry.Id)
+	}
+	if err := checkBatch("DeleteMessageBatchRequestEntry", ids); err != nil {
+		return nil, err
+	}
+
+	output := &sqs.DeleteMessageBatchOutput{Successful: []*sqs.DeleteMessageBatchResultEntry{}, Failed: []*sqs.BatchResultErrorEntry{}}
+	for _, entry := range input.Entries {
+		if err := q.delete(entry.ReceiptHandle); err != nil {
+			output.Failed = append(output.Failed, failedEntry(entry.Id, err))
+			continue
+		}
+		output.Successful = append(output.Successful, &sqs.DeleteMessageBatchResultEntry{Id: entry.Id})
+	}
+	b.notify()
+	return output, nil
+}
+
+func (b *Backend) changeVisibility(q *queue, handle *string, timeout *int64) error {
+	m, err := q.findReceipt(handle)
+	if err != nil {
+		return err
+	}
+	now := b.now()
+	if m == nil || m.receiveCount == 0 || !m.visibleAt.After(now) {
+		return sqsError("AWS.SimpleQueueService.MessageNotInflight", "Message does not exist or is not available for visibility timeout change.")
+	}
+	if timeout == nil {
+		return missingParameter("VisibilityTimeout")
+	}
+	seconds, err := intParameter("VisibilityTimeout", timeout, 0, 0, 43200)
+	if err != nil {
+		return err
+	}
+	m.visibleAt = now.Add(time.Duration(seconds) * time.Second)
+	b.notify()
+	return nil
+}
+
+// ChangeMessageVisibility changes how long until a received message becomes
+// visible again, counting from now
+func (b *Backend) ChangeMessageVisibility(input *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q, err := b.findQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.changeVisibility(q, input.ReceiptHandle, input.VisibilityTimeout); err != nil {
+		return nil, err
+	}
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+// ChangeMessageVisibilityBatch changes the visibility timeouts of up to ten
+// messages, reporting the entries that fail
+func (b *Backend) ChangeMessageVisibilityBatch(input *sqs.ChangeMessageVisibilityBatchInput) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q, err := b.findQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	var ids []*string
+	for _, entry := range input.Entries {
+		ids = append(ids, entry.Id)
+	}
+	if err := checkBatch("ChangeMessageVisibilityBatchRequestEntry", ids); err != nil {
+		return nil, err
+	}
+
+	output := &sqs.ChangeMessageVisibilityBatchOutput{Successful: []*sqs.ChangeMessageVisibilityBatchResultEntry{}, Failed: []*sqs.BatchResultErrorEntry{}}
+	for _, entry := range input.Entries {
+		if err := b.changeVisibility(q, entry.ReceiptHandle, entry.VisibilityTimeout); err != nil {
+			output.Failed = append(output.Failed, failedEntry(entry.Id, err))
+			continue
+		}
+		output.Successful = append(output.Successful, &sqs.ChangeMessageVisibilityBatchResultEntry{Id: entry.Id})
+	}
+	return output, nil
+}
@@ -0,0 +1,352 @@
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+type queue struct {
+	name, arn  string
+	attributes map[string]string
+	created    time.Time
+	modified   time.Time
+	lastPurge  time.Time
+
+	messages      []*message
+	receipts      map[string]*message
+	deduplication map[string]*message
+	sequence      int64
+}
+
+type numericAttribute struct {
+	defaultValue, min, max int
+}
+
+var numericAttributes = map[string]numericAttribute{
+	"DelaySeconds":                  {0, 0, 900},
+	"MaximumMessageSize":            {262144, 1024, 262144},
+	"MessageRetentionPeriod":        {345600, 60, 1209600},
+	"ReceiveMessageWaitTimeSeconds": {0, 0, 20},
+	"VisibilityTimeout":             {30, 0, 43200},
+}
+
+// computedAttributes are reported by GetQueueAttributes, but cannot be set
+var computedAttributes = []string{
+	"ApproximateNumberOfMessages",
+	"ApproximateNumberOfMessagesDelayed",
+	"ApproximateNumberOfMessagesNotVisible",
+	"CreatedTimestamp",
+	"LastModifiedTimestamp",
+	"QueueArn",
+}
+
+var queueNamePattern = regexp.MustCompile(`^[\w-]{1,80}$`)
+
+func (q *queue) fifo() bool {
+	return q.attributes["FifoQueue"] == "true"
+}
+
+func (q *queue) intAttribute(name string) int {
+	value, _ := strconv.Atoi(q.attributes[name])
+	return value
+}
+
+// redrivePolicy returns the dead-letter queue of the queue and the number of
+// receives after which messages move there, if the queue has one
+func (b *Backend) redrivePolicy(q *queue) (*queue, int) {
+	policy, ok := q.attributes["RedrivePolicy"]
+	if !ok {
+		return nil, 0
+	}
+	target, maxReceiveCount, _ := parseRedrivePolicy(policy)
+	return b.findQueueByArn(target), maxReceiveCount
+}
+
+func parseRedrivePolicy(policy string) (string, int, bool) {
+	var parsed struct {
+		DeadLetterTargetArn string
+		MaxReceiveCount     json.Number
+	}
+	if err := json.Unmarshal([]byte(policy), &parsed); err != nil {
+		return "", 0, false
+	}
+	maxReceiveCount, err := strconv.Atoi(parsed.MaxReceiveCount.String())
+	if err != nil || maxReceiveCount < 1 || maxReceiveCount > 1000 || parsed.DeadLetterTargetArn == "" {
+		return "", 0, false
+	}
+	return parsed.DeadLetterTargetArn, maxReceiveCount, true
+}
+
+// checkAttributes checks the attributes given to CreateQueue or
+// SetQueueAttributes
+func (b *Backend) checkAttributes(attributes map[string]*string, creating, fifo bool) error {
+	for name, value := range attributes {
+		v := aws.StringValue(value)
+		if numeric, ok := numericAttributes[name]; ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < numeric.min || n > numeric.max {
+				return sqsError("InvalidAttributeValue", "Invalid value for the parameter %s.", name)
+			}
+			continue
+		}
+		switch {
+		case name == "Policy":
+		case name == "RedrivePolicy":
+			target, _, ok := parseRedrivePolicy(v)
+			if !ok {
+				return sqsError("InvalidAttributeValue", "Invalid value for the parameter RedrivePolicy. Reason: Redrive policy is not a valid JSON map.")
+			}
+			if dlq := b.findQueueByArn(target); dlq == nil {
+				return invalidParameterValue("Value %s for parameter RedrivePolicy is invalid. Reason: Dead letter target does not exist.", v)
+			} else if dlq.fifo() != fifo {
+				return invalidParameterValue("Value %s for parameter RedrivePolicy is invalid. Reason: Dead-letter queue must be same type of queue as the source.", v)
+			}
+		case name == "FifoQueue" && creating, name == "ContentBasedDeduplication" && fifo:
+			if v != "true" && v != "false" {
+				return sqsError("InvalidAttributeValue", "Invalid value for the parameter %s.", name)
+			}
+		default:
+			return sqsError("InvalidAttributeName", "Unknown Attribute %s.", name)
+		}
+	}
+	return nil
+}
+
+func (b *Backend) describeAttributes(q *queue, names []*string) (map[string]*string, error) {
+	visible, inFlight, delayed := q.count(b.now())
+	all := map[string]string{
+		"ApproximateNumberOfMessages":           strconv.Itoa(visible),
+		"ApproximateNumberOfMessagesNotVisible": strconv.Itoa(inFlight),
+		"ApproximateNumberOfMessagesDelayed":    strconv.Itoa(delayed),
+		"CreatedTimestamp":                      strconv.FormatInt(q.created.Unix(), 10),
+		"LastModifiedTimestamp":                 strconv.FormatInt(q.modified.Unix(), 10),
+		"QueueArn":                              q.arn,
+	}
+	for name, value := range q.attributes {
+		all[name] = value
+	}
+
+	attributes := map[string]*string{}
+	for _, name := range aws.StringValueSlice(names) {
+		if name == "All" {
+			return aws.StringMap(all), nil
+		}
+		value, ok := all[name]
+		if !ok && !isAttributeName(name) {
+			return nil, sqsError("InvalidAttributeName", "Unknown Attribute %s.", name)
+		}
+		if ok {
+			attributes[name] = aws.String(value)
+		}
+	}
+	return attributes, nil
+}
+
+func isAttributeName(name string) bool {
+	if _, ok := numericAttributes[name]; ok {
+		return true
+	}
+	for _, computed := range computedAttributes {
+		if name == computed {
+			return true
+		}
+	}
+	return name == "Policy" || name == "RedrivePolicy" || name == "FifoQueue" || name == "ContentBasedDeduplication"
+}
+
+// CreateQueue creates a queue, or returns the URL of an existing queue with
+// the same name and attributes
+func (b *Backend) CreateQueue(ctx context.Context, input *sqs.CreateQueueInput) (*sqs.CreateQueueOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	name := aws.StringValue(input.QueueName)
+	fifo := aws.StringValue(input.Attributes["FifoQueue"]) == "true"
+	switch {
+	case fifo && (!strings.HasSuffix(name, ".fifo") || !queueNamePattern.MatchString(strings.TrimSuffix(name, ".fifo")) || len(name) > 80):
+		return nil, invalidParameterValue("The name of a FIFO queue can only include alphanumeric characters, hyphens, or underscores, must end with .fifo suffix and be 1 to 80 in length.")
+	case !fifo && !queueNamePattern.MatchString(name):
+		return nil, invalidParameterValue("Can only include alphanumeric characters, hyphens, or underscores. 1 to 80 in length")
+	}
+	if err := b.checkAttributes(input.Attributes, true, fifo); err != nil {
+		return nil, err
+	}
+
+	if q, exists := b.queues[name]; exists {
+		for attribute, value := range input.Attributes {
+			if q.attributes[attribute] != aws.StringValue(value) {
+				return nil, sqsError("QueueAlreadyExists", "A queue already exists with the same name and a different value for attribute %s", attribute)
+			}
+		}
+		return &sqs.CreateQueueOutput{QueueUrl: aws.String(b.queueURL(ctx, name))}, nil
+	}
+
+	now := b.now()
+	q := &queue{
+		name:          name,
+		arn:           b.queueArn(name),
+		attributes:    map[string]string{},
+		created:       now,
+		modified:      now,
+		receipts:      map[string]*message{},
+		deduplication: map[string]*message{},
+	}
+	for attribute, numeric := range numericAttributes {
+		q.attributes[attribute] = strconv.Itoa(numeric.defaultValue)
+	}
+	if fifo {
+		q.attributes["ContentBasedDeduplication"] = "false"
+	}
+	for attribute, value := range input.Attributes {
+		q.attributes[attribute] = aws.StringValue(value)
+	}
+	b.queues[name] = q
+	return &sqs.CreateQueueOutput{QueueUrl: aws.String(b.queueURL(ctx, name))}, nil
+}
+
+// GetQueueUrl returns the URL of the queue with the name
+func (b *Backend) GetQueueUrl(ctx context.Context, input *sqs.GetQueueUrlInput) (*sqs.GetQueueUrlOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, ok := b.queues[aws.StringValue(input.QueueName)]; !ok {
+		return nil, nonExistentQueue()
+	}
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String(b.queueURL(ctx, *input.QueueName))}, nil
+}
+
+// ListQueues lists the URLs of the queues with the name prefix
+func (b *Backend) ListQueues(ctx context.Context, input *sqs.ListQueuesInput) (*sqs.ListQueuesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	output := &sqs.ListQueuesOutput{}
+	for _, name := range b.queueNames() {
+		if strings.HasPrefix(name, aws.StringValue(input.QueueNamePrefix)) {
+			output.QueueUrls = append(output.QueueUrls, aws.String(b.queueURL(ctx, name)))
+		}
+	}
+	return output, nil
+}
+
+// DeleteQueue deletes a queue and its messages
+func (b *Backend) DeleteQueue(input *sqs.DeleteQueueInput) (*sqs.DeleteQueueOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q, err := b.findQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	delete(b.queues, q.name)
+	b.notify()
+	return &sqs.DeleteQueueOutput{}, nil
+}
+
+// GetQueueAttributes returns the named attributes of a queue, or all of them
+// for the name All
+func (b *Backend) GetQueueAttributes(input *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q, err := b.findQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := b.describeAttributes(q, input.AttributeNames)
+	if err != nil {
+		return nil, err
+	}
+	return &sqs.GetQueueAttributesOutput{Attributes: attributes}, nil
+}
+
+// SetQueueAttributes changes the attributes of a queue, other than whether
+// it is a FIFO queue
+func (b *Backend) SetQueueAttributes(input *sqs.SetQueueAttributesInput) (*sqs.SetQueueAttributesOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q, err := b.findQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkAttributes(input.Attributes, false, q.fifo()); err != nil {
+		return nil, err
+	}
+	for name, value := range input.Attributes {
+		q.attributes[name] = aws.StringValue(value)
+	}
+	q.modified = b.now()
+	return &sqs.SetQueueAttributesOutput{}, nil
+}
+
+// PurgeQueue deletes all messages in a queue, at most once a minute
+func (b *Backend) PurgeQueue(input *sqs.PurgeQueueInput) (*sqs.PurgeQueueOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q, err := b.findQueue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	now := b.now()
+	if !q.lastPurge.IsZero() && now.Sub(q.lastPurge) < time.Minute {
+		return nil, sqsError("AWS.SimpleQueueService.PurgeQueueInProgress", "Only one PurgeQueue operation on %s is allowed every 60 seconds.", q.name)
+	}
+	q.lastPurge = now
+	q.messages = nil
+	return &sqs.PurgeQueueOutput{}, nil
+}
+
+// count returns the number of messages that are visible, that have been
+// received and are not yet visible again, and that are delayed
+func (q *queue) count(now time.Time) (visible, inFlight, delayed int) {
+	q.expire(now)
+	for _, m := range q.messages {
+		switch {
+		case !m.visibleAt.After(now):
+			visible++
+		case m.receiveCount > 0:
+			inFlight++
+		default:
+			delayed++
+		}
+	}
+	return visible, inFlight, delayed
+}
+
+// expire drops the messages older than the retention period
+func (q *queue) expire(now time.Time) {
+	retention := time.Duration(q.intAttribute("MessageRetentionPeriod")) * time.Second
+	var kept []*message
+	for _, m := range q.messages {
+		if now.Sub(m.sent) < retention {
+			kept = append(kept, m)
+		}
+	}
+	q.messages = kept
+}
+
+// nextVisible returns how long until a message that is invisible now becomes
+// visible, or false if there is none
+func (q *queue) nextVisible(now time.Time) (time.Duration, bool) {
+	var times []time.Time
+	for _, m := range q.messages {
+		if m.visibleAt.After(now) {
+			times = append(times, m.visibleAt)
+		}
+	}
+	if len(times) == 0 {
+		return 0, false
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times[0].Sub(now), true
+}
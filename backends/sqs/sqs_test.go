@@ -0,0 +1,449 @@
+package sqs_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/rosenhouse/awsfaker"
+	fakesqs "github.com/rosenhouse/awsfaker/backends/sqs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SQS backend", func() {
+	var (
+		backend    *fakesqs.Backend
+		fakeServer *httptest.Server
+		client     *sqs.SQS
+
+		clockLock sync.Mutex
+		now       time.Time
+	)
+
+	advance := func(d time.Duration) {
+		clockLock.Lock()
+		defer clockLock.Unlock()
+		now = now.Add(d)
+	}
+
+	BeforeEach(func() {
+		backend = fakesqs.New()
+		fakeServer = httptest.NewServer(awsfaker.New(backend))
+		client = sqs.New(session.New(&aws.Config{
+			Credentials: credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""),
+			Region:      aws.String("us-east-1"),
+			Endpoint:    aws.String(fakeServer.URL),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	useClock := func() {
+		now = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		backend.Now = func() time.Time {
+			clockLock.Lock()
+			defer clockLock.Unlock()
+			return now
+		}
+	}
+
+	expectError := func(err error, code, message string) {
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal(code))
+		Expect(err.(awserr.RequestFailure).Message()).To(ContainSubstring(message))
+	}
+
+	createQueue := func(name string, attributes map[string]string) string {
+		output, err := client.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String(name), Attributes: aws.StringMap(attributes)})
+		Expect(err).NotTo(HaveOccurred())
+		return *output.QueueUrl
+	}
+
+	send := func(queueURL, body string) string {
+		output, err := client.SendMessage(&sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String(body)})
+		Expect(err).NotTo(HaveOccurred())
+		return *output.MessageId
+	}
+
+	sendToGroup := func(queueURL, body, group string) {
+		_, err := client.SendMessage(&sqs.SendMessageInput{
+			QueueUrl:               aws.String(queueURL),
+			MessageBody:            aws.String(body),
+			MessageGroupId:         aws.String(group),
+			MessageDeduplicationId: aws.String(body),
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	receive := func(queueURL string, max int64) []*sqs.Message {
+		output, err := client.ReceiveMessage(&sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL), MaxNumberOfMessages: aws.Int64(max)})
+		Expect(err).NotTo(HaveOccurred())
+		return output.Messages
+	}
+
+	bodies := func(messages []*sqs.Message) []string {
+		var bodies []string
+		for _, m := range messages {
+			bodies = append(bodies, *m.Body)
+		}
+		return bodies
+	}
+
+	attribute := func(queueURL, name string) string {
+		output, err := client.GetQueueAttributes(&sqs.GetQueueAttributesInput{QueueUrl: aws.String(queueURL), AttributeNames: aws.StringSlice([]string{name})})
+		Expect(err).NotTo(HaveOccurred())
+		return aws.StringValue(output.Attributes[name])
+	}
+
+	Describe("queues", func() {
+		It("returns queue URLs on the endpoint of the fake", func() {
+			queueURL := createQueue("some-queue", nil)
+			Expect(queueURL).To(Equal(fakeServer.URL + "/123456789012/some-queue"))
+
+			output, err := client.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String("some-queue")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.QueueUrl).To(Equal(queueURL))
+
+			attributes, err := client.GetQueueAttributes(&sqs.GetQueueAttributesInput{QueueUrl: aws.String(queueURL), AttributeNames: aws.StringSlice([]string{"All"})})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(aws.StringValueMap(attributes.Attributes)).To(HaveKeyWithValue("QueueArn", "arn:aws:sqs:us-east-1:123456789012:some-queue"))
+			Expect(aws.StringValueMap(attributes.Attributes)).To(HaveKeyWithValue("VisibilityTimeout", "30"))
+			Expect(aws.StringValueMap(attributes.Attributes)).To(HaveKeyWithValue("ApproximateNumberOfMessages", "0"))
+		})
+
+		It("creates a queue again only with the same attributes", func() {
+			queueURL := createQueue("some-queue", map[string]string{"VisibilityTimeout": "60"})
+			Expect(createQueue("some-queue", map[string]string{"VisibilityTimeout": "60"})).To(Equal(queueURL))
+
+			_, err := client.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("some-queue"), Attributes: aws.StringMap(map[string]string{"VisibilityTimeout": "10"})})
+			expectError(err, "QueueAlreadyExists", "different value for attribute VisibilityTimeout")
+		})
+
+		It("rejects invalid names and attributes", func() {
+			_, err := client.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("some queue")})
+			expectError(err, "InvalidParameterValue", "Can only include alphanumeric characters")
+
+			_, err = client.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("some-queue"), Attributes: aws.StringMap(map[string]string{"FifoQueue": "true"})})
+			expectError(err, "InvalidParameterValue", "must end with .fifo suffix")
+
+			_, err = client.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("some-queue"), Attributes: aws.StringMap(map[string]string{"DelaySeconds": "901"})})
+			expectError(err, "InvalidAttributeValue", "Invalid value for the parameter DelaySeconds.")
+		})
+
+		It("reports queues that do not exist", func() {
+			_, err := client.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String("missing")})
+			expectError(err, "AWS.SimpleQueueService.NonExistentQueue", "The specified queue does not exist")
+
+			queueURL := createQueue("some-queue", nil)
+			_, err = client.DeleteQueue(&sqs.DeleteQueueInput{QueueUrl: aws.String(queueURL)})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.SendMessage(&sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String("hello")})
+			expectError(err, "AWS.SimpleQueueService.NonExistentQueue", "")
+		})
+
+		It("lists queues by name prefix", func() {
+			createQueue("app-one", nil)
+			createQueue("app-two", nil)
+			createQueue("other", nil)
+
+			output, err := client.ListQueues(&sqs.ListQueuesInput{QueueNamePrefix: aws.String("app-")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(aws.StringValueSlice(output.QueueUrls)).To(Equal([]string{
+				fakeServer.URL + "/123456789012/app-one",
+				fakeServer.URL + "/123456789012/app-two",
+			}))
+		})
+
+		It("purges a queue at most once a minute", func() {
+			useClock()
+			queueURL := createQueue("some-queue", nil)
+			send(queueURL, "hello")
+
+			_, err := client.PurgeQueue(&sqs.PurgeQueueInput{QueueUrl: aws.String(queueURL)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attribute(queueURL, "ApproximateNumberOfMessages")).To(Equal("0"))
+
+			_, err = client.PurgeQueue(&sqs.PurgeQueueInput{QueueUrl: aws.String(queueURL)})
+			expectError(err, "AWS.SimpleQueueService.PurgeQueueInProgress", "Only one PurgeQueue operation on some-queue is allowed every 60 seconds.")
+
+			advance(time.Minute)
+			_, err = client.PurgeQueue(&sqs.PurgeQueueInput{QueueUrl: aws.String(queueURL)})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("messages", func() {
+		var queueURL string
+
+		BeforeEach(func() {
+			queueURL = createQueue("some-queue", nil)
+		})
+
+		It("returns the digests of the body and message attributes", func() {
+			output, err := client.SendMessage(&sqs.SendMessageInput{
+				QueueUrl:    aws.String(queueURL),
+				MessageBody: aws.String("hello"),
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					"color": {DataType: aws.String("String"), StringValue: aws.String("blue")},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.MD5OfMessageBody).To(Equal("5d41402abc4b2a76b9719d911017c592"))
+			Expect(*output.MD5OfMessageAttributes).To(Equal("da1b33cc3cbfe8b1630921e78e6b9880"))
+
+			received, err := client.ReceiveMessage(&sqs.ReceiveMessageInput{
+				QueueUrl:              aws.String(queueURL),
+				AttributeNames:        aws.StringSlice([]string{"All"}),
+				MessageAttributeNames: aws.StringSlice([]string{"All"}),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(received.Messages).To(HaveLen(1))
+			m := received.Messages[0]
+			Expect(*m.MessageId).To(Equal(*output.MessageId))
+			Expect(*m.MD5OfBody).To(Equal("5d41402abc4b2a76b9719d911017c592"))
+			Expect(*m.MD5OfMessageAttributes).To(Equal("da1b33cc3cbfe8b1630921e78e6b9880"))
+			Expect(*m.MessageAttributes["color"].StringValue).To(Equal("blue"))
+			Expect(*m.Attributes["ApproximateReceiveCount"]).To(Equal("1"))
+			Expect(*m.Attributes["SenderId"]).To(Equal("123456789012"))
+		})
+
+		It("rejects bodies with characters that SQS does not allow", func() {
+			_, err := client.SendMessage(&sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String("bell\a")})
+			expectError(err, "InvalidMessageContents", "Invalid binary character '#x7'")
+		})
+
+		It("hides a received message until its visibility timeout passes", func() {
+			useClock()
+			send(queueURL, "hello")
+
+			first := receive(queueURL, 1)
+			Expect(bodies(first)).To(Equal([]string{"hello"}))
+			Expect(receive(queueURL, 1)).To(BeEmpty())
+			Expect(attribute(queueURL, "ApproximateNumberOfMessagesNotVisible")).To(Equal("1"))
+
+			advance(30 * time.Second)
+			again := receive(queueURL, 1)
+			Expect(bodies(again)).To(Equal([]string{"hello"}))
+			Expect(*again[0].ReceiptHandle).NotTo(Equal(*first[0].ReceiptHandle))
+
+			_, err := client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{QueueUrl: aws.String(queueURL), ReceiptHandle: again[0].ReceiptHandle, VisibilityTimeout: aws.Int64(0)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bodies(receive(queueURL, 1))).To(Equal([]string{"hello"}))
+		})
+
+		It("deletes a message by any of its receipt handles", func() {
+			send(queueURL, "hello")
+			received := receive(queueURL, 1)
+
+			_, err := client.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: received[0].ReceiptHandle})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: received[0].ReceiptHandle})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{QueueUrl: aws.String(queueURL), ReceiptHandle: received[0].ReceiptHandle, VisibilityTimeout: aws.Int64(0)})
+			expectError(err, "AWS.SimpleQueueService.MessageNotInflight", "")
+
+			_, err = client.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: aws.String("bogus")})
+			expectError(err, "ReceiptHandleIsInvalid", `The input receipt handle "bogus" is not a valid receipt handle.`)
+		})
+
+		It("delays messages", func() {
+			useClock()
+			_, err := client.SendMessage(&sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String("later"), DelaySeconds: aws.Int64(10)})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(receive(queueURL, 1)).To(BeEmpty())
+			Expect(attribute(queueURL, "ApproximateNumberOfMessagesDelayed")).To(Equal("1"))
+
+			advance(10 * time.Second)
+			Expect(bodies(receive(queueURL, 1))).To(Equal([]string{"later"}))
+		})
+
+		It("drops messages older than the retention period", func() {
+			useClock()
+			send(queueURL, "hello")
+			advance(4 * 24 * time.Hour)
+			Expect(receive(queueURL, 1)).To(BeEmpty())
+		})
+
+		Describe("long polling", func() {
+			It("holds the request until a message is sent", func() {
+				received := make(chan []*sqs.Message)
+				go func() {
+					defer GinkgoRecover()
+					output, err := client.ReceiveMessage(&sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL), WaitTimeSeconds: aws.Int64(10)})
+					Expect(err).NotTo(HaveOccurred())
+					received <- output.Messages
+				}()
+
+				Consistently(received, "200ms").ShouldNot(Receive())
+				send(queueURL, "hello")
+
+				var messages []*sqs.Message
+				Eventually(received, "2s").Should(Receive(&messages))
+				Expect(bodies(messages)).To(Equal([]string{"hello"}))
+			})
+
+			It("returns a message when its visibility timeout passes", func() {
+				send(queueURL, "hello")
+				_, err := client.ReceiveMessage(&sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL), VisibilityTimeout: aws.Int64(1)})
+				Expect(err).NotTo(HaveOccurred())
+
+				start := time.Now()
+				output, err := client.ReceiveMessage(&sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL), WaitTimeSeconds: aws.Int64(5)})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(bodies(output.Messages)).To(Equal([]string{"hello"}))
+				Expect(time.Since(start)).To(BeNumerically("<", 3*time.Second))
+			})
+
+			It("returns nothing after the wait time", func() {
+				start := time.Now()
+				output, err := client.ReceiveMessage(&sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL), WaitTimeSeconds: aws.Int64(1)})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(output.Messages).To(BeEmpty())
+				Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+			})
+		})
+
+		Describe("batches", func() {
+			It("reports the entries that fail", func() {
+				output, err := client.SendMessageBatch(&sqs.SendMessageBatchInput{
+					QueueUrl: aws.String(queueURL),
+					Entries: []*sqs.SendMessageBatchRequestEntry{
+						{Id: aws.String("one"), MessageBody: aws.String("first")},
+						{Id: aws.String("two"), MessageBody: aws.String("")},
+						{Id: aws.String("three"), MessageBody: aws.String("third")},
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(output.Successful).To(HaveLen(2))
+				Expect(output.Failed).To(HaveLen(1))
+				Expect(*output.Failed[0].Id).To(Equal("two"))
+				Expect(*output.Failed[0].Code).To(Equal("MissingParameter"))
+				Expect(*output.Failed[0].SenderFault).To(BeTrue())
+
+				received := receive(queueURL, 10)
+				Expect(bodies(received)).To(ConsistOf("first", "third"))
+
+				deleted, err := client.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
+					QueueUrl: aws.String(queueURL),
+					Entries: []*sqs.DeleteMessageBatchRequestEntry{
+						{Id: aws.String("a"), ReceiptHandle: received[0].ReceiptHandle},
+						{Id: aws.String("b"), ReceiptHandle: aws.String("bogus")},
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleted.Successful).To(HaveLen(1))
+				Expect(*deleted.Failed[0].Code).To(Equal("ReceiptHandleIsInvalid"))
+			})
+
+			It("rejects batches with repeated or too many entries", func() {
+				_, err := client.SendMessageBatch(&sqs.SendMessageBatchInput{
+					QueueUrl: aws.String(queueURL),
+					Entries: []*sqs.SendMessageBatchRequestEntry{
+						{Id: aws.String("one"), MessageBody: aws.String("first")},
+						{Id: aws.String("one"), MessageBody: aws.String("second")},
+					},
+				})
+				expectError(err, "AWS.SimpleQueueService.BatchEntryIdsNotDistinct", "Id one repeated.")
+
+				var entries []*sqs.SendMessageBatchRequestEntry
+				for _, id := range strings.Split("a b c d e f g h i j k", " ") {
+					entries = append(entries, &sqs.SendMessageBatchRequestEntry{Id: aws.String(id), MessageBody: aws.String(id)})
+				}
+				_, err = client.SendMessageBatch(&sqs.SendMessageBatchInput{QueueUrl: aws.String(queueURL), Entries: entries})
+				expectError(err, "AWS.SimpleQueueService.TooManyEntriesInBatchRequest", "You have sent 11.")
+			})
+		})
+	})
+
+	Describe("FIFO queues", func() {
+		var queueURL string
+
+		BeforeEach(func() {
+			queueURL = createQueue("orders.fifo", map[string]string{"FifoQueue": "true"})
+		})
+
+		It("requires a message group and deduplication ID", func() {
+			_, err := client.SendMessage(&sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String("hello")})
+			expectError(err, "MissingParameter", "The request must contain the parameter MessageGroupId.")
+
+			_, err = client.SendMessage(&sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String("hello"), MessageGroupId: aws.String("g")})
+			expectError(err, "InvalidParameterValue", "ContentBasedDeduplication")
+		})
+
+		It("deduplicates messages for five minutes", func() {
+			useClock()
+			first, err := client.SendMessage(&sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String("hello"), MessageGroupId: aws.String("g"), MessageDeduplicationId: aws.String("d")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(first.SequenceNumber).NotTo(BeNil())
+
+			second, err := client.SendMessage(&sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String("hello"), MessageGroupId: aws.String("g"), MessageDeduplicationId: aws.String("d")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*second.MessageId).To(Equal(*first.MessageId))
+			Expect(attribute(queueURL, "ApproximateNumberOfMessages")).To(Equal("1"))
+
+			advance(5 * time.Minute)
+			third, err := client.SendMessage(&sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String("hello"), MessageGroupId: aws.String("g"), MessageDeduplicationId: aws.String("d")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*third.MessageId).NotTo(Equal(*first.MessageId))
+			Expect(*third.SequenceNumber > *first.SequenceNumber).To(BeTrue())
+		})
+
+		It("delivers each message group in order, one batch at a time", func() {
+			sendToGroup(queueURL, "a1", "a")
+			sendToGroup(queueURL, "a2", "a")
+			sendToGroup(queueURL, "b1", "b")
+
+			first := receive(queueURL, 1)
+			Expect(bodies(first)).To(Equal([]string{"a1"}))
+			Expect(bodies(receive(queueURL, 10))).To(Equal([]string{"b1"}))
+			Expect(receive(queueURL, 10)).To(BeEmpty())
+
+			_, err := client.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: first[0].ReceiptHandle})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bodies(receive(queueURL, 10))).To(Equal([]string{"a2"}))
+		})
+	})
+
+	Describe("dead-letter queues", func() {
+		It("moves messages that are received too often", func() {
+			deadLetterURL := createQueue("dead-letters", nil)
+			redrivePolicy := `{"deadLetterTargetArn": "arn:aws:sqs:us-east-1:123456789012:dead-letters", "maxReceiveCount": 2}`
+			queueURL := createQueue("some-queue", map[string]string{"RedrivePolicy": redrivePolicy, "VisibilityTimeout": "0"})
+			send(queueURL, "poison")
+
+			Expect(receive(queueURL, 1)).To(HaveLen(1))
+			Expect(receive(queueURL, 1)).To(HaveLen(1))
+			Expect(receive(queueURL, 1)).To(BeEmpty())
+			Expect(bodies(receive(deadLetterURL, 1))).To(Equal([]string{"poison"}))
+		})
+
+		It("requires the dead-letter queue to exist", func() {
+			redrivePolicy := `{"deadLetterTargetArn": "arn:aws:sqs:us-east-1:123456789012:missing", "maxReceiveCount": 2}`
+			_, err := client.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("some-queue"), Attributes: aws.StringMap(map[string]string{"RedrivePolicy": redrivePolicy})})
+			expectError(err, "InvalidParameterValue", "Dead letter target does not exist.")
+		})
+	})
+
+	It("resets and dumps its state", func() {
+		queueURL := createQueue("some-queue", nil)
+		send(queueURL, "hello")
+		Expect(backend.DumpState()).To(Equal(fakesqs.State{Queues: []fakesqs.QueueState{{Name: "some-queue", Visible: 1}}}))
+
+		backend.Reset()
+		Expect(backend.DumpState()).To(Equal(fakesqs.State{Queues: []fakesqs.QueueState{}}))
+	})
+})
@@ -0,0 +1,235 @@
+package sts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+var (
+	roleArnPattern     = regexp.MustCompile(`^arn:aws:iam::(\d{12}):role/(?:[\w+=,.@-]+/)*([\w+=,.@-]+)$`)
+	sessionNamePattern = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+)
+
+// maxChainedDuration is the longest session that can be had by assuming a
+// role with the credentials of another assumed role
+const maxChainedDuration = time.Hour
+
+// duration returns the DurationSeconds, checked to be in range, or the
+// default
+func duration(seconds *int64, defaultSeconds, maxSeconds int64) (time.Duration, error) {
+	if seconds == nil {
+		return time.Duration(defaultSeconds) * time.Second, nil
+	}
+	if *seconds < 900 {
+		return 0, validationError("1 validation error detected: Value '%d' at 'durationSeconds' failed to satisfy constraint: Member must have value greater than or equal to 900", *seconds)
+	}
+	if *seconds > maxSeconds {
+		return 0, validationError("1 validation error detected: Value '%d' at 'durationSeconds' failed to satisfy constraint: Member must have value less than or equal to %d", *seconds, maxSeconds)
+	}
+	return time.Duration(*seconds) * time.Second, nil
+}
+
+// assumedRole returns the identity of a session of a role
+func assumedRole(roleArn, sessionName *string) (Credentials, error) {
+	match := roleArnPattern.FindStringSubmatch(aws.StringValue(roleArn))
+	if match == nil {
+		return Credentials{}, validationError("%s is invalid", aws.StringValue(roleArn))
+	}
+	if !sessionNamePattern.MatchString(aws.StringValue(sessionName)) {
+		return Credentials{}, validationError("1 validation error detected: Value '%s' at 'roleSessionName' failed to satisfy constraint: Member must satisfy regular expression pattern: [\\w+=,.@-]*", aws.StringValue(sessionName))
+	}
+	account, roleName := match[1], match[2]
+	sum := sha256.Sum256([]byte(*roleArn))
+	roleID := "AROA" + base32.StdEncoding.EncodeToString(sum[:])[:17]
+	return Credentials{
+		Account: account,
+		Arn:     "arn:aws:sts::" + account + ":assumed-role/" + roleName + "/" + *sessionName,
+		UserID:  roleID + ":" + *sessionName,
+	}, nil
+}
+
+func describe(c *Credentials) *sts.Credentials {
+	return &sts.Credentials{
+		AccessKeyId:     aws.String(c.AccessKeyID),
+		SecretAccessKey: aws.String(c.SecretAccessKey),
+		SessionToken:    aws.String(c.SessionToken),
+		Expiration:      aws.Time(c.Expiration),
+	}
+}
+
+func assumedRoleUser(c *Credentials) *sts.AssumedRoleUser {
+	return &sts.AssumedRoleUser{Arn: aws.String(c.Arn), AssumedRoleId: aws.String(c.UserID)}
+}
+
+// GetCallerIdentity returns the identity of the credentials that signed the
+// request: the assumed role or user for credentials that the backend
+// issued, and otherwise the AccountID, Arn and UserID of the backend
+func (b *Backend) GetCallerIdentity(ctx context.Context, input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	caller, err := b.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	identity := b.defaultIdentity()
+	if caller != nil {
+		identity = *caller
+	}
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(identity.Account),
+		Arn:     aws.String(identity.Arn),
+		UserId:  aws.String(identity.UserID),
+	}, nil
+}
+
+// AssumeRole issues credentials for a session of a role, which last an
+// hour unless DurationSeconds says otherwise.  Sessions started with the
+// credentials of another session last at most an hour.
+func (b *Backend) AssumeRole(ctx context.Context, input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	caller, err := b.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := assumedRole(input.RoleArn, input.RoleSessionName)
+	if err != nil {
+		return nil, err
+	}
+	d, err := duration(input.DurationSeconds, 3600, 43200)
+	if err != nil {
+		return nil, err
+	}
+	if caller != nil && d > maxChainedDuration {
+		return nil, validationError("The requested DurationSeconds exceeds the 1 hour session limit for roles assumed by role chaining.")
+	}
+
+	c := b.issue("AssumeRole", identity, d)
+	return &sts.AssumeRoleOutput{
+		AssumedRoleUser:  assumedRoleUser(c),
+		Credentials:      describe(c),
+		PackedPolicySize: packedPolicySize(input.Policy),
+	}, nil
+}
+
+// packedPolicySize returns the percentage of the allowed size used by a
+// session policy, or nil if there is none
+func packedPolicySize(policy *string) *int64 {
+	if policy == nil {
+		return nil
+	}
+	return aws.Int64(int64(len(*policy) * 100 / 2048))
+}
+
+// AssumeRoleWithWebIdentity issues credentials for a session of a role to
+// the subject of an OpenID Connect token.  The token is not verified, but
+// it must be a JWT, and it must not have expired.
+func (b *Backend) AssumeRoleWithWebIdentity(input *sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	identity, err := assumedRole(input.RoleArn, input.RoleSessionName)
+	if err != nil {
+		return nil, err
+	}
+	d, err := duration(input.DurationSeconds, 3600, 43200)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := parseToken(aws.StringValue(input.WebIdentityToken))
+	if err != nil {
+		return nil, err
+	}
+	if claims.Expires != 0 && b.now().After(time.Unix(claims.Expires, 0)) {
+		return nil, stsError("ExpiredTokenException", http.StatusBadRequest, "Token expired: current date/time %s must be before the expiration date/time %s", b.now().UTC().Format(time.RFC3339), time.Unix(claims.Expires, 0).UTC().Format(time.RFC3339))
+	}
+
+	c := b.issue("AssumeRoleWithWebIdentity", identity, d)
+	provider := strings.TrimPrefix(claims.Issuer, "https://")
+	if input.ProviderId != nil {
+		provider = *input.ProviderId
+	}
+	return &sts.AssumeRoleWithWebIdentityOutput{
+		AssumedRoleUser:             assumedRoleUser(c),
+		Credentials:                 describe(c),
+		Audience:                    aws.String(string(claims.Audience)),
+		Provider:                    aws.String(provider),
+		SubjectFromWebIdentityToken: aws.String(claims.Subject),
+		PackedPolicySize:            packedPolicySize(input.Policy),
+	}, nil
+}
+
+type tokenClaims struct {
+	Issuer   string   `json:"iss"`
+	Subject  string   `json:"sub"`
+	Audience audience `json:"aud"`
+	Expires  int64    `json:"exp"`
+}
+
+// audience is the aud claim of a JWT, which may be a string or a list of
+// strings, of which the first is used
+type audience string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		if len(list) > 0 {
+			*a = audience(list[0])
+		}
+		return nil
+	}
+	return json.Unmarshal(data, (*string)(a))
+}
+
+// parseToken returns the claims of a JWT, without checking its signature
+func parseToken(token string) (tokenClaims, error) {
+	invalid := stsError("InvalidIdentityToken", http.StatusBadRequest, "The ID Token provided is not a valid JWT. (You may see this error if you sent an Access Token)")
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return tokenClaims{}, invalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return tokenClaims{}, invalid
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return tokenClaims{}, invalid
+	}
+	return claims, nil
+}
+
+// GetSessionToken issues credentials for the caller, which last 12 hours
+// unless DurationSeconds says otherwise.  Like the real service, it refuses
+// callers who are already using temporary credentials.
+func (b *Backend) GetSessionToken(ctx context.Context, input *sts.GetSessionTokenInput) (*sts.GetSessionTokenOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	caller, err := b.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if caller != nil {
+		return nil, stsError("AccessDenied", http.StatusForbidden, "Cannot call GetSessionToken with session credentials")
+	}
+	d, err := duration(input.DurationSeconds, 43200, 129600)
+	if err != nil {
+		return nil, err
+	}
+
+	c := b.issue("GetSessionToken", b.defaultIdentity(), d)
+	return &sts.GetSessionTokenOutput{Credentials: describe(c)}, nil
+}
@@ -0,0 +1,218 @@
+// Package sts is a ready-made backend for a fake AWS Security Token Service,
+// which issues temporary credentials and remembers them.
+//
+// The credentials are derived from a counter, so a test that makes the same
+// calls gets the same access keys, secrets and session tokens on every run.
+// Lookup tells tests and other fakes who was issued an access key, and the
+// Backend is an awsfaker.CredentialStore, so a SignatureVerifier accepts the
+// keys until they expire and then refuses them with ExpiredToken.
+package sts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rosenhouse/awsfaker"
+)
+
+// Backend is a fake STS.  Use New to create one.
+type Backend struct {
+	// AccountID is the account of callers whose access keys the backend did
+	// not issue
+	AccountID string
+
+	// Arn and UserID identify those callers in GetCallerIdentity, and
+	// default to the root user of the account
+	Arn    string
+	UserID string
+
+	// Fallback, if set, is consulted by Credential for the access keys that
+	// the backend did not issue, such as the long-term keys that callers
+	// use to assume roles
+	Fallback awsfaker.CredentialStore
+
+	// Now returns the current time, and defaults to time.Now.  It decides
+	// when credentials expire.
+	Now func() time.Time
+
+	lock    sync.Mutex
+	issued  map[string]*Credentials
+	ordered []*Credentials
+}
+
+// Credentials are temporary credentials issued by the backend, and the
+// identity of the caller who uses them
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+
+	// Action is the call that issued the credentials, e.g. AssumeRole
+	Action string
+
+	// Account, Arn and UserID are reported by GetCallerIdentity.  For an
+	// assumed role, Arn is the assumed-role ARN and UserID is the role ID
+	// followed by the session name.
+	Account string
+	Arn     string
+	UserID  string
+}
+
+// New returns a Backend that has issued no credentials
+func New() *Backend {
+	b := &Backend{AccountID: "123456789012"}
+	b.clear()
+	return b
+}
+
+func (b *Backend) clear() {
+	b.issued = map[string]*Credentials{}
+	b.ordered = nil
+}
+
+// Reset forgets all issued credentials, and starts issuing the same
+// sequence of credentials again
+func (b *Backend) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.clear()
+}
+
+// State is the state of a Backend, as reported by DumpState
+type State struct {
+	Credentials []CredentialState
+}
+
+// CredentialState describes issued credentials without their secrets
+type CredentialState struct {
+	AccessKeyID string
+	Action      string
+	Arn         string
+	Expiration  time.Time
+	Expired     bool
+}
+
+// DumpState returns the credentials that have been issued, oldest first
+func (b *Backend) DumpState() interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	state := State{Credentials: []CredentialState{}}
+	for _, c := range b.ordered {
+		state.Credentials = append(state.Credentials, CredentialState{
+			AccessKeyID: c.AccessKeyID,
+			Action:      c.Action,
+			Arn:         c.Arn,
+			Expiration:  c.Expiration,
+			Expired:     now.After(c.Expiration),
+		})
+	}
+	return state
+}
+
+// Lookup returns the credentials that the backend issued with the access
+// key ID, whether or not they have expired
+func (b *Backend) Lookup(accessKeyID string) (Credentials, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	c, ok := b.issued[accessKeyID]
+	if !ok {
+		return Credentials{}, false
+	}
+	return *c, true
+}
+
+// Credential returns the secret, session token and expiration of issued
+// credentials, or else asks the Fallback
+func (b *Backend) Credential(accessKeyID string) (awsfaker.Credential, bool) {
+	if c, ok := b.Lookup(accessKeyID); ok {
+		return awsfaker.Credential{
+			SecretAccessKey: c.SecretAccessKey,
+			SessionToken:    c.SessionToken,
+			Expiration:      c.Expiration,
+		}, true
+	}
+	if b.Fallback != nil {
+		return b.Fallback.Credential(accessKeyID)
+	}
+	return awsfaker.Credential{}, false
+}
+
+func (b *Backend) now() time.Time {
+	if b.Now == nil {
+		return time.Now()
+	}
+	return b.Now()
+}
+
+// defaultIdentity returns the identity of callers whose access keys the
+// backend did not issue
+func (b *Backend) defaultIdentity() Credentials {
+	identity := Credentials{Account: b.AccountID, Arn: b.Arn, UserID: b.UserID}
+	if identity.Arn == "" {
+		identity.Arn = fmt.Sprintf("arn:aws:iam::%s:root", b.AccountID)
+	}
+	if identity.UserID == "" {
+		identity.UserID = b.AccountID
+	}
+	return identity
+}
+
+// caller returns the issued credentials that signed the request, or nil if
+// the backend did not issue them.  Like the real service, it refuses
+// requests signed with expired credentials.
+func (b *Backend) caller(ctx context.Context) (*Credentials, error) {
+	info, ok := awsfaker.RequestInfoFromContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	c, ok := b.issued[info.AccessKeyID]
+	if !ok {
+		return nil, nil
+	}
+	if b.now().After(c.Expiration) {
+		return nil, stsError("ExpiredToken", http.StatusForbidden, "The security token included in the request is expired")
+	}
+	return c, nil
+}
+
+// issue mints the next credentials in the sequence for an identity
+func (b *Backend) issue(action string, identity Credentials, duration time.Duration) *Credentials {
+	n := len(b.ordered) + 1
+	c := identity
+	c.Action = action
+	c.AccessKeyID = "ASIA" + base32.StdEncoding.EncodeToString(derive("access-key", n))[:16]
+	c.SecretAccessKey = base64.StdEncoding.EncodeToString(derive("secret", n))[:40]
+	c.SessionToken = base64.StdEncoding.EncodeToString(append(append(derive("token-1", n), derive("token-2", n)...), derive("token-3", n)...))
+	c.Expiration = b.now().Add(duration).UTC().Truncate(time.Second)
+
+	b.issued[c.AccessKeyID] = &c
+	b.ordered = append(b.ordered, &c)
+	return &c
+}
+
+// derive returns bytes that depend only on the purpose and sequence number
+func derive(purpose string, n int) []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("awsfaker/sts/%s/%d", purpose, n)))
+	return sum[:]
+}
+
+func stsError(code string, status int, format string, args ...interface{}) error {
+	return &awsfaker.ErrorResponse{
+		AWSErrorCode:    code,
+		AWSErrorMessage: fmt.Sprintf(format, args...),
+		HTTPStatusCode:  status,
+	}
+}
+
+func validationError(format string, args ...interface{}) error {
+	return stsError("ValidationError", http.StatusBadRequest, format, args...)
+}
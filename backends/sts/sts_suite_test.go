@@ -0,0 +1,13 @@
+package sts_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSTS(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "STS Suite")
+}
@@ -0,0 +1,255 @@
+package sts_test
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"github.com/rosenhouse/awsfaker"
+	fakests "github.com/rosenhouse/awsfaker/backends/sts"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("STS backend", func() {
+	var (
+		backend    *fakests.Backend
+		handler    *awsfaker.Handler
+		fakeServer *httptest.Server
+		client     *sts.STS
+
+		clockLock sync.Mutex
+		now       time.Time
+	)
+
+	const roleArn = "arn:aws:iam::210987654321:role/deploy/some-role"
+
+	newClient := func(accessKey, secretKey, sessionToken string) *sts.STS {
+		return sts.New(session.New(&aws.Config{
+			Credentials: credentials.NewStaticCredentials(accessKey, secretKey, sessionToken),
+			Region:      aws.String("us-east-1"),
+			Endpoint:    aws.String(fakeServer.URL),
+			MaxRetries:  aws.Int(0),
+		}))
+	}
+
+	advance := func(d time.Duration) {
+		clockLock.Lock()
+		defer clockLock.Unlock()
+		now = now.Add(d)
+	}
+
+	BeforeEach(func() {
+		backend = fakests.New()
+		handler = awsfaker.New(backend)
+		fakeServer = httptest.NewServer(handler)
+		client = newClient("some-access-key", "some-secret-key", "")
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	useClock := func() {
+		now = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		backend.Now = func() time.Time {
+			clockLock.Lock()
+			defer clockLock.Unlock()
+			return now
+		}
+	}
+
+	expectError := func(err error, code, message string) {
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal(code))
+		Expect(err.(awserr.RequestFailure).Message()).To(ContainSubstring(message))
+	}
+
+	assumeRole := func(c *sts.STS, input *sts.AssumeRoleInput) *sts.AssumeRoleOutput {
+		output, err := c.AssumeRole(input)
+		Expect(err).NotTo(HaveOccurred())
+		return output
+	}
+
+	clientFor := func(c *sts.Credentials) *sts.STS {
+		return newClient(*c.AccessKeyId, *c.SecretAccessKey, *c.SessionToken)
+	}
+
+	token := func(claims string) string {
+		encode := base64.RawURLEncoding.EncodeToString
+		return encode([]byte(`{"alg":"RS256"}`)) + "." + encode([]byte(claims)) + ".c2lnbmF0dXJl"
+	}
+
+	Describe("GetCallerIdentity", func() {
+		It("reports the root user of the account by default", func() {
+			output, err := client.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.Account).To(Equal("123456789012"))
+			Expect(*output.Arn).To(Equal("arn:aws:iam::123456789012:root"))
+			Expect(*output.UserId).To(Equal("123456789012"))
+		})
+
+		It("reports the configured identity", func() {
+			backend.AccountID = "111122223333"
+			backend.Arn = "arn:aws:iam::111122223333:user/some-user"
+			backend.UserID = "AIDASOMEUSER"
+
+			output, err := client.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.Account).To(Equal("111122223333"))
+			Expect(*output.Arn).To(Equal("arn:aws:iam::111122223333:user/some-user"))
+			Expect(*output.UserId).To(Equal("AIDASOMEUSER"))
+		})
+	})
+
+	Describe("AssumeRole", func() {
+		It("issues credentials for a session of the role", func() {
+			useClock()
+			output := assumeRole(client, &sts.AssumeRoleInput{RoleArn: aws.String(roleArn), RoleSessionName: aws.String("some-session")})
+
+			Expect(*output.AssumedRoleUser.Arn).To(Equal("arn:aws:sts::210987654321:assumed-role/some-role/some-session"))
+			Expect(*output.AssumedRoleUser.AssumedRoleId).To(MatchRegexp(`^AROA[A-Z2-7]{17}:some-session$`))
+			Expect(*output.Credentials.AccessKeyId).To(MatchRegexp(`^ASIA[A-Z2-7]{16}$`))
+			Expect(*output.Credentials.SecretAccessKey).To(HaveLen(40))
+			Expect(*output.Credentials.SessionToken).NotTo(BeEmpty())
+			Expect(*output.Credentials.Expiration).To(BeTemporally("==", now.Add(time.Hour)))
+
+			identity, err := clientFor(output.Credentials).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*identity.Account).To(Equal("210987654321"))
+			Expect(*identity.Arn).To(Equal(*output.AssumedRoleUser.Arn))
+			Expect(*identity.UserId).To(Equal(*output.AssumedRoleUser.AssumedRoleId))
+		})
+
+		It("issues the same sequence of credentials after Reset", func() {
+			input := &sts.AssumeRoleInput{RoleArn: aws.String(roleArn), RoleSessionName: aws.String("some-session")}
+			first := assumeRole(client, input).Credentials
+			second := assumeRole(client, input).Credentials
+			Expect(*second.AccessKeyId).NotTo(Equal(*first.AccessKeyId))
+
+			backend.Reset()
+			again := assumeRole(client, input).Credentials
+			Expect(*again.AccessKeyId).To(Equal(*first.AccessKeyId))
+			Expect(*again.SecretAccessKey).To(Equal(*first.SecretAccessKey))
+			Expect(*again.SessionToken).To(Equal(*first.SessionToken))
+		})
+
+		It("rejects invalid role ARNs, session names and durations", func() {
+			_, err := client.AssumeRole(&sts.AssumeRoleInput{RoleArn: aws.String("arn:aws:iam::210987654321:user/someone"), RoleSessionName: aws.String("some-session")})
+			expectError(err, "ValidationError", "is invalid")
+
+			_, err = client.AssumeRole(&sts.AssumeRoleInput{RoleArn: aws.String(roleArn), RoleSessionName: aws.String("some session")})
+			expectError(err, "ValidationError", "at 'roleSessionName' failed to satisfy constraint")
+
+			_, err = client.AssumeRole(&sts.AssumeRoleInput{RoleArn: aws.String(roleArn), RoleSessionName: aws.String("some-session"), DurationSeconds: aws.Int64(60)})
+			expectError(err, "ValidationError", "greater than or equal to 900")
+		})
+
+		It("limits sessions assumed with session credentials to an hour", func() {
+			output := assumeRole(client, &sts.AssumeRoleInput{RoleArn: aws.String(roleArn), RoleSessionName: aws.String("some-session")})
+			chained := clientFor(output.Credentials)
+
+			_, err := chained.AssumeRole(&sts.AssumeRoleInput{RoleArn: aws.String(roleArn), RoleSessionName: aws.String("chained"), DurationSeconds: aws.Int64(7200)})
+			expectError(err, "ValidationError", "1 hour session limit")
+
+			assumeRole(chained, &sts.AssumeRoleInput{RoleArn: aws.String(roleArn), RoleSessionName: aws.String("chained")})
+		})
+
+		It("refuses credentials once they have expired", func() {
+			useClock()
+			output := assumeRole(client, &sts.AssumeRoleInput{RoleArn: aws.String(roleArn), RoleSessionName: aws.String("some-session"), DurationSeconds: aws.Int64(900)})
+
+			advance(16 * time.Minute)
+			_, err := clientFor(output.Credentials).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+			expectError(err, "ExpiredToken", "The security token included in the request is expired")
+
+			Expect(backend.DumpState()).To(Equal(fakests.State{Credentials: []fakests.CredentialState{{
+				AccessKeyID: *output.Credentials.AccessKeyId,
+				Action:      "AssumeRole",
+				Arn:         *output.AssumedRoleUser.Arn,
+				Expiration:  *output.Credentials.Expiration,
+				Expired:     true,
+			}}}))
+		})
+	})
+
+	Describe("AssumeRoleWithWebIdentity", func() {
+		It("issues credentials to the subject of the token", func() {
+			output, err := client.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityInput{
+				RoleArn:          aws.String(roleArn),
+				RoleSessionName:  aws.String("web-session"),
+				WebIdentityToken: aws.String(token(`{"iss":"https://oidc.example.com","sub":"some-subject","aud":["some-audience"]}`)),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.SubjectFromWebIdentityToken).To(Equal("some-subject"))
+			Expect(*output.Audience).To(Equal("some-audience"))
+			Expect(*output.Provider).To(Equal("oidc.example.com"))
+			Expect(*output.AssumedRoleUser.Arn).To(Equal("arn:aws:sts::210987654321:assumed-role/some-role/web-session"))
+
+			issued, ok := backend.Lookup(*output.Credentials.AccessKeyId)
+			Expect(ok).To(BeTrue())
+			Expect(issued.Action).To(Equal("AssumeRoleWithWebIdentity"))
+			Expect(issued.SessionToken).To(Equal(*output.Credentials.SessionToken))
+		})
+
+		It("rejects tokens that are not JWTs or have expired", func() {
+			useClock()
+			_, err := client.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityInput{
+				RoleArn:          aws.String(roleArn),
+				RoleSessionName:  aws.String("web-session"),
+				WebIdentityToken: aws.String("some-access-token"),
+			})
+			expectError(err, "InvalidIdentityToken", "not a valid JWT")
+
+			_, err = client.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityInput{
+				RoleArn:          aws.String(roleArn),
+				RoleSessionName:  aws.String("web-session"),
+				WebIdentityToken: aws.String(token(`{"sub":"some-subject","exp":1400000000}`)),
+			})
+			expectError(err, "ExpiredTokenException", "Token expired")
+		})
+	})
+
+	Describe("GetSessionToken", func() {
+		It("issues credentials for the caller that last 12 hours", func() {
+			useClock()
+			output, err := client.GetSessionToken(&sts.GetSessionTokenInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*output.Credentials.Expiration).To(BeTemporally("==", now.Add(12*time.Hour)))
+
+			identity, err := clientFor(output.Credentials).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*identity.Arn).To(Equal("arn:aws:iam::123456789012:root"))
+
+			_, err = clientFor(output.Credentials).GetSessionToken(&sts.GetSessionTokenInput{})
+			expectError(err, "AccessDenied", "Cannot call GetSessionToken with session credentials")
+		})
+	})
+
+	Describe("as a credential store", func() {
+		BeforeEach(func() {
+			backend.Fallback = awsfaker.StaticCredentials{"some-access-key": {SecretAccessKey: "some-secret-key"}}
+			handler.Signatures = &awsfaker.SignatureVerifier{Credentials: backend}
+		})
+
+		It("accepts the long-term keys of the fallback and the keys it issued", func() {
+			output := assumeRole(client, &sts.AssumeRoleInput{RoleArn: aws.String(roleArn), RoleSessionName: aws.String("some-session")})
+			_, err := clientFor(output.Credentials).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("refuses issued keys used without their session token", func() {
+			output := assumeRole(client, &sts.AssumeRoleInput{RoleArn: aws.String(roleArn), RoleSessionName: aws.String("some-session")})
+			_, err := newClient(*output.Credentials.AccessKeyId, *output.Credentials.SecretAccessKey, "").GetCallerIdentity(&sts.GetCallerIdentityInput{})
+			expectError(err, "InvalidClientTokenId", "The security token included in the request is invalid.")
+		})
+	})
+})
@@ -0,0 +1,72 @@
+// Command awsfaker-gen generates a fake backend for awsfaker from an
+// aws-sdk-go service interface.
+//
+// For example,
+//
+//	awsfaker-gen -interface github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface.CloudFormationAPI \
+//		-operations DescribeStacks,UpdateStack -package fakes -o fakes/cloudformation.go
+//
+// writes a FakeCloudFormationBackend with DescribeStacks and UpdateStack
+// methods, plus helpers to stub their results and inspect their inputs.
+// The aws-sdk-go source must be in the GOPATH.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rosenhouse/awsfaker/internal/gen"
+)
+
+func main() {
+	var (
+		interfaceName = flag.String("interface", "", "service interface to fake, as import/path.InterfaceName")
+		operations    = flag.String("operations", "", "comma-separated operations to implement (default all)")
+		typeName      = flag.String("type", "", "name of the fake type (default derived from the interface, e.g. FakeCloudFormationBackend)")
+		packageName   = flag.String("package", "fakes", "package name of the generated file")
+		output        = flag.String("o", "", "output file (default stdout)")
+	)
+	flag.Parse()
+
+	if err := run(*interfaceName, *operations, *typeName, *packageName, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "awsfaker-gen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(interfaceName, operations, typeName, packageName, output string) error {
+	i := strings.LastIndex(interfaceName, ".")
+	if i < 0 {
+		return fmt.Errorf("expected -interface like import/path.InterfaceName, got %q", interfaceName)
+	}
+	iface, err := gen.LoadInterface(interfaceName[:i], interfaceName[i+1:])
+	if err != nil {
+		return err
+	}
+
+	config := gen.Config{
+		Package:   packageName,
+		TypeName:  typeName,
+		Interface: iface,
+	}
+	if config.TypeName == "" {
+		config.TypeName = gen.DefaultTypeName(iface.Name)
+	}
+	if operations != "" {
+		config.Operations = strings.Split(operations, ",")
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return gen.Generate(w, config)
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAWSFaker(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "awsfaker Command Suite")
+}
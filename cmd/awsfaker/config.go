@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"plugin"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/rosenhouse/awsfaker"
+)
+
+// A config describes the fakes to serve.  Relative paths are resolved
+// against the directory of the config file.
+type config struct {
+	Address  string          `yaml:"address"`
+	Region   string          `yaml:"region"`
+	TLS      tlsConfig       `yaml:"tls"`
+	Services []serviceConfig `yaml:"services"`
+}
+
+type tlsConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// A serviceConfig names either a fixture file, whose responses are served by
+// an awsfaker.FixtureBackend, or a Go plugin exporting a function
+//
+//	func NewBackend() interface{}
+//
+// that returns a backend as accepted by awsfaker.New
+type serviceConfig struct {
+	Fixtures string `yaml:"fixtures"`
+	Plugin   string `yaml:"plugin"`
+}
+
+func loadConfig(path string) (config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config{}, err
+	}
+	var c config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return config{}, fmt.Errorf("unable to parse config %s: %s", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	c.TLS.CertFile = resolve(dir, c.TLS.CertFile)
+	c.TLS.KeyFile = resolve(dir, c.TLS.KeyFile)
+	for i := range c.Services {
+		c.Services[i].Fixtures = resolve(dir, c.Services[i].Fixtures)
+		c.Services[i].Plugin = resolve(dir, c.Services[i].Plugin)
+	}
+	return c, nil
+}
+
+func resolve(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func (s serviceConfig) backend() (interface{}, error) {
+	switch {
+	case s.Fixtures != "" && s.Plugin != "":
+		return nil, fmt.Errorf("service may have fixtures or a plugin, not both: %s, %s", s.Fixtures, s.Plugin)
+	case s.Fixtures != "":
+		return loadFixtures(s.Fixtures)
+	case s.Plugin != "":
+		return loadPlugin(s.Plugin)
+	default:
+		return nil, fmt.Errorf("service needs fixtures or a plugin")
+	}
+}
+
+func loadFixtures(path string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fixtureFile, err := awsfaker.ParseFixtureFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse fixtures in %s: %s", path, err)
+	}
+	api, ok := serviceAPIs[fixtureFile.Service]
+	if !ok {
+		return nil, fmt.Errorf("unknown service %q in %s, expected one of: %s",
+			fixtureFile.Service, path, strings.Join(knownServices(), ", "))
+	}
+	backend, err := awsfaker.NewFixtureBackend(api, fixtureFile.Fixtures)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixtures in %s: %s", path, err)
+	}
+	return backend, nil
+}
+
+func loadPlugin(path string) (interface{}, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := p.Lookup("NewBackend")
+	if err != nil {
+		return nil, err
+	}
+	newBackend, ok := symbol.(func() interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected NewBackend in %s to be a func() interface{}, got %T", path, symbol)
+	}
+	return newBackend(), nil
+}
@@ -0,0 +1,227 @@
+// Command awsfaker serves fake AWS services over HTTP, for integration tests
+// that run the application under test as a separate process.
+//
+// For example,
+//
+//	awsfaker serve -config awsfaker.yml -address 127.0.0.1:8080
+//
+// serves the services described in awsfaker.yml and prints the environment
+// variables that point an AWS client at them:
+//
+//	export AWS_ENDPOINT_URL=http://127.0.0.1:8080
+//	export AWSFAKER_ADMIN_URL=http://127.0.0.1:8080/_awsfaker/
+//	export AWS_REGION=us-east-1
+//	...
+//
+// The admin API under /_awsfaker/ lists the calls received and accepts new
+// responses between test steps; see awsfaker.Mux.Admin.
+//
+// The config lists the services to fake, each either as a fixture file of
+// canned responses (see awsfaker.FixtureFile) or as a Go plugin that exports
+// a constructor for a backend:
+//
+//	address: 127.0.0.1:8080
+//	region: us-west-2
+//	tls:
+//	  certFile: cert.pem
+//	  keyFile: key.pem
+//	services:
+//	- fixtures: fixtures/cloudformation.yml
+//	- plugin: plugins/ec2.so  # exports func NewBackend() interface{}
+//
+// Flags given on the command line take precedence over the config.  The
+// server shuts down cleanly on SIGTERM or SIGINT.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rosenhouse/awsfaker"
+)
+
+const usage = `usage: awsfaker serve [flags]
+
+Serves the fake AWS services described in a config file.
+
+flags:
+`
+
+const (
+	defaultAddress = "127.0.0.1:8080"
+	defaultRegion  = "us-east-1"
+
+	shutdownTimeout = 10 * time.Second
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "serve" {
+		fmt.Fprint(os.Stderr, usage)
+		newFlagSet().PrintDefaults()
+		os.Exit(2)
+	}
+
+	flags := newFlagSet()
+	var (
+		configPath = flags.String("config", "awsfaker.yml", "config file describing the services to serve")
+		address    = flags.String("address", "", "address to listen on (default from config, or "+defaultAddress+")")
+		region     = flags.String("region", "", "region to advertise to clients (default from config, or "+defaultRegion+")")
+		certFile   = flags.String("tls-cert", "", "certificate file, to serve HTTPS")
+		keyFile    = flags.String("tls-key", "", "private key file, to serve HTTPS")
+	)
+	flags.Parse(os.Args[2:])
+
+	c, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("awsfaker: %s", err)
+	}
+	override(&c.Address, *address, defaultAddress)
+	override(&c.Region, *region, defaultRegion)
+	override(&c.TLS.CertFile, *certFile, "")
+	override(&c.TLS.KeyFile, *keyFile, "")
+
+	if err := serve(c); err != nil {
+		log.Fatalf("awsfaker: %s", err)
+	}
+}
+
+func newFlagSet() *flag.FlagSet {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// override sets the config value from the flag, if given, or else to the
+// default if the config has no value
+func override(value *string, flagValue, defaultValue string) {
+	if flagValue != "" {
+		*value = flagValue
+	} else if *value == "" {
+		*value = defaultValue
+	}
+}
+
+func serve(c config) error {
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("TLS needs both a certificate and a key")
+	}
+
+	mux, err := newMux(c.Services)
+	if err != nil {
+		return err
+	}
+	mux.OnError = func(err error) {
+		log.Printf("awsfaker: %s", err)
+	}
+
+	listener, err := listen(c.Address, c.TLS)
+	if err != nil {
+		return err
+	}
+	routes := http.NewServeMux()
+	routes.Handle(awsfaker.AdminPrefix, http.StripPrefix(strings.TrimSuffix(awsfaker.AdminPrefix, "/"), mux.Admin()))
+	routes.Handle("/", mux)
+	server := &http.Server{Handler: routes}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	endpointURL := endpoint(listener.Addr(), c.TLS.CertFile != "")
+	log.Printf("awsfaker: serving %d service(s) at %s", len(c.Services), endpointURL)
+	printEnvironment(os.Stdout, endpointURL, c)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-served:
+		return err
+	case <-signals:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+func listen(address string, t tlsConfig) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil || t.CertFile == "" {
+		return listener, err
+	}
+	certificate, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{certificate}}), nil
+}
+
+// newMux builds the backends, reporting the panics of awsfaker.NewMux as
+// errors
+func newMux(services []serviceConfig) (mux *awsfaker.Mux, err error) {
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no services configured")
+	}
+	backends := []interface{}{}
+	for _, service := range services {
+		backend, err := service.backend()
+		if err != nil {
+			return nil, err
+		}
+		backends = append(backends, backend)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return awsfaker.NewMux(backends...), nil
+}
+
+// endpoint returns the URL at which clients reach the listener.  A wildcard
+// address is reported as the loopback address.
+func endpoint(addr net.Addr, isTLS bool) string {
+	host, port, _ := net.SplitHostPort(addr.String())
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	scheme := "http"
+	if isTLS {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port))
+}
+
+// printEnvironment writes the environment for clients, in a form that a
+// shell can source.  Credentials already in the environment are kept, since
+// awsfaker does not check them.
+func printEnvironment(w io.Writer, endpointURL string, c config) {
+	fmt.Fprintf(w, "export AWS_ENDPOINT_URL=%s\n", endpointURL)
+	fmt.Fprintf(w, "export AWSFAKER_ADMIN_URL=%s%s\n", endpointURL, awsfaker.AdminPrefix)
+	fmt.Fprintf(w, "export AWS_REGION=%s\n", c.Region)
+	fmt.Fprintf(w, "export AWS_DEFAULT_REGION=%s\n", c.Region)
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "" {
+		fmt.Fprintln(w, "export AWS_ACCESS_KEY_ID=awsfaker")
+		fmt.Fprintln(w, "export AWS_SECRET_ACCESS_KEY=awsfaker")
+	}
+	if c.TLS.CertFile != "" {
+		fmt.Fprintf(w, "export AWS_CA_BUNDLE=%s\n", c.TLS.CertFile)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("The awsfaker command", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "awsfaker-cmd")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writeFile := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		return path
+	}
+
+	Describe("loading the config", func() {
+		It("reads the settings and resolves paths against the config directory", func() {
+			path := writeFile("awsfaker.yml", `
+address: 127.0.0.1:9090
+region: us-west-2
+tls:
+  certFile: cert.pem
+  keyFile: /etc/awsfaker/key.pem
+services:
+- fixtures: fixtures/cloudformation.yml
+- plugin: plugins/ec2.so
+`)
+			c, err := loadConfig(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c).To(Equal(config{
+				Address: "127.0.0.1:9090",
+				Region:  "us-west-2",
+				TLS: tlsConfig{
+					CertFile: filepath.Join(dir, "cert.pem"),
+					KeyFile:  "/etc/awsfaker/key.pem",
+				},
+				Services: []serviceConfig{
+					{Fixtures: filepath.Join(dir, "fixtures/cloudformation.yml")},
+					{Plugin: filepath.Join(dir, "plugins/ec2.so")},
+				},
+			}))
+		})
+
+		It("reports a config that is missing or cannot be parsed", func() {
+			_, err := loadConfig(filepath.Join(dir, "missing.yml"))
+			Expect(err).To(HaveOccurred())
+
+			path := writeFile("awsfaker.yml", "services: {")
+			_, err = loadConfig(path)
+			Expect(err).To(MatchError(HavePrefix("unable to parse config " + path)))
+		})
+
+		It("lets flags override the config, and falls back to defaults", func() {
+			value := "from-config"
+			override(&value, "from-flag", "default")
+			Expect(value).To(Equal("from-flag"))
+
+			override(&value, "", "default")
+			Expect(value).To(Equal("from-flag"))
+
+			value = ""
+			override(&value, "", "default")
+			Expect(value).To(Equal("default"))
+		})
+	})
+
+	Describe("registering services", func() {
+		newSession := func(endpointURL string) *session.Session {
+			return session.New(&aws.Config{
+				Credentials:      credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""),
+				Region:           aws.String("us-east-1"),
+				Endpoint:         aws.String(endpointURL),
+				S3ForcePathStyle: aws.Bool(true),
+				MaxRetries:       aws.Int(0),
+			})
+		}
+
+		It("serves query, REST-JSON and REST-XML services from fixtures", func() {
+			services := []serviceConfig{
+				{Fixtures: writeFile("cloudformation.yml", `
+service: cloudformation
+responses:
+- action: DescribeStacks
+  output:
+    Stacks:
+    - StackName: some-stack
+      StackStatus: CREATE_COMPLETE
+`)},
+				{Fixtures: writeFile("lambda.yml", `
+service: lambda
+responses:
+- action: ListFunctions
+  output:
+    Functions:
+    - FunctionName: some-function
+`)},
+				{Fixtures: writeFile("route53.yml", `
+service: route53
+responses:
+- action: ListHostedZones
+  output:
+    HostedZones:
+    - Id: some-zone
+      Name: example.com.
+      CallerReference: some-reference
+    IsTruncated: false
+    Marker: ""
+    MaxItems: "100"
+`)},
+				{Fixtures: writeFile("s3.yml", `
+service: s3
+responses:
+- action: ListBuckets
+  output:
+    Buckets:
+    - Name: some-bucket
+`)},
+			}
+
+			mux, err := newMux(services)
+			Expect(err).NotTo(HaveOccurred())
+			server := httptest.NewServer(mux)
+			defer server.Close()
+			sess := newSession(server.URL)
+
+			stacks, err := cloudformation.New(sess).DescribeStacks(&cloudformation.DescribeStacksInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*stacks.Stacks[0].StackName).To(Equal("some-stack"))
+
+			functions, err := lambda.New(sess).ListFunctions(&lambda.ListFunctionsInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*functions.Functions[0].FunctionName).To(Equal("some-function"))
+
+			zones, err := route53.New(sess).ListHostedZones(&route53.ListHostedZonesInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*zones.HostedZones[0].Name).To(Equal("example.com."))
+
+			buckets, err := s3.New(sess).ListBuckets(&s3.ListBucketsInput{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*buckets.Buckets[0].Name).To(Equal("some-bucket"))
+		})
+
+		It("reports services that cannot be built", func() {
+			_, err := newMux(nil)
+			Expect(err).To(MatchError("no services configured"))
+
+			_, err = newMux([]serviceConfig{{}})
+			Expect(err).To(MatchError("service needs fixtures or a plugin"))
+
+			_, err = newMux([]serviceConfig{{Fixtures: "some.yml", Plugin: "some.so"}})
+			Expect(err).To(MatchError("service may have fixtures or a plugin, not both: some.yml, some.so"))
+
+			path := writeFile("unknown.yml", "service: nosuchservice\nresponses: []\n")
+			_, err = newMux([]serviceConfig{{Fixtures: path}})
+			Expect(err).To(MatchError(HavePrefix(`unknown service "nosuchservice" in ` + path)))
+		})
+	})
+
+	Describe("printing the environment", func() {
+		var savedAccessKey string
+
+		BeforeEach(func() {
+			savedAccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+			os.Unsetenv("AWS_ACCESS_KEY_ID")
+		})
+
+		AfterEach(func() {
+			os.Setenv("AWS_ACCESS_KEY_ID", savedAccessKey)
+		})
+
+		It("exports the endpoint, admin URL, region and placeholder credentials", func() {
+			var output bytes.Buffer
+			printEnvironment(&output, "http://127.0.0.1:8080", config{Region: "us-west-2"})
+			Expect(output.String()).To(Equal(`export AWS_ENDPOINT_URL=http://127.0.0.1:8080
+export AWSFAKER_ADMIN_URL=http://127.0.0.1:8080/_awsfaker/
+export AWS_REGION=us-west-2
+export AWS_DEFAULT_REGION=us-west-2
+export AWS_ACCESS_KEY_ID=awsfaker
+export AWS_SECRET_ACCESS_KEY=awsfaker
+`))
+		})
+
+		It("keeps credentials from the environment, and exports the CA bundle for TLS", func() {
+			os.Setenv("AWS_ACCESS_KEY_ID", "some-access-key")
+			var output bytes.Buffer
+			printEnvironment(&output, "https://127.0.0.1:8443", config{Region: "us-east-1", TLS: tlsConfig{CertFile: "/some/cert.pem"}})
+			Expect(output.String()).NotTo(ContainSubstring("AWS_ACCESS_KEY_ID"))
+			Expect(output.String()).To(ContainSubstring("export AWS_CA_BUNDLE=/some/cert.pem\n"))
+		})
+
+		It("reports wildcard addresses as the loopback address", func() {
+			Expect(endpoint(&net.TCPAddr{IP: net.IPv4zero, Port: 8080}, false)).To(Equal("http://127.0.0.1:8080"))
+			Expect(endpoint(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8443}, true)).To(Equal("https://10.0.0.1:8443"))
+		})
+	})
+})
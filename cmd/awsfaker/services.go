@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// serviceAPIs maps the service names used in fixture files to the
+// aws-sdk-go interfaces that supply their input and output types
+var serviceAPIs = map[string]interface{}{
+	"cloudformation": (*cloudformationiface.CloudFormationAPI)(nil),
+	"cloudwatch":     (*cloudwatchiface.CloudWatchAPI)(nil),
+	"dynamodb":       (*dynamodbiface.DynamoDBAPI)(nil),
+	"ec2":            (*ec2iface.EC2API)(nil),
+	"iam":            (*iamiface.IAMAPI)(nil),
+	"kinesis":        (*kinesisiface.KinesisAPI)(nil),
+	"kms":            (*kmsiface.KMSAPI)(nil),
+	"lambda":         (*lambdaiface.LambdaAPI)(nil),
+	"route53":        (*route53iface.Route53API)(nil),
+	"s3":             (*s3iface.S3API)(nil),
+	"sns":            (*snsiface.SNSAPI)(nil),
+	"sqs":            (*sqsiface.SQSAPI)(nil),
+	"sts":            (*stsiface.STSAPI)(nil),
+}
+
+func knownServices() []string {
+	names := []string{}
+	for name := range serviceAPIs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
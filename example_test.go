@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
@@ -61,12 +62,14 @@ func Example() {
 	_, err = client.CreateStack(&cloudformation.CreateStackInput{
 		StackName: aws.String("some-stack"),
 	})
-	fmt.Printf("[Client] CreateStack returned error:\n %s\n", err)
+	awsErr := err.(awserr.RequestFailure)
+	fmt.Printf("[Client] CreateStack returned error:\n %s: %s\n status code: %d\n",
+		awsErr.Code(), awsErr.Message(), awsErr.StatusCode())
 	// Output:
 	// [Server] CreateStack called on "some-stack"
 	// [Client] CreateStack returned ID: "some-id"
 	// [Server] CreateStack called on "some-stack"
 	// [Client] CreateStack returned error:
 	//  AlreadyExistsException: Stack [some-stack] already exists
-	// 	status code: 400, request id:
+	//  status code: 400
 }
@@ -21,12 +21,16 @@ package awsfaker
 
 import (
 	"fmt"
-	"net/http"
 
+	"github.com/rosenhouse/awsfaker/internal/detect"
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+	"github.com/rosenhouse/awsfaker/protocols/jsonrpc"
 	"github.com/rosenhouse/awsfaker/protocols/query"
+	"github.com/rosenhouse/awsfaker/protocols/restjson"
+	"github.com/rosenhouse/awsfaker/protocols/restxml"
 )
 
-// New returns a new http.Handler that will dispatch incoming requests to
+// New returns a new Handler that will dispatch incoming requests to
 // the given service backend, decoding requests and encoding responses in the
 // format used by that service.
 //
@@ -36,8 +40,71 @@ import (
 //	func (b *MyBackend) SomeAction(input *service.SomeActionInput) (*service.SomeActionOutput, error)
 // where the input and output types are those in github.com/aws/aws-sdk-go
 // When returning an error from a backend method, use the ErrorResponse type.
-func New(serviceBackend interface{}) http.Handler {
-	return query.New(serviceBackend)
+// A method may also take a context.Context before its input, to see the
+// RequestInfo of the request it serves.
+//
+// The service, and so the protocol, is detected from the package of the input
+// types.  New panics if the backend mixes input types from several service
+// packages, or if the service uses a protocol that awsfaker does not support.
+//
+// Requests that the backend cannot serve, such as those for unimplemented
+// actions, receive an AWS error response; see Handler.OnError to observe them.
+func New(serviceBackend interface{}) *Handler {
+	service, err := newFakeService(serviceBackend)
+	if err != nil {
+		panic(fmt.Sprintf("awsfaker: %s", err))
+	}
+	return newServiceHandler(service)
+}
+
+// A fakeService is the handler for one service backend, along with the
+// responses injected through the admin API
+type fakeService struct {
+	name       string
+	backend    interface{}
+	handler    *dispatch.Handler
+	injections *injections
+}
+
+func newFakeService(serviceBackend interface{}) (*fakeService, error) {
+	handler, serviceName, err := newHandler(serviceBackend)
+	if err != nil {
+		return nil, err
+	}
+	service := &fakeService{
+		name:       serviceName,
+		backend:    serviceBackend,
+		handler:    handler,
+		injections: &injections{},
+	}
+	handler.Intercept = service.injections.answer
+	return service, nil
+}
+
+// newHandler returns a handler for the backend, along with the name of the
+// service that it fakes
+func newHandler(serviceBackend interface{}) (*dispatch.Handler, string, error) {
+	serviceName, err := detect.GetServiceName(serviceBackend)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to detect protocol for %T: %s", serviceBackend, err)
+	}
+	protocol, err := detect.GetProtocol(serviceBackend)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to detect protocol for %T: %s", serviceBackend, err)
+	}
+
+	switch protocol {
+	case "query", "ec2query":
+		return query.New(serviceBackend).Handler, serviceName, nil
+	case "jsonrpc":
+		return jsonrpc.New(serviceBackend).Handler, serviceName, nil
+	case "restjson":
+		return restjson.New(serviceBackend).Handler, serviceName, nil
+	case "restxml":
+		return restxml.New(serviceBackend).Handler, serviceName, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported protocol %q for %T", protocol, serviceBackend)
+	}
 }
 
 // An ErrorResponse represents an error from a backend method
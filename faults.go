@@ -0,0 +1,207 @@
+package awsfaker
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+)
+
+// A Fault is a way for a fake service to misbehave
+type Fault struct {
+	// Delay holds back the response
+	Delay time.Duration
+
+	// Error, if set, is sent in place of the response of the backend.  An
+	// Error without a valid HTTPStatusCode is sent with 500.
+	Error *ErrorResponse
+
+	// Reset drops the connection without any response
+	Reset bool
+}
+
+// Faults that AWS services produce under load.  The client libraries retry
+// all of them.
+var (
+	Throttling = Fault{Error: &ErrorResponse{
+		AWSErrorCode:    "Throttling",
+		AWSErrorMessage: "Rate exceeded",
+		HTTPStatusCode:  http.StatusBadRequest,
+	}}
+	RequestLimitExceeded = Fault{Error: &ErrorResponse{
+		AWSErrorCode:    "RequestLimitExceeded",
+		AWSErrorMessage: "Request limit exceeded.",
+		HTTPStatusCode:  http.StatusServiceUnavailable,
+	}}
+	ProvisionedThroughputExceeded = Fault{Error: &ErrorResponse{
+		AWSErrorCode:    "ProvisionedThroughputExceededException",
+		AWSErrorMessage: "The level of configured provisioned throughput for the table was exceeded.",
+		HTTPStatusCode:  http.StatusBadRequest,
+	}}
+	InternalServerError = Fault{Error: &ErrorResponse{
+		AWSErrorCode:    "InternalFailure",
+		AWSErrorMessage: "We encountered an internal error. Please try again.",
+		HTTPStatusCode:  http.StatusInternalServerError,
+	}}
+	ServiceUnavailable = Fault{Error: &ErrorResponse{
+		AWSErrorCode:    "ServiceUnavailable",
+		AWSErrorMessage: "Service is unavailable. Please try again.",
+		HTTPStatusCode:  http.StatusServiceUnavailable,
+	}}
+	ConnectionReset = Fault{Reset: true}
+)
+
+// Delay returns a Fault that holds back the response for the duration
+func Delay(d time.Duration) Fault {
+	return Fault{Delay: d}
+}
+
+// A FaultRule chooses the calls that suffer a fault.  The conditions that
+// are set must all hold.
+type FaultRule struct {
+	// Action restricts the rule to calls of the named action
+	Action string
+
+	// Probability is the chance that the fault applies to a call.  Zero
+	// means every call.
+	Probability float64
+
+	// NthCall restricts the rule to the nth call that it sees, counting
+	// from 1
+	NthCall int
+
+	// FirstCalls restricts the rule to the first calls that it sees
+	FirstCalls int
+
+	Fault Fault
+}
+
+// Faults makes a Handler or Mux misbehave on purpose, to exercise the retry
+// and backoff logic of the code under test.  Set it as the Faults field of
+// the Handler or Mux.
+//
+// Each call is checked against every rule.  Delays of all rules that apply
+// add up, and the first error or reset that applies is the response.  Calls
+// that suffer an error or reset do not reach the backend, and are not
+// recorded in the journal.
+//
+// The zero value has no rules, and draws probabilities as if made by
+// NewFaults with a seed of 0.
+type Faults struct {
+	lock   sync.Mutex
+	random *rand.Rand
+	rules  []*faultRule
+}
+
+type faultRule struct {
+	FaultRule
+	calls int
+}
+
+// NewFaults returns a Faults with the given rules.  Probabilities are drawn
+// from a source with the given seed, so that a test run can be reproduced.
+func NewFaults(seed int64, rules ...FaultRule) *Faults {
+	f := &Faults{random: rand.New(rand.NewSource(seed))}
+	return f.Add(rules...)
+}
+
+// Add adds rules, and returns the Faults for chaining
+func (f *Faults) Add(rules ...FaultRule) *Faults {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, rule := range rules {
+		f.rules = append(f.rules, &faultRule{FaultRule: rule})
+	}
+	return f
+}
+
+// Clear removes all rules
+func (f *Faults) Clear() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.rules = nil
+}
+
+// choose returns the combined fault for a call to the action
+func (f *Faults) choose(action string) Fault {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var chosen Fault
+	for _, rule := range f.rules {
+		if rule.Action != "" && rule.Action != action {
+			continue
+		}
+		rule.calls++
+		if f.random == nil {
+			f.random = rand.New(rand.NewSource(0))
+		}
+		if !rule.applies(f.random) {
+			continue
+		}
+		chosen.Delay += rule.Fault.Delay
+		if chosen.Error == nil && !chosen.Reset {
+			chosen.Error = rule.Fault.Error
+			chosen.Reset = rule.Fault.Reset
+		}
+	}
+	return chosen
+}
+
+func (r *faultRule) applies(random *rand.Rand) bool {
+	if r.NthCall > 0 && r.calls != r.NthCall {
+		return false
+	}
+	if r.FirstCalls > 0 && r.calls > r.FirstCalls {
+		return false
+	}
+	if r.Probability > 0 && random.Float64() >= r.Probability {
+		return false
+	}
+	return true
+}
+
+// inject applies the fault chosen for the call, and returns the error to
+// respond with, or reports that it dropped the connection
+func (f *Faults) inject(w http.ResponseWriter, r *http.Request, action string) (*dispatch.ErrorResponse, bool) {
+	fault := f.choose(action)
+	if fault.Delay > 0 {
+		select {
+		case <-time.After(fault.Delay):
+		case <-r.Context().Done():
+			return nil, true
+		}
+	}
+	if fault.Reset {
+		resetConnection(w)
+		return nil, true
+	}
+	if fault.Error != nil {
+		refusal := dispatch.ErrorResponse(*fault.Error)
+		if refusal.HTTPStatusCode < 100 || refusal.HTTPStatusCode > 999 {
+			refusal.HTTPStatusCode = http.StatusInternalServerError
+		}
+		return &refusal, false
+	}
+	return nil, false
+}
+
+// resetConnection closes the underlying connection so that the client sees
+// a reset, or else aborts the response
+func resetConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
@@ -0,0 +1,450 @@
+package awsfaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/rosenhouse/awsfaker/internal/yamlutil"
+)
+
+// A Fixture is a canned response to an action.
+//
+// If Match is set, the fixture applies only to inputs whose fields equal the
+// given values.  Keys are paths into the input, using the field names of the
+// aws-sdk-go input struct, e.g. StackName or Parameters[0].ParameterKey.
+// A value may also be given as {"regex": "..."} to match by regular
+// expression.
+//
+// The response is either an Output document, using the field names of the
+// aws-sdk-go output struct, or an Error.  An Error without an HTTPStatusCode
+// is sent as 400 Bad Request.
+type Fixture struct {
+	Action string                 `json:"action"`
+	Match  map[string]interface{} `json:"match,omitempty"`
+	Output map[string]interface{} `json:"output,omitempty"`
+	Error  *ErrorResponse         `json:"error,omitempty"`
+}
+
+// A FixtureFile holds the fixtures for one service, e.g.
+//
+//	service: cloudformation
+//	responses:
+//	- action: DescribeStacks
+//	  match:
+//	    StackName: some-stack
+//	  output:
+//	    Stacks:
+//	    - StackName: some-stack
+//	      StackStatus: CREATE_COMPLETE
+//	- action: DescribeStacks
+//	  error:
+//	    AWSErrorCode: ValidationError
+//	    AWSErrorMessage: Stack does not exist
+//	    HTTPStatusCode: 400
+type FixtureFile struct {
+	Service  string    `json:"service"`
+	Fixtures []Fixture `json:"responses"`
+}
+
+// ParseFixtureFile parses a fixture file written in YAML or JSON
+func ParseFixtureFile(data []byte) (FixtureFile, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return FixtureFile{}, err
+	}
+	normalized, err := json.Marshal(yamlutil.Normalize(document))
+	if err != nil {
+		return FixtureFile{}, err
+	}
+	var fixtureFile FixtureFile
+	if err := json.Unmarshal(normalized, &fixtureFile); err != nil {
+		return FixtureFile{}, err
+	}
+	return fixtureFile, nil
+}
+
+// A FixtureBackend serves canned responses, without any Go backend code.
+//
+// It is built from an aws-sdk-go service interface, which supplies the input
+// and output types of each action, and a list of fixtures.  Only the actions
+// named by the fixtures are implemented.  The first fixture that matches an
+// input supplies the response.
+type FixtureBackend struct {
+	api reflect.Type
+
+	lock     sync.RWMutex
+	fixtures []Fixture
+	actions  map[string]reflect.Value
+}
+
+// NewFixtureBackend returns a FixtureBackend for the service interface given
+// as a nil pointer, e.g.
+//
+//	awsfaker.NewFixtureBackend((*cloudformationiface.CloudFormationAPI)(nil), fixtures)
+func NewFixtureBackend(api interface{}, fixtures []Fixture) (*FixtureBackend, error) {
+	t := reflect.TypeOf(api)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Interface {
+		return nil, fmt.Errorf("expected a pointer to a service interface, got %T", api)
+	}
+	b := &FixtureBackend{api: t.Elem()}
+	if err := b.SetFixtures(fixtures); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// LoadFixtureBackend returns a FixtureBackend for the service interface,
+// with fixtures read from a YAML or JSON file
+func LoadFixtureBackend(api interface{}, path string) (*FixtureBackend, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fixtureFile, err := ParseFixtureFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse fixtures in %s: %s", path, err)
+	}
+	return NewFixtureBackend(api, fixtureFile.Fixtures)
+}
+
+// SetFixtures replaces the fixtures of the backend.  The actions that the
+// backend implements are fixed when it is passed to New, so fixtures for
+// other actions are not served after that.
+func (b *FixtureBackend) SetFixtures(fixtures []Fixture) error {
+	actions := map[string]reflect.Value{}
+	for _, fixture := range fixtures {
+		method, ok := b.api.MethodByName(fixture.Action)
+		if !ok || !isPlainAction(method) {
+			return fmt.Errorf("no action named %q in %s", fixture.Action, b.api)
+		}
+		if err := fixture.validate(method.Type.Out(0)); err != nil {
+			return err
+		}
+		actions[fixture.Action] = b.makeAction(fixture.Action, method.Type)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.fixtures = append([]Fixture(nil), fixtures...)
+	b.actions = actions
+	return nil
+}
+
+// Fixtures returns the fixtures of the backend
+func (b *FixtureBackend) Fixtures() []Fixture {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return append([]Fixture(nil), b.fixtures...)
+}
+
+// Actions returns a function for each action named by the fixtures
+func (b *FixtureBackend) Actions() map[string]reflect.Value {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	actions := make(map[string]reflect.Value, len(b.actions))
+	for name, action := range b.actions {
+		actions[name] = action
+	}
+	return actions
+}
+
+// isPlainAction reports whether an interface method looks like
+//
+//	SomeAction(*service.SomeActionInput) (*service.SomeActionOutput, error)
+func isPlainAction(method reflect.Method) bool {
+	t := method.Type
+	if t.NumIn() != 1 || t.NumOut() != 2 {
+		return false
+	}
+	input := t.In(0)
+	return input.Kind() == reflect.Ptr && input.Elem().Name() == method.Name+"Input" &&
+		t.Out(0).Kind() == reflect.Ptr && t.Out(1) == reflect.TypeOf((*error)(nil)).Elem()
+}
+
+func (b *FixtureBackend) makeAction(action string, funcType reflect.Type) reflect.Value {
+	outputType := funcType.Out(0)
+	return reflect.MakeFunc(funcType, func(args []reflect.Value) []reflect.Value {
+		output := reflect.Zero(outputType)
+		var err error
+
+		fixture, ok := b.find(action, args[0])
+		if ok {
+			output, err = fixture.respond(outputType)
+		} else {
+			err = &ErrorResponse{
+				AWSErrorCode:    "NoMatchingFixture",
+				AWSErrorMessage: fmt.Sprintf("awsfaker: no fixture for %s matches the input", action),
+				HTTPStatusCode:  http.StatusInternalServerError,
+			}
+		}
+		return []reflect.Value{output, reflect.ValueOf(&err).Elem()}
+	})
+}
+
+// respond returns the output or error given by the fixture, with the output
+// decoded into the given pointer type
+func (f Fixture) respond(outputType reflect.Type) (reflect.Value, error) {
+	if f.Error != nil {
+		errorResponse := *f.Error
+		if errorResponse.HTTPStatusCode == 0 {
+			errorResponse.HTTPStatusCode = http.StatusBadRequest
+		}
+		return reflect.Zero(outputType), &errorResponse
+	}
+	output := reflect.New(outputType.Elem())
+	if err := decodeDocument(f.Output, output.Elem()); err != nil {
+		return reflect.Zero(outputType), &ErrorResponse{
+			AWSErrorCode:    "InvalidFixture",
+			AWSErrorMessage: fmt.Sprintf("awsfaker: invalid output for %s: %s", f.Action, err),
+			HTTPStatusCode:  http.StatusInternalServerError,
+		}
+	}
+	return output, nil
+}
+
+// validate checks the match and output of the fixture, given the output
+// type of its action
+func (f Fixture) validate(outputType reflect.Type) error {
+	for path, expected := range f.Match {
+		if _, err := newFieldMatcher(path, expected); err != nil {
+			return fmt.Errorf("invalid match for %s: %s", f.Action, err)
+		}
+	}
+	if f.Error == nil {
+		if err := decodeDocument(f.Output, reflect.New(outputType.Elem()).Elem()); err != nil {
+			return fmt.Errorf("invalid output for %s: %s", f.Action, err)
+		}
+	} else if status := f.Error.HTTPStatusCode; status != 0 && (status < 300 || status > 599) {
+		return fmt.Errorf("invalid error for %s: HTTPStatusCode %d is not an error status", f.Action, status)
+	}
+	return nil
+}
+
+func (b *FixtureBackend) find(action string, input reflect.Value) (Fixture, bool) {
+	for _, fixture := range b.Fixtures() {
+		if fixture.Action == action && matches(fixture.Match, input) {
+			return fixture, true
+		}
+	}
+	return Fixture{}, false
+}
+
+func matches(match map[string]interface{}, input reflect.Value) bool {
+	for path, expected := range match {
+		matcher, err := newFieldMatcher(path, expected)
+		if err != nil || !matcher.matches(input) {
+			return false
+		}
+	}
+	return true
+}
+
+type fieldMatcher struct {
+	path     []string
+	expected interface{}
+	regex    *regexp.Regexp
+}
+
+var pathElementPattern = regexp.MustCompile(`[^.\[\]]+`)
+
+func newFieldMatcher(path string, expected interface{}) (fieldMatcher, error) {
+	m := fieldMatcher{path: pathElementPattern.FindAllString(path, -1), expected: expected}
+	if len(m.path) == 0 {
+		return m, fmt.Errorf("empty path")
+	}
+	if spec, ok := expected.(map[string]interface{}); ok {
+		pattern, ok := spec["regex"].(string)
+		if !ok || len(spec) != 1 {
+			return m, fmt.Errorf("expected a value or {regex: ...} for %s", path)
+		}
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return m, err
+		}
+		m.regex = regex
+	}
+	return m, nil
+}
+
+func (m fieldMatcher) matches(input reflect.Value) bool {
+	value, ok := lookup(input, m.path)
+	if !ok {
+		return m.expected == nil
+	}
+	actual := formatValue(value)
+	if m.regex != nil {
+		return m.regex.MatchString(actual)
+	}
+	return actual == formatExpected(m.expected)
+}
+
+// lookup follows a path of field names and list indices from a value,
+// dereferencing pointers on the way
+func lookup(value reflect.Value, path []string) (reflect.Value, bool) {
+	for _, element := range path {
+		for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+			if value.IsNil() {
+				return reflect.Value{}, false
+			}
+			value = value.Elem()
+		}
+		switch value.Kind() {
+		case reflect.Struct:
+			value = value.FieldByName(element)
+			if !value.IsValid() {
+				return reflect.Value{}, false
+			}
+		case reflect.Slice:
+			i, err := strconv.Atoi(element)
+			if err != nil || i < 0 || i >= value.Len() {
+				return reflect.Value{}, false
+			}
+			value = value.Index(i)
+		case reflect.Map:
+			value = value.MapIndex(reflect.ValueOf(element))
+			if !value.IsValid() {
+				return reflect.Value{}, false
+			}
+		default:
+			return reflect.Value{}, false
+		}
+	}
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return reflect.Value{}, false
+		}
+		value = value.Elem()
+	}
+	return value, true
+}
+
+func formatValue(value reflect.Value) string {
+	if t, ok := value.Interface().(time.Time); ok {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+func formatExpected(expected interface{}) string {
+	if f, ok := expected.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(expected)
+}
+
+// decodeDocument sets the fields of an aws-sdk-go struct from a document
+// decoded from JSON, keyed by Go field name
+func decodeDocument(document interface{}, value reflect.Value) error {
+	if document == nil {
+		return nil
+	}
+	if value.Kind() == reflect.Ptr {
+		element := reflect.New(value.Type().Elem())
+		if err := decodeDocument(document, element.Elem()); err != nil {
+			return err
+		}
+		value.Set(element)
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type() == reflect.TypeOf(time.Time{}) {
+			s, ok := document.(string)
+			if !ok {
+				return fmt.Errorf("expected an RFC 3339 timestamp, got %v", document)
+			}
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return err
+			}
+			value.Set(reflect.ValueOf(t.UTC()))
+			return nil
+		}
+		fields, ok := document.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected an object for %s, got %v", value.Type(), document)
+		}
+		for name, fieldDocument := range fields {
+			field := value.FieldByName(name)
+			if !field.IsValid() || !field.CanSet() {
+				return fmt.Errorf("no field %s in %s", name, value.Type())
+			}
+			if err := decodeDocument(fieldDocument, field); err != nil {
+				return fmt.Errorf("%s.%s: %s", value.Type().Name(), name, err)
+			}
+		}
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			s, ok := document.(string)
+			if !ok {
+				return fmt.Errorf("expected a string, got %v", document)
+			}
+			value.SetBytes([]byte(s))
+			return nil
+		}
+		elements, ok := document.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected a list, got %v", document)
+		}
+		list := reflect.MakeSlice(value.Type(), len(elements), len(elements))
+		for i, element := range elements {
+			if err := decodeDocument(element, list.Index(i)); err != nil {
+				return err
+			}
+		}
+		value.Set(list)
+	case reflect.Map:
+		entries, ok := document.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected an object, got %v", document)
+		}
+		m := reflect.MakeMap(value.Type())
+		for key, entry := range entries {
+			element := reflect.New(value.Type().Elem()).Elem()
+			if err := decodeDocument(entry, element); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(value.Type().Key()), element)
+		}
+		value.Set(m)
+	case reflect.String:
+		s, ok := document.(string)
+		if !ok {
+			s = formatExpected(document)
+		}
+		value.SetString(s)
+	case reflect.Bool:
+		b, ok := document.(bool)
+		if !ok {
+			return fmt.Errorf("expected a boolean, got %v", document)
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		f, ok := document.(float64)
+		if !ok || f != float64(int64(f)) {
+			return fmt.Errorf("expected an integer, got %v", document)
+		}
+		value.SetInt(int64(f))
+	case reflect.Float64:
+		f, ok := document.(float64)
+		if !ok {
+			return fmt.Errorf("expected a number, got %v", document)
+		}
+		value.SetFloat(f)
+	case reflect.Interface:
+		value.Set(reflect.ValueOf(document))
+	default:
+		return fmt.Errorf("unsupported field type %s", value.Type())
+	}
+	return nil
+}
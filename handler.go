@@ -0,0 +1,117 @@
+package awsfaker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+	"github.com/rosenhouse/awsfaker/journal"
+)
+
+// A Handler is an http.Handler that mimics an AWS service API
+type Handler struct {
+	// OnError, if set, is called with each failure that awsfaker detects
+	// itself, such as a request for an action that the backend does not
+	// implement, or a request that cannot be decoded.  The client receives an
+	// error response in the format of the service either way, so this is
+	// the place to fail a test that has outgrown its fake backend.
+	OnError func(error)
+
+	// Signatures, if set, checks the signature of each request before it
+	// reaches the backend
+	Signatures *SignatureVerifier
+
+	// Faults, if set, makes the handler misbehave on purpose
+	Faults *Faults
+
+	service *fakeService
+}
+
+func newServiceHandler(service *fakeService) *Handler {
+	h := &Handler{service: service}
+	service.handler.OnError = h.reportError
+	service.handler.Authenticate = h.authenticate
+	service.handler.InjectFault = h.injectFault
+	return h
+}
+
+// ServeHTTP dispatches a request to a backend method and writes the response
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.service.handler.ServeHTTP(w, r)
+}
+
+// Journal returns the record of every call that reached the backend, with
+// its input, its output or error, and the HTTP request
+func (h *Handler) Journal() *journal.Journal {
+	return h.service.handler.Journal
+}
+
+// A Panic records a panic recovered from a backend method.  The client
+// receives an InternalFailure error in its place.
+type Panic struct {
+	Action string
+	Value  interface{}
+	Stack  []byte
+}
+
+func (p Panic) String() string {
+	return fmt.Sprintf("%s panicked: %v\n%s", p.Action, p.Value, p.Stack)
+}
+
+// Panics returns the panics recovered from backend methods, in the order
+// they occurred
+func (h *Handler) Panics() []Panic {
+	return convertPanics(h.service.handler.Panics())
+}
+
+func convertPanics(recovered []dispatch.Panic) []Panic {
+	panics := make([]Panic, len(recovered))
+	for i, p := range recovered {
+		panics[i] = Panic{Action: p.Action, Value: p.Value, Stack: p.Stack}
+	}
+	return panics
+}
+
+func (h *Handler) authenticate(r *http.Request) *dispatch.ErrorResponse {
+	if h.Signatures == nil {
+		return nil
+	}
+	return h.Signatures.verify(r, h.service.name)
+}
+
+func (h *Handler) injectFault(w http.ResponseWriter, r *http.Request, action string) (*dispatch.ErrorResponse, bool) {
+	if h.Faults == nil {
+		return nil, false
+	}
+	return h.Faults.inject(w, r, action)
+}
+
+func (h *Handler) reportError(err error) {
+	if h.OnError != nil {
+		h.OnError(err)
+	}
+}
+
+// RequestInfo describes the request being served by a backend method.
+//
+// Backend methods that take a context.Context before their input, like the
+// WithContext variants of the aws-sdk-go clients, receive a context that
+// carries the RequestInfo and that is canceled if the client goes away.
+// The RequestID is also sent to the client in the response, so it can be
+// used to correlate the logs of the backend with those of the code under
+// test.
+type RequestInfo struct {
+	Request     *http.Request
+	Header      http.Header
+	AccessKeyID string
+	Region      string
+	RequestID   string
+}
+
+// RequestInfoFromContext returns the RequestInfo carried by the context
+// passed to a backend method
+func RequestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	info, ok := dispatch.RequestInfoFrom(ctx)
+	return RequestInfo(info), ok
+}
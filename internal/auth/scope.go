@@ -0,0 +1,56 @@
+// Package auth reads the AWS Signature Version 4 credential scope from
+// incoming requests.
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// A CredentialScope identifies the key and the date, region and service for
+// which a request was signed
+type CredentialScope struct {
+	AccessKeyID string
+	Date        string
+	Region      string
+	Service     string
+}
+
+// String returns the scope in the form used to compute signatures, e.g.
+// 20150830/us-east-1/iam/aws4_request
+func (s CredentialScope) String() string {
+	return strings.Join([]string{s.Date, s.Region, s.Service, "aws4_request"}, "/")
+}
+
+// ParseCredentialScope reads the credential scope from the Authorization
+// header, or from the X-Amz-Credential query parameter of a presigned URL
+func ParseCredentialScope(r *http.Request) (CredentialScope, bool) {
+	if credential := r.URL.Query().Get("X-Amz-Credential"); credential != "" {
+		return parseCredential(credential)
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 ") {
+		return CredentialScope{}, false
+	}
+	for _, part := range strings.Split(authorization[len("AWS4-HMAC-SHA256 "):], ",") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "Credential=") {
+			return parseCredential(part[len("Credential="):])
+		}
+	}
+	return CredentialScope{}, false
+}
+
+func parseCredential(credential string) (CredentialScope, bool) {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return CredentialScope{}, false
+	}
+	return CredentialScope{
+		AccessKeyID: parts[0],
+		Date:        parts[1],
+		Region:      parts[2],
+		Service:     parts[3],
+	}, true
+}
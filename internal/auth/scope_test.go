@@ -0,0 +1,52 @@
+package auth_test
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rosenhouse/awsfaker/internal/auth"
+)
+
+var _ = Describe("Parsing the credential scope", func() {
+	var request *http.Request
+
+	BeforeEach(func() {
+		var err error
+		request, err = http.NewRequest("GET", "http://example.com/", nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should read the Authorization header", func() {
+		request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=some-access-key/20150830/us-east-1/iam/aws4_request, SignedHeaders=host;x-amz-date, Signature=abc123")
+
+		scope, ok := auth.ParseCredentialScope(request)
+		Expect(ok).To(BeTrue())
+		Expect(scope).To(Equal(auth.CredentialScope{
+			AccessKeyID: "some-access-key",
+			Date:        "20150830",
+			Region:      "us-east-1",
+			Service:     "iam",
+		}))
+		Expect(scope.String()).To(Equal("20150830/us-east-1/iam/aws4_request"))
+	})
+
+	It("should read the query string of presigned URLs", func() {
+		request.URL.RawQuery = "X-Amz-Credential=some-access-key%2F20150830%2Fus-west-2%2Fs3%2Faws4_request"
+
+		scope, ok := auth.ParseCredentialScope(request)
+		Expect(ok).To(BeTrue())
+		Expect(scope.Service).To(Equal("s3"))
+		Expect(scope.Region).To(Equal("us-west-2"))
+	})
+
+	It("should report unsigned requests", func() {
+		_, ok := auth.ParseCredentialScope(request)
+		Expect(ok).To(BeFalse())
+
+		request.Header.Set("Authorization", "AWS some-access-key:signature")
+		_, ok = auth.ParseCredentialScope(request)
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm = "AWS4-HMAC-SHA256"
+
+	// TimeFormat is the format of the X-Amz-Date of a signed request
+	TimeFormat = "20060102T150405Z"
+
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	streamingPayload = "STREAMING-"
+)
+
+// ErrUnsigned is returned by ParseSignature for a request without any
+// signature
+var ErrUnsigned = errors.New("request is not signed")
+
+// A Signature is the AWS Signature Version 4 carried by a request, either in
+// its Authorization header or, for a presigned URL, in its query string
+type Signature struct {
+	Scope         CredentialScope
+	SignedHeaders []string
+	Signature     string
+	Date          time.Time
+	SecurityToken string
+
+	// Expires is the lifetime of a presigned URL, and zero otherwise
+	Expires time.Duration
+	// Presigned is set if the signature is in the query string
+	Presigned bool
+}
+
+// ParseSignature reads the signature of the request.  It returns ErrUnsigned
+// if the request carries no signature at all.
+func ParseSignature(r *http.Request) (Signature, error) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "" || query.Get("X-Amz-Signature") != "" {
+		return parsePresigned(r, query)
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return Signature{}, ErrUnsigned
+	}
+	if !strings.HasPrefix(authorization, algorithm+" ") {
+		return Signature{}, fmt.Errorf("unsupported authorization scheme: %s", strings.SplitN(authorization, " ", 2)[0])
+	}
+
+	s := Signature{SecurityToken: r.Header.Get("X-Amz-Security-Token")}
+	var credential string
+	for _, part := range strings.Split(authorization[len(algorithm)+1:], ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case strings.HasPrefix(part, "Credential="):
+			credential = part[len("Credential="):]
+		case strings.HasPrefix(part, "SignedHeaders="):
+			s.SignedHeaders = strings.Split(part[len("SignedHeaders="):], ";")
+		case strings.HasPrefix(part, "Signature="):
+			s.Signature = part[len("Signature="):]
+		}
+	}
+
+	date := r.Header.Get("X-Amz-Date")
+	if date == "" {
+		date = r.Header.Get("Date")
+	}
+	return s, s.complete(credential, date)
+}
+
+func parsePresigned(r *http.Request, query url.Values) (Signature, error) {
+	if query.Get("X-Amz-Algorithm") != algorithm {
+		return Signature{}, fmt.Errorf("unsupported algorithm: %s", query.Get("X-Amz-Algorithm"))
+	}
+	s := Signature{
+		SignedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+		Signature:     query.Get("X-Amz-Signature"),
+		SecurityToken: query.Get("X-Amz-Security-Token"),
+		Presigned:     true,
+	}
+	if expires := query.Get("X-Amz-Expires"); expires != "" {
+		seconds, err := strconv.Atoi(expires)
+		if err != nil {
+			return Signature{}, fmt.Errorf("invalid X-Amz-Expires: %s", expires)
+		}
+		s.Expires = time.Duration(seconds) * time.Second
+	}
+	return s, s.complete(query.Get("X-Amz-Credential"), query.Get("X-Amz-Date"))
+}
+
+func (s *Signature) complete(credential, date string) error {
+	scope, ok := parseCredential(credential)
+	if !ok {
+		return fmt.Errorf("invalid credential: %q", credential)
+	}
+	s.Scope = scope
+	if s.Signature == "" || len(s.SignedHeaders) == 0 || s.SignedHeaders[0] == "" {
+		return errors.New("signature is incomplete")
+	}
+
+	t, err := time.Parse(TimeFormat, date)
+	if err != nil {
+		t, err = time.Parse(time.RFC1123, date)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid date: %q", date)
+	}
+	s.Date = t.UTC()
+	return nil
+}
+
+// Compute returns the signature that the request should carry, given the
+// secret key for the scope of the signature and the request body.
+//
+// Most services sign the path of the request URI escaped a second time.
+// Pass escapePath false for S3, which signs the path as sent.
+func (s Signature) Compute(r *http.Request, body []byte, secretAccessKey string, escapePath bool) string {
+	stringToSign := strings.Join([]string{
+		algorithm,
+		s.Date.Format(TimeFormat),
+		s.Scope.String(),
+		hashHex([]byte(s.canonicalRequest(r, body, escapePath))),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), s.Scope.Date)
+	key = hmacSHA256(key, s.Scope.Region)
+	key = hmacSHA256(key, s.Scope.Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// Matches reports whether the request carries the signature that it should.
+// See Compute.
+func (s Signature) Matches(r *http.Request, body []byte, secretAccessKey string, escapePath bool) bool {
+	expected := s.Compute(r, body, secretAccessKey, escapePath)
+	return hmac.Equal([]byte(expected), []byte(s.Signature))
+}
+
+func (s Signature) canonicalRequest(r *http.Request, body []byte, escapePath bool) string {
+	return strings.Join([]string{
+		r.Method,
+		canonicalURI(r, escapePath),
+		s.canonicalQuery(r),
+		s.canonicalHeaders(r),
+		strings.Join(s.SignedHeaders, ";"),
+		s.payloadHash(r, body),
+	}, "\n")
+}
+
+// canonicalURI returns the escaped path of the request
+func canonicalURI(r *http.Request, escapePath bool) string {
+	uri := r.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	if escapePath {
+		uri = escapeURIPath(uri)
+	}
+	return uri
+}
+
+// escapeURIPath escapes all but the unreserved characters and slashes
+func escapeURIPath(path string) string {
+	var escaped bytes.Buffer
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if isUnreserved(c) || c == '/' {
+			escaped.WriteByte(c)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '_' || c == '.' || c == '~'
+}
+
+func (s Signature) canonicalQuery(r *http.Request) string {
+	query := r.URL.Query()
+	if s.Presigned {
+		query.Del("X-Amz-Signature")
+	}
+	return strings.Replace(query.Encode(), "+", "%20", -1)
+}
+
+func (s Signature) canonicalHeaders(r *http.Request) string {
+	var lines []string
+	for _, name := range s.SignedHeaders {
+		var values []string
+		switch name {
+		case "host":
+			values = []string{r.Host}
+		case "content-length":
+			values = r.Header["Content-Length"]
+			if len(values) == 0 {
+				values = []string{strconv.FormatInt(r.ContentLength, 10)}
+			}
+		default:
+			values = r.Header[http.CanonicalHeaderKey(name)]
+		}
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		lines = append(lines, name+":"+strings.Join(trimmed, ","))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ContentHashMatches reports whether the X-Amz-Content-Sha256 header of the
+// request, if it carries the hash of the payload, is the hash of the body.
+// The signature covers the header rather than the body, so a body that does
+// not match would otherwise go unnoticed.
+func ContentHashMatches(r *http.Request, body []byte) bool {
+	hash := r.Header.Get("X-Amz-Content-Sha256")
+	if hash == "" || hash == unsignedPayload || strings.HasPrefix(hash, streamingPayload) {
+		return true
+	}
+	return strings.ToLower(hash) == hashHex(body)
+}
+
+func (s Signature) payloadHash(r *http.Request, body []byte) string {
+	if hash := r.Header.Get("X-Amz-Content-Sha256"); hash != "" {
+		return hash
+	}
+	if s.Presigned && s.Scope.Service == "s3" {
+		return unsignedPayload
+	}
+	return hashHex(body)
+}
+
+func hashHex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,96 @@
+package auth_test
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rosenhouse/awsfaker/internal/auth"
+)
+
+var _ = Describe("Verifying signatures", func() {
+	const secretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+
+	var request *http.Request
+
+	// the example request from the AWS General Reference for Signature Version 4
+	BeforeEach(func() {
+		var err error
+		request, err = http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		request.Header.Set("X-Amz-Date", "20150830T123600Z")
+		request.Header.Set("Authorization", "AWS4-HMAC-SHA256 "+
+			"Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+			"SignedHeaders=content-type;host;x-amz-date, "+
+			"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7")
+	})
+
+	It("should parse the signature", func() {
+		signature, err := auth.ParseSignature(request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signature.Scope.AccessKeyID).To(Equal("AKIDEXAMPLE"))
+		Expect(signature.SignedHeaders).To(Equal([]string{"content-type", "host", "x-amz-date"}))
+		Expect(signature.Date).To(Equal(time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)))
+		Expect(signature.Presigned).To(BeFalse())
+	})
+
+	It("should compute the same signature as AWS", func() {
+		signature, err := auth.ParseSignature(request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signature.Compute(request, nil, secretAccessKey, true)).To(Equal(signature.Signature))
+		Expect(signature.Matches(request, nil, secretAccessKey, true)).To(BeTrue())
+	})
+
+	It("should detect a wrong secret or a modified request", func() {
+		signature, err := auth.ParseSignature(request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signature.Matches(request, nil, "some-other-secret", true)).To(BeFalse())
+
+		request.URL.RawQuery = "Action=DeleteUser&Version=2010-05-08"
+		Expect(signature.Matches(request, nil, secretAccessKey, true)).To(BeFalse())
+	})
+
+	It("should check the body against its hash in X-Amz-Content-Sha256", func() {
+		body := []byte("some body")
+		Expect(auth.ContentHashMatches(request, body)).To(BeTrue())
+
+		request.Header.Set("X-Amz-Content-Sha256", "5f483264496cf1440c6ef569cc4fb9785d3bed896efdadfc998e9cb1badcec81")
+		Expect(auth.ContentHashMatches(request, body)).To(BeTrue())
+		Expect(auth.ContentHashMatches(request, []byte("some other body"))).To(BeFalse())
+
+		request.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+		Expect(auth.ContentHashMatches(request, body)).To(BeTrue())
+
+		request.Header.Set("X-Amz-Content-Sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+		Expect(auth.ContentHashMatches(request, body)).To(BeTrue())
+	})
+
+	It("should report unsigned requests", func() {
+		request.Header.Del("Authorization")
+		_, err := auth.ParseSignature(request)
+		Expect(err).To(Equal(auth.ErrUnsigned))
+	})
+
+	It("should report incomplete signatures", func() {
+		request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request")
+		_, err := auth.ParseSignature(request)
+		Expect(err).To(MatchError("signature is incomplete"))
+	})
+
+	It("should read presigned URLs", func() {
+		request.Header.Del("Authorization")
+		request.URL.RawQuery = "X-Amz-Algorithm=AWS4-HMAC-SHA256" +
+			"&X-Amz-Credential=AKIDEXAMPLE%2F20150830%2Fus-east-1%2Fs3%2Faws4_request" +
+			"&X-Amz-Date=20150830T123600Z&X-Amz-Expires=900&X-Amz-SignedHeaders=host&X-Amz-Signature=abc123"
+
+		signature, err := auth.ParseSignature(request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signature.Presigned).To(BeTrue())
+		Expect(signature.Expires).To(Equal(15 * time.Minute))
+		Expect(signature.Scope.Service).To(Equal("s3"))
+		Expect(signature.Signature).To(Equal("abc123"))
+	})
+})
@@ -1,34 +1,126 @@
 package detect
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 )
 
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
 func getShortPkgPath(t reflect.Type) string {
 	parts := strings.Split(t.PkgPath(), "/")
 	return parts[len(parts)-1]
 }
 
+// GetServiceName returns the short name of the aws-sdk-go service package,
+// e.g. "cloudformation", whose input types are taken by the backend methods.
+//
+// Methods that don't look like actions are ignored, but it is an error for
+// the backend to have no actions, or for its actions to take input types from
+// more than one service package.
 func GetServiceName(serviceBackend interface{}) (string, error) {
 	t := reflect.TypeOf(serviceBackend)
 	if t == nil {
 		return "", fmt.Errorf("expected non-nil service backend")
 	}
+	if dynamic, ok := serviceBackend.(dynamicBackend); ok {
+		return getServiceNameForActions(dynamic.Actions())
+	}
 	if t.Kind() != reflect.Ptr {
 		return "", fmt.Errorf("expected pointer type")
 	}
 	if t.NumMethod() == 0 {
 		return "", fmt.Errorf("no methods found")
 	}
-	methodType := t.Method(0).Type
-	if methodType.NumIn() != 2 {
+
+	var firstErr error
+	methodsByService := map[string][]string{}
+	for i := 0; i < t.NumMethod(); i++ {
+		method := t.Method(i)
+		serviceName, err := getServiceNameForMethod(method.Type)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		methodsByService[serviceName] = append(methodsByService[serviceName], method.Name)
+	}
+
+	return chooseServiceName(methodsByService, firstErr)
+}
+
+// dynamicBackend matches dispatch.DynamicBackend
+type dynamicBackend interface {
+	Actions() map[string]reflect.Value
+}
+
+func getServiceNameForActions(actions map[string]reflect.Value) (string, error) {
+	var firstErr error
+	methodsByService := map[string][]string{}
+	for name, value := range actions {
+		if value.Kind() != reflect.Func {
+			continue
+		}
+		serviceName, err := getServiceNameForFunc(value.Type(), 0)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		methodsByService[serviceName] = append(methodsByService[serviceName], name)
+	}
+	if len(methodsByService) == 0 && firstErr == nil {
+		firstErr = fmt.Errorf("no actions found")
+	}
+	return chooseServiceName(methodsByService, firstErr)
+}
+
+func chooseServiceName(methodsByService map[string][]string, firstErr error) (string, error) {
+	switch len(methodsByService) {
+	case 0:
+		return "", firstErr
+	case 1:
+		for serviceName := range methodsByService {
+			return serviceName, nil
+		}
+	}
+
+	descriptions := []string{}
+	for serviceName, methodNames := range methodsByService {
+		sort.Strings(methodNames)
+		descriptions = append(descriptions,
+			fmt.Sprintf("%s (%s)", serviceName, strings.Join(methodNames, ", ")))
+	}
+	sort.Strings(descriptions)
+	return "", fmt.Errorf("expected all methods to take inputs from a single service package, instead got: %s",
+		strings.Join(descriptions, "; "))
+}
+
+func getServiceNameForMethod(methodType reflect.Type) (string, error) {
+	return getServiceNameForFunc(methodType, 1)
+}
+
+// getServiceNameForFunc checks the signature of an action, given the number
+// of leading receiver arguments: 1 for a method, 0 for a plain function
+func getServiceNameForFunc(methodType reflect.Type, receivers int) (string, error) {
+	takesContext := methodType.NumIn() == receivers+2 && methodType.In(receivers) == contextType
+	if methodType.NumIn() != receivers+1 && !takesContext {
+		if receivers == 0 {
+			return "", fmt.Errorf("expected function with single argument, instead got: %+v", methodType)
+		}
 		return "", fmt.Errorf(
 			"expected method with receiver plus single argument, instead got: %+v",
 			methodType)
 	}
-	argType := methodType.In(1)
+	argType := methodType.In(methodType.NumIn() - 1)
 	if argType.Kind() != reflect.Ptr {
 		return "", fmt.Errorf("expected argument to be pointer type")
 	}
@@ -38,9 +130,27 @@ func GetServiceName(serviceBackend interface{}) (string, error) {
 		return "", fmt.Errorf("expected argument to be pointer to non-basic type")
 	}
 
+	if methodType.NumOut() != 2 || methodType.Out(1) != errorType {
+		return "", fmt.Errorf("expected method to return a result and an error, instead got: %+v", methodType)
+	}
+
 	return pkgPath, nil
 }
 
+// GetProtocol returns the name of the AWS protocol, e.g. "query" or
+// "jsonrpc", used by the service that the backend fakes
+func GetProtocol(serviceBackend interface{}) (string, error) {
+	serviceName, err := GetServiceName(serviceBackend)
+	if err != nil {
+		return "", err
+	}
+	return getProtocol(serviceName)
+}
+
 func getProtocol(serviceName string) (string, error) {
-	return "", nil
+	protocol, ok := ProtocolForService[serviceName]
+	if !ok {
+		return "", fmt.Errorf("no known protocol for service %q", serviceName)
+	}
+	return protocol, nil
 }
@@ -1,11 +1,16 @@
 package detect_test
 
 import (
+	"bytes"
+	"context"
 	"strings"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
 	"github.com/rosenhouse/awsfaker/internal/detect"
 )
 
@@ -43,11 +48,55 @@ func (n *TypeWithMethodWithArgNotAPointer) SomeServiceCall(strings.Reader) (*str
 	return nil, nil
 }
 
+type TypeWithHelperMethod struct{}
+
+func (n *TypeWithHelperMethod) Reset() {}
+
+func (n *TypeWithHelperMethod) SomeServiceCall(*strings.Reader) (*strings.Reader, error) {
+	return nil, nil
+}
+
+type TypeWithContextMethod struct{}
+
+func (n *TypeWithContextMethod) SomeServiceCall(context.Context, *strings.Reader) (*strings.Reader, error) {
+	return nil, nil
+}
+
+type TypeWithMethodsFromSeveralPackages struct{}
+
+func (n *TypeWithMethodsFromSeveralPackages) SomeServiceCall(*strings.Reader) (*strings.Reader, error) {
+	return nil, nil
+}
+
+func (n *TypeWithMethodsFromSeveralPackages) OtherServiceCall(*bytes.Reader) (*bytes.Reader, error) {
+	return nil, nil
+}
+
+type CloudFormationBackend struct{}
+
+func (b *CloudFormationBackend) DescribeStacks(*cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	return nil, nil
+}
+
+type DynamoDBBackend struct{}
+
+func (b *DynamoDBBackend) GetItem(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return nil, nil
+}
+
 var _ = Describe("Detecting the service name", func() {
 	It("should return the short name of the package containing the type of the first argument", func() {
 		Expect(detect.GetServiceName(new(SomeServiceBackend))).To(Equal("strings"))
 	})
 
+	It("should accept methods that take a context before the input", func() {
+		Expect(detect.GetServiceName(new(TypeWithContextMethod))).To(Equal("strings"))
+	})
+
+	It("should ignore methods that don't look like actions", func() {
+		Expect(detect.GetServiceName(new(TypeWithHelperMethod))).To(Equal("strings"))
+	})
+
 	Context("when given bad inputs", func() {
 
 		Context("when given a nil interface value", func() {
@@ -97,5 +146,33 @@ var _ = Describe("Detecting the service name", func() {
 				Expect(err).To(MatchError("expected argument to be pointer to non-basic type"))
 			})
 		})
+
+		Context("when the methods take inputs from several packages", func() {
+			It("should return an error naming the packages", func() {
+				_, err := detect.GetServiceName(&TypeWithMethodsFromSeveralPackages{})
+				Expect(err).To(MatchError("expected all methods to take inputs from a single service package, instead got: bytes (OtherServiceCall); strings (SomeServiceCall)"))
+			})
+		})
+	})
+})
+
+var _ = Describe("Detecting the protocol", func() {
+	It("should return the protocol used by the service", func() {
+		Expect(detect.GetProtocol(&CloudFormationBackend{})).To(Equal("query"))
+		Expect(detect.GetProtocol(&DynamoDBBackend{})).To(Equal("jsonrpc"))
+	})
+
+	Context("when the service is not known", func() {
+		It("should return an error", func() {
+			_, err := detect.GetProtocol(&SomeServiceBackend{})
+			Expect(err).To(MatchError(`no known protocol for service "strings"`))
+		})
+	})
+
+	Context("when the service cannot be determined", func() {
+		It("should return an error", func() {
+			_, err := detect.GetProtocol(SomeServiceBackend{})
+			Expect(err).To(MatchError("expected pointer type"))
+		})
 	})
 })
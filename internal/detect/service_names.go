@@ -0,0 +1,56 @@
+package detect
+
+// SigningName returns the name that the service uses in the credential scope
+// of its request signatures
+func SigningName(serviceName string) string {
+	if signingName, ok := signingNames[serviceName]; ok {
+		return signingName
+	}
+	return serviceName
+}
+
+// EndpointPrefix returns the first part of the host name of the service's
+// default endpoints, e.g. "monitoring" for monitoring.us-east-1.amazonaws.com
+func EndpointPrefix(serviceName string) string {
+	if endpointPrefix, ok := endpointPrefixes[serviceName]; ok {
+		return endpointPrefix
+	}
+	return serviceName
+}
+
+// signingNames lists services whose signing name is not their package name
+var signingNames = map[string]string{
+	"cloudsearchdomain":    "cloudsearch",
+	"cloudwatch":           "monitoring",
+	"cloudwatchlogs":       "logs",
+	"cognitoidentity":      "cognito-identity",
+	"cognitosync":          "cognito-sync",
+	"configservice":        "config",
+	"directoryservice":     "ds",
+	"dynamodbstreams":      "dynamodb",
+	"efs":                  "elasticfilesystem",
+	"elasticsearchservice": "es",
+	"elb":                  "elasticloadbalancing",
+	"emr":                  "elasticmapreduce",
+	"iot":                  "execute-api",
+	"iotdataplane":         "iotdata",
+	"simpledb":             "sdb",
+}
+
+// endpointPrefixes lists services whose endpoint prefix is not their package name
+var endpointPrefixes = map[string]string{
+	"cloudwatch":           "monitoring",
+	"cloudwatchlogs":       "logs",
+	"cognitoidentity":      "cognito-identity",
+	"cognitosync":          "cognito-sync",
+	"configservice":        "config",
+	"directoryservice":     "ds",
+	"dynamodbstreams":      "streams.dynamodb",
+	"efs":                  "elasticfilesystem",
+	"elasticsearchservice": "es",
+	"elb":                  "elasticloadbalancing",
+	"emr":                  "elasticmapreduce",
+	"iotdataplane":         "data.iot",
+	"ses":                  "email",
+	"simpledb":             "sdb",
+}
@@ -0,0 +1,171 @@
+// Package dispatch routes requests to the methods of a fake service backend.
+//
+// It is shared by the protocol packages.  Each protocol supplies a Codec that
+// knows how to read the action name and input from an HTTP request and how to
+// write outputs and errors in that protocol's wire format.
+package dispatch
+
+import (
+	"context"
+	"reflect"
+	"sort"
+)
+
+// A Backend holds the actions implemented by a fake service backend
+type Backend struct {
+	actions map[string]Method
+}
+
+// A DynamicBackend provides its actions as function values, keyed by action
+// name, rather than as methods.  Each function has the signature of an action
+// method, without the receiver.
+type DynamicBackend interface {
+	Actions() map[string]reflect.Value
+}
+
+// NewBackend registers the methods of the given service backend as actions,
+// or the actions of a DynamicBackend.
+//
+// It panics if the backend is not a non-nil pointer with at least one method
+// that looks like an action.  Other methods are ignored.
+func NewBackend(serviceBackend interface{}) *Backend {
+	if dynamic, ok := serviceBackend.(DynamicBackend); ok {
+		return newDynamicBackend(dynamic)
+	}
+
+	service := reflect.ValueOf(serviceBackend)
+	if !service.IsValid() {
+		panic("invalid service interface")
+	}
+	if service.Kind() != reflect.Ptr {
+		panic("expecting struct pointer as service interface")
+	}
+	if !service.Elem().IsValid() {
+		panic("expecting non-nil pointer as service interface")
+	}
+	serviceType := service.Type()
+	n := service.NumMethod()
+	if n == 0 {
+		panic("no methods on service interface")
+	}
+
+	b := &Backend{actions: make(map[string]Method)}
+	for i := 0; i < n; i++ {
+		if !isAction(service.Method(i).Type()) {
+			continue // ignore helper methods
+		}
+		name := serviceType.Method(i).Name
+		b.actions[name] = Method{Name: name, value: service.Method(i)}
+	}
+	if len(b.actions) == 0 {
+		panic("no action methods on service interface")
+	}
+	return b
+}
+
+func newDynamicBackend(dynamic DynamicBackend) *Backend {
+	b := &Backend{actions: make(map[string]Method)}
+	for name, value := range dynamic.Actions() {
+		if value.Kind() != reflect.Func || !isAction(value.Type()) {
+			continue
+		}
+		b.actions[name] = Method{Name: name, value: value}
+	}
+	if len(b.actions) == 0 {
+		panic("no actions on dynamic backend")
+	}
+	return b
+}
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// isAction reports whether a method has the signature of an action:
+// a single struct pointer argument, optionally preceded by a context, and a
+// result plus an error
+func isAction(methodType reflect.Type) bool {
+	if methodType.NumOut() != 2 || methodType.Out(1) != errorType {
+		return false
+	}
+	switch methodType.NumIn() {
+	case 1:
+	case 2:
+		if methodType.In(0) != contextType {
+			return false
+		}
+	default:
+		return false
+	}
+	input := methodType.In(methodType.NumIn() - 1)
+	return input.Kind() == reflect.Ptr && input.Elem().Kind() == reflect.Struct
+}
+
+// Method returns the backend method for the named action
+func (b *Backend) Method(action string) (Method, bool) {
+	method, ok := b.actions[action]
+	return method, ok
+}
+
+// Methods returns all of the backend methods, sorted by name
+func (b *Backend) Methods() []Method {
+	names := make([]string, 0, len(b.actions))
+	for name := range b.actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	methods := make([]Method, len(names))
+	for i, name := range names {
+		methods[i] = b.actions[name]
+	}
+	return methods
+}
+
+// A Method is a single action on a backend, with a signature like
+//
+//	func (b *MyBackend) SomeAction(input *service.SomeActionInput) (*service.SomeActionOutput, error)
+//
+// or, to receive the context of the request,
+//
+//	func (b *MyBackend) SomeAction(ctx context.Context, input *service.SomeActionInput) (*service.SomeActionOutput, error)
+type Method struct {
+	Name  string
+	value reflect.Value
+}
+
+// InputType returns the struct type that the method takes a pointer to
+func (m Method) InputType() reflect.Type {
+	methodType := m.value.Type()
+	return methodType.In(methodType.NumIn() - 1).Elem()
+}
+
+// OutputType returns the pointer type of the output of the method
+func (m Method) OutputType() reflect.Type {
+	return m.value.Type().Out(0)
+}
+
+// TakesContext reports whether the method takes a context.Context
+func (m Method) TakesContext() bool {
+	return m.value.Type().NumIn() == 2
+}
+
+// NewInput returns a pointer to a new, zero-valued input struct for the method
+func (m Method) NewInput() interface{} {
+	return reflect.New(m.InputType()).Interface()
+}
+
+// Call invokes the backend method, passing the context only if the method
+// takes one
+func (m Method) Call(ctx context.Context, input interface{}) (interface{}, error) {
+	args := []reflect.Value{reflect.ValueOf(input)}
+	if m.TakesContext() {
+		args = append([]reflect.Value{reflect.ValueOf(&ctx).Elem()}, args...)
+	}
+	results := m.value.Call(args)
+	if errVal := results[1].Interface(); errVal != nil {
+		return nil, errVal.(error)
+	}
+	return results[0].Interface(), nil
+}
@@ -0,0 +1,152 @@
+package dispatch_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+)
+
+type SomeBackend struct {
+	Receives *strings.Reader
+}
+
+func (b *SomeBackend) SomeAction(input *strings.Reader) (*strings.Reader, error) {
+	b.Receives = input
+	return strings.NewReader("some output"), nil
+}
+
+func (b *SomeBackend) OtherAction(input *strings.Reader) (*strings.Reader, error) {
+	return nil, errors.New("some error")
+}
+
+func (b *SomeBackend) Reset() {
+	b.Receives = nil
+}
+
+type SomeServiceBackendWithoutActions struct{}
+
+func (b *SomeServiceBackendWithoutActions) Reset() {}
+
+var _ = Describe("Registering a backend", func() {
+	var backend *SomeBackend
+
+	BeforeEach(func() {
+		backend = &SomeBackend{}
+	})
+
+	It("should register every action method, ignoring helper methods", func() {
+		methods := dispatch.NewBackend(backend).Methods()
+		Expect(methods).To(HaveLen(2))
+		Expect(methods[0].Name).To(Equal("OtherAction"))
+		Expect(methods[1].Name).To(Equal("SomeAction"))
+	})
+
+	It("should construct inputs of the right type and call the method", func() {
+		method, ok := dispatch.NewBackend(backend).Method("SomeAction")
+		Expect(ok).To(BeTrue())
+
+		input := method.NewInput()
+		Expect(input).To(BeAssignableToTypeOf(&strings.Reader{}))
+
+		output, err := method.Call(context.Background(), input)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(Equal(strings.NewReader("some output")))
+		Expect(backend.Receives).To(BeIdenticalTo(input))
+	})
+
+	It("should return errors from the method", func() {
+		method, _ := dispatch.NewBackend(backend).Method("OtherAction")
+		_, err := method.Call(context.Background(), method.NewInput())
+		Expect(err).To(MatchError("some error"))
+	})
+
+	It("should report missing actions", func() {
+		_, ok := dispatch.NewBackend(backend).Method("MissingAction")
+		Expect(ok).To(BeFalse())
+	})
+
+	Context("when given bad inputs", func() {
+		It("should panic", func() {
+			Expect(func() { dispatch.NewBackend(nil) }).To(Panic())
+			Expect(func() { dispatch.NewBackend(SomeBackend{}) }).To(Panic())
+			Expect(func() { dispatch.NewBackend((*SomeBackend)(nil)) }).To(Panic())
+			Expect(func() { dispatch.NewBackend(&struct{}{}) }).To(Panic())
+			Expect(func() { dispatch.NewBackend(&SomeServiceBackendWithoutActions{}) }).To(Panic())
+		})
+	})
+})
+
+type SomeContextBackend struct {
+	ReceivesContext context.Context
+}
+
+func (b *SomeContextBackend) SomeAction(ctx context.Context, input *strings.Reader) (*strings.Reader, error) {
+	b.ReceivesContext = ctx
+	return strings.NewReader("some output"), nil
+}
+
+func (b *SomeContextBackend) NotAnAction(notContext *strings.Reader, input *strings.Reader) (*strings.Reader, error) {
+	return nil, nil
+}
+
+var _ = Describe("Registering a backend with context-aware methods", func() {
+	It("should register methods that take a context before the input", func() {
+		methods := dispatch.NewBackend(&SomeContextBackend{}).Methods()
+		Expect(methods).To(HaveLen(1))
+		Expect(methods[0].Name).To(Equal("SomeAction"))
+		Expect(methods[0].TakesContext()).To(BeTrue())
+		Expect(methods[0].InputType()).To(Equal(reflect.TypeOf(strings.Reader{})))
+	})
+
+	It("should pass the context to the method", func() {
+		backend := &SomeContextBackend{}
+		method, _ := dispatch.NewBackend(backend).Method("SomeAction")
+
+		ctx := context.WithValue(context.Background(), "some-key", "some-value")
+		_, err := method.Call(ctx, method.NewInput())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backend.ReceivesContext).To(Equal(ctx))
+	})
+})
+
+type SomeErrorResponse struct {
+	AWSErrorCode    string
+	AWSErrorMessage string
+	HTTPStatusCode  int
+}
+
+func (e *SomeErrorResponse) Error() string { return e.AWSErrorCode }
+
+var _ = Describe("Converting backend errors", func() {
+	It("should copy fields that match by name", func() {
+		err := &SomeErrorResponse{
+			AWSErrorCode:    "SomeCode",
+			AWSErrorMessage: "some message",
+			HTTPStatusCode:  418,
+		}
+		Expect(dispatch.ToErrorResponse(err)).To(Equal(dispatch.ErrorResponse{
+			AWSErrorCode:    "SomeCode",
+			AWSErrorMessage: "some message",
+			HTTPStatusCode:  418,
+		}))
+	})
+
+	It("should fill in defaults for other errors", func() {
+		Expect(dispatch.ToErrorResponse(errors.New("some error"))).To(Equal(dispatch.ErrorResponse{
+			AWSErrorCode:    "[awsfaker missing error code]",
+			AWSErrorMessage: "[awsfaker missing error message]",
+			HTTPStatusCode:  500,
+		}))
+	})
+
+	It("should replace a missing status with 500", func() {
+		err := &SomeErrorResponse{AWSErrorCode: "SomeCode", AWSErrorMessage: "some message"}
+		Expect(dispatch.ToErrorResponse(err).HTTPStatusCode).To(Equal(500))
+	})
+})
@@ -0,0 +1,41 @@
+package dispatch
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rosenhouse/awsfaker/internal/auth"
+)
+
+// RequestInfo describes the request being served by a backend method
+type RequestInfo struct {
+	Request     *http.Request
+	Header      http.Header
+	AccessKeyID string
+	Region      string
+	RequestID   string
+}
+
+type requestInfoKey struct{}
+
+// newContext returns a context for a backend method call, carrying the
+// RequestInfo and canceled when the client goes away
+func newContext(r *http.Request, requestID string) context.Context {
+	info := RequestInfo{
+		Request:   r,
+		Header:    r.Header,
+		RequestID: requestID,
+	}
+	if scope, ok := auth.ParseCredentialScope(r); ok {
+		info.AccessKeyID = scope.AccessKeyID
+		info.Region = scope.Region
+	}
+	return context.WithValue(r.Context(), requestInfoKey{}, info)
+}
+
+// RequestInfoFrom returns the RequestInfo carried by the context of a
+// backend method call
+func RequestInfoFrom(ctx context.Context) (RequestInfo, bool) {
+	info, ok := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info, ok
+}
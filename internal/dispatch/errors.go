@@ -0,0 +1,63 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// An ErrorResponse carries the same fields as awsfaker.ErrorResponse, which
+// this package cannot import.  Codecs specialize it into the error format of
+// their protocol.
+type ErrorResponse struct {
+	AWSErrorCode    string
+	AWSErrorMessage string
+	HTTPStatusCode  int
+}
+
+// Error lets a Codec return an ErrorResponse from its decode function, to
+// respond to an invalid input with a specific error
+func (e *ErrorResponse) Error() string {
+	return fmt.Sprintf("%s: %s", e.AWSErrorCode, e.AWSErrorMessage)
+}
+
+func errCopy(src interface{}, dst interface{}) {
+	srcBytes, err := json.Marshal(src)
+	if err != nil {
+		panic(err)
+	}
+
+	err = json.Unmarshal(srcBytes, dst)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ToErrorResponse converts an error returned by a backend method into an
+// ErrorResponse, copying any fields that match by name.  A status that
+// net/http cannot write, such as a zero HTTPStatusCode, becomes 500.
+func ToErrorResponse(err error) ErrorResponse {
+	errorResponse := ErrorResponse{
+		AWSErrorCode:    "[awsfaker missing error code]",
+		AWSErrorMessage: "[awsfaker missing error message]",
+		HTTPStatusCode:  http.StatusInternalServerError,
+	}
+	errCopy(err, &errorResponse)
+	if errorResponse.HTTPStatusCode < 100 || errorResponse.HTTPStatusCode > 999 {
+		errorResponse.HTTPStatusCode = http.StatusInternalServerError
+	}
+	return errorResponse
+}
+
+// An UnknownActionError is returned by a Codec for a request that does not
+// identify any action of the backend
+type UnknownActionError struct {
+	Action string
+}
+
+func (e *UnknownActionError) Error() string {
+	if e.Action == "" {
+		return "request does not name an action"
+	}
+	return fmt.Sprintf("action %s not found, check that you've fully implemented your fake backend", e.Action)
+}
@@ -0,0 +1,247 @@
+package dispatch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/rosenhouse/awsfaker/journal"
+)
+
+// A Codec reads requests and writes responses in the format of one AWS protocol
+type Codec interface {
+	// ReadRequest returns the action named by the request, along with a
+	// function that decodes the request into that action's input struct.
+	// It returns an *UnknownActionError if the request does not name an
+	// action, and any other error if the request is malformed.  The decode
+	// function may return an *ErrorResponse to choose the error sent to
+	// the client.
+	ReadRequest(r *http.Request) (action string, decode func(input interface{}) error, err error)
+
+	// WriteResponse encodes the output returned by a backend method
+	WriteResponse(w http.ResponseWriter, requestID string, action string, output interface{}) error
+
+	// WriteError encodes an error returned by a backend method
+	WriteError(w http.ResponseWriter, requestID string, errorResponse ErrorResponse) error
+
+	// ProtocolErrors returns the error codes used by the protocol for
+	// failures that the handler detects itself
+	ProtocolErrors() ProtocolErrors
+}
+
+// ProtocolErrors holds the error codes that a protocol uses for requests
+// that never reach a backend method
+type ProtocolErrors struct {
+	UnknownAction    string
+	MalformedRequest string
+}
+
+// InternalFailure is the error code for failures within awsfaker itself,
+// such as an output that cannot be encoded
+const InternalFailure = "InternalFailure"
+
+// A Handler is an http.Handler that dispatches requests to a Backend,
+// using a Codec to translate to and from the wire format
+type Handler struct {
+	Backend *Backend
+	Codec   Codec
+
+	// OnError, if set, is called with each failure that the handler detects
+	// itself, after the error response has been chosen
+	OnError func(error)
+
+	// Journal records each call that reaches a backend method
+	Journal *journal.Journal
+
+	// Authenticate, if set, checks each request before it is read, and
+	// returns the error to respond with if the request is refused
+	Authenticate func(r *http.Request) *ErrorResponse
+
+	// InjectFault, if set, is consulted for each call once its input is
+	// decoded.  It may delay the call, return an error to respond with in
+	// place of the backend, or report that it aborted the response itself.
+	InjectFault func(w http.ResponseWriter, r *http.Request, action string) (refusal *ErrorResponse, aborted bool)
+
+	// Intercept, if set, is offered each call before the backend method,
+	// and may answer it in the method's place by returning ok
+	Intercept func(method Method, input interface{}) (output interface{}, ok bool, err error)
+
+	panicsLock sync.Mutex
+	panics     []Panic
+}
+
+// A Panic records a panic recovered from a backend method
+type Panic struct {
+	Action string
+	Value  interface{}
+	Stack  []byte
+}
+
+// NewHandler returns a new Handler for the given backend and codec
+func NewHandler(backend *Backend, codec Codec) *Handler {
+	return &Handler{Backend: backend, Codec: codec, Journal: &journal.Journal{}}
+}
+
+// ServeHTTP dispatches a request to a backend method and writes the response
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := NewRequestID()
+	protocolErrors := h.Codec.ProtocolErrors()
+
+	if h.Authenticate != nil {
+		if refused := h.Authenticate(r); refused != nil {
+			h.fail(w, requestID, refused, *refused)
+			return
+		}
+	}
+
+	action, decode, err := h.Codec.ReadRequest(r)
+	if unknown, ok := err.(*UnknownActionError); ok {
+		h.fail(w, requestID, err, unknownAction(protocolErrors, unknown.Action))
+		return
+	}
+	if err != nil {
+		h.fail(w, requestID, err, ErrorResponse{
+			AWSErrorCode:    protocolErrors.MalformedRequest,
+			AWSErrorMessage: err.Error(),
+			HTTPStatusCode:  http.StatusBadRequest,
+		})
+		return
+	}
+
+	method, ok := h.Backend.Method(action)
+	if !ok {
+		err = fmt.Errorf("action %s not found, check that you've fully implemented your fake backend", action)
+		h.fail(w, requestID, err, unknownAction(protocolErrors, action))
+		return
+	}
+
+	input := method.NewInput()
+	err = decode(input)
+	if errorResponse, ok := err.(*ErrorResponse); ok {
+		h.fail(w, requestID, err, *errorResponse)
+		return
+	}
+	if err != nil {
+		h.fail(w, requestID, err, ErrorResponse{
+			AWSErrorCode:    protocolErrors.MalformedRequest,
+			AWSErrorMessage: err.Error(),
+			HTTPStatusCode:  http.StatusBadRequest,
+		})
+		return
+	}
+
+	if h.InjectFault != nil {
+		refusal, aborted := h.InjectFault(w, r, action)
+		if aborted {
+			return
+		}
+		if refusal != nil {
+			h.writeError(w, requestID, *refusal)
+			return
+		}
+	}
+
+	started := time.Now()
+	output, recovered, err := h.call(newContext(r, requestID), method, input)
+	if recovered != nil {
+		err = fmt.Errorf("backend method %s panicked: %v", action, recovered.Value)
+	}
+	h.Journal.Record(journal.Call{
+		Action:    action,
+		Input:     input,
+		Output:    output,
+		Err:       err,
+		Request:   r,
+		RequestID: requestID,
+		Started:   started,
+		Duration:  time.Since(started),
+	})
+	if recovered != nil {
+		h.fail(w, requestID, err, ErrorResponse{
+			AWSErrorCode:    InternalFailure,
+			AWSErrorMessage: err.Error(),
+			HTTPStatusCode:  http.StatusInternalServerError,
+		})
+		return
+	}
+	if err != nil {
+		h.writeError(w, requestID, ToErrorResponse(err))
+		return
+	}
+
+	err = h.Codec.WriteResponse(w, requestID, action, output)
+	if err != nil {
+		err = fmt.Errorf("unable to encode output of %s: %s", action, err)
+		h.fail(w, requestID, err, ErrorResponse{
+			AWSErrorCode:    InternalFailure,
+			AWSErrorMessage: err.Error(),
+			HTTPStatusCode:  http.StatusInternalServerError,
+		})
+	}
+}
+
+// call invokes the backend method, unless the call is intercepted,
+// recovering and recording any panic
+func (h *Handler) call(ctx context.Context, method Method, input interface{}) (output interface{}, recovered *Panic, err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			recovered = &Panic{Action: method.Name, Value: value, Stack: debug.Stack()}
+			h.panicsLock.Lock()
+			h.panics = append(h.panics, *recovered)
+			h.panicsLock.Unlock()
+		}
+	}()
+	if h.Intercept != nil {
+		if output, ok, err := h.Intercept(method, input); ok {
+			return output, nil, err
+		}
+	}
+	output, err = method.Call(ctx, input)
+	return output, nil, err
+}
+
+// Panics returns the panics recovered from backend methods, in the order
+// they occurred
+func (h *Handler) Panics() []Panic {
+	h.panicsLock.Lock()
+	defer h.panicsLock.Unlock()
+	return append([]Panic(nil), h.panics...)
+}
+
+// RefuseUnknownAction responds that the action is not valid, in the error
+// format of the codec, for a request that never reaches the handler
+func (h *Handler) RefuseUnknownAction(w http.ResponseWriter, action string) {
+	h.writeError(w, NewRequestID(), unknownAction(h.Codec.ProtocolErrors(), action))
+}
+
+func unknownAction(protocolErrors ProtocolErrors, action string) ErrorResponse {
+	return ErrorResponse{
+		AWSErrorCode:    protocolErrors.UnknownAction,
+		AWSErrorMessage: fmt.Sprintf("The action %s is not valid for this web service.", action),
+		HTTPStatusCode:  http.StatusBadRequest,
+	}
+}
+
+// fail reports a failure detected by the handler and responds with the
+// given error
+func (h *Handler) fail(w http.ResponseWriter, requestID string, err error, errorResponse ErrorResponse) {
+	h.report(err)
+	h.writeError(w, requestID, errorResponse)
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, requestID string, errorResponse ErrorResponse) {
+	err := h.Codec.WriteError(w, requestID, errorResponse)
+	if err != nil {
+		h.report(fmt.Errorf("unable to encode error response: %s", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) report(err error) {
+	if h.OnError != nil {
+		h.OnError(err)
+	}
+}
@@ -0,0 +1,311 @@
+package dispatch_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+)
+
+type FakeCodec struct {
+	ReadRequestCall struct {
+		ReturnsAction string
+		ReturnsError  error
+		DecodeError   error
+	}
+	WriteResponseCall struct {
+		ReturnsError error
+	}
+	WriteErrorCall struct {
+		Receives     *dispatch.ErrorResponse
+		ReturnsError error
+	}
+}
+
+func (c *FakeCodec) ReadRequest(r *http.Request) (string, func(interface{}) error, error) {
+	decode := func(interface{}) error { return c.ReadRequestCall.DecodeError }
+	return c.ReadRequestCall.ReturnsAction, decode, c.ReadRequestCall.ReturnsError
+}
+
+func (c *FakeCodec) WriteResponse(w http.ResponseWriter, requestID string, action string, output interface{}) error {
+	return c.WriteResponseCall.ReturnsError
+}
+
+func (c *FakeCodec) WriteError(w http.ResponseWriter, requestID string, errorResponse dispatch.ErrorResponse) error {
+	c.WriteErrorCall.Receives = &errorResponse
+	if c.WriteErrorCall.ReturnsError != nil {
+		return c.WriteErrorCall.ReturnsError
+	}
+	w.WriteHeader(errorResponse.HTTPStatusCode)
+	return nil
+}
+
+func (c *FakeCodec) ProtocolErrors() dispatch.ProtocolErrors {
+	return dispatch.ProtocolErrors{
+		UnknownAction:    "SomeUnknownActionCode",
+		MalformedRequest: "SomeMalformedRequestCode",
+	}
+}
+
+var _ = Describe("Handling requests", func() {
+	var (
+		codec    *FakeCodec
+		handler  *dispatch.Handler
+		recorder *httptest.ResponseRecorder
+		reported []error
+	)
+
+	BeforeEach(func() {
+		codec = &FakeCodec{}
+		codec.ReadRequestCall.ReturnsAction = "SomeAction"
+		handler = dispatch.NewHandler(dispatch.NewBackend(&SomeBackend{}), codec)
+		reported = nil
+		handler.OnError = func(err error) { reported = append(reported, err) }
+		recorder = httptest.NewRecorder()
+	})
+
+	serve := func() {
+		request, err := http.NewRequest("POST", "/", strings.NewReader(""))
+		Expect(err).NotTo(HaveOccurred())
+		handler.ServeHTTP(recorder, request)
+	}
+
+	It("should respond with the protocol's error for an unimplemented action", func() {
+		codec.ReadRequestCall.ReturnsAction = "MissingAction"
+		serve()
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(codec.WriteErrorCall.Receives).To(Equal(&dispatch.ErrorResponse{
+			AWSErrorCode:    "SomeUnknownActionCode",
+			AWSErrorMessage: "The action MissingAction is not valid for this web service.",
+			HTTPStatusCode:  http.StatusBadRequest,
+		}))
+		Expect(reported).To(HaveLen(1))
+		Expect(reported[0]).To(MatchError(ContainSubstring("action MissingAction not found")))
+	})
+
+	It("should treat an UnknownActionError from the codec as an unknown action", func() {
+		codec.ReadRequestCall.ReturnsError = &dispatch.UnknownActionError{Action: "GET /some/path"}
+		serve()
+
+		Expect(codec.WriteErrorCall.Receives.AWSErrorCode).To(Equal("SomeUnknownActionCode"))
+		Expect(reported).To(HaveLen(1))
+	})
+
+	It("should respond with the protocol's error for a request that cannot be read", func() {
+		codec.ReadRequestCall.ReturnsError = errors.New("some read error")
+		serve()
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(codec.WriteErrorCall.Receives).To(Equal(&dispatch.ErrorResponse{
+			AWSErrorCode:    "SomeMalformedRequestCode",
+			AWSErrorMessage: "some read error",
+			HTTPStatusCode:  http.StatusBadRequest,
+		}))
+		Expect(reported).To(ConsistOf(MatchError("some read error")))
+	})
+
+	It("should respond with the protocol's error for an input that cannot be decoded", func() {
+		codec.ReadRequestCall.DecodeError = errors.New("some decode error")
+		serve()
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(codec.WriteErrorCall.Receives.AWSErrorCode).To(Equal("SomeMalformedRequestCode"))
+		Expect(reported).To(ConsistOf(MatchError("some decode error")))
+	})
+
+	It("should respond with an InternalFailure when the output cannot be encoded", func() {
+		codec.WriteResponseCall.ReturnsError = errors.New("some encode error")
+		serve()
+
+		Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+		Expect(codec.WriteErrorCall.Receives.AWSErrorCode).To(Equal(dispatch.InternalFailure))
+		Expect(reported).To(HaveLen(1))
+		Expect(reported[0]).To(MatchError(ContainSubstring("some encode error")))
+	})
+
+	It("should record calls that reach the backend in the journal", func() {
+		serve()
+		codec.ReadRequestCall.ReturnsAction = "MissingAction"
+		serve()
+		codec.ReadRequestCall.ReturnsAction = "OtherAction"
+		serve()
+
+		calls := handler.Journal.Calls()
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].Action).To(Equal("SomeAction"))
+		Expect(calls[0].Output).To(Equal(strings.NewReader("some output")))
+		Expect(calls[0].Err).NotTo(HaveOccurred())
+		Expect(calls[0].Request.Method).To(Equal("POST"))
+		Expect(calls[0].RequestID).NotTo(BeEmpty())
+		Expect(calls[0].Started).NotTo(BeZero())
+		Expect(calls[1].Action).To(Equal("OtherAction"))
+		Expect(calls[1].Err).To(MatchError("some error"))
+	})
+
+	It("should let the interceptor answer a call in place of the backend", func() {
+		var intercepted []string
+		handler.Intercept = func(method dispatch.Method, input interface{}) (interface{}, bool, error) {
+			intercepted = append(intercepted, method.Name)
+			if method.Name == "OtherAction" {
+				return strings.NewReader("intercepted output"), true, nil
+			}
+			return nil, false, nil
+		}
+		serve()
+		codec.ReadRequestCall.ReturnsAction = "OtherAction"
+		serve()
+
+		Expect(intercepted).To(Equal([]string{"SomeAction", "OtherAction"}))
+		calls := handler.Journal.Calls()
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].Output).To(Equal(strings.NewReader("some output")))
+		Expect(calls[1].Output).To(Equal(strings.NewReader("intercepted output")))
+		Expect(calls[1].Err).NotTo(HaveOccurred())
+	})
+
+	It("should respond with the error chosen by Authenticate for a refused request", func() {
+		handler.Authenticate = func(r *http.Request) *dispatch.ErrorResponse {
+			return &dispatch.ErrorResponse{
+				AWSErrorCode:    "SomeAuthCode",
+				AWSErrorMessage: "some auth message",
+				HTTPStatusCode:  http.StatusForbidden,
+			}
+		}
+		serve()
+
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		Expect(codec.WriteErrorCall.Receives.AWSErrorCode).To(Equal("SomeAuthCode"))
+		Expect(reported).To(ConsistOf(MatchError("SomeAuthCode: some auth message")))
+		Expect(handler.Journal.Calls()).To(BeEmpty())
+	})
+
+	It("should respond with an injected fault in place of the backend, without reporting it", func() {
+		handler.InjectFault = func(w http.ResponseWriter, r *http.Request, action string) (*dispatch.ErrorResponse, bool) {
+			return &dispatch.ErrorResponse{
+				AWSErrorCode:    "Throttling",
+				AWSErrorMessage: "Rate exceeded",
+				HTTPStatusCode:  http.StatusBadRequest,
+			}, false
+		}
+		serve()
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(codec.WriteErrorCall.Receives.AWSErrorCode).To(Equal("Throttling"))
+		Expect(reported).To(BeEmpty())
+		Expect(handler.Journal.Calls()).To(BeEmpty())
+	})
+
+	It("should write nothing more once a fault has aborted the response", func() {
+		handler.InjectFault = func(w http.ResponseWriter, r *http.Request, action string) (*dispatch.ErrorResponse, bool) {
+			w.WriteHeader(http.StatusTeapot)
+			return nil, true
+		}
+		serve()
+
+		Expect(recorder.Code).To(Equal(http.StatusTeapot))
+		Expect(codec.WriteErrorCall.Receives).To(BeNil())
+		Expect(handler.Journal.Calls()).To(BeEmpty())
+	})
+
+	It("should not report errors returned by the backend", func() {
+		codec.ReadRequestCall.ReturnsAction = "OtherAction"
+		serve()
+
+		Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+		Expect(codec.WriteErrorCall.Receives.AWSErrorCode).To(Equal("[awsfaker missing error code]"))
+		Expect(reported).To(BeEmpty())
+	})
+
+	It("should fall back to a plain error when the error cannot be encoded", func() {
+		codec.ReadRequestCall.ReturnsAction = "MissingAction"
+		codec.WriteErrorCall.ReturnsError = errors.New("some error encoding error")
+		serve()
+
+		Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+		Expect(reported).To(HaveLen(2))
+	})
+})
+
+type PanickingBackend struct{}
+
+func (b *PanickingBackend) SomeAction(input *strings.Reader) (*strings.Reader, error) {
+	panic("some panic")
+}
+
+var _ = Describe("Handling a panic in a backend method", func() {
+	var (
+		codec    *FakeCodec
+		handler  *dispatch.Handler
+		recorder *httptest.ResponseRecorder
+		reported []error
+	)
+
+	BeforeEach(func() {
+		codec = &FakeCodec{}
+		codec.ReadRequestCall.ReturnsAction = "SomeAction"
+		handler = dispatch.NewHandler(dispatch.NewBackend(&PanickingBackend{}), codec)
+		reported = nil
+		handler.OnError = func(err error) { reported = append(reported, err) }
+		recorder = httptest.NewRecorder()
+
+		request, err := http.NewRequest("POST", "/", strings.NewReader(""))
+		Expect(err).NotTo(HaveOccurred())
+		handler.ServeHTTP(recorder, request)
+	})
+
+	It("should respond with an InternalFailure", func() {
+		Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+		Expect(codec.WriteErrorCall.Receives).To(Equal(&dispatch.ErrorResponse{
+			AWSErrorCode:    dispatch.InternalFailure,
+			AWSErrorMessage: "backend method SomeAction panicked: some panic",
+			HTTPStatusCode:  http.StatusInternalServerError,
+		}))
+		Expect(reported).To(ConsistOf(MatchError("backend method SomeAction panicked: some panic")))
+	})
+
+	It("should record the panic value and stack trace", func() {
+		panics := handler.Panics()
+		Expect(panics).To(HaveLen(1))
+		Expect(panics[0].Action).To(Equal("SomeAction"))
+		Expect(panics[0].Value).To(Equal("some panic"))
+		Expect(string(panics[0].Stack)).To(ContainSubstring("PanickingBackend"))
+	})
+})
+
+type RequestInfoBackend struct {
+	ReceivesContext context.Context
+}
+
+func (b *RequestInfoBackend) SomeAction(ctx context.Context, input *strings.Reader) (*strings.Reader, error) {
+	b.ReceivesContext = ctx
+	return nil, nil
+}
+
+var _ = Describe("Passing request info to a backend method", func() {
+	It("should describe the request in the context", func() {
+		backend := &RequestInfoBackend{}
+		codec := &FakeCodec{}
+		codec.ReadRequestCall.ReturnsAction = "SomeAction"
+		handler := dispatch.NewHandler(dispatch.NewBackend(backend), codec)
+
+		request, err := http.NewRequest("POST", "/", strings.NewReader(""))
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=some-access-key/20170101/some-region/some-service/aws4_request, SignedHeaders=host, Signature=some-signature")
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		info, ok := dispatch.RequestInfoFrom(backend.ReceivesContext)
+		Expect(ok).To(BeTrue())
+		Expect(info.Request).To(BeIdenticalTo(request))
+		Expect(info.Header.Get("Authorization")).To(HavePrefix("AWS4-HMAC-SHA256"))
+		Expect(info.AccessKeyID).To(Equal("some-access-key"))
+		Expect(info.Region).To(Equal("some-region"))
+		Expect(info.RequestID).NotTo(BeEmpty())
+	})
+})
@@ -0,0 +1,8 @@
+package dispatch
+
+import "github.com/rosenhouse/awsfaker/internal/random"
+
+// NewRequestID returns a random request ID, formatted like those of AWS
+func NewRequestID() string {
+	return random.UUID()
+}
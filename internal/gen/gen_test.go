@@ -0,0 +1,97 @@
+package gen_test
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rosenhouse/awsfaker/internal/gen"
+)
+
+const cloudFormationIface = "github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+
+var _ = Describe("Loading a service interface", func() {
+	It("should find the plain action methods", func() {
+		iface, err := gen.LoadInterface(cloudFormationIface, "CloudFormationAPI")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(iface.ServicePkgPath).To(Equal("github.com/aws/aws-sdk-go/service/cloudformation"))
+		Expect(iface.ServicePkgName).To(Equal("cloudformation"))
+
+		operation, ok := iface.Operation("DescribeStacks")
+		Expect(ok).To(BeTrue())
+		Expect(operation).To(Equal(gen.Operation{
+			Name:       "DescribeStacks",
+			InputType:  "DescribeStacksInput",
+			OutputType: "DescribeStacksOutput",
+		}))
+
+		for _, operation := range iface.Operations {
+			Expect(operation.InputType).To(Equal(operation.Name + "Input"))
+		}
+		_, ok = iface.Operation("DescribeStacksRequest")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should report a missing interface", func() {
+		_, err := gen.LoadInterface(cloudFormationIface, "MissingAPI")
+		Expect(err).To(MatchError(ContainSubstring("no interface named MissingAPI")))
+	})
+})
+
+var _ = Describe("Generating a fake backend", func() {
+	var iface gen.Interface
+
+	BeforeEach(func() {
+		iface = gen.Interface{
+			Name:           "CloudFormationAPI",
+			ServicePkgPath: "github.com/aws/aws-sdk-go/service/cloudformation",
+			ServicePkgName: "cloudformation",
+			Operations: []gen.Operation{
+				{Name: "DescribeStacks", InputType: "DescribeStacksInput", OutputType: "DescribeStacksOutput"},
+				{Name: "UpdateStack", InputType: "UpdateStackInput", OutputType: "UpdateStackOutput"},
+			},
+		}
+	})
+
+	It("should generate valid Go source for the chosen operations", func() {
+		buffer := &bytes.Buffer{}
+		err := gen.Generate(buffer, gen.Config{
+			Package:    "fakes",
+			TypeName:   gen.DefaultTypeName(iface.Name),
+			Interface:  iface,
+			Operations: []string{"UpdateStack"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = parser.ParseFile(token.NewFileSet(), "fake.go", buffer.Bytes(), 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		source := buffer.String()
+		Expect(source).To(ContainSubstring("package fakes"))
+		Expect(source).To(ContainSubstring("type FakeCloudFormationBackend struct"))
+		Expect(source).To(ContainSubstring("func (fake *FakeCloudFormationBackend) UpdateStack(input *cloudformation.UpdateStackInput) (*cloudformation.UpdateStackOutput, error)"))
+		Expect(source).To(ContainSubstring("func (fake *FakeCloudFormationBackend) UpdateStackReturnsOnCall(i int, result1 *cloudformation.UpdateStackOutput, result2 error)"))
+		Expect(source).NotTo(ContainSubstring("DescribeStacks"))
+	})
+
+	It("should implement every operation by default", func() {
+		buffer := &bytes.Buffer{}
+		err := gen.Generate(buffer, gen.Config{Package: "fakes", TypeName: "SomeFake", Interface: iface})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buffer.String()).To(ContainSubstring("func (fake *SomeFake) DescribeStacks("))
+		Expect(buffer.String()).To(ContainSubstring("func (fake *SomeFake) UpdateStack("))
+	})
+
+	It("should reject unknown operations", func() {
+		err := gen.Generate(&bytes.Buffer{}, gen.Config{
+			Package:    "fakes",
+			TypeName:   "SomeFake",
+			Interface:  iface,
+			Operations: []string{"MissingOperation"},
+		})
+		Expect(err).To(MatchError("no operation named MissingOperation in CloudFormationAPI"))
+	})
+})
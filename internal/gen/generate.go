@@ -0,0 +1,173 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// A Config describes the fake backend to generate
+type Config struct {
+	// Package is the name of the package of the generated file
+	Package string
+
+	// TypeName is the name of the fake backend type
+	TypeName string
+
+	// Interface is the service interface to fake
+	Interface Interface
+
+	// Operations names the subset of operations to implement, or all of
+	// them if empty
+	Operations []string
+}
+
+// DefaultTypeName returns a name for the fake of an interface, e.g.
+// FakeCloudFormationBackend for CloudFormationAPI
+func DefaultTypeName(interfaceName string) string {
+	return "Fake" + strings.TrimSuffix(interfaceName, "API") + "Backend"
+}
+
+// Generate writes the Go source of a fake backend.
+//
+// The fake records the input of each call and returns the results set by
+// its Returns and ReturnsOnCall methods, unless a Stub func is set.  Only
+// the chosen operations are implemented, and the helper methods do not
+// look like actions, so the fake can be passed to awsfaker.New.
+func Generate(w io.Writer, config Config) error {
+	operations := config.Interface.Operations
+	if len(config.Operations) > 0 {
+		operations = nil
+		for _, name := range config.Operations {
+			operation, ok := config.Interface.Operation(name)
+			if !ok {
+				return fmt.Errorf("no operation named %s in %s", name, config.Interface.Name)
+			}
+			operations = append(operations, operation)
+		}
+	}
+
+	buffer := &bytes.Buffer{}
+	err := fakeTemplate.Execute(buffer, struct {
+		Config
+		Operations []Operation
+	}{config, operations})
+	if err != nil {
+		return err
+	}
+
+	source, err := format.Source(buffer.Bytes())
+	if err != nil {
+		return fmt.Errorf("unable to format generated source: %s", err)
+	}
+	_, err = w.Write(source)
+	return err
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func operationNames(operations []Operation) string {
+	names := make([]string, len(operations))
+	for i, operation := range operations {
+		names[i] = operation.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+var fakeTemplate = template.Must(template.New("fake").Funcs(template.FuncMap{
+	"lowerFirst":     lowerFirst,
+	"operationNames": operationNames,
+}).Parse(`// Code generated by awsfaker-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"sync"
+
+	"{{.Interface.ServicePkgPath}}"
+)
+{{$type := .TypeName}}{{$pkg := .Interface.ServicePkgName}}
+// {{$type}} is a fake {{$pkg}} backend for awsfaker, implementing
+// {{operationNames .Operations}}
+type {{$type}} struct {
+{{- range .Operations}}{{$private := lowerFirst .Name}}
+	{{.Name}}Stub func(*{{$pkg}}.{{.InputType}}) (*{{$pkg}}.{{.OutputType}}, error)
+	{{$private}}Mutex sync.RWMutex
+	{{$private}}ArgsForCall []*{{$pkg}}.{{.InputType}}
+	{{$private}}Returns struct {
+		result1 *{{$pkg}}.{{.OutputType}}
+		result2 error
+	}
+	{{$private}}ReturnsOnCall map[int]struct {
+		result1 *{{$pkg}}.{{.OutputType}}
+		result2 error
+	}
+{{- end}}
+}
+{{range .Operations}}{{$private := lowerFirst .Name}}
+func (fake *{{$type}}) {{.Name}}(input *{{$pkg}}.{{.InputType}}) (*{{$pkg}}.{{.OutputType}}, error) {
+	fake.{{$private}}Mutex.Lock()
+	ret, specificReturn := fake.{{$private}}ReturnsOnCall[len(fake.{{$private}}ArgsForCall)]
+	fake.{{$private}}ArgsForCall = append(fake.{{$private}}ArgsForCall, input)
+	stub := fake.{{.Name}}Stub
+	returns := fake.{{$private}}Returns
+	fake.{{$private}}Mutex.Unlock()
+	if stub != nil {
+		return stub(input)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return returns.result1, returns.result2
+}
+
+// {{.Name}}CallCount returns the number of calls to {{.Name}}
+func (fake *{{$type}}) {{.Name}}CallCount() int {
+	fake.{{$private}}Mutex.RLock()
+	defer fake.{{$private}}Mutex.RUnlock()
+	return len(fake.{{$private}}ArgsForCall)
+}
+
+// {{.Name}}ArgsForCall returns the input of the i'th call to {{.Name}}
+func (fake *{{$type}}) {{.Name}}ArgsForCall(i int) *{{$pkg}}.{{.InputType}} {
+	fake.{{$private}}Mutex.RLock()
+	defer fake.{{$private}}Mutex.RUnlock()
+	return fake.{{$private}}ArgsForCall[i]
+}
+
+// {{.Name}}Returns sets the results of every call to {{.Name}}
+func (fake *{{$type}}) {{.Name}}Returns(result1 *{{$pkg}}.{{.OutputType}}, result2 error) {
+	fake.{{$private}}Mutex.Lock()
+	defer fake.{{$private}}Mutex.Unlock()
+	fake.{{.Name}}Stub = nil
+	fake.{{$private}}Returns = struct {
+		result1 *{{$pkg}}.{{.OutputType}}
+		result2 error
+	}{result1, result2}
+}
+
+// {{.Name}}ReturnsOnCall sets the results of the i'th call to {{.Name}}
+func (fake *{{$type}}) {{.Name}}ReturnsOnCall(i int, result1 *{{$pkg}}.{{.OutputType}}, result2 error) {
+	fake.{{$private}}Mutex.Lock()
+	defer fake.{{$private}}Mutex.Unlock()
+	fake.{{.Name}}Stub = nil
+	if fake.{{$private}}ReturnsOnCall == nil {
+		fake.{{$private}}ReturnsOnCall = make(map[int]struct {
+			result1 *{{$pkg}}.{{.OutputType}}
+			result2 error
+		})
+	}
+	fake.{{$private}}ReturnsOnCall[i] = struct {
+		result1 *{{$pkg}}.{{.OutputType}}
+		result2 error
+	}{result1, result2}
+}
+{{end}}`))
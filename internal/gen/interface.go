@@ -0,0 +1,181 @@
+// Package gen generates fake backends from the service interfaces of
+// aws-sdk-go, e.g. cloudformationiface.CloudFormationAPI.
+//
+// It reads the aws-sdk-go source, so the source must be available when the
+// generator runs.  The generated code does not need it.
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// An Interface describes the actions of an aws-sdk-go service interface
+type Interface struct {
+	Name           string
+	ServicePkgPath string
+	ServicePkgName string
+	Operations     []Operation
+}
+
+// An Operation is a single action, e.g. DescribeStacks, taking a pointer to
+// its input type and returning a pointer to its output type and an error
+type Operation struct {
+	Name       string
+	InputType  string
+	OutputType string
+}
+
+// Operation returns the named operation of the interface
+func (i Interface) Operation(name string) (Operation, bool) {
+	for _, operation := range i.Operations {
+		if operation.Name == name {
+			return operation, true
+		}
+	}
+	return Operation{}, false
+}
+
+// LoadInterface reads the named interface from the source of an aws-sdk-go
+// interface package, e.g. github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface
+//
+// Only the plain action methods are kept; the Request, WithContext and Pages
+// variants are ignored.
+func LoadInterface(pkgPath string, name string) (Interface, error) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return Interface{}, err
+	}
+	pkg, err := build.Import(pkgPath, workingDir, build.FindOnly)
+	if err != nil {
+		return Interface{}, fmt.Errorf("unable to find source for %s: %s", pkgPath, err)
+	}
+
+	fileSet := token.NewFileSet()
+	isSource := func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}
+	pkgs, err := parser.ParseDir(fileSet, pkg.Dir, isSource, 0)
+	if err != nil {
+		return Interface{}, fmt.Errorf("unable to parse source for %s: %s", pkgPath, err)
+	}
+
+	for _, p := range pkgs {
+		for _, file := range p.Files {
+			interfaceType, ok := findInterface(file, name)
+			if !ok {
+				continue
+			}
+			return parseInterface(name, interfaceType, imports(file))
+		}
+	}
+	return Interface{}, fmt.Errorf("no interface named %s in %s", name, pkgPath)
+}
+
+func findInterface(file *ast.File, name string) (*ast.InterfaceType, bool) {
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			if typeSpec.Name.Name != name {
+				continue
+			}
+			interfaceType, ok := typeSpec.Type.(*ast.InterfaceType)
+			return interfaceType, ok
+		}
+	}
+	return nil, false
+}
+
+// imports returns the import paths of a file, keyed by package name
+func imports(file *ast.File) map[string]string {
+	paths := map[string]string{}
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		paths[name] = path
+	}
+	return paths
+}
+
+func parseInterface(name string, interfaceType *ast.InterfaceType, imports map[string]string) (Interface, error) {
+	i := Interface{Name: name}
+	for _, method := range interfaceType.Methods.List {
+		funcType, ok := method.Type.(*ast.FuncType)
+		if !ok || len(method.Names) != 1 {
+			continue
+		}
+		operation, pkgName, ok := parseOperation(method.Names[0].Name, funcType)
+		if !ok {
+			continue
+		}
+		if i.ServicePkgName == "" {
+			i.ServicePkgName = pkgName
+			i.ServicePkgPath = imports[pkgName]
+		}
+		if pkgName == i.ServicePkgName {
+			i.Operations = append(i.Operations, operation)
+		}
+	}
+
+	if len(i.Operations) == 0 {
+		return Interface{}, fmt.Errorf("no operations found in interface %s", name)
+	}
+	if i.ServicePkgPath == "" {
+		return Interface{}, fmt.Errorf("unable to find the import path of package %s", i.ServicePkgName)
+	}
+	return i, nil
+}
+
+// parseOperation recognizes methods like
+//
+//	DescribeStacks(*cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error)
+func parseOperation(name string, funcType *ast.FuncType) (Operation, string, bool) {
+	if funcType.Params.NumFields() != 1 || funcType.Results.NumFields() != 2 {
+		return Operation{}, "", false
+	}
+	inputPkg, inputType, ok := pointerToSelector(funcType.Params.List[0].Type)
+	if !ok || inputType != name+"Input" {
+		return Operation{}, "", false
+	}
+	outputPkg, outputType, ok := pointerToSelector(funcType.Results.List[0].Type)
+	if !ok || outputPkg != inputPkg {
+		return Operation{}, "", false
+	}
+	errorIdent, ok := funcType.Results.List[1].Type.(*ast.Ident)
+	if !ok || errorIdent.Name != "error" {
+		return Operation{}, "", false
+	}
+	return Operation{Name: name, InputType: inputType, OutputType: outputType}, inputPkg, true
+}
+
+func pointerToSelector(expr ast.Expr) (string, string, bool) {
+	star, ok := expr.(*ast.StarExpr)
+	if !ok {
+		return "", "", false
+	}
+	selector, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return "", "", false
+	}
+	pkgName, ok := selector.X.(*ast.Ident)
+	if !ok {
+		return "", "", false
+	}
+	return pkgName.Name, selector.Sel.Name, true
+}
@@ -0,0 +1,54 @@
+// Package random generates the identifiers that AWS assigns to requests and
+// resources.
+package random
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+const (
+	upperAlphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	alphanumeric      = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+func bytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// UUID returns a random version 4 UUID, as used for request and stack IDs
+func UUID() string {
+	b := bytes(16)
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Hex returns n random lowercase hex digits, as in EC2 resource IDs like
+// i-0123456789abcdef0
+func Hex(n int) string {
+	return fmt.Sprintf("%x", bytes((n+1)/2))[:n]
+}
+
+// Upper returns n random uppercase letters and digits, as in IAM unique IDs
+// and access key IDs
+func Upper(n int) string {
+	return fromAlphabet(upperAlphanumeric, n)
+}
+
+// Alphanumeric returns n random letters and digits, as in secret keys
+func Alphanumeric(n int) string {
+	return fromAlphabet(alphanumeric, n)
+}
+
+func fromAlphabet(alphabet string, n int) string {
+	b := bytes(n)
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b)
+}
@@ -0,0 +1,23 @@
+// Package yamlutil helps to treat documents decoded from YAML like those
+// decoded from JSON.
+package yamlutil
+
+import "fmt"
+
+// Normalize converts the map[interface{}]interface{} values produced by the
+// YAML decoder into map[string]interface{}, so they can be re-encoded as JSON
+func Normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			m[fmt.Sprint(key)] = Normalize(element)
+		}
+		return m
+	case []interface{}:
+		for i, element := range v {
+			v[i] = Normalize(element)
+		}
+	}
+	return value
+}
@@ -0,0 +1,80 @@
+// Package journal records the calls served by a fake backend, so that tests
+// can assert on what the code under test asked of AWS without each backend
+// having to record its own inputs.
+package journal
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A Call records one request that reached a backend method
+type Call struct {
+	Action    string
+	Input     interface{}
+	Output    interface{}
+	Err       error
+	Request   *http.Request
+	RequestID string
+	Started   time.Time
+	Duration  time.Duration
+}
+
+// A Journal is an ordered record of calls.  It is safe for concurrent use,
+// and its zero value is an empty journal ready to use.
+type Journal struct {
+	lock  sync.Mutex
+	calls []Call
+}
+
+// Record appends a call to the journal
+func (j *Journal) Record(call Call) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.calls = append(j.calls, call)
+}
+
+// Calls returns every call in the journal, in the order they were made
+func (j *Journal) Calls() []Call {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return append([]Call(nil), j.calls...)
+}
+
+// CallsTo returns the calls to the named action, in the order they were made
+func (j *Journal) CallsTo(action string) []Call {
+	calls := []Call{}
+	for _, call := range j.Calls() {
+		if call.Action == action {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// LastCall returns the most recent call to the named action
+func (j *Journal) LastCall(action string) (Call, bool) {
+	calls := j.CallsTo(action)
+	if len(calls) == 0 {
+		return Call{}, false
+	}
+	return calls[len(calls)-1], true
+}
+
+// LastInput returns the input of the most recent call to the named action,
+// or nil if the action has not been called
+func (j *Journal) LastInput(action string) interface{} {
+	call, ok := j.LastCall(action)
+	if !ok {
+		return nil
+	}
+	return call.Input
+}
+
+// Reset empties the journal
+func (j *Journal) Reset() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.calls = nil
+}
@@ -0,0 +1,67 @@
+package journal_test
+
+import (
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rosenhouse/awsfaker/journal"
+)
+
+var _ = Describe("Journal", func() {
+	var j *journal.Journal
+
+	BeforeEach(func() {
+		j = &journal.Journal{}
+		j.Record(journal.Call{Action: "SomeAction", Input: strings.NewReader("first")})
+		j.Record(journal.Call{Action: "OtherAction", Input: strings.NewReader("other")})
+		j.Record(journal.Call{Action: "SomeAction", Input: strings.NewReader("second")})
+	})
+
+	It("should return every call in order", func() {
+		calls := j.Calls()
+		Expect(calls).To(HaveLen(3))
+		Expect(calls[0].Action).To(Equal("SomeAction"))
+		Expect(calls[1].Action).To(Equal("OtherAction"))
+		Expect(calls[2].Action).To(Equal("SomeAction"))
+	})
+
+	It("should return the calls to one action", func() {
+		calls := j.CallsTo("SomeAction")
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].Input).To(Equal(strings.NewReader("first")))
+		Expect(calls[1].Input).To(Equal(strings.NewReader("second")))
+
+		Expect(j.CallsTo("MissingAction")).To(BeEmpty())
+	})
+
+	It("should return the input of the last call to an action", func() {
+		Expect(j.LastInput("SomeAction")).To(Equal(strings.NewReader("second")))
+		Expect(j.LastInput("MissingAction")).To(BeNil())
+	})
+
+	It("should forget every call when reset", func() {
+		j.Reset()
+		Expect(j.Calls()).To(BeEmpty())
+		_, ok := j.LastCall("SomeAction")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should be safe for concurrent use", func() {
+		j.Reset()
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				j.Record(journal.Call{Action: "SomeAction"})
+				j.CallsTo("SomeAction")
+			}()
+		}
+		wg.Wait()
+		Expect(j.Calls()).To(HaveLen(10))
+	})
+})
@@ -0,0 +1,246 @@
+package awsfaker
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rosenhouse/awsfaker/internal/auth"
+	"github.com/rosenhouse/awsfaker/internal/detect"
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+	"github.com/rosenhouse/awsfaker/journal"
+)
+
+// A Mux is an http.Handler that serves fakes of several AWS services from a
+// single endpoint, so that an application can be pointed at one fake for all
+// of the services it uses.
+//
+// Each request is routed to the backend for the service named in the
+// credential scope of its signature.  Unsigned requests, and requests whose
+// signing name is shared by more than one service, are routed by the action
+// in the X-Amz-Target header or the Action in the URL or form body, or
+// failing that by the Host header.  Requests that cannot be routed are
+// refused with the unknown action error of the protocol they appear to use.
+type Mux struct {
+	// OnError, if set, is called with each failure that awsfaker detects
+	// itself, as for Handler.OnError, including requests that cannot be
+	// routed to any of the backends.
+	OnError func(error)
+
+	// Signatures, if set, checks the signature of each request before it
+	// reaches a backend, as for Handler.Signatures
+	Signatures *SignatureVerifier
+
+	// Faults, if set, makes the backends misbehave on purpose
+	Faults *Faults
+
+	services []*fakeService
+	journal  *journal.Journal
+}
+
+// NewMux returns a Mux that dispatches requests to the given service backends.
+//
+// It panics under the same conditions as New, or if more than one backend
+// fakes the same service.
+func NewMux(serviceBackends ...interface{}) *Mux {
+	mux := &Mux{journal: &journal.Journal{}}
+	for _, serviceBackend := range serviceBackends {
+		service, err := newFakeService(serviceBackend)
+		if err != nil {
+			panic(fmt.Sprintf("awsfaker: %s", err))
+		}
+		for _, existing := range mux.services {
+			if existing.name == service.name {
+				panic(fmt.Sprintf("awsfaker: more than one backend for service %q", service.name))
+			}
+		}
+		service.handler.OnError = mux.reportError
+		service.handler.Authenticate = mux.authenticator(service.name)
+		service.handler.InjectFault = mux.injectFault
+		service.handler.Journal = mux.journal
+		mux.services = append(mux.services, service)
+	}
+	return mux
+}
+
+// ServeHTTP dispatches the request to the backend for the service it targets
+func (m *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	candidates := m.route(r)
+	if len(candidates) != 1 {
+		m.reportError(fmt.Errorf("unable to determine the service targeted by %s %s", r.Method, r.URL))
+		m.refuse(w, r, candidates)
+		return
+	}
+	candidates[0].handler.ServeHTTP(w, r)
+}
+
+// refuse responds to a request that cannot be routed, using the protocol of
+// one of the candidate services that the request looks like it was meant
+// for, or else of any service
+func (m *Mux) refuse(w http.ResponseWriter, r *http.Request, candidates []*fakeService) {
+	if len(candidates) == 0 {
+		candidates = m.services
+	}
+	if len(candidates) == 0 {
+		http.Error(w, "awsfaker: no services to route the request to", http.StatusBadRequest)
+		return
+	}
+
+	action := r.Method + " " + r.URL.Path
+	protocols := []string{"restjson", "restxml"}
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		action = target[strings.LastIndex(target, ".")+1:]
+		protocols = []string{"jsonrpc"}
+	} else if queryAction := queryAction(r); queryAction != "" {
+		action = queryAction
+		protocols = []string{"query", "ec2query"}
+	}
+
+	chosen := candidates[0]
+	for _, service := range candidates {
+		if contains(protocols, detect.ProtocolForService[service.name]) {
+			chosen = service
+			break
+		}
+	}
+	chosen.handler.RefuseUnknownAction(w, action)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// queryAction returns the Action of a query protocol request, which is given
+// either in the URL or in a form-encoded body.  A body that is read is put
+// back for the backend.
+func queryAction(r *http.Request) string {
+	if action := r.URL.Query().Get("Action"); action != "" {
+		return action
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Method != "POST" || r.Body == nil || mediaType != "application/x-www-form-urlencoded" {
+		return ""
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	return values.Get("Action")
+}
+
+// Journal returns the record of every call that reached any of the backends
+func (m *Mux) Journal() *journal.Journal {
+	return m.journal
+}
+
+// Panics returns the panics recovered from the methods of all backends
+func (m *Mux) Panics() []Panic {
+	panics := []Panic{}
+	for _, service := range m.services {
+		panics = append(panics, convertPanics(service.handler.Panics())...)
+	}
+	return panics
+}
+
+func (m *Mux) authenticator(serviceName string) func(*http.Request) *dispatch.ErrorResponse {
+	return func(r *http.Request) *dispatch.ErrorResponse {
+		if m.Signatures == nil {
+			return nil
+		}
+		return m.Signatures.verify(r, serviceName)
+	}
+}
+
+func (m *Mux) injectFault(w http.ResponseWriter, r *http.Request, action string) (*dispatch.ErrorResponse, bool) {
+	if m.Faults == nil {
+		return nil, false
+	}
+	return m.Faults.inject(w, r, action)
+}
+
+func (m *Mux) reportError(err error) {
+	if m.OnError != nil {
+		m.OnError(err)
+	}
+}
+
+// route returns the services that the request may be meant for, which is a
+// single service unless the request is ambiguous
+func (m *Mux) route(r *http.Request) []*fakeService {
+	candidates := m.services
+
+	// a request signed for a service that is not served goes nowhere, even
+	// if a served service has an action of the same name
+	if scope, ok := auth.ParseCredentialScope(r); ok {
+		candidates = filter(candidates, func(s *fakeService) bool {
+			return detect.SigningName(s.name) == scope.Service
+		})
+		if len(candidates) == 0 {
+			return nil
+		}
+	}
+
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		action := target[strings.LastIndex(target, ".")+1:]
+		candidates = narrow(candidates, func(s *fakeService) bool {
+			_, ok := s.handler.Backend.Method(action)
+			return ok
+		})
+	}
+
+	if len(candidates) > 1 {
+		if action := queryAction(r); action != "" {
+			candidates = narrow(candidates, func(s *fakeService) bool {
+				_, ok := s.handler.Backend.Method(action)
+				return ok
+			})
+		}
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return narrow(candidates, func(s *fakeService) bool {
+		return strings.HasPrefix(host, detect.EndpointPrefix(s.name)+".")
+	})
+}
+
+// narrow returns the services that match, unless that would leave none, or
+// there is no ambiguity left to resolve
+func narrow(services []*fakeService, matches func(*fakeService) bool) []*fakeService {
+	if len(services) <= 1 {
+		return services
+	}
+	matching := filter(services, matches)
+	if len(matching) == 0 {
+		return services
+	}
+	return matching
+}
+
+// filter returns the services that match
+func filter(services []*fakeService, matches func(*fakeService) bool) []*fakeService {
+	matching := []*fakeService{}
+	for _, service := range services {
+		if matches(service) {
+			matching = append(matching, service)
+		}
+	}
+	return matching
+}
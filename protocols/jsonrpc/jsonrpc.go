@@ -0,0 +1,130 @@
+// Package jsonrpc implements the AWS JSON-RPC protocol
+//
+// The JSON-RPC protocol is used by many AWS APIs, including DynamoDB,
+// Kinesis, and KMS.  Each request is an HTTP POST with the action named in
+// the X-Amz-Target header and the input encoded as JSON in the body.
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+)
+
+// A Handler is an http.Handler that can mimic an AWS service API
+type Handler struct {
+	*dispatch.Handler
+}
+
+// New returns a new Handler that will dispatch incoming requests to
+// the fake service backend given as an argument.
+func New(serviceBackend interface{}) *Handler {
+	backend := dispatch.NewBackend(serviceBackend)
+	codec := &codec{contentType: "application/x-amz-json-" + jsonVersion(backend)}
+	return &Handler{dispatch.NewHandler(backend, codec)}
+}
+
+// jsonVersions holds the JSON version of the services that do not use 1.1,
+// keyed by the name of their aws-sdk-go package.  It follows the JSONVersion
+// in the metadata of the SDK clients.
+var jsonVersions = map[string]string{
+	"dynamodb":        "1.0",
+	"dynamodbstreams": "1.0",
+	"swf":             "1.0",
+}
+
+// jsonVersion returns the JSON version of the service that defines the
+// inputs of the backend
+func jsonVersion(backend *dispatch.Backend) string {
+	if methods := backend.Methods(); len(methods) > 0 {
+		if version, ok := jsonVersions[path.Base(methods[0].InputType().PkgPath())]; ok {
+			return version
+		}
+	}
+	return "1.1"
+}
+
+type codec struct {
+	contentType string
+}
+
+func (c *codec) ReadRequest(r *http.Request) (string, func(interface{}) error, error) {
+	target := r.Header.Get("X-Amz-Target")
+	action, ok := parseTarget(target)
+	if !ok {
+		return "", nil, &dispatch.UnknownActionError{Action: target}
+	}
+
+	requestBodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to read request body: %s", err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(requestBodyBytes))
+
+	decode := func(input interface{}) error {
+		return jsonutil.UnmarshalJSON(input, bytes.NewReader(requestBodyBytes))
+	}
+	return action, decode, nil
+}
+
+func (c *codec) WriteResponse(w http.ResponseWriter, requestID string, action string, output interface{}) error {
+	body, err := jsonutil.BuildJSON(output)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+	return c.writeJSON(w, requestID, http.StatusOK, body)
+}
+
+type jsonErrorResponse struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+func (c *codec) ProtocolErrors() dispatch.ProtocolErrors {
+	return dispatch.ProtocolErrors{
+		UnknownAction:    "UnknownOperationException",
+		MalformedRequest: "SerializationException",
+	}
+}
+
+func (c *codec) WriteError(w http.ResponseWriter, requestID string, errorResponse dispatch.ErrorResponse) error {
+	body, err := json.Marshal(jsonErrorResponse{
+		Type:    errorResponse.AWSErrorCode,
+		Message: errorResponse.AWSErrorMessage,
+	})
+	if err != nil {
+		return err
+	}
+	return c.writeJSON(w, requestID, errorResponse.HTTPStatusCode, body)
+}
+
+// parseTarget returns the action from an X-Amz-Target header value like
+// DynamoDB_20120810.GetItem
+func parseTarget(target string) (string, bool) {
+	i := strings.LastIndex(target, ".")
+	if i < 0 || i == len(target)-1 {
+		return "", false
+	}
+	return target[i+1:], true
+}
+
+func (c *codec) writeJSON(w http.ResponseWriter, requestID string, statusCode int, body []byte) error {
+	w.Header().Set("Content-Type", c.contentType)
+	w.Header().Set("X-Amzn-RequestId", requestID)
+	w.Header().Set("X-Amz-Crc32", strconv.FormatUint(uint64(crc32.ChecksumIEEE(body)), 10))
+	w.WriteHeader(statusCode)
+	_, err := w.Write(body)
+	return err
+}
@@ -0,0 +1,13 @@
+package jsonrpc_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestJsonrpc(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "JSON-RPC Suite")
+}
@@ -0,0 +1,142 @@
+package jsonrpc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+
+	"github.com/rosenhouse/awsfaker"
+	"github.com/rosenhouse/awsfaker/protocols/jsonrpc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type FakeDynamoDBBackend struct {
+	GetItemCall struct {
+		Receives      *dynamodb.GetItemInput
+		ReturnsResult *dynamodb.GetItemOutput
+		ReturnsError  error
+	}
+}
+
+func (f *FakeDynamoDBBackend) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	f.GetItemCall.Receives = input
+	return f.GetItemCall.ReturnsResult, f.GetItemCall.ReturnsError
+}
+
+type FakeKinesisBackend struct{}
+
+func (f *FakeKinesisBackend) ListStreams(input *kinesis.ListStreamsInput) (*kinesis.ListStreamsOutput, error) {
+	return &kinesis.ListStreamsOutput{}, nil
+}
+
+var _ = Describe("Handling JSON-RPC requests", func() {
+	var (
+		fakeBackend *FakeDynamoDBBackend
+		fakeServer  *httptest.Server
+		client      *dynamodb.DynamoDB
+	)
+
+	BeforeEach(func() {
+		fakeBackend = &FakeDynamoDBBackend{}
+		fakeServer = httptest.NewServer(jsonrpc.New(fakeBackend))
+		client = dynamodb.New(session.New(&aws.Config{
+			Credentials: credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""),
+			Region:      aws.String("some-region"),
+			Endpoint:    aws.String(fakeServer.URL),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		if fakeServer != nil {
+			fakeServer.Close()
+		}
+	})
+
+	It("should decode the input and call the backend method", func() {
+		client.GetItem(&dynamodb.GetItemInput{
+			TableName: aws.String("some-table"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"some-key": &dynamodb.AttributeValue{S: aws.String("some-value")},
+			},
+			ConsistentRead: aws.Bool(true),
+		})
+
+		Expect(fakeBackend.GetItemCall.Receives).To(Equal(&dynamodb.GetItemInput{
+			TableName: aws.String("some-table"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"some-key": &dynamodb.AttributeValue{S: aws.String("some-value")},
+			},
+			ConsistentRead: aws.Bool(true),
+		}))
+	})
+
+	Context("when the backend succeeds", func() {
+		It("should return the data in a format parsable by the client library", func() {
+			fakeBackend.GetItemCall.ReturnsResult = &dynamodb.GetItemOutput{
+				Item: map[string]*dynamodb.AttributeValue{
+					"some-attribute": &dynamodb.AttributeValue{N: aws.String("42")},
+				},
+			}
+
+			output, err := client.GetItem(&dynamodb.GetItemInput{
+				TableName: aws.String("some-table"),
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(&dynamodb.GetItemOutput{
+				Item: map[string]*dynamodb.AttributeValue{
+					"some-attribute": &dynamodb.AttributeValue{N: aws.String("42")},
+				},
+			}))
+		})
+	})
+
+	Context("when the backend returns an error", func() {
+		It("should return the error in a format that is parsable by the client library", func() {
+			fakeBackend.GetItemCall.ReturnsError = &awsfaker.ErrorResponse{
+				AWSErrorCode:    "ResourceNotFoundException",
+				AWSErrorMessage: "some error message",
+				HTTPStatusCode:  http.StatusBadRequest,
+			}
+
+			_, err := client.GetItem(&dynamodb.GetItemInput{
+				TableName: aws.String("some-table"),
+			})
+
+			Expect(err).To(HaveOccurred())
+			awsErr := err.(awserr.RequestFailure)
+			Expect(awsErr.StatusCode()).To(Equal(400))
+			Expect(awsErr.Code()).To(Equal("ResourceNotFoundException"))
+			Expect(awsErr.Message()).To(Equal("some error message"))
+		})
+	})
+
+	It("should respond in the JSON version of the service", func() {
+		contentType := func(serverURL, target string) string {
+			request, err := http.NewRequest("POST", serverURL, strings.NewReader("{}"))
+			Expect(err).NotTo(HaveOccurred())
+			request.Header.Set("X-Amz-Target", target)
+			response, err := http.DefaultClient.Do(request)
+			Expect(err).NotTo(HaveOccurred())
+			response.Body.Close()
+			return response.Header.Get("Content-Type")
+		}
+
+		Expect(contentType(fakeServer.URL, "DynamoDB_20120810.GetItem")).To(Equal("application/x-amz-json-1.0"))
+		Expect(contentType(fakeServer.URL, "DynamoDB_20120810.NoSuchAction")).To(Equal("application/x-amz-json-1.0"))
+
+		kinesisServer := httptest.NewServer(jsonrpc.New(&FakeKinesisBackend{}))
+		defer kinesisServer.Close()
+		Expect(contentType(kinesisServer.URL, "Kinesis_20131202.ListStreams")).To(Equal("application/x-amz-json-1.1"))
+	})
+})
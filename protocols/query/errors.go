@@ -1,59 +1,63 @@
 package query
 
 import (
-	"encoding/json"
 	"encoding/xml"
-	"reflect"
-)
+	"fmt"
+	"net/http"
 
-type withHTTPCode interface {
-	HTTPStatusCode() int
-}
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+	"github.com/rosenhouse/awsfaker/protocols/query/queryutil"
+)
 
 type queryErrorResponse struct {
 	XMLName         xml.Name `xml:"ErrorResponse"`
+	Type            string   `xml:"Error>Type"`
 	AWSErrorCode    string   `xml:"Error>Code"`
 	AWSErrorMessage string   `xml:"Error>Message"`
 	RequestID       string   `xml:"RequestId"`
-	HttpStatusCode  int      `xml:"-"`
 }
 
-func (q queryErrorResponse) HTTPStatusCode() int { return q.HttpStatusCode }
-
 type ec2ErrorResponse struct {
 	XMLName         xml.Name `xml:"Response"`
 	AWSErrorCode    string   `xml:"Errors>Error>Code"`
 	AWSErrorMessage string   `xml:"Errors>Error>Message"`
-	RequestID       string   `xml:"RequestId"`
-	HttpStatusCode  int      `xml:"-"`
+	RequestID       string   `xml:"RequestID"`
 }
 
-func (q ec2ErrorResponse) HTTPStatusCode() int { return q.HttpStatusCode }
-
-func errCopy(src interface{}, dst interface{}) {
-	srcBytes, err := json.Marshal(src)
-	if err != nil {
-		panic(err)
+// invalidParameter returns the error that AWS sends for a parameter value
+// of the wrong type
+func invalidParameter(isEC2 bool, decodeErr *queryutil.DecodeError) *dispatch.ErrorResponse {
+	if isEC2 {
+		return &dispatch.ErrorResponse{
+			AWSErrorCode:    "InvalidParameterValue",
+			AWSErrorMessage: fmt.Sprintf("Invalid value '%s' for %s", decodeErr.Value, decodeErr.Field),
+			HTTPStatusCode:  http.StatusBadRequest,
+		}
 	}
-
-	err = json.Unmarshal(srcBytes, dst)
-	if err != nil {
-		panic(err)
+	return &dispatch.ErrorResponse{
+		AWSErrorCode:    "ValidationError",
+		AWSErrorMessage: fmt.Sprintf("Value '%s' at '%s' failed to satisfy constraint: %s", decodeErr.Value, decodeErr.Field, decodeErr.Inner),
+		HTTPStatusCode:  http.StatusBadRequest,
 	}
 }
 
-func specializeErrorResponse(method reflect.Value, genericError error) withHTTPCode {
-	if methodIsEC2(method) {
-		var specialized ec2ErrorResponse
-		specialized.AWSErrorCode = "[awsfaker missing error code]"
-		specialized.AWSErrorMessage = "[awsfaker missing error message]"
-		errCopy(genericError, &specialized)
-		return specialized
-	} else {
-		var specialized queryErrorResponse
-		specialized.AWSErrorCode = "[awsfaker missing error code]"
-		specialized.AWSErrorMessage = "[awsfaker missing error message]"
-		errCopy(genericError, &specialized)
-		return specialized
+func specializeErrorResponse(isEC2 bool, requestID string, genericError dispatch.ErrorResponse) interface{} {
+	if isEC2 {
+		return ec2ErrorResponse{
+			AWSErrorCode:    genericError.AWSErrorCode,
+			AWSErrorMessage: genericError.AWSErrorMessage,
+			RequestID:       requestID,
+		}
+	}
+
+	errorType := "Sender"
+	if genericError.HTTPStatusCode >= 500 {
+		errorType = "Receiver"
+	}
+	return queryErrorResponse{
+		Type:            errorType,
+		AWSErrorCode:    genericError.AWSErrorCode,
+		AWSErrorMessage: genericError.AWSErrorMessage,
+		RequestID:       requestID,
 	}
 }
@@ -0,0 +1,233 @@
+package query
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/private/protocol/xml/xmlutil"
+)
+
+// buildXML encodes an output like xmlutil.BuildXML.
+//
+// BuildXML puts all the entries of a flattened map, such as the Attributes of
+// an SQS message, into a single element, which the SDK cannot read back.  So
+// outputs with flattened maps are re-encoded with an element for each entry:
+//
+//	<Attribute><Name>a</Name><Value>1</Value></Attribute><Attribute><Name>b</Name>...
+//
+// Members are written in the order that the output declares them.  Outputs
+// without flattened maps are left to BuildXML.
+func buildXML(output interface{}, encoder *xml.Encoder) error {
+	if !hasFlattenedMap(reflect.TypeOf(output), map[reflect.Type]bool{}) {
+		return xmlutil.BuildXML(output, encoder)
+	}
+
+	built := &bytes.Buffer{}
+	builtEncoder := xml.NewEncoder(built)
+	if err := xmlutil.BuildXML(output, builtEncoder); err != nil {
+		return err
+	}
+	if err := builtEncoder.Flush(); err != nil {
+		return err
+	}
+	root, err := xmlutil.XMLToStruct(xml.NewDecoder(built), nil)
+	if err != nil {
+		return err
+	}
+	if err := writeChildren(encoder, root, reflect.ValueOf(output), ""); err != nil {
+		return err
+	}
+	return encoder.Flush()
+}
+
+func hasFlattenedMap(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return false
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type.Kind() == reflect.Map && field.Tag.Get("flattened") != "" {
+			return true
+		}
+		if hasFlattenedMap(field.Type, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+func elemOf(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	return value
+}
+
+func tagOr(tag reflect.StructTag, key, defaultValue string) string {
+	if value := tag.Get(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// sortedKeys returns the keys of a map in the order that BuildXML writes
+// its entries
+func sortedKeys(value reflect.Value) []reflect.Value {
+	keys := value.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	return keys
+}
+
+// writeNode writes the element of the node built from the value, whose
+// struct field carries the tag
+func writeNode(encoder *xml.Encoder, node *xmlutil.XMLNode, value reflect.Value, tag reflect.StructTag) error {
+	start := xml.StartElement{Name: node.Name, Attr: node.Attr}
+	if node.Text != "" {
+		return encoder.EncodeElement(node.Text, start)
+	}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := writeChildren(encoder, node, value, tag); err != nil {
+		return err
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// writeChildren walks the node built from the value alongside the value, and
+// writes the children of the node in the order of the value: struct members
+// in declaration order, and list members and map entries in the order that
+// BuildXML wrote them.  Flattened maps are split into one element per entry
+// on the way.
+func writeChildren(encoder *xml.Encoder, node *xmlutil.XMLNode, value reflect.Value, tag reflect.StructTag) error {
+	value = elemOf(value)
+	written := map[string]bool{}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" || field.Tag.Get("location") != "" {
+				continue
+			}
+			name := tagOr(field.Tag, "locationName", field.Name)
+			if written[name] {
+				continue
+			}
+			written[name] = true
+			if err := writeMember(encoder, name, node.Children[name], value.Field(i), field.Tag); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		name := tagOr(tag, "locationNameList", "member")
+		written[name] = true
+		for j, item := range node.Children[name] {
+			if err := writeNode(encoder, item, indexOf(value, j), ""); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		written["entry"] = true
+		keys := sortedKeys(value)
+		for j, entry := range node.Children["entry"] {
+			var entryValue reflect.Value
+			if j < len(keys) {
+				entryValue = value.MapIndex(keys[j])
+			}
+			if err := writeEntry(encoder, entry, entryValue, tag); err != nil {
+				return err
+			}
+		}
+	}
+
+	// anything that the value does not account for is written as built
+	var names []string
+	for name := range node.Children {
+		if !written[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, child := range node.Children[name] {
+			if err := xmlutil.StructToXML(encoder, child, true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeMember writes the elements built from a struct member
+func writeMember(encoder *xml.Encoder, name string, children []*xmlutil.XMLNode, member reflect.Value, tag reflect.StructTag) error {
+	member = elemOf(member)
+	flattened := tag.Get("flattened") != ""
+
+	switch {
+	case flattened && member.Kind() == reflect.Slice:
+		for j, child := range children {
+			if err := writeNode(encoder, child, indexOf(member, j), ""); err != nil {
+				return err
+			}
+		}
+	case flattened && member.Kind() == reflect.Map && len(children) > 0:
+		keyNodes := children[0].Children[tagOr(tag, "locationNameKey", "key")]
+		valueNodes := children[0].Children[tagOr(tag, "locationNameValue", "value")]
+		keys := sortedKeys(member)
+		for j := 0; j < len(keyNodes) && j < len(valueNodes) && j < len(keys); j++ {
+			entry := xml.StartElement{Name: children[0].Name}
+			if err := encoder.EncodeToken(entry); err != nil {
+				return err
+			}
+			if err := writeNode(encoder, keyNodes[j], reflect.Value{}, ""); err != nil {
+				return err
+			}
+			if err := writeNode(encoder, valueNodes[j], member.MapIndex(keys[j]), ""); err != nil {
+				return err
+			}
+			if err := encoder.EncodeToken(entry.End()); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, child := range children {
+			if err := writeNode(encoder, child, member, tag); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeEntry writes an entry of a map that is not flattened
+func writeEntry(encoder *xml.Encoder, entry *xmlutil.XMLNode, value reflect.Value, tag reflect.StructTag) error {
+	start := xml.StartElement{Name: entry.Name, Attr: entry.Attr}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, child := range entry.Children[tagOr(tag, "locationNameKey", "key")] {
+		if err := writeNode(encoder, child, reflect.Value{}, ""); err != nil {
+			return err
+		}
+	}
+	for _, child := range entry.Children[tagOr(tag, "locationNameValue", "value")] {
+		if err := writeNode(encoder, child, value, ""); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+func indexOf(list reflect.Value, i int) reflect.Value {
+	if i < list.Len() {
+		return list.Index(i)
+	}
+	return reflect.Value{}
+}
@@ -0,0 +1,127 @@
+package query_test
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol/xml/xmlutil"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rosenhouse/awsfaker/protocols/query"
+)
+
+// message and messageBatch are tagged like the SQS outputs of the SDK, and
+// messageBatch declares its members out of alphabetical order
+type message struct {
+	_ struct{} `type:"structure"`
+
+	MessageId  *string            `type:"string"`
+	Body       *string            `type:"string"`
+	Attributes map[string]*string `locationName:"Attribute" locationNameKey:"Name" locationNameValue:"Value" type:"map" flattened:"true"`
+}
+
+type messageBatch struct {
+	_ struct{} `type:"structure"`
+
+	Messages []*message `locationName:"Message" type:"list" flattened:"true"`
+	Count    *int64     `type:"integer"`
+}
+
+type FakeSQSBackend struct {
+	ReceiveMessageCall struct {
+		ReturnsResult *messageBatch
+	}
+}
+
+func (f *FakeSQSBackend) ReceiveMessage(input *sqs.ReceiveMessageInput) (*messageBatch, error) {
+	return f.ReceiveMessageCall.ReturnsResult, nil
+}
+
+type FakeSNSBackend struct{}
+
+func (f *FakeSNSBackend) GetTopicAttributes(input *sns.GetTopicAttributesInput) (*sns.GetTopicAttributesOutput, error) {
+	return &sns.GetTopicAttributesOutput{
+		Attributes: map[string]*string{"DisplayName": aws.String("some-name")},
+	}, nil
+}
+
+var _ = Describe("Encoding outputs", func() {
+	var (
+		fakeBackend *FakeSQSBackend
+		fakeServer  *httptest.Server
+	)
+
+	BeforeEach(func() {
+		fakeBackend = &FakeSQSBackend{}
+		fakeServer = httptest.NewServer(query.New(fakeBackend))
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	post := func(serverURL, action string) string {
+		response, err := http.PostForm(serverURL, url.Values{"Action": {action}})
+		Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusOK), string(body))
+		return string(body)
+	}
+
+	It("should write an element for each entry of a flattened map, which the SDK can read", func() {
+		fakeBackend.ReceiveMessageCall.ReturnsResult = &messageBatch{
+			Messages: []*message{{
+				Body: aws.String("some body"),
+				Attributes: map[string]*string{
+					"SenderId":      aws.String("some-sender"),
+					"SentTimestamp": aws.String("1234"),
+				},
+			}},
+		}
+
+		body := post(fakeServer.URL, "ReceiveMessage")
+		Expect(body).To(ContainSubstring("<Attribute><Name>SenderId</Name><Value>some-sender</Value></Attribute>" +
+			"<Attribute><Name>SentTimestamp</Name><Value>1234</Value></Attribute>"))
+
+		decoder := xml.NewDecoder(strings.NewReader(body))
+		output := &messageBatch{}
+		Expect(xmlutil.UnmarshalXML(output, decoder, "ReceiveMessageResult")).To(Succeed())
+		Expect(output).To(Equal(fakeBackend.ReceiveMessageCall.ReturnsResult))
+	})
+
+	It("should write members in the order that the output declares them", func() {
+		fakeBackend.ReceiveMessageCall.ReturnsResult = &messageBatch{
+			Messages: []*message{{
+				MessageId:  aws.String("some-message-id"),
+				Body:       aws.String("some body"),
+				Attributes: map[string]*string{"SenderId": aws.String("some-sender")},
+			}},
+			Count: aws.Int64(1),
+		}
+
+		body := post(fakeServer.URL, "ReceiveMessage")
+		Expect(body).To(ContainSubstring("<ReceiveMessageResult>" +
+			"<Message><MessageId>some-message-id</MessageId><Body>some body</Body>" +
+			"<Attribute><Name>SenderId</Name><Value>some-sender</Value></Attribute></Message>" +
+			"<Count>1</Count></ReceiveMessageResult>"))
+	})
+
+	It("should leave maps that are not flattened in entry elements", func() {
+		snsServer := httptest.NewServer(query.New(&FakeSNSBackend{}))
+		defer snsServer.Close()
+
+		body := post(snsServer.URL, "GetTopicAttributes")
+		Expect(body).To(ContainSubstring("<Attributes><entry><key>DisplayName</key><value>some-name</value></entry></Attributes>"))
+	})
+})
@@ -0,0 +1,24 @@
+package query
+
+// namespaces holds the XML namespace of the responses of each query service,
+// keyed by the name of its aws-sdk-go package.  Services not listed here
+// respond without a namespace, which the SDK does not check.
+var namespaces = map[string]string{
+	"autoscaling":      "http://autoscaling.amazonaws.com/doc/2011-01-01/",
+	"cloudformation":   "http://cloudformation.amazonaws.com/doc/2010-05-15/",
+	"cloudsearch":      "http://cloudsearch.amazonaws.com/doc/2013-01-01/",
+	"cloudwatch":       "http://monitoring.amazonaws.com/doc/2010-08-01/",
+	"ec2":              "http://ec2.amazonaws.com/doc/2016-11-15/",
+	"elasticache":      "http://elasticache.amazonaws.com/doc/2015-02-02/",
+	"elasticbeanstalk": "http://elasticbeanstalk.amazonaws.com/docs/2010-12-01/",
+	"elb":              "http://elasticloadbalancing.amazonaws.com/doc/2012-06-01/",
+	"elbv2":            "http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/",
+	"iam":              "https://iam.amazonaws.com/doc/2010-05-08/",
+	"rds":              "http://rds.amazonaws.com/doc/2014-10-31/",
+	"redshift":         "http://redshift.amazonaws.com/doc/2012-12-01/",
+	"ses":              "http://ses.amazonaws.com/doc/2010-12-01/",
+	"simpledb":         "http://sdb.amazonaws.com/doc/2009-04-15/",
+	"sns":              "http://sns.amazonaws.com/doc/2010-03-31/",
+	"sqs":              "http://queue.amazonaws.com/doc/2012-11-05/",
+	"sts":              "https://sts.amazonaws.com/doc/2011-06-15/",
+}
@@ -8,127 +8,137 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"reflect"
+	"path"
 	"strings"
 
-	"github.com/aws/aws-sdk-go/private/protocol/xml/xmlutil"
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
 	"github.com/rosenhouse/awsfaker/protocols/query/queryutil"
 )
 
 // A Handler is an http.Handler that can mimic an AWS service API
 type Handler struct {
-	actions map[string]reflect.Value
-}
-
-func (h *Handler) registerService(awsService interface{}) {
-	service := reflect.ValueOf(awsService)
-	if !service.IsValid() {
-		panic("invalid service interface")
-	}
-	if service.Kind() != reflect.Ptr {
-		panic("expecting struct pointer as service interface")
-	}
-	if !service.Elem().IsValid() {
-		panic("expectingn non-nil pointer as service interface")
-	}
-	serviceType := service.Type()
-	n := service.NumMethod()
-	if n == 0 {
-		panic("no methods on service interface")
-	}
-	for i := 0; i < n; i++ {
-		h.actions[serviceType.Method(i).Name] = service.Method(i)
-	}
+	*dispatch.Handler
 }
 
 // New returns a new Handler that will dispatch incoming requests to
 // one or more fake service backends given as arguments.
 func New(serviceBackend interface{}) *Handler {
-	handler := &Handler{make(map[string]reflect.Value)}
-	handler.registerService(serviceBackend)
-	return handler
+	backend := dispatch.NewBackend(serviceBackend)
+	codec := &codec{
+		isEC2:     backendIsEC2(backend),
+		namespace: namespaces[servicePackage(backend)],
+	}
+	return &Handler{dispatch.NewHandler(backend, codec)}
 }
 
-func (f *Handler) findMethod(actionName string) (reflect.Value, error) {
-	method, ok := f.actions[actionName]
-	if !ok {
-		return reflect.Value{}, fmt.Errorf("action %s not found, check that you've fully implemented your fake backend", actionName)
-	}
-	return method, nil
+type codec struct {
+	isEC2     bool
+	namespace string
 }
 
-// ServeHTTP dispatches a request to a backend method and writes the response
-func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (c *codec) ReadRequest(r *http.Request) (string, func(interface{}) error, error) {
 	queryValues, err := parseQueryRequest(r)
 	if err != nil {
-		panic(err)
+		return "", nil, err
 	}
-	methodName := queryValues.Get("Action")
-	method, err := f.findMethod(methodName)
-	if err != nil {
-		panic(err)
+	decode := func(input interface{}) error {
+		return constructInput(input, queryValues, c.isEC2)
 	}
+	return queryValues.Get("Action"), decode, nil
+}
 
-	input, err := constructInput(method, queryValues)
+func (c *codec) WriteResponse(w http.ResponseWriter, requestID string, action string, output interface{}) error {
+	body, err := c.buildResponse(requestID, action, output)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	c.setHeaders(w, requestID)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body)
+	return err
+}
 
-	results := method.Call([]reflect.Value{reflect.ValueOf(input)})
-	errVal := results[1].Interface()
-	if errVal != nil {
-		errorResponse := errVal.(error)
-		err := specializeErrorResponse(method, errorResponse)
-		writeError(w, err)
-		return
+func (c *codec) ProtocolErrors() dispatch.ProtocolErrors {
+	return dispatch.ProtocolErrors{
+		UnknownAction:    "InvalidAction",
+		MalformedRequest: "MalformedQueryString",
 	}
+}
 
-	outVal := results[0].Interface()
+func (c *codec) WriteError(w http.ResponseWriter, requestID string, errorResponse dispatch.ErrorResponse) error {
+	responseBodyBytes, err := xml.Marshal(specializeErrorResponse(c.isEC2, requestID, errorResponse))
 	if err != nil {
-		panic(err)
+		return err
 	}
-	writeResponse(w, http.StatusOK, methodName, outVal)
+
+	c.setHeaders(w, requestID)
+	w.WriteHeader(errorResponse.HTTPStatusCode)
+	_, err = w.Write(responseBodyBytes)
+	return err
 }
 
-func writeResponse(w http.ResponseWriter, statusCode int, action string, data interface{}) {
+func (c *codec) setHeaders(w http.ResponseWriter, requestID string) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.Header().Set("X-Amzn-RequestId", requestID)
+}
+
+// buildResponse encodes the output in the envelope used by the service.
+// Query services wrap it like
+//
+//	<ActionResponse xmlns="..."><ActionResult>...</ActionResult><ResponseMetadata><RequestId>...
+//
+// while EC2 puts the output members directly in the response element
+//
+//	<ActionResponse xmlns="..."><requestId>...</requestId>...
+func (c *codec) buildResponse(requestID string, action string, output interface{}) ([]byte, error) {
 	responseBuffer := &bytes.Buffer{}
 	encoder := xml.NewEncoder(responseBuffer)
-	resultWrapper := xml.StartElement{Name: xml.Name{Local: action + "Result"}}
-	err := encoder.EncodeToken(resultWrapper)
-	if err != nil {
-		panic(err)
-	}
-	err = xmlutil.BuildXML(data, encoder)
-	if err != nil {
-		panic(err)
-	}
-	err = encoder.EncodeToken(resultWrapper.End())
-	if err != nil {
-		panic(err)
-	}
-	err = encoder.Flush()
-	if err != nil {
-		panic(err)
-	}
 
-	w.WriteHeader(statusCode)
-	_, err = w.Write(responseBuffer.Bytes())
-	if err != nil {
-		panic(err)
-	}
+	responseWrapper := xml.StartElement{Name: xml.Name{Local: action + "Response"}}
+	if c.namespace != "" {
+		responseWrapper.Attr = []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: c.namespace}}
+	}
+	if err := encoder.EncodeToken(responseWrapper); err != nil {
+		return nil, err
+	}
+
+	if c.isEC2 {
+		if err := encodeElement(encoder, "requestId", requestID); err != nil {
+			return nil, err
+		}
+		if err := buildXML(output, encoder); err != nil {
+			return nil, err
+		}
+	} else {
+		resultWrapper := xml.StartElement{Name: xml.Name{Local: action + "Result"}}
+		if err := encoder.EncodeToken(resultWrapper); err != nil {
+			return nil, err
+		}
+		if err := buildXML(output, encoder); err != nil {
+			return nil, err
+		}
+		if err := encoder.EncodeToken(resultWrapper.End()); err != nil {
+			return nil, err
+		}
+		metadata := struct {
+			RequestID string `xml:"RequestId"`
+		}{requestID}
+		if err := encoder.EncodeElement(metadata, xml.StartElement{Name: xml.Name{Local: "ResponseMetadata"}}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := encoder.EncodeToken(responseWrapper.End()); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return responseBuffer.Bytes(), nil
 }
 
-func writeError(w http.ResponseWriter, errorResponse withHTTPCode) {
-	responseBodyBytes, err := xml.Marshal(errorResponse)
-	if err != nil {
-		panic(err)
-	}
-
-	w.WriteHeader(errorResponse.HTTPStatusCode())
-	_, err = w.Write(responseBodyBytes)
-	if err != nil {
-		panic(err)
-	}
+func encodeElement(encoder *xml.Encoder, name string, value string) error {
+	return encoder.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}})
 }
 
 func parseQueryRequest(r *http.Request) (url.Values, error) {
@@ -143,17 +153,39 @@ func parseQueryRequest(r *http.Request) (url.Values, error) {
 		return nil, fmt.Errorf("unable to parse request body as query syntax: %s", err)
 	}
 
-	return values, err
+	// requests without a body carry their parameters in the URL, as in the
+	// links that SNS sends to confirm or cancel a subscription
+	if r.Method == "GET" || len(requestBodyBytes) == 0 {
+		for name, urlValues := range r.URL.Query() {
+			values[name] = append(values[name], urlValues...)
+		}
+	}
+	return values, nil
+}
+
+func methodIsEC2(method dispatch.Method) bool {
+	return strings.HasSuffix(method.InputType().PkgPath(), "ec2")
 }
 
-func methodIsEC2(method reflect.Value) bool {
-	return strings.HasSuffix(method.Type().In(0).Elem().PkgPath(), "ec2")
+// servicePackage returns the name of the aws-sdk-go package that defines
+// the inputs of the backend, e.g. cloudformation
+func servicePackage(backend *dispatch.Backend) string {
+	return path.Base(backend.Methods()[0].InputType().PkgPath())
 }
 
-func constructInput(method reflect.Value, queryValues url.Values) (interface{}, error) {
-	inputValueType := method.Type().In(0).Elem()
-	inputValue := reflect.New(inputValueType).Interface()
-	isEC2 := methodIsEC2(method)
-	queryutil.Decode(queryValues, inputValue, isEC2)
-	return inputValue, nil
+func backendIsEC2(backend *dispatch.Backend) bool {
+	for _, method := range backend.Methods() {
+		if methodIsEC2(method) {
+			return true
+		}
+	}
+	return false
+}
+
+func constructInput(input interface{}, queryValues url.Values, isEC2 bool) error {
+	err := queryutil.Decode(queryValues, input, isEC2)
+	if decodeErr, ok := err.(*queryutil.DecodeError); ok {
+		return invalidParameter(isEC2, decodeErr)
+	}
+	return err
 }
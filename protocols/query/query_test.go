@@ -0,0 +1,70 @@
+package query_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rosenhouse/awsfaker/protocols/query"
+)
+
+type FakeSubscriptionBackend struct {
+	ConfirmSubscriptionCall struct {
+		Receives *sns.ConfirmSubscriptionInput
+	}
+}
+
+func (f *FakeSubscriptionBackend) ConfirmSubscription(input *sns.ConfirmSubscriptionInput) (*sns.ConfirmSubscriptionOutput, error) {
+	f.ConfirmSubscriptionCall.Receives = input
+	return &sns.ConfirmSubscriptionOutput{}, nil
+}
+
+var _ = Describe("Reading requests", func() {
+	var (
+		fakeBackend *FakeSubscriptionBackend
+		fakeServer  *httptest.Server
+	)
+
+	BeforeEach(func() {
+		fakeBackend = &FakeSubscriptionBackend{}
+		fakeServer = httptest.NewServer(query.New(fakeBackend))
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	It("should read the parameters of a GET request from the URL", func() {
+		query := url.Values{"Action": {"ConfirmSubscription"}, "TopicArn": {"some-topic-arn"}, "Token": {"some-token"}}
+		response, err := http.Get(fakeServer.URL + "/?" + query.Encode())
+		Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+
+		Expect(fakeBackend.ConfirmSubscriptionCall.Receives).To(Equal(&sns.ConfirmSubscriptionInput{
+			TopicArn: aws.String("some-topic-arn"),
+			Token:    aws.String("some-token"),
+		}))
+	})
+
+	It("should read the parameters of a request with a body from the body alone", func() {
+		body := url.Values{"Action": {"ConfirmSubscription"}, "TopicArn": {"some-topic-arn"}, "Token": {"some-token"}}
+		query := url.Values{"TopicArn": {"some-other-topic-arn"}, "AuthenticateOnUnsubscribe": {"true"}}
+		response, err := http.Post(fakeServer.URL+"/?"+query.Encode(), "application/x-www-form-urlencoded", strings.NewReader(body.Encode()))
+		Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+
+		Expect(fakeBackend.ConfirmSubscriptionCall.Receives).To(Equal(&sns.ConfirmSubscriptionInput{
+			TopicArn: aws.String("some-topic-arn"),
+			Token:    aws.String("some-token"),
+		}))
+	})
+})
@@ -2,12 +2,14 @@ package queryutil
 
 import "fmt"
 
-type decodeError struct {
+// A DecodeError describes a query parameter whose value could not be
+// converted to the type of the field it names
+type DecodeError struct {
 	Field string
 	Value string
 	Inner error
 }
 
-func (de *decodeError) Error() string {
+func (de *DecodeError) Error() string {
 	return fmt.Sprintf("error parsing field %q value %q: %s", de.Field, de.Value, de.Inner)
 }
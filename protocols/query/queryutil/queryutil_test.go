@@ -114,3 +114,18 @@ var _ = Describe("Encode / decode cycle", func() {
 	})
 
 })
+
+var _ = Describe("Decoding malformed values", func() {
+	It("should return a DecodeError naming the field", func() {
+		encoded := url.Values{"StructArray.member.1.Bool": {"not-a-bool"}}
+
+		decoded := dataObject{}
+		err := queryutil.Decode(encoded, &decoded, false)
+		Expect(err).To(BeAssignableToTypeOf(&queryutil.DecodeError{}))
+
+		decodeErr := err.(*queryutil.DecodeError)
+		Expect(decodeErr.Field).To(Equal("StructArray.member.1.Bool"))
+		Expect(decodeErr.Value).To(Equal("not-a-bool"))
+		Expect(decodeErr.Inner).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,386 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RFC822 is the timestamp format used in HTTP headers
+const RFC822 = "Mon, 2 Jan 2006 15:04:05 GMT"
+
+// ISO8601 is the timestamp format used in the URI and query string
+const ISO8601 = "2006-01-02T15:04:05Z"
+
+var (
+	byteSliceType = reflect.TypeOf([]byte{})
+	timeType      = reflect.TypeOf(time.Time{})
+	readSeeker    = reflect.TypeOf((*io.ReadSeeker)(nil)).Elem()
+	readCloser    = reflect.TypeOf((*io.ReadCloser)(nil)).Elem()
+)
+
+// BindRequest sets the fields of the input struct that are bound to the URI,
+// the query string or the HTTP headers
+func BindRequest(input interface{}, r *http.Request, labels map[string]string) error {
+	v := reflect.ValueOf(input).Elem()
+	t := v.Type()
+	query := r.URL.Query()
+
+	for i := 0; i < v.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // ignore unexported fields
+		}
+		name := field.Tag.Get("locationName")
+		if name == "" {
+			name = field.Name
+		}
+
+		var err error
+		switch field.Tag.Get("location") {
+		case "uri":
+			if value, ok := labels[name]; ok {
+				err = setScalar(v.Field(i), field.Tag, value, ISO8601)
+			}
+		case "querystring":
+			err = bindQuery(v.Field(i), field.Tag, name, query)
+		case "header":
+			if value := r.Header.Get(name); value != "" {
+				err = setScalar(v.Field(i), field.Tag, value, RFC822)
+			}
+		case "headers":
+			bindHeaderMap(v.Field(i), name, r.Header)
+		}
+		if err != nil {
+			return &BindError{Field: field.Name, Inner: err}
+		}
+	}
+	return nil
+}
+
+// A BindError describes a URI, query string or header value that could not
+// be converted to the type of its input field
+type BindError struct {
+	Field string
+	Inner error
+}
+
+func (e *BindError) Error() string {
+	return fmt.Sprintf("error binding field %q: %s", e.Field, e.Inner)
+}
+
+func bindQuery(field reflect.Value, tag reflect.StructTag, name string, query map[string][]string) error {
+	switch field.Kind() {
+	case reflect.Slice:
+		if field.Type() == byteSliceType {
+			break
+		}
+		values, ok := query[name]
+		if !ok {
+			return nil
+		}
+		list := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setScalar(list.Index(i), "", value, ISO8601); err != nil {
+				return err
+			}
+		}
+		field.Set(list)
+		return nil
+	case reflect.Map:
+		m := reflect.MakeMap(field.Type())
+		for key, values := range query {
+			element := reflect.New(field.Type().Elem()).Elem()
+			if err := setScalar(element, "", values[0], ISO8601); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key), element)
+		}
+		field.Set(m)
+		return nil
+	}
+
+	values, ok := query[name]
+	if !ok || len(values) == 0 {
+		return nil
+	}
+	return setScalar(field, tag, values[0], ISO8601)
+}
+
+func bindHeaderMap(field reflect.Value, prefix string, header http.Header) {
+	m := reflect.MakeMap(field.Type())
+	for key, values := range header {
+		if !strings.HasPrefix(strings.ToLower(key), strings.ToLower(prefix)) {
+			continue
+		}
+		value := values[0]
+		m.SetMapIndex(reflect.ValueOf(key[len(prefix):]), reflect.ValueOf(&value))
+	}
+	if m.Len() > 0 {
+		field.Set(m)
+	}
+}
+
+func setScalar(field reflect.Value, tag reflect.StructTag, value string, timeFormat string) error {
+	if field.Kind() == reflect.Ptr {
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+
+	if tag.Get("jsonvalue") == "true" {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return err
+		}
+		ptr := reflect.New(field.Type())
+		if err := json.Unmarshal(decoded, ptr.Interface()); err != nil {
+			return err
+		}
+		field.Set(ptr.Elem())
+		return nil
+	}
+
+	switch {
+	case field.Type() == byteSliceType:
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return err
+		}
+		field.SetBytes(decoded)
+	case field.Type() == timeType:
+		parsed, err := parseTime(value, tag, timeFormat)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(parsed.UTC()))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case field.Kind() == reflect.Int64, field.Kind() == reflect.Int:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+	case field.Kind() == reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(parsed)
+	default:
+		return fmt.Errorf("unsupported value type %s", field.Type())
+	}
+	return nil
+}
+
+func parseTime(value string, tag reflect.StructTag, defaultFormat string) (time.Time, error) {
+	switch tag.Get("timestampFormat") {
+	case "unixTimestamp":
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(int64(seconds), 0).UTC(), nil
+	case "iso8601":
+		return time.Parse(ISO8601, value)
+	case "rfc822":
+		return time.Parse(RFC822, value)
+	}
+	parsed, err := time.Parse(defaultFormat, value)
+	if err != nil {
+		return time.Parse(time.RFC3339, value)
+	}
+	return parsed, nil
+}
+
+// PayloadField returns the struct field named by the payload tag of a
+// request or response struct, if there is one
+func PayloadField(t reflect.Type) (reflect.StructField, bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	metadata, ok := t.FieldByName("_")
+	if !ok {
+		return reflect.StructField{}, false
+	}
+	payload := metadata.Tag.Get("payload")
+	if payload == "" {
+		return reflect.StructField{}, false
+	}
+	return t.FieldByName(payload)
+}
+
+// HasRawPayload reports whether the payload of a request or response struct
+// is sent as the raw HTTP body, rather than as an encoded structure
+func HasRawPayload(t reflect.Type) bool {
+	field, ok := PayloadField(t)
+	if !ok {
+		return false
+	}
+	switch field.Tag.Get("type") {
+	case "blob", "string":
+		return true
+	case "structure":
+		return false
+	}
+	return field.Type == byteSliceType || field.Type.Kind() == reflect.Interface
+}
+
+// SetRawPayload stores the HTTP request body in the payload field of the input
+func SetRawPayload(input interface{}, body []byte) {
+	v := reflect.ValueOf(input).Elem()
+	field, _ := PayloadField(v.Type())
+	payload := v.FieldByIndex(field.Index)
+
+	switch {
+	case payload.Type() == byteSliceType:
+		payload.SetBytes(body)
+	case payload.Type() == readSeeker:
+		payload.Set(reflect.ValueOf(bytes.NewReader(body)))
+	case payload.Type() == readCloser:
+		payload.Set(reflect.ValueOf(ioutil.NopCloser(bytes.NewReader(body))))
+	case payload.Kind() == reflect.Ptr && payload.Type().Elem().Kind() == reflect.String:
+		s := string(body)
+		payload.Set(reflect.ValueOf(&s))
+	}
+}
+
+// RawPayload returns a reader for the payload field of the output, or nil
+// if the field is not set
+func RawPayload(output interface{}) io.Reader {
+	v := reflect.Indirect(reflect.ValueOf(output))
+	if !v.IsValid() {
+		return nil
+	}
+	field, _ := PayloadField(v.Type())
+	payload := v.FieldByIndex(field.Index)
+
+	switch value := payload.Interface().(type) {
+	case []byte:
+		return bytes.NewReader(value)
+	case *string:
+		if value == nil {
+			return nil
+		}
+		return strings.NewReader(*value)
+	case io.Reader:
+		return value
+	}
+	return nil
+}
+
+// WriteHeaders sets the response headers that are bound to fields of the
+// output, and returns the status code given by the output or else 200 OK.
+// A status code that net/http cannot write, such as 0, is ignored.
+func WriteHeaders(w http.ResponseWriter, output interface{}) (int, error) {
+	statusCode := http.StatusOK
+	v := reflect.Indirect(reflect.ValueOf(output))
+	if !v.IsValid() {
+		return statusCode, nil
+	}
+	t := v.Type()
+
+	for i := 0; i < v.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+		if field.PkgPath != "" || isNil(value) {
+			continue
+		}
+		name := field.Tag.Get("locationName")
+		if name == "" {
+			name = field.Name
+		}
+
+		switch field.Tag.Get("location") {
+		case "statusCode":
+			if code := int(reflect.Indirect(value).Int()); code >= 100 && code <= 999 {
+				statusCode = code
+			}
+		case "header":
+			formatted, err := formatScalar(value, field.Tag)
+			if err != nil {
+				return 0, &BindError{Field: field.Name, Inner: err}
+			}
+			w.Header().Set(name, formatted)
+		case "headers":
+			for _, key := range value.MapKeys() {
+				element := reflect.Indirect(value.MapIndex(key))
+				if element.IsValid() {
+					w.Header().Set(name+key.String(), element.String())
+				}
+			}
+		}
+	}
+	return statusCode, nil
+}
+
+func isNil(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return value.IsNil()
+	}
+	return false
+}
+
+func formatScalar(value reflect.Value, tag reflect.StructTag) (string, error) {
+	if tag.Get("jsonvalue") == "true" {
+		encoded, err := json.Marshal(value.Interface())
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(encoded), nil
+	}
+
+	switch v := reflect.Indirect(value).Interface().(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case time.Time:
+		switch tag.Get("timestampFormat") {
+		case "unixTimestamp":
+			return strconv.FormatInt(v.Unix(), 10), nil
+		case "iso8601":
+			return v.UTC().Format(ISO8601), nil
+		}
+		return v.UTC().Format(RFC822), nil
+	}
+	return "", fmt.Errorf("unsupported value type %s", value.Type())
+}
+
+// WriteBody writes the status code and the body, if any.  Bodies are dropped
+// from responses that may not have one, such as responses to HEAD requests.
+func WriteBody(w http.ResponseWriter, statusCode int, body io.Reader) error {
+	w.WriteHeader(statusCode)
+	if body == nil {
+		return nil
+	}
+	if closer, ok := body.(io.Closer); ok {
+		defer closer.Close()
+	}
+	_, err := io.Copy(w, body)
+	if err == http.ErrBodyNotAllowed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package rest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rosenhouse/awsfaker/protocols/rest"
+)
+
+type someInput struct {
+	_ struct{} `type:"structure" payload:"Body"`
+
+	Body      []byte             `type:"blob"`
+	Bucket    *string            `location:"uri" locationName:"Bucket" type:"string"`
+	Count     *int64             `location:"querystring" locationName:"count" type:"integer"`
+	Names     []*string          `location:"querystring" locationName:"name" type:"list"`
+	Modified  *time.Time         `location:"header" locationName:"If-Modified-Since" type:"timestamp"`
+	Enabled   *bool              `location:"header" locationName:"X-Enabled" type:"boolean"`
+	Metadata  map[string]*string `location:"headers" locationName:"x-amz-meta-" type:"map"`
+	Unrelated *string            `type:"string"`
+}
+
+type someOutput struct {
+	_ struct{} `type:"structure"`
+
+	ETag       *string            `location:"header" locationName:"ETag" type:"string"`
+	Metadata   map[string]*string `location:"headers" locationName:"x-amz-meta-" type:"map"`
+	StatusCode *int64             `location:"statusCode" type:"integer"`
+	Other      *string            `type:"string"`
+}
+
+var _ = Describe("Binding request locations", func() {
+	It("should set URI, querystring and header fields", func() {
+		r, err := http.NewRequest("PUT", "http://example.com/some-bucket?count=3&name=a&name=b", nil)
+		Expect(err).NotTo(HaveOccurred())
+		r.Header.Set("If-Modified-Since", "Mon, 2 Jan 2006 15:04:05 GMT")
+		r.Header.Set("X-Enabled", "true")
+		r.Header.Set("X-Amz-Meta-Color", "blue")
+
+		input := &someInput{}
+		err = rest.BindRequest(input, r, map[string]string{"Bucket": "some-bucket"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(input.Bucket).To(Equal(aws.String("some-bucket")))
+		Expect(input.Count).To(Equal(aws.Int64(3)))
+		Expect(input.Names).To(Equal([]*string{aws.String("a"), aws.String("b")}))
+		Expect(input.Modified).To(Equal(aws.Time(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))))
+		Expect(input.Enabled).To(Equal(aws.Bool(true)))
+		Expect(input.Metadata).To(Equal(map[string]*string{"Color": aws.String("blue")}))
+		Expect(input.Unrelated).To(BeNil())
+	})
+
+	It("should report values that cannot be converted", func() {
+		r, _ := http.NewRequest("GET", "http://example.com/?count=many", nil)
+		err := rest.BindRequest(&someInput{}, r, nil)
+		Expect(err).To(MatchError(`error binding field "Count": strconv.ParseInt: parsing "many": invalid syntax`))
+	})
+})
+
+var _ = Describe("Raw payloads", func() {
+	It("should detect blob payloads", func() {
+		Expect(rest.HasRawPayload(reflect.TypeOf(&someInput{}))).To(BeTrue())
+		Expect(rest.HasRawPayload(reflect.TypeOf(&someOutput{}))).To(BeFalse())
+	})
+
+	It("should copy the body into and out of the payload field", func() {
+		input := &someInput{}
+		rest.SetRawPayload(input, []byte("some body"))
+		Expect(input.Body).To(Equal([]byte("some body")))
+
+		body, err := ioutil.ReadAll(rest.RawPayload(input))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("some body"))
+	})
+})
+
+var _ = Describe("Writing response headers", func() {
+	It("should set header fields and return the status code", func() {
+		recorder := httptest.NewRecorder()
+		statusCode, err := rest.WriteHeaders(recorder, &someOutput{
+			ETag:       aws.String(`"some-etag"`),
+			Metadata:   map[string]*string{"Color": aws.String("blue")},
+			StatusCode: aws.Int64(206),
+			Other:      aws.String("not a header"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(206))
+		Expect(recorder.Header().Get("ETag")).To(Equal(`"some-etag"`))
+		Expect(recorder.Header().Get("X-Amz-Meta-Color")).To(Equal("blue"))
+		Expect(strings.Join(recorder.Header()["Other"], "")).To(BeEmpty())
+	})
+
+	It("should default to 200 OK, also for status codes that cannot be written", func() {
+		statusCode, err := rest.WriteHeaders(httptest.NewRecorder(), &someOutput{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statusCode).To(Equal(http.StatusOK))
+
+		for _, invalid := range []int64{0, 42, 1000} {
+			statusCode, err = rest.WriteHeaders(httptest.NewRecorder(), &someOutput{StatusCode: aws.Int64(invalid)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statusCode).To(Equal(http.StatusOK))
+		}
+	})
+})
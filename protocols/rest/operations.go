@@ -0,0 +1,125 @@
+// Package rest supports the REST-style AWS protocols, restjson and restxml.
+//
+// These protocols identify an action by its HTTP method and URI rather than
+// by an Action parameter, and bind input and output fields to the URI, the
+// query string and the HTTP headers.  The method and URI template of each
+// operation are taken from the request.Operation that the aws-sdk-go client
+// for the service builds in its XxxRequest method, so nothing beyond the
+// compiled SDK is needed at runtime.
+package rest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/apigateway"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	"github.com/aws/aws-sdk-go/service/cloudsearchdomain"
+	"github.com/aws/aws-sdk-go/service/cognitosync"
+	"github.com/aws/aws-sdk-go/service/efs"
+	"github.com/aws/aws-sdk-go/service/elasticsearchservice"
+	"github.com/aws/aws-sdk-go/service/elastictranscoder"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/aws/aws-sdk-go/service/iot"
+	"github.com/aws/aws-sdk-go/service/iotdataplane"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/mobileanalytics"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// An Operation describes the HTTP binding of one API action
+type Operation struct {
+	Name       string
+	HTTPMethod string
+	HTTPPath   string
+}
+
+const sdkServicePrefix = "github.com/aws/aws-sdk-go/service/"
+
+// clientConstructors builds the aws-sdk-go client of each REST service,
+// keyed by package name.  They cover the restjson and restxml services
+// listed in internal/detect.
+var clientConstructors = map[string]func(client.ConfigProvider) interface{}{
+	"apigateway":           func(p client.ConfigProvider) interface{} { return apigateway.New(p) },
+	"cloudfront":           func(p client.ConfigProvider) interface{} { return cloudfront.New(p) },
+	"cloudsearchdomain":    func(p client.ConfigProvider) interface{} { return cloudsearchdomain.New(p) },
+	"cognitosync":          func(p client.ConfigProvider) interface{} { return cognitosync.New(p) },
+	"efs":                  func(p client.ConfigProvider) interface{} { return efs.New(p) },
+	"elasticsearchservice": func(p client.ConfigProvider) interface{} { return elasticsearchservice.New(p) },
+	"elastictranscoder":    func(p client.ConfigProvider) interface{} { return elastictranscoder.New(p) },
+	"glacier":              func(p client.ConfigProvider) interface{} { return glacier.New(p) },
+	"iot":                  func(p client.ConfigProvider) interface{} { return iot.New(p) },
+	"iotdataplane":         func(p client.ConfigProvider) interface{} { return iotdataplane.New(p) },
+	"lambda":               func(p client.ConfigProvider) interface{} { return lambda.New(p) },
+	"mobileanalytics":      func(p client.ConfigProvider) interface{} { return mobileanalytics.New(p) },
+	"route53":              func(p client.ConfigProvider) interface{} { return route53.New(p) },
+	"s3":                   func(p client.ConfigProvider) interface{} { return s3.New(p) },
+}
+
+var clientsCache = struct {
+	sync.Mutex
+	byPackage map[string]reflect.Value
+}{byPackage: map[string]reflect.Value{}}
+
+// serviceClient returns an aws-sdk-go client for the service package.  The
+// client only ever builds requests, so it is never given real credentials
+// or a reachable endpoint.
+func serviceClient(pkgPath string) (reflect.Value, error) {
+	clientsCache.Lock()
+	defer clientsCache.Unlock()
+
+	if c, ok := clientsCache.byPackage[pkgPath]; ok {
+		return c, nil
+	}
+
+	newClient, ok := clientConstructors[strings.TrimPrefix(pkgPath, sdkServicePrefix)]
+	if !ok || !strings.HasPrefix(pkgPath, sdkServicePrefix) {
+		return reflect.Value{}, fmt.Errorf("%s is not a supported REST service", pkgPath)
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.AnonymousCredentials,
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String("http://localhost"),
+	})
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	c := reflect.ValueOf(newClient(sess))
+	clientsCache.byPackage[pkgPath] = c
+	return c, nil
+}
+
+// FindOperation returns the HTTP binding of the named action, whose input is
+// of the given struct type from an aws-sdk-go service package.  The binding
+// is read from the request built by the client's XxxRequest method.
+func FindOperation(name string, inputType reflect.Type) (Operation, error) {
+	c, err := serviceClient(inputType.PkgPath())
+	if err != nil {
+		return Operation{}, err
+	}
+
+	method := c.MethodByName(name + "Request")
+	if !method.IsValid() || method.Type().NumIn() != 1 || method.Type().NumOut() != 2 || method.Type().In(0) != reflect.PtrTo(inputType) {
+		return Operation{}, fmt.Errorf("no operation named %s in %s", name, inputType.PkgPath())
+	}
+	results := method.Call([]reflect.Value{reflect.Zero(reflect.PtrTo(inputType))})
+	req, ok := results[0].Interface().(*request.Request)
+	if !ok || req == nil || req.Operation == nil {
+		return Operation{}, fmt.Errorf("unable to build a request for %s in %s", name, inputType.PkgPath())
+	}
+
+	return Operation{
+		Name:       req.Operation.Name,
+		HTTPMethod: req.Operation.HTTPMethod,
+		HTTPPath:   req.Operation.HTTPPath,
+	}, nil
+}
@@ -0,0 +1,51 @@
+package rest_test
+
+import (
+	"os"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rosenhouse/awsfaker/protocols/rest"
+)
+
+var _ = Describe("Finding operations", func() {
+	It("should read the HTTP binding from the SDK client", func() {
+		operation, err := rest.FindOperation("PutObject", reflect.TypeOf(s3.PutObjectInput{}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operation).To(Equal(rest.Operation{Name: "PutObject", HTTPMethod: "PUT", HTTPPath: "/{Bucket}/{Key+}"}))
+
+		operation, err = rest.FindOperation("Invoke", reflect.TypeOf(lambda.InvokeInput{}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operation.HTTPMethod).To(Equal("POST"))
+		Expect(operation.HTTPPath).To(Equal("/2015-03-31/functions/{FunctionName}/invocations"))
+	})
+
+	It("should not need the aws-sdk-go source", func() {
+		workingDir, err := os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		defer os.Chdir(workingDir)
+		Expect(os.Chdir(os.TempDir())).To(Succeed())
+
+		_, err = rest.FindOperation("GetObject", reflect.TypeOf(s3.GetObjectInput{}))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject operations that do not take the input type", func() {
+		_, err := rest.FindOperation("GetObject", reflect.TypeOf(s3.PutObjectInput{}))
+		Expect(err).To(MatchError("no operation named GetObject in github.com/aws/aws-sdk-go/service/s3"))
+
+		_, err = rest.FindOperation("NoSuchThing", reflect.TypeOf(s3.PutObjectInput{}))
+		Expect(err).To(MatchError("no operation named NoSuchThing in github.com/aws/aws-sdk-go/service/s3"))
+	})
+
+	It("should reject services that are not REST services", func() {
+		_, err := rest.FindOperation("CreateStack", reflect.TypeOf(cloudformation.CreateStackInput{}))
+		Expect(err).To(MatchError("github.com/aws/aws-sdk-go/service/cloudformation is not a supported REST service"))
+	})
+})
@@ -0,0 +1,178 @@
+package rest
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+)
+
+// A Router identifies the action targeted by a request, using the HTTP
+// method and URI template of each operation
+type Router struct {
+	routes []route
+}
+
+type route struct {
+	action string
+	method string
+
+	// matches the escaped request path, capturing URI labels
+	pattern *regexp.Regexp
+	labels  []string
+
+	// constraints from the query portion of the template, e.g. ?uploads
+	query url.Values
+
+	// names of required querystring and header input fields, which
+	// distinguish operations that share a method and path
+	requiredQuery  []string
+	requiredHeader []string
+
+	literalLength int
+}
+
+var labelPattern = regexp.MustCompile(`\{([^}+]+)(\+?)\}`)
+
+// NewRouter builds a Router for the actions implemented by the given backend
+func NewRouter(backend *dispatch.Backend) (*Router, error) {
+	router := &Router{}
+	for _, method := range backend.Methods() {
+		inputType := method.InputType()
+		operation, err := FindOperation(method.Name, inputType)
+		if err != nil {
+			return nil, err
+		}
+		router.routes = append(router.routes, newRoute(operation, inputType))
+	}
+	return router, nil
+}
+
+func newRoute(operation Operation, inputType reflect.Type) route {
+	r := route{action: operation.Name, method: operation.HTTPMethod}
+	if r.method == "" {
+		r.method = "POST"
+	}
+
+	path := operation.HTTPPath
+	if i := strings.Index(path, "?"); i >= 0 {
+		r.query, _ = url.ParseQuery(path[i+1:])
+		path = path[:i]
+	}
+
+	pattern := "^"
+	last := 0
+	for _, match := range labelPattern.FindAllStringSubmatchIndex(path, -1) {
+		literal := path[last:match[0]]
+		pattern += regexp.QuoteMeta(literal)
+		r.literalLength += len(literal)
+
+		r.labels = append(r.labels, path[match[2]:match[3]])
+		if greedy := match[5] > match[4]; greedy {
+			pattern += "(.+)"
+		} else {
+			pattern += "([^/]+)"
+		}
+		last = match[1]
+	}
+	pattern += regexp.QuoteMeta(path[last:]) + "$"
+	r.literalLength += len(path) - last
+	r.pattern = regexp.MustCompile(pattern)
+
+	for i := 0; i < inputType.NumField(); i++ {
+		field := inputType.Field(i)
+		if field.Tag.Get("required") != "true" {
+			continue
+		}
+		switch field.Tag.Get("location") {
+		case "querystring":
+			r.requiredQuery = append(r.requiredQuery, field.Tag.Get("locationName"))
+		case "header":
+			r.requiredHeader = append(r.requiredHeader, field.Tag.Get("locationName"))
+		}
+	}
+
+	return r
+}
+
+// specificity ranks routes that match the same request, so that e.g.
+// UploadPart wins over PutObject when an uploadId is given
+func (r route) specificity() (int, int) {
+	return len(r.query) + len(r.requiredQuery) + len(r.requiredHeader), r.literalLength
+}
+
+func (r route) match(req *http.Request, escapedPath string) (map[string]string, bool) {
+	if req.Method != r.method {
+		return nil, false
+	}
+
+	submatches := r.pattern.FindStringSubmatch(escapedPath)
+	if submatches == nil {
+		return nil, false
+	}
+
+	query := req.URL.Query()
+	for key, values := range r.query {
+		if _, ok := query[key]; !ok {
+			return nil, false
+		}
+		if len(values) > 0 && values[0] != "" && query.Get(key) != values[0] {
+			return nil, false
+		}
+	}
+	for _, key := range r.requiredQuery {
+		if _, ok := query[key]; !ok {
+			return nil, false
+		}
+	}
+	for _, key := range r.requiredHeader {
+		if req.Header.Get(key) == "" {
+			return nil, false
+		}
+	}
+
+	labels := map[string]string{}
+	for i, label := range r.labels {
+		value, err := url.PathUnescape(submatches[i+1])
+		if err != nil {
+			return nil, false
+		}
+		labels[label] = value
+	}
+	return labels, true
+}
+
+// Match returns the action targeted by the request, along with the values of
+// the URI labels, keyed by label name
+func (router *Router) Match(req *http.Request, escapedPath string) (string, map[string]string, bool) {
+	var (
+		best       *route
+		bestLabels map[string]string
+	)
+	for i := range router.routes {
+		candidate := &router.routes[i]
+		labels, ok := candidate.match(req, escapedPath)
+		if !ok {
+			continue
+		}
+		if best == nil || moreSpecific(candidate, best) {
+			best, bestLabels = candidate, labels
+		}
+	}
+	if best == nil {
+		return "", nil, false
+	}
+	return best.action, bestLabels, true
+}
+
+func moreSpecific(a, b *route) bool {
+	aConstraints, aLiterals := a.specificity()
+	bConstraints, bLiterals := b.specificity()
+	if aConstraints != bConstraints {
+		return aConstraints > bConstraints
+	}
+	return aLiterals > bLiterals
+}
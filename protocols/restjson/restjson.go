@@ -0,0 +1,118 @@
+// Package restjson implements the AWS REST-JSON protocol
+//
+// The REST-JSON protocol is used by AWS APIs including Lambda, API Gateway,
+// EFS and Glacier.  Actions are identified by HTTP method and URI, and
+// structured payloads are encoded as JSON.
+package restjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+	"github.com/rosenhouse/awsfaker/protocols/rest"
+)
+
+// A Handler is an http.Handler that can mimic an AWS service API
+type Handler struct {
+	*dispatch.Handler
+}
+
+// New returns a new Handler that will dispatch incoming requests to
+// the fake service backend given as an argument.
+//
+// It panics if an action of the backend is not an operation of one of the
+// REST services supported by the rest package.
+func New(serviceBackend interface{}) *Handler {
+	backend := dispatch.NewBackend(serviceBackend)
+	router, err := rest.NewRouter(backend)
+	if err != nil {
+		panic(err)
+	}
+	return &Handler{dispatch.NewHandler(backend, &codec{router: router})}
+}
+
+type codec struct {
+	router *rest.Router
+}
+
+func (c *codec) ReadRequest(r *http.Request) (string, func(interface{}) error, error) {
+	action, labels, ok := c.router.Match(r, r.URL.EscapedPath())
+	if !ok {
+		return "", nil, &dispatch.UnknownActionError{Action: r.Method + " " + r.URL.Path}
+	}
+
+	requestBodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to read request body: %s", err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(requestBodyBytes))
+
+	decode := func(input interface{}) error {
+		if err := rest.BindRequest(input, r, labels); err != nil {
+			return err
+		}
+		if rest.HasRawPayload(reflect.TypeOf(input)) {
+			rest.SetRawPayload(input, requestBodyBytes)
+			return nil
+		}
+		return jsonutil.UnmarshalJSON(input, bytes.NewReader(requestBodyBytes))
+	}
+	return action, decode, nil
+}
+
+func (c *codec) WriteResponse(w http.ResponseWriter, requestID string, action string, output interface{}) error {
+	w.Header().Set("X-Amzn-RequestId", requestID)
+	statusCode, err := rest.WriteHeaders(w, output)
+	if err != nil {
+		return err
+	}
+
+	if rest.HasRawPayload(reflect.TypeOf(output)) {
+		return rest.WriteBody(w, statusCode, rest.RawPayload(output))
+	}
+
+	body, err := jsonutil.BuildJSON(output)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return rest.WriteBody(w, statusCode, bytes.NewReader(body))
+}
+
+type jsonErrorResponse struct {
+	Type    string `json:"__type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (c *codec) ProtocolErrors() dispatch.ProtocolErrors {
+	return dispatch.ProtocolErrors{
+		UnknownAction:    "UnknownOperationException",
+		MalformedRequest: "SerializationException",
+	}
+}
+
+func (c *codec) WriteError(w http.ResponseWriter, requestID string, errorResponse dispatch.ErrorResponse) error {
+	body, err := json.Marshal(jsonErrorResponse{
+		Type:    errorResponse.AWSErrorCode,
+		Code:    errorResponse.AWSErrorCode,
+		Message: errorResponse.AWSErrorMessage,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Amzn-ErrorType", errorResponse.AWSErrorCode)
+	w.Header().Set("X-Amzn-RequestId", requestID)
+	return rest.WriteBody(w, errorResponse.HTTPStatusCode, bytes.NewReader(body))
+}
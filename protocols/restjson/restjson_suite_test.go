@@ -0,0 +1,13 @@
+package restjson_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestRestjson(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "REST-JSON Suite")
+}
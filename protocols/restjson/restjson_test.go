@@ -0,0 +1,154 @@
+package restjson_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+
+	"github.com/rosenhouse/awsfaker"
+	"github.com/rosenhouse/awsfaker/protocols/restjson"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type FakeLambdaBackend struct {
+	InvokeCall struct {
+		Receives      *lambda.InvokeInput
+		ReturnsResult *lambda.InvokeOutput
+		ReturnsError  error
+	}
+	ListFunctionsCall struct {
+		Receives      *lambda.ListFunctionsInput
+		ReturnsResult *lambda.ListFunctionsOutput
+		ReturnsError  error
+	}
+}
+
+func (f *FakeLambdaBackend) Invoke(input *lambda.InvokeInput) (*lambda.InvokeOutput, error) {
+	f.InvokeCall.Receives = input
+	return f.InvokeCall.ReturnsResult, f.InvokeCall.ReturnsError
+}
+
+func (f *FakeLambdaBackend) ListFunctions(input *lambda.ListFunctionsInput) (*lambda.ListFunctionsOutput, error) {
+	f.ListFunctionsCall.Receives = input
+	return f.ListFunctionsCall.ReturnsResult, f.ListFunctionsCall.ReturnsError
+}
+
+var _ = Describe("Handling REST-JSON requests", func() {
+	var (
+		fakeBackend *FakeLambdaBackend
+		fakeServer  *httptest.Server
+		client      *lambda.Lambda
+	)
+
+	BeforeEach(func() {
+		fakeBackend = &FakeLambdaBackend{}
+		fakeServer = httptest.NewServer(restjson.New(fakeBackend))
+		client = lambda.New(session.New(&aws.Config{
+			Credentials: credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""),
+			Region:      aws.String("some-region"),
+			Endpoint:    aws.String(fakeServer.URL),
+			MaxRetries:  aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		if fakeServer != nil {
+			fakeServer.Close()
+		}
+	})
+
+	It("should route by method and URI and bind URI, header and payload fields", func() {
+		client.Invoke(&lambda.InvokeInput{
+			FunctionName:   aws.String("some-function"),
+			InvocationType: aws.String("RequestResponse"),
+			Qualifier:      aws.String("some-alias"),
+			Payload:        []byte(`{"some":"payload"}`),
+		})
+
+		Expect(fakeBackend.InvokeCall.Receives).To(Equal(&lambda.InvokeInput{
+			FunctionName:   aws.String("some-function"),
+			InvocationType: aws.String("RequestResponse"),
+			Qualifier:      aws.String("some-alias"),
+			Payload:        []byte(`{"some":"payload"}`),
+		}))
+	})
+
+	It("should bind querystring fields", func() {
+		client.ListFunctions(&lambda.ListFunctionsInput{
+			Marker:   aws.String("some-marker"),
+			MaxItems: aws.Int64(7),
+		})
+
+		Expect(fakeBackend.ListFunctionsCall.Receives).To(Equal(&lambda.ListFunctionsInput{
+			Marker:   aws.String("some-marker"),
+			MaxItems: aws.Int64(7),
+		}))
+	})
+
+	Context("when the backend succeeds", func() {
+		It("should return raw payloads, header fields and the status code", func() {
+			fakeBackend.InvokeCall.ReturnsResult = &lambda.InvokeOutput{
+				FunctionError: aws.String("Handled"),
+				Payload:       []byte(`{"some":"result"}`),
+				StatusCode:    aws.Int64(202),
+			}
+
+			output, err := client.Invoke(&lambda.InvokeInput{
+				FunctionName: aws.String("some-function"),
+			})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(&lambda.InvokeOutput{
+				FunctionError: aws.String("Handled"),
+				Payload:       []byte(`{"some":"result"}`),
+				StatusCode:    aws.Int64(202),
+			}))
+		})
+
+		It("should return JSON bodies", func() {
+			fakeBackend.ListFunctionsCall.ReturnsResult = &lambda.ListFunctionsOutput{
+				Functions: []*lambda.FunctionConfiguration{
+					{FunctionName: aws.String("some-function")},
+				},
+				NextMarker: aws.String("some-next-marker"),
+			}
+
+			output, err := client.ListFunctions(&lambda.ListFunctionsInput{})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(&lambda.ListFunctionsOutput{
+				Functions: []*lambda.FunctionConfiguration{
+					{FunctionName: aws.String("some-function")},
+				},
+				NextMarker: aws.String("some-next-marker"),
+			}))
+		})
+	})
+
+	Context("when the backend returns an error", func() {
+		It("should return the error in a format that is parsable by the client library", func() {
+			fakeBackend.InvokeCall.ReturnsError = &awsfaker.ErrorResponse{
+				AWSErrorCode:    "ResourceNotFoundException",
+				AWSErrorMessage: "some error message",
+				HTTPStatusCode:  http.StatusNotFound,
+			}
+
+			_, err := client.Invoke(&lambda.InvokeInput{
+				FunctionName: aws.String("some-function"),
+			})
+
+			Expect(err).To(HaveOccurred())
+			awsErr := err.(awserr.RequestFailure)
+			Expect(awsErr.StatusCode()).To(Equal(404))
+			Expect(awsErr.Code()).To(Equal("ResourceNotFoundException"))
+			Expect(awsErr.Message()).To(Equal("some error message"))
+		})
+	})
+})
@@ -0,0 +1,54 @@
+package restxml
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var s3HostPattern = regexp.MustCompile(`^(.+)\.s3([.-][a-z0-9-]+)*\.amazonaws\.com(\.cn)?$`)
+
+// bucketFromHost returns the bucket named in a virtual-hosted-style S3 host,
+// e.g. some-bucket.s3.amazonaws.com, some-bucket.localhost or
+// some-bucket.127.0.0.1
+func bucketFromHost(hostport string) (string, bool) {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+
+	if matches := s3HostPattern.FindStringSubmatch(host); matches != nil {
+		return matches[1], true
+	}
+	if strings.HasSuffix(host, ".localhost") {
+		return strings.TrimSuffix(host, ".localhost"), true
+	}
+	for i := strings.Index(host, "."); i > 0; i = nextDot(host, i) {
+		if net.ParseIP(host[i+1:]) != nil {
+			return host[:i], true
+		}
+	}
+	return "", false
+}
+
+func nextDot(s string, i int) int {
+	j := strings.Index(s[i+1:], ".")
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+// pathStyle rewrites the path of a virtual-hosted-style request so that it
+// begins with the bucket, as in a path-style request
+func pathStyle(host, escapedPath string) string {
+	bucket, ok := bucketFromHost(host)
+	if !ok {
+		return escapedPath
+	}
+	if escapedPath == "" || escapedPath == "/" {
+		return "/" + url.PathEscape(bucket)
+	}
+	return "/" + url.PathEscape(bucket) + escapedPath
+}
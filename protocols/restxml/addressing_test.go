@@ -0,0 +1,31 @@
+package restxml
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("S3 bucket addressing", func() {
+	DescribeTable("finding the bucket in the host name",
+		func(host, expectedBucket string, expectedOK bool) {
+			bucket, ok := bucketFromHost(host)
+			Expect(ok).To(Equal(expectedOK))
+			Expect(bucket).To(Equal(expectedBucket))
+		},
+		Entry("path style, IP address", "127.0.0.1:1234", "", false),
+		Entry("path style, localhost", "localhost:1234", "", false),
+		Entry("path style, AWS", "s3.amazonaws.com", "", false),
+		Entry("virtual host, IP address", "some-bucket.127.0.0.1:1234", "some-bucket", true),
+		Entry("virtual host, localhost", "some.bucket.localhost", "some.bucket", true),
+		Entry("virtual host, AWS", "some-bucket.s3.amazonaws.com", "some-bucket", true),
+		Entry("virtual host, AWS regional", "some-bucket.s3.us-west-2.amazonaws.com", "some-bucket", true),
+		Entry("virtual host, AWS legacy regional", "some-bucket.s3-us-west-2.amazonaws.com", "some-bucket", true),
+	)
+
+	It("should rewrite virtual-hosted-style paths to path style", func() {
+		Expect(pathStyle("some-bucket.localhost", "/")).To(Equal("/some-bucket"))
+		Expect(pathStyle("some-bucket.localhost", "/some/key")).To(Equal("/some-bucket/some/key"))
+		Expect(pathStyle("localhost", "/some-bucket/some/key")).To(Equal("/some-bucket/some/key"))
+	})
+})
@@ -0,0 +1,73 @@
+package restxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+	"github.com/rosenhouse/awsfaker/protocols/rest"
+)
+
+type s3ErrorResponse struct {
+	XMLName         xml.Name `xml:"Error"`
+	AWSErrorCode    string   `xml:"Code"`
+	AWSErrorMessage string   `xml:"Message"`
+	RequestID       string   `xml:"RequestId"`
+}
+
+type restXMLErrorResponse struct {
+	XMLName         xml.Name `xml:"ErrorResponse"`
+	Type            string   `xml:"Error>Type"`
+	AWSErrorCode    string   `xml:"Error>Code"`
+	AWSErrorMessage string   `xml:"Error>Message"`
+	RequestID       string   `xml:"RequestId"`
+}
+
+func (c *codec) ProtocolErrors() dispatch.ProtocolErrors {
+	return dispatch.ProtocolErrors{
+		UnknownAction:    "InvalidAction",
+		MalformedRequest: "MalformedXML",
+	}
+}
+
+func (c *codec) WriteError(w http.ResponseWriter, requestID string, errorResponse dispatch.ErrorResponse) error {
+	var body interface{}
+	if c.isS3 {
+		body = s3ErrorResponse{
+			AWSErrorCode:    errorResponse.AWSErrorCode,
+			AWSErrorMessage: errorResponse.AWSErrorMessage,
+			RequestID:       requestID,
+		}
+	} else {
+		errorType := "Sender"
+		if errorResponse.HTTPStatusCode >= 500 {
+			errorType = "Receiver"
+		}
+		body = restXMLErrorResponse{
+			Type:            errorType,
+			AWSErrorCode:    errorResponse.AWSErrorCode,
+			AWSErrorMessage: errorResponse.AWSErrorMessage,
+			RequestID:       requestID,
+		}
+	}
+
+	responseBodyBytes, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	c.setRequestID(w, requestID)
+	w.Header().Set("Content-Type", "application/xml")
+	return rest.WriteBody(w, errorResponse.HTTPStatusCode, bytes.NewReader(responseBodyBytes))
+}
+
+// setRequestID sets the request ID header, which S3 names differently from
+// the other services
+func (c *codec) setRequestID(w http.ResponseWriter, requestID string) {
+	if c.isS3 {
+		w.Header().Set("X-Amz-Request-Id", requestID)
+	} else {
+		w.Header().Set("X-Amzn-RequestId", requestID)
+	}
+}
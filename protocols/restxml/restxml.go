@@ -0,0 +1,157 @@
+// Package restxml implements the AWS REST-XML protocol
+//
+// The REST-XML protocol is used by S3, Route 53 and CloudFront.  Actions are
+// identified by HTTP method and URI, and structured payloads are encoded as
+// XML.  For S3, buckets may be addressed either in the path, as in
+// http://host/bucket/key, or in the host name, as in http://bucket.host/key
+package restxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/private/protocol/xml/xmlutil"
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+	"github.com/rosenhouse/awsfaker/protocols/rest"
+)
+
+// A Handler is an http.Handler that can mimic an AWS service API
+type Handler struct {
+	*dispatch.Handler
+}
+
+// New returns a new Handler that will dispatch incoming requests to
+// the fake service backend given as an argument.
+//
+// It panics if an action of the backend is not an operation of one of the
+// REST services supported by the rest package.
+func New(serviceBackend interface{}) *Handler {
+	backend := dispatch.NewBackend(serviceBackend)
+	router, err := rest.NewRouter(backend)
+	if err != nil {
+		panic(err)
+	}
+	codec := &codec{
+		router: router,
+		isS3:   backendIsS3(backend),
+	}
+	return &Handler{dispatch.NewHandler(backend, codec)}
+}
+
+func backendIsS3(backend *dispatch.Backend) bool {
+	for _, method := range backend.Methods() {
+		if path.Base(method.InputType().PkgPath()) == "s3" {
+			return true
+		}
+	}
+	return false
+}
+
+type codec struct {
+	router *rest.Router
+	isS3   bool
+}
+
+func (c *codec) ReadRequest(r *http.Request) (string, func(interface{}) error, error) {
+	escapedPath := r.URL.EscapedPath()
+	if c.isS3 {
+		escapedPath = pathStyle(r.Host, escapedPath)
+	}
+
+	action, labels, ok := c.router.Match(r, escapedPath)
+	if !ok {
+		return "", nil, &dispatch.UnknownActionError{Action: r.Method + " " + escapedPath}
+	}
+
+	requestBodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to read request body: %s", err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(requestBodyBytes))
+
+	decode := func(input interface{}) error {
+		if err := rest.BindRequest(input, r, labels); err != nil {
+			return err
+		}
+		if rest.HasRawPayload(reflect.TypeOf(input)) {
+			rest.SetRawPayload(input, requestBodyBytes)
+			return nil
+		}
+		decoder := xml.NewDecoder(bytes.NewReader(requestBodyBytes))
+		return xmlutil.UnmarshalXML(input, decoder, "")
+	}
+	return action, decode, nil
+}
+
+func (c *codec) WriteResponse(w http.ResponseWriter, requestID string, action string, output interface{}) error {
+	c.setRequestID(w, requestID)
+	statusCode, err := rest.WriteHeaders(w, output)
+	if err != nil {
+		return err
+	}
+
+	// S3 answers a ranged GET with 206 Partial Content, which the output
+	// shows only by its Content-Range
+	if c.isS3 && statusCode == http.StatusOK && w.Header().Get("Content-Range") != "" {
+		statusCode = http.StatusPartialContent
+	}
+
+	if rest.HasRawPayload(reflect.TypeOf(output)) {
+		return rest.WriteBody(w, statusCode, rest.RawPayload(output))
+	}
+
+	body, err := buildXML(action, output)
+	if err != nil {
+		return err
+	}
+	if len(body) > 0 {
+		w.Header().Set("Content-Type", "application/xml")
+	}
+	return rest.WriteBody(w, statusCode, bytes.NewReader(body))
+}
+
+// buildXML encodes the body members of the output.  The SDK ignores the name
+// of the root element, so outputs without a name of their own are wrapped in
+// an element named for the action.
+func buildXML(action string, output interface{}) ([]byte, error) {
+	responseBuffer := &bytes.Buffer{}
+	encoder := xml.NewEncoder(responseBuffer)
+
+	var wrapper *xml.StartElement
+	if rootElementName(reflect.TypeOf(output)) == "" {
+		wrapper = &xml.StartElement{Name: xml.Name{Local: action + "Result"}}
+		if err := encoder.EncodeToken(*wrapper); err != nil {
+			return nil, err
+		}
+	}
+	if err := xmlutil.BuildXML(output, encoder); err != nil {
+		return nil, err
+	}
+	if wrapper != nil {
+		if err := encoder.EncodeToken(wrapper.End()); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return responseBuffer.Bytes(), nil
+}
+
+func rootElementName(t reflect.Type) string {
+	if payload, ok := rest.PayloadField(t); ok {
+		return payload.Tag.Get("locationName")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if metadata, ok := t.FieldByName("_"); ok {
+		return metadata.Tag.Get("locationName")
+	}
+	return ""
+}
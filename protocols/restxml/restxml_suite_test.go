@@ -0,0 +1,13 @@
+package restxml_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestRestxml(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "REST-XML Suite")
+}
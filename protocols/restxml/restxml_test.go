@@ -0,0 +1,221 @@
+package restxml_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/rosenhouse/awsfaker"
+	"github.com/rosenhouse/awsfaker/protocols/restxml"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type FakeS3Backend struct {
+	CreateBucketCall struct {
+		Receives      *s3.CreateBucketInput
+		ReturnsResult *s3.CreateBucketOutput
+		ReturnsError  error
+	}
+	PutObjectCall struct {
+		Receives      *s3.PutObjectInput
+		ReceivedBody  []byte
+		ReturnsResult *s3.PutObjectOutput
+		ReturnsError  error
+	}
+	GetObjectCall struct {
+		Receives      *s3.GetObjectInput
+		ReturnsResult *s3.GetObjectOutput
+		ReturnsError  error
+	}
+	ListObjectsCall struct {
+		Receives      *s3.ListObjectsInput
+		ReturnsResult *s3.ListObjectsOutput
+		ReturnsError  error
+	}
+}
+
+func (f *FakeS3Backend) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	f.CreateBucketCall.Receives = input
+	return f.CreateBucketCall.ReturnsResult, f.CreateBucketCall.ReturnsError
+}
+
+func (f *FakeS3Backend) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	f.PutObjectCall.Receives = input
+	f.PutObjectCall.ReceivedBody, _ = ioutil.ReadAll(input.Body)
+	return f.PutObjectCall.ReturnsResult, f.PutObjectCall.ReturnsError
+}
+
+func (f *FakeS3Backend) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	f.GetObjectCall.Receives = input
+	return f.GetObjectCall.ReturnsResult, f.GetObjectCall.ReturnsError
+}
+
+func (f *FakeS3Backend) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+	f.ListObjectsCall.Receives = input
+	return f.ListObjectsCall.ReturnsResult, f.ListObjectsCall.ReturnsError
+}
+
+var _ = Describe("Handling REST-XML requests", func() {
+	var (
+		fakeBackend *FakeS3Backend
+		handler     *restxml.Handler
+		fakeServer  *httptest.Server
+		client      *s3.S3
+	)
+
+	BeforeEach(func() {
+		fakeBackend = &FakeS3Backend{}
+		handler = restxml.New(fakeBackend)
+		fakeServer = httptest.NewServer(handler)
+		client = s3.New(session.New(&aws.Config{
+			Credentials:      credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""),
+			Region:           aws.String("some-region"),
+			Endpoint:         aws.String(fakeServer.URL),
+			S3ForcePathStyle: aws.Bool(true),
+			MaxRetries:       aws.Int(0),
+		}))
+	})
+
+	AfterEach(func() {
+		if fakeServer != nil {
+			fakeServer.Close()
+		}
+	})
+
+	It("should decode XML payloads", func() {
+		client.CreateBucket(&s3.CreateBucketInput{
+			Bucket: aws.String("some-bucket"),
+			CreateBucketConfiguration: &s3.CreateBucketConfiguration{
+				LocationConstraint: aws.String("some-region"),
+			},
+		})
+
+		Expect(fakeBackend.CreateBucketCall.Receives).NotTo(BeNil())
+		Expect(fakeBackend.CreateBucketCall.Receives.Bucket).To(Equal(aws.String("some-bucket")))
+		Expect(fakeBackend.CreateBucketCall.Receives.CreateBucketConfiguration).To(Equal(&s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String("some-region"),
+		}))
+	})
+
+	It("should bind raw request bodies and header maps", func() {
+		client.PutObject(&s3.PutObjectInput{
+			Bucket:      aws.String("some-bucket"),
+			Key:         aws.String("some/key"),
+			Body:        strings.NewReader("some content"),
+			ContentType: aws.String("text/plain"),
+			Metadata:    map[string]*string{"Color": aws.String("blue")},
+		})
+
+		Expect(fakeBackend.PutObjectCall.Receives).NotTo(BeNil())
+		Expect(fakeBackend.PutObjectCall.Receives.Bucket).To(Equal(aws.String("some-bucket")))
+		Expect(fakeBackend.PutObjectCall.Receives.Key).To(Equal(aws.String("some/key")))
+		Expect(fakeBackend.PutObjectCall.Receives.ContentType).To(Equal(aws.String("text/plain")))
+		Expect(fakeBackend.PutObjectCall.Receives.Metadata).To(Equal(map[string]*string{"Color": aws.String("blue")}))
+		Expect(string(fakeBackend.PutObjectCall.ReceivedBody)).To(Equal("some content"))
+	})
+
+	It("should find the bucket in virtual-hosted-style requests", func() {
+		fakeBackend.GetObjectCall.ReturnsResult = &s3.GetObjectOutput{}
+		request := httptest.NewRequest("GET", "http://some-bucket.127.0.0.1:1234/some/key", nil)
+
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		Expect(fakeBackend.GetObjectCall.Receives).To(Equal(&s3.GetObjectInput{
+			Bucket: aws.String("some-bucket"),
+			Key:    aws.String("some/key"),
+		}))
+	})
+
+	Context("when the backend succeeds", func() {
+		It("should stream raw response bodies along with header fields", func() {
+			fakeBackend.GetObjectCall.ReturnsResult = &s3.GetObjectOutput{
+				Body:     ioutil.NopCloser(bytes.NewReader([]byte("some content"))),
+				ETag:     aws.String(`"some-etag"`),
+				Metadata: map[string]*string{"Color": aws.String("blue")},
+			}
+
+			output, err := client.GetObject(&s3.GetObjectInput{
+				Bucket: aws.String("some-bucket"),
+				Key:    aws.String("some/key"),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(output.ETag).To(Equal(aws.String(`"some-etag"`)))
+			Expect(output.Metadata).To(Equal(map[string]*string{"Color": aws.String("blue")}))
+			body, err := ioutil.ReadAll(output.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(body)).To(Equal("some content"))
+		})
+
+		It("should respond with 206 Partial Content when there is a Content-Range", func() {
+			fakeBackend.GetObjectCall.ReturnsResult = &s3.GetObjectOutput{
+				Body:         ioutil.NopCloser(bytes.NewReader([]byte("some"))),
+				ContentRange: aws.String("bytes 0-3/12"),
+			}
+			request, err := http.NewRequest("GET", fakeServer.URL+"/some-bucket/some/key", nil)
+			Expect(err).NotTo(HaveOccurred())
+			request.Header.Set("Range", "bytes=0-3")
+
+			response, err := http.DefaultClient.Do(request)
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close()
+			Expect(response.StatusCode).To(Equal(http.StatusPartialContent))
+			Expect(response.Header.Get("Content-Range")).To(Equal("bytes 0-3/12"))
+			Expect(fakeBackend.GetObjectCall.Receives.Range).To(Equal(aws.String("bytes=0-3")))
+		})
+
+		It("should return XML bodies", func() {
+			fakeBackend.ListObjectsCall.ReturnsResult = &s3.ListObjectsOutput{
+				Name: aws.String("some-bucket"),
+				Contents: []*s3.Object{
+					{Key: aws.String("some/key"), Size: aws.Int64(12)},
+					{Key: aws.String("other/key"), Size: aws.Int64(34)},
+				},
+			}
+
+			output, err := client.ListObjects(&s3.ListObjectsInput{
+				Bucket: aws.String("some-bucket"),
+				Prefix: aws.String("some/"),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeBackend.ListObjectsCall.Receives.Prefix).To(Equal(aws.String("some/")))
+			Expect(output.Name).To(Equal(aws.String("some-bucket")))
+			Expect(output.Contents).To(Equal([]*s3.Object{
+				{Key: aws.String("some/key"), Size: aws.Int64(12)},
+				{Key: aws.String("other/key"), Size: aws.Int64(34)},
+			}))
+		})
+	})
+
+	Context("when the backend returns an error", func() {
+		It("should return the error in a format that is parsable by the client library", func() {
+			fakeBackend.GetObjectCall.ReturnsError = &awsfaker.ErrorResponse{
+				AWSErrorCode:    "NoSuchKey",
+				AWSErrorMessage: "The specified key does not exist.",
+				HTTPStatusCode:  http.StatusNotFound,
+			}
+
+			_, err := client.GetObject(&s3.GetObjectInput{
+				Bucket: aws.String("some-bucket"),
+				Key:    aws.String("some/key"),
+			})
+
+			Expect(err).To(HaveOccurred())
+			awsErr := err.(awserr.RequestFailure)
+			Expect(awsErr.StatusCode()).To(Equal(404))
+			Expect(awsErr.Code()).To(Equal("NoSuchKey"))
+			Expect(awsErr.Message()).To(Equal("The specified key does not exist."))
+		})
+	})
+})
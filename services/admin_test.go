@@ -0,0 +1,194 @@
+package services_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+
+	"github.com/rosenhouse/awsfaker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type StackCountingBackend struct {
+	lock   sync.Mutex
+	stacks []string
+}
+
+func (b *StackCountingBackend) CreateStack(input *cloudformation.CreateStackInput) (*cloudformation.CreateStackOutput, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.stacks = append(b.stacks, aws.StringValue(input.StackName))
+	return &cloudformation.CreateStackOutput{StackId: aws.String(fmt.Sprintf("stack-%d", len(b.stacks)))}, nil
+}
+
+func (b *StackCountingBackend) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.stacks = nil
+}
+
+func (b *StackCountingBackend) DumpState() interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return map[string]interface{}{"stacks": append([]string{}, b.stacks...)}
+}
+
+var _ = Describe("The admin API", func() {
+	var (
+		backend     *StackCountingBackend
+		fakeServer  *httptest.Server
+		adminServer *httptest.Server
+		client      *cloudformation.CloudFormation
+	)
+
+	BeforeEach(func() {
+		backend = &StackCountingBackend{}
+		mux := awsfaker.NewMux(backend, &FakeEC2Backend{})
+		fakeServer = httptest.NewServer(mux)
+		adminServer = httptest.NewServer(mux.Admin())
+		client = cloudformation.New(newSession(fakeServer.URL))
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+		adminServer.Close()
+	})
+
+	adminRequest := func(method, path, body string) (int, string) {
+		request, err := http.NewRequest(method, adminServer.URL+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		response, err := http.DefaultClient.Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+		responseBody, err := ioutil.ReadAll(response.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return response.StatusCode, string(responseBody)
+	}
+
+	createStack := func(name string) (*cloudformation.CreateStackOutput, error) {
+		return client.CreateStack(&cloudformation.CreateStackInput{StackName: aws.String(name)})
+	}
+
+	It("should list the calls received as JSON", func() {
+		_, err := createStack("some-stack")
+		Expect(err).NotTo(HaveOccurred())
+
+		status, body := adminRequest("GET", "/calls?action=CreateStack", "")
+		Expect(status).To(Equal(http.StatusOK))
+
+		var calls []struct {
+			Action    string
+			RequestID string
+			Input     map[string]interface{}
+			Output    map[string]interface{}
+		}
+		Expect(json.Unmarshal([]byte(body), &calls)).To(Succeed())
+		Expect(calls).To(HaveLen(1))
+		Expect(calls[0].Action).To(Equal("CreateStack"))
+		Expect(calls[0].RequestID).NotTo(BeEmpty())
+		Expect(calls[0].Input).To(HaveKeyWithValue("StackName", "some-stack"))
+		Expect(calls[0].Output).To(HaveKeyWithValue("StackId", "stack-1"))
+
+		status, _ = adminRequest("DELETE", "/calls", "")
+		Expect(status).To(Equal(http.StatusNoContent))
+		_, body = adminRequest("GET", "/calls", "")
+		Expect(body).To(MatchJSON(`[]`))
+	})
+
+	It("should answer matching calls with an injected response, for as many times as given", func() {
+		status, body := adminRequest("POST", "/responses", `{
+			"action": "CreateStack",
+			"match": {"StackName": "some-stack"},
+			"output": {"StackId": "injected-id"},
+			"times": 1
+		}`)
+		Expect(status).To(Equal(http.StatusCreated), body)
+
+		output, err := createStack("other-stack")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.StackId).To(Equal(aws.String("stack-1")))
+
+		output, err = createStack("some-stack")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.StackId).To(Equal(aws.String("injected-id")))
+
+		output, err = createStack("some-stack")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.StackId).To(Equal(aws.String("stack-2")))
+	})
+
+	It("should answer with an injected error until the injections are removed", func() {
+		status, _ := adminRequest("POST", "/responses", `{
+			"action": "CreateStack",
+			"error": {"AWSErrorCode": "LimitExceededException", "AWSErrorMessage": "too many stacks", "HTTPStatusCode": 400}
+		}`)
+		Expect(status).To(Equal(http.StatusCreated))
+
+		_, body := adminRequest("GET", "/responses", "")
+		Expect(body).To(ContainSubstring(`"service": "cloudformation"`))
+
+		_, err := createStack("some-stack")
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal("LimitExceededException"))
+
+		status, _ = adminRequest("DELETE", "/responses", "")
+		Expect(status).To(Equal(http.StatusNoContent))
+		_, err = createStack("some-stack")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should send an injected error without a status as 400 Bad Request", func() {
+		status, body := adminRequest("POST", "/responses", `{"action": "CreateStack", "error": {"AWSErrorCode": "LimitExceededException"}}`)
+		Expect(status).To(Equal(http.StatusCreated), body)
+
+		_, err := createStack("some-stack")
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).StatusCode()).To(Equal(http.StatusBadRequest))
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal("LimitExceededException"))
+	})
+
+	It("should reject injections that no backend can serve", func() {
+		status, body := adminRequest("POST", "/responses", `{"action": "DeleteStack"}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(body).To(MatchJSON(`{"error": "no backend serves action \"DeleteStack\", and only the actions of a backend can be injected"}`))
+
+		_, err := client.DeleteStack(&cloudformation.DeleteStackInput{StackName: aws.String("some-stack")})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal("InvalidAction"))
+
+		status, body = adminRequest("POST", "/responses", `{"action": "CreateStack", "output": {"NoSuchField": 1}}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(body).To(ContainSubstring("invalid output for CreateStack"))
+	})
+
+	It("should dump the state of the backends and reset them", func() {
+		_, err := createStack("some-stack")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, body := adminRequest("GET", "/state", "")
+		Expect(body).To(MatchJSON(`{"cloudformation": {"stacks": ["some-stack"]}}`))
+
+		status, _ := adminRequest("POST", "/reset", "")
+		Expect(status).To(Equal(http.StatusNoContent))
+
+		_, body = adminRequest("GET", "/state", "")
+		Expect(body).To(MatchJSON(`{"cloudformation": {"stacks": []}}`))
+		_, body = adminRequest("GET", "/calls", "")
+		Expect(body).To(MatchJSON(`[]`))
+	})
+
+	It("should respond with an error for unknown routes", func() {
+		status, _ := adminRequest("GET", "/no-such-route", "")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+})
@@ -1,8 +1,12 @@
 package services_test
 
 import (
+	"context"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -17,6 +21,7 @@ import (
 type FakeCloudFormationBackend struct {
 	DescribeStacksCall struct {
 		Receives      *cloudformation.DescribeStacksInput
+		RequestID     string
 		ReturnsResult *cloudformation.DescribeStacksOutput
 		ReturnsError  error
 	}
@@ -32,8 +37,10 @@ func (f *FakeCloudFormationBackend) UpdateStack(input *cloudformation.UpdateStac
 	return f.UpdateStackCall.ReturnsResult, f.UpdateStackCall.ReturnsError
 }
 
-func (f *FakeCloudFormationBackend) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+func (f *FakeCloudFormationBackend) DescribeStacks(ctx context.Context, input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
 	f.DescribeStacksCall.Receives = input
+	info, _ := awsfaker.RequestInfoFromContext(ctx)
+	f.DescribeStacksCall.RequestID = info.RequestID
 	return f.DescribeStacksCall.ReturnsResult, f.DescribeStacksCall.ReturnsError
 }
 
@@ -162,4 +169,175 @@ var _ = Describe("Mocking out the CloudFormation service", func() {
 			Expect(awsErr.Message()).To(Equal("some error message"))
 		})
 	})
+
+	It("should respond in the full query envelope, with a request ID shared with the backend", func() {
+		fakeBackend.DescribeStacksCall.ReturnsResult = &cloudformation.DescribeStacksOutput{}
+		body := url.Values{"Action": {"DescribeStacks"}}.Encode()
+		resp, err := http.Post(fakeServer.URL, "application/x-www-form-urlencoded", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		requestID := resp.Header.Get("X-Amzn-RequestId")
+		Expect(requestID).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+		Expect(fakeBackend.DescribeStacksCall.RequestID).To(Equal(requestID))
+
+		responseBody, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(responseBody)).To(HavePrefix(`<DescribeStacksResponse xmlns="http://cloudformation.amazonaws.com/doc/2010-05-15/"><DescribeStacksResult>`))
+		Expect(string(responseBody)).To(HaveSuffix(`</DescribeStacksResult><ResponseMetadata><RequestId>` + requestID + `</RequestId></ResponseMetadata></DescribeStacksResponse>`))
+	})
+
+	It("should give each request a new ID", func() {
+		req, _ := client.DescribeStacksRequest(&cloudformation.DescribeStacksInput{})
+		Expect(req.Send()).To(Succeed())
+		firstID := req.RequestID
+
+		req, _ = client.DescribeStacksRequest(&cloudformation.DescribeStacksInput{})
+		Expect(req.Send()).To(Succeed())
+
+		Expect(firstID).NotTo(BeEmpty())
+		Expect(req.RequestID).NotTo(Equal(firstID))
+	})
+
+	Context("when the backend does not implement the action", func() {
+		var reported []error
+
+		BeforeEach(func() {
+			reported = nil
+			handler := awsfaker.New(fakeBackend)
+			handler.OnError = func(err error) { reported = append(reported, err) }
+			fakeServer.Close()
+			fakeServer = httptest.NewServer(handler)
+			client = cloudformation.New(newSession(fakeServer.URL))
+		})
+
+		It("should respond with an InvalidAction error and report it", func() {
+			_, err := client.DeleteStack(&cloudformation.DeleteStackInput{StackName: aws.String("some-stack-name")})
+			Expect(err).To(HaveOccurred())
+			awsErr := err.(awserr.RequestFailure)
+			Expect(awsErr.StatusCode()).To(Equal(http.StatusBadRequest))
+			Expect(awsErr.Code()).To(Equal("InvalidAction"))
+			Expect(awsErr.Message()).To(Equal("The action DeleteStack is not valid for this web service."))
+
+			Expect(reported).To(HaveLen(1))
+			Expect(reported[0]).To(MatchError(ContainSubstring("action DeleteStack not found")))
+		})
+	})
+
+	It("should respond with a ValidationError when a parameter cannot be decoded", func() {
+		body := url.Values{
+			"Action":              {"UpdateStack"},
+			"StackName":           {"some-stack-name"},
+			"UsePreviousTemplate": {"not-a-bool"},
+		}.Encode()
+		resp, err := http.Post(fakeServer.URL, "application/x-www-form-urlencoded", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		responseBody, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(responseBody)).To(ContainSubstring("<Code>ValidationError</Code>"))
+		Expect(string(responseBody)).To(ContainSubstring("UsePreviousTemplate"))
+		Expect(fakeBackend.UpdateStackCall.Receives).To(BeNil())
+	})
+
+	Context("when a backend method panics", func() {
+		var handler *awsfaker.Handler
+
+		BeforeEach(func() {
+			handler = awsfaker.New(&PanickingCloudFormationBackend{})
+			fakeServer.Close()
+			fakeServer = httptest.NewServer(handler)
+			client = cloudformation.New(newSession(fakeServer.URL), &aws.Config{MaxRetries: aws.Int(0)})
+		})
+
+		It("should respond with an InternalFailure and record the panic", func() {
+			_, err := client.DescribeStacks(&cloudformation.DescribeStacksInput{})
+			Expect(err).To(HaveOccurred())
+			awsErr := err.(awserr.RequestFailure)
+			Expect(awsErr.StatusCode()).To(Equal(http.StatusInternalServerError))
+			Expect(awsErr.Code()).To(Equal("InternalFailure"))
+
+			panics := handler.Panics()
+			Expect(panics).To(HaveLen(1))
+			Expect(panics[0].Action).To(Equal("DescribeStacks"))
+			Expect(panics[0].Value).To(Equal("some panic"))
+			Expect(panics[0].String()).To(ContainSubstring("PanickingCloudFormationBackend"))
+		})
+	})
+})
+
+type PanickingCloudFormationBackend struct{}
+
+func (b *PanickingCloudFormationBackend) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	panic("some panic")
+}
+
+type ContextCloudFormationBackend struct {
+	ReceivesRequestInfo awsfaker.RequestInfo
+}
+
+func (b *ContextCloudFormationBackend) DescribeStacks(ctx context.Context, input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	b.ReceivesRequestInfo, _ = awsfaker.RequestInfoFromContext(ctx)
+	return &cloudformation.DescribeStacksOutput{}, nil
+}
+
+var _ = Describe("Mocking out the CloudFormation service with context-aware methods", func() {
+	It("should pass the request info to the backend", func() {
+		fakeBackend := &ContextCloudFormationBackend{}
+		fakeServer := httptest.NewServer(awsfaker.New(fakeBackend))
+		defer fakeServer.Close()
+		client := cloudformation.New(newSession(fakeServer.URL))
+
+		req, _ := client.DescribeStacksRequest(&cloudformation.DescribeStacksInput{})
+		Expect(req.Send()).To(Succeed())
+
+		info := fakeBackend.ReceivesRequestInfo
+		Expect(info.AccessKeyID).To(Equal("some-access-key"))
+		Expect(info.Region).To(Equal("some-region"))
+		Expect(info.RequestID).To(Equal(req.RequestID))
+		Expect(info.Header.Get("Authorization")).To(HavePrefix("AWS4-HMAC-SHA256"))
+		Expect(info.Request.Method).To(Equal("POST"))
+	})
+})
+
+type StackCreatingBackend struct{}
+
+func (b *StackCreatingBackend) CreateStack(input *cloudformation.CreateStackInput) (*cloudformation.CreateStackOutput, error) {
+	return &cloudformation.CreateStackOutput{StackId: aws.String("id-of-" + aws.StringValue(input.StackName))}, nil
+}
+
+var _ = Describe("Asserting on the journal of calls", func() {
+	var (
+		handler    *awsfaker.Handler
+		fakeServer *httptest.Server
+		client     *cloudformation.CloudFormation
+	)
+
+	BeforeEach(func() {
+		handler = awsfaker.New(&StackCreatingBackend{})
+		fakeServer = httptest.NewServer(handler)
+		client = cloudformation.New(newSession(fakeServer.URL))
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	It("should record each call with its input and output", func() {
+		for _, name := range []string{"some-stack", "other-stack"} {
+			_, err := client.CreateStack(&cloudformation.CreateStackInput{StackName: aws.String(name)})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		calls := handler.Journal().CallsTo("CreateStack")
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].Input).To(Equal(&cloudformation.CreateStackInput{StackName: aws.String("some-stack")}))
+		Expect(calls[0].Output).To(Equal(&cloudformation.CreateStackOutput{StackId: aws.String("id-of-some-stack")}))
+		Expect(handler.Journal().LastInput("CreateStack")).To(Equal(&cloudformation.CreateStackInput{StackName: aws.String("other-stack")}))
+
+		handler.Journal().Reset()
+		Expect(handler.Journal().Calls()).To(BeEmpty())
+	})
 })
@@ -0,0 +1,105 @@
+package services_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/rosenhouse/awsfaker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type FakeDynamoDBBackend struct {
+	PutItemCall struct {
+		Receives      *dynamodb.PutItemInput
+		ReturnsResult *dynamodb.PutItemOutput
+		ReturnsError  error
+	}
+}
+
+func (f *FakeDynamoDBBackend) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	f.PutItemCall.Receives = input
+	return f.PutItemCall.ReturnsResult, f.PutItemCall.ReturnsError
+}
+
+var _ = Describe("Mocking out the DynamoDB service", func() {
+	var (
+		fakeBackend *FakeDynamoDBBackend
+		fakeServer  *httptest.Server
+		client      *dynamodb.DynamoDB
+	)
+
+	BeforeEach(func() {
+		fakeBackend = &FakeDynamoDBBackend{}
+		fakeServer = httptest.NewServer(awsfaker.New(fakeBackend))
+		client = dynamodb.New(newSession(fakeServer.URL))
+	})
+
+	AfterEach(func() {
+		if fakeServer != nil {
+			fakeServer.Close()
+		}
+	})
+
+	It("should call the backend method", func() {
+		client.PutItem(
+			&dynamodb.PutItemInput{
+				TableName: aws.String("some-table"),
+				Item: map[string]*dynamodb.AttributeValue{
+					"some-key": &dynamodb.AttributeValue{S: aws.String("some-value")},
+				},
+			})
+
+		Expect(fakeBackend.PutItemCall.Receives).NotTo(BeNil())
+		Expect(fakeBackend.PutItemCall.Receives.TableName).To(Equal(aws.String("some-table")))
+		Expect(fakeBackend.PutItemCall.Receives.Item).To(Equal(map[string]*dynamodb.AttributeValue{
+			"some-key": &dynamodb.AttributeValue{S: aws.String("some-value")},
+		}))
+	})
+
+	Context("when the backend returns an error", func() {
+		It("should return the error in a format that is parsable by the client library", func() {
+			fakeBackend.PutItemCall.ReturnsError = &awsfaker.ErrorResponse{
+				AWSErrorCode:    "ConditionalCheckFailedException",
+				AWSErrorMessage: "some error message",
+				HTTPStatusCode:  http.StatusBadRequest,
+			}
+
+			_, err := client.PutItem(
+				&dynamodb.PutItemInput{
+					TableName: aws.String("some-table"),
+				})
+
+			Expect(err).To(HaveOccurred())
+			awsErr := err.(awserr.RequestFailure)
+			Expect(awsErr.StatusCode()).To(Equal(400))
+			Expect(awsErr.Code()).To(Equal("ConditionalCheckFailedException"))
+			Expect(awsErr.Message()).To(Equal("some error message"))
+		})
+	})
+})
+
+type MixedBackend struct{}
+
+func (b *MixedBackend) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	return nil, nil
+}
+
+func (b *MixedBackend) UpdateStack(input *cloudformation.UpdateStackInput) (*cloudformation.UpdateStackOutput, error) {
+	return nil, nil
+}
+
+var _ = Describe("Constructing a fake for a backend that mixes services", func() {
+	It("should fail fast with a clear error", func() {
+		defer func() {
+			Expect(recover()).To(ContainSubstring("expected all methods to take inputs from a single service package"))
+		}()
+		awsfaker.New(&MixedBackend{})
+	})
+})
@@ -96,6 +96,7 @@ var _ = Describe("Mocking out the EC2 service", func() {
 			Expect(awsErr.StatusCode()).To(Equal(400))
 			Expect(awsErr.Code()).To(Equal("ValidationError"))
 			Expect(awsErr.Message()).To(Equal("some error message"))
+			Expect(awsErr.RequestID()).NotTo(BeEmpty())
 		})
 	})
 })
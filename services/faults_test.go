@@ -0,0 +1,140 @@
+package services_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/onsi/ginkgo/config"
+
+	"github.com/rosenhouse/awsfaker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Injecting faults", func() {
+	var (
+		handler    *awsfaker.Handler
+		fakeServer *httptest.Server
+	)
+
+	BeforeEach(func() {
+		handler = awsfaker.New(&StackCreatingBackend{})
+		fakeServer = httptest.NewServer(handler)
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	createStack := func(maxRetries int) error {
+		client := cloudformation.New(newSession(fakeServer.URL), &aws.Config{MaxRetries: aws.Int(maxRetries)})
+		_, err := client.CreateStack(&cloudformation.CreateStackInput{StackName: aws.String("some-stack")})
+		return err
+	}
+
+	It("should respond with the error of the fault", func() {
+		handler.Faults = awsfaker.NewFaults(0, awsfaker.FaultRule{Fault: awsfaker.Throttling})
+
+		err := createStack(0)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal("Throttling"))
+		Expect(err.(awserr.RequestFailure).StatusCode()).To(Equal(http.StatusBadRequest))
+		Expect(handler.Journal().Calls()).To(BeEmpty())
+	})
+
+	It("should respond with 500 when the error of the fault has no status", func() {
+		handler.Faults = awsfaker.NewFaults(0, awsfaker.FaultRule{Fault: awsfaker.Fault{
+			Error: &awsfaker.ErrorResponse{AWSErrorCode: "SomeError", AWSErrorMessage: "some message"},
+		}})
+
+		err := createStack(0)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal("SomeError"))
+		Expect(err.(awserr.RequestFailure).StatusCode()).To(Equal(http.StatusInternalServerError))
+	})
+
+	It("should let the client succeed on retry once the first calls have failed", func() {
+		handler.Faults = awsfaker.NewFaults(0, awsfaker.FaultRule{
+			Action:     "CreateStack",
+			FirstCalls: 2,
+			Fault:      awsfaker.ServiceUnavailable,
+		})
+
+		Expect(createStack(2)).To(Succeed())
+		Expect(handler.Journal().Calls()).To(HaveLen(1))
+	})
+
+	It("should apply a fault to the nth call only", func() {
+		handler.Faults = awsfaker.NewFaults(0, awsfaker.FaultRule{NthCall: 2, Fault: awsfaker.InternalServerError})
+
+		Expect(createStack(0)).To(Succeed())
+		err := createStack(0)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).StatusCode()).To(Equal(http.StatusInternalServerError))
+		Expect(createStack(0)).To(Succeed())
+	})
+
+	It("should ignore calls to other actions", func() {
+		handler.Faults = awsfaker.NewFaults(0, awsfaker.FaultRule{Action: "DeleteStack", Fault: awsfaker.Throttling})
+
+		Expect(createStack(0)).To(Succeed())
+	})
+
+	It("should drop the connection", func() {
+		handler.Faults = awsfaker.NewFaults(0, awsfaker.FaultRule{FirstCalls: 1, Fault: awsfaker.ConnectionReset})
+
+		err := createStack(0)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.Error).Code()).To(Equal("RequestError"))
+
+		Expect(createStack(0)).To(Succeed())
+	})
+
+	It("should delay the response, combining the rules that apply", func() {
+		handler.Faults = awsfaker.NewFaults(0,
+			awsfaker.FaultRule{Fault: awsfaker.Delay(20 * time.Millisecond)},
+			awsfaker.FaultRule{Fault: awsfaker.Delay(30 * time.Millisecond)},
+		)
+
+		started := time.Now()
+		Expect(createStack(0)).To(Succeed())
+		Expect(time.Since(started)).To(BeNumerically(">=", 50*time.Millisecond))
+	})
+
+	It("should apply faults with the given probability, reproducibly for a seed", func() {
+		outcomes := func() []bool {
+			handler.Faults = awsfaker.NewFaults(config.GinkgoConfig.RandomSeed, awsfaker.FaultRule{
+				Probability: 0.5,
+				Fault:       awsfaker.InternalServerError,
+			})
+			results := []bool{}
+			for i := 0; i < 20; i++ {
+				results = append(results, createStack(0) == nil)
+			}
+			return results
+		}
+
+		first := outcomes()
+		Expect(first).To(ContainElement(true))
+		Expect(first).To(ContainElement(false))
+		Expect(outcomes()).To(Equal(first))
+	})
+
+	It("should draw probabilities like a seed of 0 when the Faults is not made by NewFaults", func() {
+		outcomes := func(faults *awsfaker.Faults) []bool {
+			handler.Faults = faults.Add(awsfaker.FaultRule{Probability: 0.5, Fault: awsfaker.InternalServerError})
+			results := []bool{}
+			for i := 0; i < 20; i++ {
+				results = append(results, createStack(0) == nil)
+			}
+			return results
+		}
+
+		Expect(outcomes(&awsfaker.Faults{})).To(Equal(outcomes(awsfaker.NewFaults(0))))
+	})
+})
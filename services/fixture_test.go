@@ -0,0 +1,172 @@
+package services_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+
+	"github.com/rosenhouse/awsfaker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const cloudFormationFixtures = `
+service: cloudformation
+responses:
+- action: DescribeStacks
+  match:
+    StackName: some-stack
+  output:
+    Stacks:
+    - StackName: some-stack
+      StackStatus: CREATE_COMPLETE
+      CreationTime: "2017-01-02T03:04:05Z"
+      DisableRollback: true
+      Parameters:
+      - ParameterKey: some-key
+        ParameterValue: some-value
+- action: DescribeStacks
+  match:
+    StackName: {regex: "^other-"}
+  output:
+    Stacks:
+    - StackName: other-stack
+- action: DescribeStacks
+  error:
+    AWSErrorCode: ValidationError
+    AWSErrorMessage: Stack does not exist
+    HTTPStatusCode: 400
+- action: ListStacks
+  error:
+    AWSErrorCode: Throttling
+    AWSErrorMessage: Rate exceeded
+`
+
+var _ = Describe("Serving canned responses from fixtures", func() {
+	var (
+		fakeServer *httptest.Server
+		client     *cloudformation.CloudFormation
+	)
+
+	BeforeEach(func() {
+		fixtureFile, err := awsfaker.ParseFixtureFile([]byte(cloudFormationFixtures))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fixtureFile.Service).To(Equal("cloudformation"))
+
+		backend, err := awsfaker.NewFixtureBackend((*cloudformationiface.CloudFormationAPI)(nil), fixtureFile.Fixtures)
+		Expect(err).NotTo(HaveOccurred())
+
+		fakeServer = httptest.NewServer(awsfaker.New(backend))
+		client = cloudformation.New(newSession(fakeServer.URL))
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	It("should convert the output document into the output struct", func() {
+		output, err := client.DescribeStacks(&cloudformation.DescribeStacksInput{StackName: aws.String("some-stack")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(Equal(&cloudformation.DescribeStacksOutput{
+			Stacks: []*cloudformation.Stack{
+				&cloudformation.Stack{
+					StackName:       aws.String("some-stack"),
+					StackStatus:     aws.String("CREATE_COMPLETE"),
+					CreationTime:    aws.Time(time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)),
+					DisableRollback: aws.Bool(true),
+					Parameters: []*cloudformation.Parameter{
+						&cloudformation.Parameter{
+							ParameterKey:   aws.String("some-key"),
+							ParameterValue: aws.String("some-value"),
+						},
+					},
+				},
+			},
+		}))
+	})
+
+	It("should match inputs by regular expression", func() {
+		output, err := client.DescribeStacks(&cloudformation.DescribeStacksInput{StackName: aws.String("other-name")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.Stacks[0].StackName).To(Equal(aws.String("other-stack")))
+	})
+
+	It("should fall through to later fixtures, including errors", func() {
+		_, err := client.DescribeStacks(&cloudformation.DescribeStacksInput{StackName: aws.String("missing-stack")})
+		Expect(err).To(HaveOccurred())
+		awsErr := err.(awserr.RequestFailure)
+		Expect(awsErr.StatusCode()).To(Equal(http.StatusBadRequest))
+		Expect(awsErr.Code()).To(Equal("ValidationError"))
+		Expect(awsErr.Message()).To(Equal("Stack does not exist"))
+	})
+
+	It("should send errors without a status as 400 Bad Request", func() {
+		_, err := client.ListStacks(&cloudformation.ListStacksInput{})
+		Expect(err).To(HaveOccurred())
+		awsErr := err.(awserr.RequestFailure)
+		Expect(awsErr.StatusCode()).To(Equal(http.StatusBadRequest))
+		Expect(awsErr.Code()).To(Equal("Throttling"))
+	})
+
+	It("should not implement actions without fixtures", func() {
+		_, err := client.DeleteStack(&cloudformation.DeleteStackInput{StackName: aws.String("some-stack")})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal("InvalidAction"))
+	})
+})
+
+var _ = Describe("Loading fixtures", func() {
+	It("should read JSON fixture files", func() {
+		dir, err := ioutil.TempDir("", "fixtures")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "fixtures.json")
+		Expect(ioutil.WriteFile(path, []byte(`{
+			"service": "cloudformation",
+			"responses": [{"action": "DescribeStacks", "output": {"NextToken": "some-token"}}]
+		}`), 0600)).To(Succeed())
+
+		backend, err := awsfaker.LoadFixtureBackend((*cloudformationiface.CloudFormationAPI)(nil), path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backend.Fixtures()).To(HaveLen(1))
+		Expect(backend.Actions()).To(HaveKey("DescribeStacks"))
+	})
+
+	It("should reject fixtures for unknown actions", func() {
+		_, err := awsfaker.NewFixtureBackend((*cloudformationiface.CloudFormationAPI)(nil), []awsfaker.Fixture{
+			{Action: "MissingAction"},
+		})
+		Expect(err).To(MatchError(ContainSubstring(`no action named "MissingAction"`)))
+	})
+
+	It("should reject invalid matchers", func() {
+		_, err := awsfaker.NewFixtureBackend((*cloudformationiface.CloudFormationAPI)(nil), []awsfaker.Fixture{
+			{Action: "DescribeStacks", Match: map[string]interface{}{"StackName": map[string]interface{}{"regex": "("}}},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject outputs that do not fit the output type", func() {
+		_, err := awsfaker.NewFixtureBackend((*cloudformationiface.CloudFormationAPI)(nil), []awsfaker.Fixture{
+			{Action: "DescribeStacks", Output: map[string]interface{}{"NoSuchField": "some-value"}},
+		})
+		Expect(err).To(MatchError(ContainSubstring("invalid output for DescribeStacks")))
+	})
+
+	It("should reject errors whose status is not an error status", func() {
+		_, err := awsfaker.NewFixtureBackend((*cloudformationiface.CloudFormationAPI)(nil), []awsfaker.Fixture{
+			{Action: "DescribeStacks", Error: &awsfaker.ErrorResponse{AWSErrorCode: "ValidationError", HTTPStatusCode: 200}},
+		})
+		Expect(err).To(MatchError("invalid error for DescribeStacks: HTTPStatusCode 200 is not an error status"))
+	})
+})
@@ -0,0 +1,146 @@
+package services_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"github.com/rosenhouse/awsfaker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Serving several services from one endpoint", func() {
+	var (
+		cloudFormationBackend *FakeCloudFormationBackend
+		ec2Backend            *FakeEC2Backend
+		dynamoDBBackend       *FakeDynamoDBBackend
+		mux                   *awsfaker.Mux
+		fakeServer            *httptest.Server
+	)
+
+	BeforeEach(func() {
+		cloudFormationBackend = &FakeCloudFormationBackend{}
+		ec2Backend = &FakeEC2Backend{}
+		dynamoDBBackend = &FakeDynamoDBBackend{}
+		mux = awsfaker.NewMux(cloudFormationBackend, ec2Backend, dynamoDBBackend)
+		fakeServer = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		if fakeServer != nil {
+			fakeServer.Close()
+		}
+	})
+
+	It("should route signed requests by the service in the credential scope", func() {
+		cloudformation.New(newSession(fakeServer.URL)).DescribeStacks(
+			&cloudformation.DescribeStacksInput{StackName: aws.String("some-stack-name")})
+		ec2.New(newSession(fakeServer.URL)).CreateKeyPair(
+			&ec2.CreateKeyPairInput{KeyName: aws.String("some-key-name")})
+		dynamodb.New(newSession(fakeServer.URL)).PutItem(
+			&dynamodb.PutItemInput{TableName: aws.String("some-table")})
+
+		Expect(cloudFormationBackend.DescribeStacksCall.Receives.StackName).To(Equal(aws.String("some-stack-name")))
+		Expect(ec2Backend.CreateKeyPairCall.Receives.KeyName).To(Equal(aws.String("some-key-name")))
+		Expect(dynamoDBBackend.PutItemCall.Receives.TableName).To(Equal(aws.String("some-table")))
+	})
+
+	It("should route unsigned requests by X-Amz-Target", func() {
+		client := dynamodb.New(session.New(&aws.Config{
+			Credentials: credentials.AnonymousCredentials,
+			Region:      aws.String("some-region"),
+			Endpoint:    aws.String(fakeServer.URL),
+		}))
+		client.PutItem(&dynamodb.PutItemInput{TableName: aws.String("some-table")})
+
+		Expect(dynamoDBBackend.PutItemCall.Receives.TableName).To(Equal(aws.String("some-table")))
+	})
+
+	It("should route unsigned requests by Host", func() {
+		body := url.Values{"Action": {"DescribeStacks"}, "StackName": {"some-stack-name"}}.Encode()
+		request, err := http.NewRequest("POST", "http://cloudformation.us-east-1.amazonaws.com/", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		mux.ServeHTTP(httptest.NewRecorder(), request)
+
+		Expect(cloudFormationBackend.DescribeStacksCall.Receives.StackName).To(Equal(aws.String("some-stack-name")))
+	})
+
+	It("should route unsigned query requests by the Action in the form body", func() {
+		body := url.Values{"Action": {"DescribeStacks"}, "StackName": {"some-stack-name"}}.Encode()
+		request, err := http.NewRequest("POST", "http://localhost/", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		mux.ServeHTTP(httptest.NewRecorder(), request)
+
+		Expect(cloudFormationBackend.DescribeStacksCall.Receives.StackName).To(Equal(aws.String("some-stack-name")))
+	})
+
+	It("should reject requests that cannot be routed with an error in their protocol", func() {
+		var routingErrors []error
+		mux.OnError = func(err error) { routingErrors = append(routingErrors, err) }
+
+		client := sts.New(session.New(&aws.Config{
+			Credentials: credentials.AnonymousCredentials,
+			Region:      aws.String("some-region"),
+			Endpoint:    aws.String(fakeServer.URL),
+			MaxRetries:  aws.Int(0),
+		}))
+		_, err := client.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		Expect(err).To(HaveOccurred())
+		awsErr := err.(awserr.RequestFailure)
+		Expect(awsErr.StatusCode()).To(Equal(http.StatusBadRequest))
+		Expect(awsErr.Code()).To(Equal("InvalidAction"))
+		Expect(awsErr.Message()).To(Equal("The action GetCallerIdentity is not valid for this web service."))
+		Expect(routingErrors).To(HaveLen(1))
+
+		request, err := http.NewRequest("POST", "http://localhost/", strings.NewReader("{}"))
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("X-Amz-Target", "Kinesis_20131202.ListStreams")
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"__type": "UnknownOperationException", "message": "The action ListStreams is not valid for this web service."}`))
+	})
+
+	It("should reject requests signed for a service that it does not serve", func() {
+		body := strings.NewReader(url.Values{"Action": {"DescribeStacks"}, "StackName": {"some-stack-name"}}.Encode())
+		request, err := http.NewRequest("POST", "http://localhost/", body)
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		signer := v4.NewSigner(credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""))
+		_, err = signer.Sign(request, body, "sts", "some-region", time.Now())
+		Expect(err).NotTo(HaveOccurred())
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(recorder.Body.String()).To(ContainSubstring("<Code>InvalidAction</Code>"))
+		Expect(cloudFormationBackend.DescribeStacksCall.Receives).To(BeNil())
+	})
+
+	It("should not accept two backends for the same service", func() {
+		defer func() {
+			Expect(recover()).To(ContainSubstring(`more than one backend for service "ec2"`))
+		}()
+		awsfaker.NewMux(&FakeEC2Backend{}, &FakeEC2Backend{})
+	})
+})
@@ -0,0 +1,181 @@
+package services_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+
+	"github.com/rosenhouse/awsfaker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Verifying request signatures", func() {
+	var (
+		handler    *awsfaker.Handler
+		fakeServer *httptest.Server
+		now        time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Now()
+		handler = awsfaker.New(&StackCreatingBackend{})
+		handler.Signatures = &awsfaker.SignatureVerifier{
+			Credentials: awsfaker.StaticCredentials{
+				"some-access-key": {SecretAccessKey: "some-secret-key"},
+				"some-temporary-key": {
+					SecretAccessKey: "some-temporary-secret",
+					SessionToken:    "some-session-token",
+					Expiration:      now.Add(time.Hour),
+				},
+			},
+			Region: "some-region",
+			Now:    func() time.Time { return now },
+		}
+		fakeServer = httptest.NewServer(handler)
+	})
+
+	AfterEach(func() {
+		fakeServer.Close()
+	})
+
+	createStack := func(config *aws.Config) error {
+		config.Endpoint = aws.String(fakeServer.URL)
+		if config.Region == nil {
+			config.Region = aws.String("some-region")
+		}
+		client := cloudformation.New(session.New(config), &aws.Config{MaxRetries: aws.Int(0)})
+		_, err := client.CreateStack(&cloudformation.CreateStackInput{StackName: aws.String("some stack/with ~odd* characters")})
+		return err
+	}
+
+	expectRefusal := func(err error, code string) {
+		Expect(err).To(HaveOccurred())
+		Expect(err.(awserr.RequestFailure).Code()).To(Equal(code))
+		Expect(err.(awserr.RequestFailure).StatusCode()).To(Equal(http.StatusForbidden))
+	}
+
+	It("should accept requests signed with a known key", func() {
+		err := createStack(&aws.Config{Credentials: credentials.NewStaticCredentials("some-access-key", "some-secret-key", "")})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = createStack(&aws.Config{Credentials: credentials.NewStaticCredentials("some-temporary-key", "some-temporary-secret", "some-session-token")})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should refuse requests signed with the wrong secret", func() {
+		err := createStack(&aws.Config{Credentials: credentials.NewStaticCredentials("some-access-key", "some-wrong-secret", "")})
+		expectRefusal(err, "SignatureDoesNotMatch")
+		Expect(handler.Journal().Calls()).To(BeEmpty())
+	})
+
+	It("should refuse requests signed with an unknown key or session token", func() {
+		err := createStack(&aws.Config{Credentials: credentials.NewStaticCredentials("some-unknown-key", "some-secret-key", "")})
+		expectRefusal(err, "InvalidClientTokenId")
+
+		err = createStack(&aws.Config{Credentials: credentials.NewStaticCredentials("some-temporary-key", "some-temporary-secret", "some-stale-token")})
+		expectRefusal(err, "InvalidClientTokenId")
+	})
+
+	It("should refuse every key when there are no credentials", func() {
+		handler.Signatures.Credentials = nil
+		err := createStack(&aws.Config{Credentials: credentials.NewStaticCredentials("some-access-key", "some-secret-key", "")})
+		expectRefusal(err, "InvalidClientTokenId")
+	})
+
+	It("should refuse requests with an expired session token", func() {
+		now = now.Add(2 * time.Hour)
+		err := createStack(&aws.Config{Credentials: credentials.NewStaticCredentials("some-temporary-key", "some-temporary-secret", "some-session-token")})
+		expectRefusal(err, "ExpiredToken")
+	})
+
+	It("should refuse unsigned requests", func() {
+		err := createStack(&aws.Config{Credentials: credentials.AnonymousCredentials})
+		expectRefusal(err, "MissingAuthenticationToken")
+	})
+
+	It("should refuse requests signed for another region", func() {
+		err := createStack(&aws.Config{
+			Credentials: credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""),
+			Region:      aws.String("some-other-region"),
+		})
+		expectRefusal(err, "SignatureDoesNotMatch")
+		Expect(err.(awserr.RequestFailure).Message()).To(ContainSubstring("some-other-region"))
+	})
+
+	It("should refuse requests signed too long ago", func() {
+		now = now.Add(20 * time.Minute)
+		err := createStack(&aws.Config{Credentials: credentials.NewStaticCredentials("some-access-key", "some-secret-key", "")})
+		expectRefusal(err, "SignatureDoesNotMatch")
+		Expect(err.(awserr.RequestFailure).Message()).To(HavePrefix("Signature expired"))
+	})
+
+	It("should refuse requests signed for another service", func() {
+		ec2Handler := awsfaker.New(&FakeEC2Backend{})
+		ec2Handler.Signatures = handler.Signatures
+		ec2Server := httptest.NewServer(ec2Handler)
+		defer ec2Server.Close()
+
+		send := func(signingName string) (int, string) {
+			body := strings.NewReader("Action=CreateKeyPair&KeyName=some-key&Version=2016-11-15")
+			request, err := http.NewRequest("POST", ec2Server.URL, body)
+			Expect(err).NotTo(HaveOccurred())
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+			signer := v4.NewSigner(credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""))
+			_, err = signer.Sign(request, body, signingName, "some-region", now)
+			Expect(err).NotTo(HaveOccurred())
+
+			response, err := http.DefaultClient.Do(request)
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close()
+			responseBody, err := ioutil.ReadAll(response.Body)
+			Expect(err).NotTo(HaveOccurred())
+			return response.StatusCode, string(responseBody)
+		}
+
+		status, body := send("cloudformation")
+		Expect(status).To(Equal(http.StatusForbidden))
+		Expect(body).To(ContainSubstring("Credential should be scoped to correct service"))
+
+		status, body = send("ec2")
+		Expect(status).To(Equal(http.StatusOK), body)
+	})
+
+	It("should refuse a body that does not match its signed hash", func() {
+		ec2Handler := awsfaker.New(&FakeEC2Backend{})
+		ec2Handler.Signatures = handler.Signatures
+		ec2Server := httptest.NewServer(ec2Handler)
+		defer ec2Server.Close()
+
+		body := strings.NewReader("Action=CreateKeyPair&KeyName=some-key&Version=2016-11-15")
+		request, err := http.NewRequest("POST", ec2Server.URL, body)
+		Expect(err).NotTo(HaveOccurred())
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		request.Header.Set("X-Amz-Content-Sha256", "78da7bd4ccc3dd3fd85139e6fd8fbfdc2a143190151cb16081fe29c6ddde9a4b")
+		signer := v4.NewSigner(credentials.NewStaticCredentials("some-access-key", "some-secret-key", ""))
+		_, err = signer.Sign(request, body, "ec2", "some-region", now)
+		Expect(err).NotTo(HaveOccurred())
+
+		tampered := "Action=CreateKeyPair&KeyName=evil-key&Version=2016-11-15"
+		request.Body = ioutil.NopCloser(strings.NewReader(tampered))
+		request.ContentLength = int64(len(tampered))
+
+		response, err := http.DefaultClient.Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+		responseBody, err := ioutil.ReadAll(response.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(string(responseBody)).To(ContainSubstring("XAmzContentSHA256Mismatch"))
+	})
+})
@@ -0,0 +1,169 @@
+package awsfaker
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/rosenhouse/awsfaker/internal/auth"
+	"github.com/rosenhouse/awsfaker/internal/detect"
+	"github.com/rosenhouse/awsfaker/internal/dispatch"
+)
+
+// A Credential is the secret part of an AWS access key
+type Credential struct {
+	SecretAccessKey string
+
+	// SessionToken, if set, must accompany each request signed with the
+	// key, as for temporary credentials
+	SessionToken string
+
+	// Expiration, if set, is the time after which the session token is
+	// refused
+	Expiration time.Time
+}
+
+// A CredentialStore looks up the credential for an access key ID
+type CredentialStore interface {
+	Credential(accessKeyID string) (Credential, bool)
+}
+
+// StaticCredentials is a CredentialStore holding a fixed set of
+// credentials, keyed by access key ID
+type StaticCredentials map[string]Credential
+
+// Credential returns the credential for the access key ID
+func (c StaticCredentials) Credential(accessKeyID string) (Credential, bool) {
+	credential, ok := c[accessKeyID]
+	return credential, ok
+}
+
+// DefaultMaxSkew is the largest difference between the signing time of a
+// request and the current time that AWS accepts
+const DefaultMaxSkew = 15 * time.Minute
+
+// A SignatureVerifier checks the AWS Signature Version 4 of each request,
+// and refuses those that AWS would refuse with the error that AWS would
+// send, such as SignatureDoesNotMatch or MissingAuthenticationToken.  It
+// catches mistakes in the way that the code under test loads credentials.
+//
+// Set it as the Signatures field of a Handler or Mux.
+type SignatureVerifier struct {
+	// Credentials holds the secret keys of the access keys that are accepted.
+	// If it is nil, no access key is accepted.
+	Credentials CredentialStore
+
+	// Region, if set, is the only region accepted in credential scopes
+	Region string
+
+	// MaxSkew is the largest difference allowed between the signing time
+	// and the current time.  Zero means DefaultMaxSkew.
+	MaxSkew time.Duration
+
+	// Now returns the current time, and defaults to time.Now
+	Now func() time.Time
+}
+
+func (v *SignatureVerifier) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+	return time.Now()
+}
+
+func (v *SignatureVerifier) maxSkew() time.Duration {
+	if v.MaxSkew != 0 {
+		return v.MaxSkew
+	}
+	return DefaultMaxSkew
+}
+
+func (v *SignatureVerifier) credential(accessKeyID string) (Credential, bool) {
+	if v.Credentials == nil {
+		return Credential{}, false
+	}
+	return v.Credentials.Credential(accessKeyID)
+}
+
+// verify returns the error with which AWS would refuse the request to the
+// service, or nil if the request is properly signed
+func (v *SignatureVerifier) verify(r *http.Request, serviceName string) *dispatch.ErrorResponse {
+	signature, err := auth.ParseSignature(r)
+	if err == auth.ErrUnsigned {
+		return refuse("MissingAuthenticationToken", "Request is missing Authentication Token")
+	}
+	if err != nil {
+		return &dispatch.ErrorResponse{
+			AWSErrorCode:    "IncompleteSignature",
+			AWSErrorMessage: err.Error(),
+			HTTPStatusCode:  http.StatusBadRequest,
+		}
+	}
+
+	now := v.now().UTC()
+	credential, ok := v.credential(signature.Scope.AccessKeyID)
+	if !ok || signature.SecurityToken != credential.SessionToken {
+		return refuse("InvalidClientTokenId", "The security token included in the request is invalid.")
+	}
+	if credential.SessionToken != "" && !credential.Expiration.IsZero() && now.After(credential.Expiration) {
+		return refuse("ExpiredToken", "The security token included in the request is expired")
+	}
+
+	scope := signature.Scope
+	if date := signature.Date.Format("20060102"); scope.Date != date {
+		return mismatch("Date in Credential scope does not match YYYYMMDD from ISO-8601 version of date from HTTP: '%s' != '%s'", scope.Date, date)
+	}
+	if v.Region != "" && scope.Region != v.Region {
+		return mismatch("Credential should be scoped to a valid region, not '%s'.", scope.Region)
+	}
+	if signingName := detect.SigningName(serviceName); scope.Service != signingName {
+		return mismatch("Credential should be scoped to correct service: '%s'.", signingName)
+	}
+
+	signed := signature.Date.Format(auth.TimeFormat)
+	maxSkew := v.maxSkew()
+	switch {
+	case signature.Expires > 0 && now.After(signature.Date.Add(signature.Expires)):
+		return refuse("AccessDenied", "Request has expired")
+	case signature.Expires == 0 && now.Sub(signature.Date) > maxSkew:
+		return mismatch("Signature expired: %s is now earlier than %s (%s - %s.)",
+			signed, now.Add(-maxSkew).Format(auth.TimeFormat), now.Format(auth.TimeFormat), maxSkew)
+	case signature.Date.Sub(now) > maxSkew:
+		return mismatch("Signature not yet current: %s is still later than %s (%s + %s.)",
+			signed, now.Add(maxSkew).Format(auth.TimeFormat), now.Format(auth.TimeFormat), maxSkew)
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return mismatch("unable to read request body: %s", err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if !auth.ContentHashMatches(r, body) {
+		return &dispatch.ErrorResponse{
+			AWSErrorCode:    "XAmzContentSHA256Mismatch",
+			AWSErrorMessage: "The provided 'x-amz-content-sha256' header does not match what was computed.",
+			HTTPStatusCode:  http.StatusBadRequest,
+		}
+	}
+
+	if !signature.Matches(r, body, credential.SecretAccessKey, serviceName != "s3") {
+		return mismatch("The request signature we calculated does not match the signature you provided. " +
+			"Check your AWS Secret Access Key and signing method. Consult the service documentation for details.")
+	}
+	return nil
+}
+
+func refuse(code, message string) *dispatch.ErrorResponse {
+	return &dispatch.ErrorResponse{
+		AWSErrorCode:    code,
+		AWSErrorMessage: message,
+		HTTPStatusCode:  http.StatusForbidden,
+	}
+}
+
+func mismatch(format string, args ...interface{}) *dispatch.ErrorResponse {
+	return refuse("SignatureDoesNotMatch", fmt.Sprintf(format, args...))
+}